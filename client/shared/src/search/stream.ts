@@ -166,6 +166,7 @@ export interface Skipped {
      * - excluded-fork :: we did not search a repository because it is a fork.
      * - excluded-archive :: we did not search a repository because it is archived.
      * - display :: we hit the display limit, so we stopped sending results from the backend.
+     * - search-queued :: the search waited because the user reached their limit of concurrent searches.
      */
     reason:
         | 'document-match-limit'
@@ -177,6 +178,7 @@ export interface Skipped {
         | 'excluded-fork'
         | 'excluded-archive'
         | 'display'
+        | 'search-queued'
         | 'error'
     /**
      * A short message. eg 1,200 timed out.
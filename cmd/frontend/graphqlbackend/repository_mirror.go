@@ -200,6 +200,52 @@ func (r *updateQueueResolver) Total() int32 {
 	return int32(r.queue.Total)
 }
 
+func (r *repositoryMirrorInfoResolver) UpdateProgress(ctx context.Context) (*updateProgressResolver, error) {
+	progress, err := repoupdater.DefaultClient.RepoUpdateProgress(ctx, r.repository.RepoName())
+	if err != nil {
+		return nil, err
+	}
+	return &updateProgressResolver{progress: progress}, nil
+}
+
+type updateProgressResolver struct {
+	progress *repoupdaterprotocol.RepoUpdateProgress
+}
+
+func (r *updateProgressResolver) State() string {
+	return strings.ToUpper(string(r.progress.State))
+}
+
+func (r *updateProgressResolver) QueuePosition() *int32 {
+	if r.progress.State != repoupdaterprotocol.RepoUpdateStateQueued {
+		return nil
+	}
+	position := int32(r.progress.Position)
+	return &position
+}
+
+func (r *updateProgressResolver) Percent() *int32 {
+	if r.progress.Percent == nil {
+		return nil
+	}
+	percent := int32(*r.progress.Percent)
+	return &percent
+}
+
+func (r *updateProgressResolver) Message() *string {
+	if r.progress.Message == "" {
+		return nil
+	}
+	return &r.progress.Message
+}
+
+func (r *updateProgressResolver) Error() *string {
+	if r.progress.Error == "" {
+		return nil
+	}
+	return &r.progress.Error
+}
+
 func (r *schemaResolver) CheckMirrorRepositoryConnection(ctx context.Context, args *struct {
 	Repository *graphql.ID
 	Name       *string
@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"path"
 	"strconv"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/google/zoekt"
@@ -22,6 +23,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/database"
 	"github.com/sourcegraph/sourcegraph/internal/database/dbutil"
 	"github.com/sourcegraph/sourcegraph/internal/errcode"
+	"github.com/sourcegraph/sourcegraph/internal/featureflag"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/jsonc"
@@ -150,6 +152,34 @@ func serveExternalServicesList(db dbutil.DB) func(w http.ResponseWriter, r *http
 	}
 }
 
+// serveFeatureFlagsEvaluate serves a JSON response that is a map of all
+// feature flags evaluated for the actor of the request.
+func serveFeatureFlagsEvaluate(ffs featureflag.Store) func(w http.ResponseWriter, r *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		var req api.FeatureFlagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return err
+		}
+
+		var (
+			flags map[string]bool
+			err   error
+		)
+		switch {
+		case req.UserID != 0:
+			flags, err = ffs.GetUserFlags(r.Context(), req.UserID)
+		case req.AnonymousUID != "":
+			flags, err = ffs.GetAnonymousUserFlags(r.Context(), req.AnonymousUID)
+		default:
+			flags, err = ffs.GetGlobalFeatureFlags(r.Context())
+		}
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(flags)
+	}
+}
+
 func serveConfiguration(w http.ResponseWriter, r *http.Request) error {
 	raw, err := globals.ConfigurationServerFrontendOnly.Source.Read(r.Context())
 	if err != nil {
@@ -162,6 +192,30 @@ func serveConfiguration(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// configurationWatchTimeout is how long serveConfigurationWatch waits for the
+// configuration to change before returning it unchanged. It must be shorter
+// than the timeouts of proxies between services.
+const configurationWatchTimeout = 50 * time.Second
+
+// serveConfigurationWatch is like serveConfiguration, but waits until the
+// configuration differs from the version the caller has. This lets services
+// learn about changes promptly without polling.
+func serveConfigurationWatch(w http.ResponseWriter, r *http.Request) error {
+	var req api.ConfigurationWatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), configurationWatchTimeout)
+	defer cancel()
+	raw := globals.ConfigurationServerFrontendOnly.WaitForChange(ctx, req.Version)
+
+	if err := json.NewEncoder(w).Encode(raw); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
 func repoRankFromConfig(siteConfig schema.SiteConfiguration, repoName string) float64 {
 	val := 0.0
 	if siteConfig.ExperimentalFeatures == nil || siteConfig.ExperimentalFeatures.Ranking == nil {
@@ -224,3 +224,51 @@ func TestRepoRankFromConfig(t *testing.T) {
 		}
 	}
 }
+
+type testFeatureFlagStore struct{}
+
+func (testFeatureFlagStore) GetUserFlags(_ context.Context, userID int32) (map[string]bool, error) {
+	return map[string]bool{"user": userID == 1}, nil
+}
+
+func (testFeatureFlagStore) GetAnonymousUserFlags(_ context.Context, anonymousUID string) (map[string]bool, error) {
+	return map[string]bool{"anonymous": anonymousUID == "abc"}, nil
+}
+
+func (testFeatureFlagStore) GetGlobalFeatureFlags(context.Context) (map[string]bool, error) {
+	return map[string]bool{"global": true}, nil
+}
+
+func TestFeatureFlagsEvaluate(t *testing.T) {
+	h := serveFeatureFlagsEvaluate(testFeatureFlagStore{})
+
+	for _, tc := range []struct {
+		name string
+		req  api.FeatureFlagsRequest
+		want map[string]bool
+	}{
+		{name: "user", req: api.FeatureFlagsRequest{UserID: 1, AnonymousUID: "abc"}, want: map[string]bool{"user": true}},
+		{name: "anonymous", req: api.FeatureFlagsRequest{AnonymousUID: "abc"}, want: map[string]bool{"anonymous": true}},
+		{name: "global", req: api.FeatureFlagsRequest{}, want: map[string]bool{"global": true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/feature-flags/evaluate", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			if err := h(w, req); err != nil {
+				t.Fatal(err)
+			}
+
+			var have map[string]bool
+			if err := json.NewDecoder(w.Body).Decode(&have); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Fatalf("unexpected flags (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -13,6 +13,8 @@ const (
 
 	SearchStream = "search.stream"
 
+	SiteAdminSearcherPrefetch = "site-admin.searcher.prefetch"
+
 	SrcCliVersion  = "src-cli.version"
 	SrcCliDownload = "src-cli.download"
 
@@ -52,9 +54,12 @@ const (
 	ReposIndex             = "internal.repos.index"
 	ReposListEnabled       = "internal.repos.list-enabled"
 	Configuration          = "internal.configuration"
+	ConfigurationWatch     = "internal.configuration.watch"
 	SearchConfiguration    = "internal.search-configuration"
 	ExternalServiceConfigs = "internal.external-services.configs"
 	ExternalServicesList   = "internal.external-services.list"
+	FeatureFlagsEvaluate   = "internal.feature-flags.evaluate"
+	SearcherPrefetch       = "internal.searcher.prefetch"
 	StreamingSearch        = "internal.stream-search"
 )
 
@@ -74,6 +79,7 @@ func New(base *mux.Router) *mux.Router {
 	base.Path("/bitbucket-server-webhooks").Methods("POST").Name(BitbucketServerWebhooks)
 	base.Path("/lsif/upload").Methods("POST").Name(LSIFUpload)
 	base.Path("/search/stream").Methods("GET").Name(SearchStream)
+	base.Path("/searcher/prefetch").Methods("POST").Name(SiteAdminSearcherPrefetch)
 	base.Path("/src-cli/version").Methods("GET").Name(SrcCliVersion)
 	base.Path("/src-cli/{rest:.*}").Methods("GET").Name(SrcCliDownload)
 
@@ -118,6 +124,8 @@ func NewInternal(base *mux.Router) *mux.Router {
 	base.Path("/phabricator/repo-create").Methods("POST").Name(PhabricatorRepoCreate)
 	base.Path("/external-services/configs").Methods("POST").Name(ExternalServiceConfigs)
 	base.Path("/external-services/list").Methods("POST").Name(ExternalServicesList)
+	base.Path("/feature-flags/evaluate").Methods("POST").Name(FeatureFlagsEvaluate)
+	base.Path("/searcher/prefetch").Methods("POST").Name(SearcherPrefetch)
 	base.Path("/repos/inventory-uncached").Methods("POST").Name(ReposInventoryUncached)
 	base.Path("/repos/inventory").Methods("POST").Name(ReposInventory)
 	base.Path("/repos/list").Methods("POST").Name(ReposList)
@@ -125,6 +133,7 @@ func NewInternal(base *mux.Router) *mux.Router {
 	base.Path("/repos/list-enabled").Methods("POST").Name(ReposListEnabled)
 	base.Path("/repos/{RepoName:.*}").Methods("POST").Name(ReposGetByName)
 	base.Path("/configuration").Methods("POST").Name(Configuration)
+	base.Path("/configuration/watch").Methods("POST").Name(ConfigurationWatch)
 	base.Path("/search/configuration").Methods("GET", "POST").Name(SearchConfiguration)
 	base.Path("/telemetry").Methods("POST").Name(Telemetry)
 	base.Path("/lsif/upload").Methods("POST").Name(LSIFUpload)
@@ -0,0 +1,76 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/backend"
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/database/dbutil"
+	"github.com/sourcegraph/sourcegraph/internal/endpoint"
+	"github.com/sourcegraph/sourcegraph/internal/errcode"
+	"github.com/sourcegraph/sourcegraph/internal/search/searcher"
+)
+
+// maxSearcherPrefetchArchives is the maximum number of archives of a
+// SearcherPrefetchRequest.
+const maxSearcherPrefetchArchives = 10000
+
+// serveSearcherPrefetch serves a JSON response with the errors of fetching
+// the archives of an api.SearcherPrefetchRequest into the caches of the
+// searcher replicas which their searches are sent to.
+func serveSearcherPrefetch(searcherURLs *endpoint.Map) func(w http.ResponseWriter, r *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		var req api.SearcherPrefetchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: err}
+		}
+		if len(req.Archives) > maxSearcherPrefetchArchives {
+			return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.Errorf("at most %d archives can be prefetched at once, got %d", maxSearcherPrefetchArchives, len(req.Archives))}
+		}
+		archives := make([]protocol.Archive, len(req.Archives))
+		for i, a := range req.Archives {
+			if a.Repo == "" || len(a.Commit) != 40 {
+				return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.Errorf("archive %d must have a repo and a resolved commit", i)}
+			}
+			archives[i] = protocol.Archive{Repo: a.Repo, Commit: a.Commit}
+		}
+
+		ctx := r.Context()
+		if req.Deadline != "" {
+			var deadline time.Time
+			if err := deadline.UnmarshalText([]byte(req.Deadline)); err != nil {
+				return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.Wrap(err, "invalid deadline")}
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+
+		errs, err := searcher.Prefetch(ctx, searcherURLs, archives)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(api.SearcherPrefetchResponse{Errors: errs})
+	}
+}
+
+// serveSiteAdminSearcherPrefetch is serveSearcherPrefetch for site admins, for
+// example to warm the caches of searcher ahead of scheduled searches.
+func serveSiteAdminSearcherPrefetch(db dbutil.DB, searcherURLs *endpoint.Map) func(w http.ResponseWriter, r *http.Request) error {
+	prefetch := serveSearcherPrefetch(searcherURLs)
+	return func(w http.ResponseWriter, r *http.Request) error {
+		// 🚨 SECURITY: Only site admins may prefetch archives, since any
+		// repository can be fetched, regardless of the permissions of the
+		// user.
+		if err := backend.CheckCurrentUserIsSiteAdmin(r.Context(), db); err != nil {
+			return &errcode.HTTPErr{Status: http.StatusForbidden, Err: err}
+		}
+		return prefetch(w, r)
+	}
+}
@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/endpoint"
+	"github.com/sourcegraph/sourcegraph/internal/errcode"
+)
+
+func TestSearcherPrefetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req protocol.PrefetchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := protocol.PrefetchResponse{Errors: make([]string, len(req.Archives))}
+		for i, a := range req.Archives {
+			if a.Repo == "bad" {
+				resp.Errors[i] = "repo not found"
+			}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+	h := serveSearcherPrefetch(endpoint.Static(srv.URL))
+
+	serve := func(req api.SearcherPrefetchRequest) (*httptest.ResponseRecorder, error) {
+		body, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		return w, h(w, httptest.NewRequest("POST", "/searcher/prefetch", bytes.NewReader(body)))
+	}
+
+	commit := api.CommitID("deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	w, err := serve(api.SearcherPrefetchRequest{Archives: []api.SearcherArchive{{Repo: "good", Commit: commit}, {Repo: "bad", Commit: commit}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have api.SearcherPrefetchResponse
+	if err := json.NewDecoder(w.Body).Decode(&have); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"", "repo not found"}, have.Errors); diff != "" {
+		t.Fatalf("unexpected errors (-want +got):\n%s", diff)
+	}
+
+	// Commits must be resolved.
+	_, err = serve(api.SearcherPrefetchRequest{Archives: []api.SearcherArchive{{Repo: "good", Commit: "HEAD"}}})
+	if status := errcode.HTTP(err); status != http.StatusBadRequest {
+		t.Fatalf("got status %d for an unresolved commit, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -52,6 +52,7 @@ func (p *progressAggregator) currentStats() api.ProgressStats {
 		Missing:             getNames(p.Stats, searchshared.RepoStatusMissing),
 		Cloning:             getNames(p.Stats, searchshared.RepoStatusCloning),
 		LimitHit:            p.Stats.IsLimitHit,
+		Queued:              p.Stats.IsQueued,
 		SuggestedLimit:      suggestedLimit,
 		Trace:               p.Trace,
 		DisplayLimit:        p.DisplayLimit,
@@ -19,6 +19,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/backend"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/graphqlbackend"
 	searchlogs "github.com/sourcegraph/sourcegraph/cmd/frontend/internal/search/logs"
 	"github.com/sourcegraph/sourcegraph/internal/api"
@@ -27,6 +28,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/lazyregexp"
 	"github.com/sourcegraph/sourcegraph/internal/search/result"
 	"github.com/sourcegraph/sourcegraph/internal/search/run"
+	"github.com/sourcegraph/sourcegraph/internal/search/searcher"
 	"github.com/sourcegraph/sourcegraph/internal/search/streaming"
 	streamhttp "github.com/sourcegraph/sourcegraph/internal/search/streaming/http"
 	"github.com/sourcegraph/sourcegraph/internal/trace"
@@ -60,6 +62,16 @@ func (h *streamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if args.Profile {
+		// 🚨 SECURITY: Capturing CPU profiles is expensive, so only site
+		// admins may profile their searches.
+		if err := backend.CheckCurrentUserIsSiteAdmin(ctx, h.db); err != nil {
+			http.Error(w, "only site admins may profile searches", http.StatusForbidden)
+			return
+		}
+		ctx = searcher.WithShouldProfile(ctx, true)
+	}
+
 	tr, ctx := trace.New(ctx, "search.ServeStream", args.Query,
 		trace.Tag{Key: "version", Value: args.Version},
 		trace.Tag{Key: "pattern_type", Value: args.PatternType},
@@ -340,6 +352,9 @@ type args struct {
 	DecorationLimit        int    // The initial number of files to decorate in the result set.
 	DecorationKind         string // The kind of decoration to apply (HTML highlighting, plaintext, etc.)
 	DecorationContextLines int    // The number of lines of context to include around lines with matches.
+
+	// Profile is true if searcher should capture a CPU profile of the search.
+	Profile bool
 }
 
 func parseURLQuery(q url.Values) (*args, error) {
@@ -379,6 +394,11 @@ func parseURLQuery(q url.Values) (*args, error) {
 		return nil, errors.Errorf("decorationContextLines must be an integer, got %q: %w", decorationContextLines, err)
 	}
 
+	profile := get("profile", "false")
+	if a.Profile, err = strconv.ParseBool(profile); err != nil {
+		return nil, errors.Errorf("profile must be a boolean, got %q: %w", profile, err)
+	}
+
 	return &a, nil
 }
 
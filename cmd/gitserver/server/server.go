@@ -47,6 +47,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/lazyregexp"
 	"github.com/sourcegraph/sourcegraph/internal/mutablelimiter"
 	"github.com/sourcegraph/sourcegraph/internal/repotrackutil"
+	"github.com/sourcegraph/sourcegraph/internal/requestid"
 	streamhttp "github.com/sourcegraph/sourcegraph/internal/search/streaming/http"
 	"github.com/sourcegraph/sourcegraph/internal/trace"
 	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
@@ -907,6 +908,7 @@ func (s *Server) search(w http.ResponseWriter, r *http.Request, args *protocol.S
 	tr.LogFields(
 		otlog.String("query", args.Query.String()),
 		otlog.Int("limit", args.Limit),
+		otlog.String("requestID", requestid.FromContext(ctx)),
 	)
 	defer tr.Finish()
 
@@ -986,11 +988,17 @@ func (s *Server) search(w http.ResponseWriter, r *http.Request, args *protocol.S
 			return err
 		}
 
+		ig, err := search.ReadIgnoreFile(ctx, dir.Path())
+		if err != nil {
+			return err
+		}
+
 		searcher := &search.CommitSearcher{
 			RepoDir:     dir.Path(),
 			Revisions:   args.Revisions,
 			Query:       mt,
 			IncludeDiff: args.IncludeDiff,
+			Ignore:      ig,
 		}
 
 		return searcher.Search(ctx, func(match *protocol.CommitMatch) bool {
@@ -1155,6 +1163,9 @@ func (s *Server) exec(w http.ResponseWriter, r *http.Request, req *protocol.Exec
 					ev.AddField("fetch_duration_ms", fetchDuration.Milliseconds())
 				}
 
+				if requestID := requestid.FromContext(ctx); requestID != "" {
+					ev.AddField("requestID", requestID)
+				}
 				if traceID := trace.ID(ctx); traceID != "" {
 					ev.AddField("traceID", traceID)
 					ev.AddField("trace", trace.URL(traceID))
@@ -1389,6 +1400,9 @@ func (s *Server) p4exec(w http.ResponseWriter, r *http.Request, req *protocol.P4
 					ev.AddField("cmd_duration_ms", cmdDuration.Milliseconds())
 				}
 
+				if requestID := requestid.FromContext(ctx); requestID != "" {
+					ev.AddField("requestID", requestID)
+				}
 				if traceID := trace.ID(ctx); traceID != "" {
 					ev.AddField("traceID", traceID)
 					ev.AddField("trace", trace.URL(traceID))
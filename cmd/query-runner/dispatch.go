@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+
+	"github.com/sourcegraph/sourcegraph/internal/env"
+)
+
+var notificationsPerMinute = env.Get("NOTIFICATIONS_PER_MINUTE", "6", "maximum number of saved search notifications sent to a single Slack webhook or email recipient per minute")
+
+var notificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "src_query_runner_notifications_total",
+	Help: "Number of saved search notifications delivered, by type and result.",
+}, []string{"type", "result"})
+
+// dispatcher delivers notifications. Notifications to the same destination
+// (a Slack webhook or a user's email address) are rate limited, so that a
+// saved search with frequent new results doesn't flood a channel or inbox,
+// and failed deliveries are retried with exponential backoff.
+type dispatcher struct {
+	limit    rate.Limit
+	burst    int
+	attempts int
+	backoff  time.Duration
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+var dispatch = newDispatcher()
+
+func newDispatcher() *dispatcher {
+	perMinute, err := strconv.Atoi(notificationsPerMinute)
+	if err != nil || perMinute <= 0 {
+		log15.Error("query-runner: invalid NOTIFICATIONS_PER_MINUTE, using default", "value", notificationsPerMinute)
+		perMinute = 6
+	}
+	return &dispatcher{
+		limit:    rate.Limit(float64(perMinute) / 60),
+		burst:    perMinute,
+		attempts: 3,
+		backoff:  2 * time.Second,
+		limiters: map[string]*rate.Limiter{},
+	}
+}
+
+// permanentError marks a delivery error which retrying won't fix, e.g. a
+// missing webhook URL.
+type permanentError struct{ error }
+
+func (e permanentError) Cause() error  { return e.error }
+func (e permanentError) Unwrap() error { return e.error }
+
+// send calls deliver, waiting until the rate limit of destination allows
+// another notification. Failed deliveries are retried unless the error is a
+// permanentError. typ labels the notification in metrics.
+func (d *dispatcher) send(ctx context.Context, typ, destination string, deliver func(context.Context) error) (err error) {
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		notificationsTotal.WithLabelValues(typ, result).Inc()
+	}()
+
+	limiter := d.limiter(typ + ":" + destination)
+	backoff := d.backoff
+	for attempt := 1; ; attempt++ {
+		if err := limiter.Wait(ctx); err != nil {
+			return errors.Wrap(err, "waiting for notification rate limit")
+		}
+
+		err = deliver(ctx)
+		if err == nil || errors.HasType(err, permanentError{}) || attempt >= d.attempts {
+			return err
+		}
+
+		log15.Warn("query-runner: failed to deliver notification, retrying", "type", typ, "attempt", attempt, "backoff", backoff, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func (d *dispatcher) limiter(key string) *rate.Limiter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l, ok := d.limiters[key]
+	if !ok {
+		l = rate.NewLimiter(d.limit, d.burst)
+		d.limiters[key] = l
+	}
+	return l
+}
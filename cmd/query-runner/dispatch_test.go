@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/time/rate"
+)
+
+func newTestDispatcher(limit rate.Limit, burst int) *dispatcher {
+	return &dispatcher{
+		limit:    limit,
+		burst:    burst,
+		attempts: 3,
+		backoff:  time.Millisecond,
+		limiters: map[string]*rate.Limiter{},
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDispatcher(rate.Inf, 1)
+
+	t.Run("transient", func(t *testing.T) {
+		calls := 0
+		err := d.send(ctx, "slack", "hook", func(context.Context) error {
+			calls++
+			if calls < 3 {
+				return errors.New("unavailable")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calls != 3 {
+			t.Fatalf("got %d calls, want 3", calls)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		calls := 0
+		err := d.send(ctx, "slack", "hook", func(context.Context) error {
+			calls++
+			return errors.New("unavailable")
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if calls != 3 {
+			t.Fatalf("got %d calls, want 3", calls)
+		}
+	})
+
+	t.Run("permanent", func(t *testing.T) {
+		calls := 0
+		err := d.send(ctx, "email", "1", func(context.Context) error {
+			calls++
+			return errors.Wrap(permanentError{errors.New("no email address")}, "sending")
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if calls != 1 {
+			t.Fatalf("got %d calls, want 1", calls)
+		}
+	})
+}
+
+func TestDispatcherRateLimit(t *testing.T) {
+	d := newTestDispatcher(rate.Every(time.Hour), 1)
+	deliver := func(context.Context) error { return nil }
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := d.send(ctx, "slack", "a", deliver); err != nil {
+		t.Fatal(err)
+	}
+	// Other destinations have their own limit.
+	if err := d.send(ctx, "slack", "b", deliver); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.send(ctx, "email", "a", deliver); err != nil {
+		t.Fatal(err)
+	}
+	// The next notification to a would wait past the deadline.
+	if err := d.send(ctx, "slack", "a", deliver); err == nil {
+		t.Fatal("expected rate limit error")
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/cockroachdb/errors"
@@ -136,13 +137,15 @@ func sendEmail(ctx context.Context, userID int32, eventType string, template txt
 		return errors.Wrap(err, fmt.Sprintf("InternalClient.UserEmailsGetEmail for userID=%d", userID))
 	}
 	if email == nil {
-		return errors.Errorf("unable to send email to user ID %d with unknown email address", userID)
+		return permanentError{errors.Errorf("unable to send email to user ID %d with unknown email address", userID)}
 	}
 
-	if err := api.InternalClient.SendEmail(ctx, txtypes.Message{
-		To:       []string{*email},
-		Template: template,
-		Data:     data,
+	if err := dispatch.send(ctx, "email", strconv.Itoa(int(userID)), func(ctx context.Context) error {
+		return api.InternalClient.SendEmail(ctx, txtypes.Message{
+			To:       []string{*email},
+			Template: template,
+			Data:     data,
+		})
 	}); err != nil {
 		return errors.Wrap(err, fmt.Sprintf("InternalClient.SendEmail to email=%q userID=%d", *email, userID))
 	}
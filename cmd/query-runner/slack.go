@@ -64,7 +64,7 @@ func slackNotify(ctx context.Context, recipient *recipient, text string, slackWe
 	}
 
 	if slackWebhookURL == nil || *slackWebhookURL == "" {
-		return errors.Errorf("unable to send Slack notification because recipient (%s) has no Slack webhook URL configured", recipient.spec)
+		return permanentError{errors.Errorf("unable to send Slack notification because recipient (%s) has no Slack webhook URL configured", recipient.spec)}
 	}
 
 	payload := &slack.Payload{
@@ -75,5 +75,7 @@ func slackNotify(ctx context.Context, recipient *recipient, text string, slackWe
 		Text:        text,
 	}
 	client := slack.New(*slackWebhookURL)
-	return client.Post(ctx, payload)
+	return dispatch.send(ctx, "slack", *slackWebhookURL, func(ctx context.Context) error {
+		return client.Post(ctx, payload)
+	})
 }
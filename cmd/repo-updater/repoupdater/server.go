@@ -3,9 +3,11 @@ package repoupdater
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/cockroachdb/errors"
@@ -17,7 +19,9 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/database"
 	"github.com/sourcegraph/sourcegraph/internal/errcode"
 	"github.com/sourcegraph/sourcegraph/internal/extsvc/github"
+	gitserverprotocol "github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/httpcli"
+	"github.com/sourcegraph/sourcegraph/internal/lazyregexp"
 	"github.com/sourcegraph/sourcegraph/internal/repos"
 	"github.com/sourcegraph/sourcegraph/internal/repoupdater/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/trace"
@@ -30,11 +34,12 @@ type Server struct {
 	*repos.Syncer
 	SourcegraphDotComMode bool
 	Scheduler             interface {
-		UpdateOnce(id api.RepoID, name api.RepoName)
+		UpdateOnce(id api.RepoID, name api.RepoName, priority protocol.RepoUpdatePriority)
 		ScheduleInfo(id api.RepoID) *protocol.RepoUpdateSchedulerInfoResult
 	}
 	GitserverClient interface {
 		ListCloned(context.Context) ([]string, error)
+		RepoCloneProgress(context.Context, ...api.RepoName) (*gitserverprotocol.RepoCloneProgressResponse, error)
 	}
 	ChangesetSyncRegistry interface {
 		// EnqueueChangesetSyncs will queue the supplied changesets to sync ASAP.
@@ -62,6 +67,8 @@ func (s *Server) Handler() http.Handler {
 	mux.HandleFunc("/repo-update-scheduler-info", s.handleRepoUpdateSchedulerInfo)
 	mux.HandleFunc("/repo-lookup", s.handleRepoLookup)
 	mux.HandleFunc("/enqueue-repo-update", s.handleEnqueueRepoUpdate)
+	mux.HandleFunc("/enqueue-repo-updates", s.handleEnqueueRepoUpdates)
+	mux.HandleFunc("/repo-update-progress", s.handleRepoUpdateProgress)
 	mux.HandleFunc("/sync-external-service", s.handleExternalServiceSync)
 	mux.HandleFunc("/enqueue-changeset-sync", s.handleEnqueueChangesetSync)
 	mux.HandleFunc("/schedule-perms-sync", s.handleSchedulePermsSync)
@@ -172,7 +179,7 @@ func (s *Server) enqueueRepoUpdate(ctx context.Context, req *protocol.RepoUpdate
 
 	repo := rs[0]
 
-	s.Scheduler.UpdateOnce(repo.ID, repo.Name)
+	s.Scheduler.UpdateOnce(repo.ID, repo.Name, req.Priority)
 
 	return &protocol.RepoUpdateResponse{
 		ID:   repo.ID,
@@ -180,6 +187,164 @@ func (s *Server) enqueueRepoUpdate(ctx context.Context, req *protocol.RepoUpdate
 	}, http.StatusOK, nil
 }
 
+func (s *Server) handleEnqueueRepoUpdates(w http.ResponseWriter, r *http.Request) {
+	var req protocol.RepoUpdatesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond(w, http.StatusBadRequest, err)
+		return
+	}
+	result, status, err := s.enqueueRepoUpdates(r.Context(), &req)
+	if err != nil {
+		log15.Error("enqueueRepoUpdates failed", "req", req.String(), "error", err)
+		respond(w, status, err)
+		return
+	}
+	respond(w, status, result)
+}
+
+func (s *Server) enqueueRepoUpdates(ctx context.Context, req *protocol.RepoUpdatesRequest) (resp *protocol.RepoUpdatesResponse, httpStatus int, err error) {
+	tr, ctx := trace.New(ctx, "enqueueRepoUpdates", req.String())
+	defer func() {
+		log15.Debug("enqueueRepoUpdates", "httpStatus", httpStatus, "error", err)
+		if resp != nil {
+			tr.LogFields(otlog.Int("resp.repos", len(resp.Repos)))
+		}
+		tr.SetError(err)
+		tr.Finish()
+	}()
+
+	resp = &protocol.RepoUpdatesResponse{Repos: []protocol.RepoUpdateResponse{}}
+	if len(req.Repos) == 0 {
+		return resp, http.StatusOK, nil
+	}
+
+	names := make([]string, 0, len(req.Repos))
+	for _, name := range req.Repos {
+		names = append(names, string(name))
+	}
+
+	rs, err := s.Store.RepoStore.List(ctx, database.ReposListOptions{Names: names})
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "store.list-repos")
+	}
+
+	for _, repo := range rs {
+		s.Scheduler.UpdateOnce(repo.ID, repo.Name, req.Priority)
+
+		resp.Repos = append(resp.Repos, protocol.RepoUpdateResponse{
+			ID:   repo.ID,
+			Name: string(repo.Name),
+		})
+	}
+
+	return resp, http.StatusOK, nil
+}
+
+func (s *Server) handleRepoUpdateProgress(w http.ResponseWriter, r *http.Request) {
+	var req protocol.RepoUpdateProgressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond(w, http.StatusBadRequest, err)
+		return
+	}
+	result, status, err := s.repoUpdateProgress(r.Context(), &req)
+	if err != nil {
+		if status != http.StatusNotFound {
+			log15.Error("repoUpdateProgress failed", "repo", req.Repo, "error", err)
+		}
+		respond(w, status, err)
+		return
+	}
+	respond(w, status, result)
+}
+
+func (s *Server) repoUpdateProgress(ctx context.Context, req *protocol.RepoUpdateProgressRequest) (resp *protocol.RepoUpdateProgress, httpStatus int, err error) {
+	tr, ctx := trace.New(ctx, "repoUpdateProgress", string(req.Repo))
+	defer func() {
+		if resp != nil {
+			tr.LogFields(otlog.String("resp.state", string(resp.State)))
+		}
+		tr.SetError(err)
+		tr.Finish()
+	}()
+
+	rs, err := s.Store.RepoStore.List(ctx, database.ReposListOptions{Names: []string{string(req.Repo)}})
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "store.list-repos")
+	}
+	if len(rs) != 1 {
+		return nil, http.StatusNotFound, errors.Errorf("repo %q not found in store", req.Repo)
+	}
+	repo := rs[0]
+
+	var lastError string
+	gr, err := database.GitserverRepos(s.Handle().DB()).GetByID(ctx, repo.ID)
+	switch {
+	case err == nil:
+		lastError = gr.LastError
+	case errors.Is(err, sql.ErrNoRows):
+		// Never cloned.
+	default:
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "getting gitserver repo")
+	}
+
+	cloneProgress, err := s.GitserverClient.RepoCloneProgress(ctx, repo.Name)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "getting clone progress")
+	}
+	clone := cloneProgress.Results[repo.Name]
+	if clone == nil {
+		clone = &gitserverprotocol.RepoCloneProgress{}
+	}
+
+	return newRepoUpdateProgress(s.Scheduler.ScheduleInfo(repo.ID).Queue, clone, lastError), http.StatusOK, nil
+}
+
+// newRepoUpdateProgress combines the state of a repo in the update queue and
+// on gitserver into the progress of its update.
+func newRepoUpdateProgress(queue *protocol.RepoQueueState, clone *gitserverprotocol.RepoCloneProgress, lastError string) *protocol.RepoUpdateProgress {
+	p := &protocol.RepoUpdateProgress{Cloned: clone.Cloned}
+	switch {
+	case clone.CloneInProgress:
+		p.State = protocol.RepoUpdateStateCloning
+		p.Message = clone.CloneProgress
+		p.Percent = cloneProgressPercent(clone.CloneProgress)
+	case queue != nil && queue.Updating:
+		p.State = protocol.RepoUpdateStateUpdating
+		if !clone.Cloned {
+			p.State = protocol.RepoUpdateStateCloning
+		}
+	case queue != nil:
+		p.State = protocol.RepoUpdateStateQueued
+		p.Position = queue.Position
+	case lastError != "":
+		p.State = protocol.RepoUpdateStateFailed
+	case clone.Cloned:
+		p.State = protocol.RepoUpdateStateDone
+	default:
+		p.State = protocol.RepoUpdateStateNotCloned
+	}
+	// The error of the last attempt is useful while the next one is queued or
+	// running too.
+	p.Error = lastError
+	return p
+}
+
+var cloneProgressPercentRegexp = lazyregexp.New(`(\d{1,3})%`)
+
+// cloneProgressPercent returns the percentage in a progress line of git, e.g.
+// "Receiving objects:  95% (2041/2148), 292.01 KiB | 515.00 KiB/s".
+func cloneProgressPercent(line string) *int {
+	m := cloneProgressPercentRegexp.FindAllStringSubmatch(line, -1)
+	if len(m) == 0 {
+		return nil
+	}
+	percent, err := strconv.Atoi(m[len(m)-1][1])
+	if err != nil || percent > 100 {
+		return nil
+	}
+	return &percent
+}
+
 func (s *Server) handleExternalServiceSync(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
@@ -27,6 +27,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/extsvc/awscodecommit"
 	"github.com/sourcegraph/sourcegraph/internal/extsvc/github"
 	"github.com/sourcegraph/sourcegraph/internal/extsvc/gitlab"
+	gitserverprotocol "github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/repos"
 	"github.com/sourcegraph/sourcegraph/internal/repoupdater"
 	"github.com/sourcegraph/sourcegraph/internal/repoupdater/protocol"
@@ -239,6 +240,43 @@ func TestServer_EnqueueRepoUpdate(t *testing.T) {
 	}
 }
 
+func TestServer_EnqueueRepoUpdates(t *testing.T) {
+	db := dbtest.NewDB(t, "")
+	store := repos.NewStore(db, sql.TxOptions{})
+	ctx := context.Background()
+
+	repo := types.Repo{
+		Name: "github.com/foo/bar",
+		ExternalRepo: api.ExternalRepoSpec{
+			ID:          "bar",
+			ServiceType: extsvc.TypeGitHub,
+			ServiceID:   "http://github.com",
+		},
+		Metadata: new(github.Repository),
+	}
+
+	if err := store.RepoStore.Create(ctx, &repo); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Store: store, Scheduler: &fakeScheduler{}}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	cli := repoupdater.NewClient(srv.URL)
+
+	res, err := cli.EnqueueRepoUpdates(ctx, []api.RepoName{repo.Name, "github.com/foo/missing"}, protocol.RepoUpdatePriorityUrgent)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := &protocol.RepoUpdatesResponse{
+		Repos: []protocol.RepoUpdateResponse{{ID: repo.ID, Name: string(repo.Name)}},
+	}
+	if diff := cmp.Diff(want, res); diff != "" {
+		t.Errorf("unexpected response (-want +got):\n%s", diff)
+	}
+}
+
 func TestServer_RepoLookup(t *testing.T) {
 	db := dbtest.NewDB(t, "")
 	store := repos.NewStore(db, sql.TxOptions{})
@@ -659,9 +697,78 @@ func TestServer_RepoLookup(t *testing.T) {
 	}
 }
 
+func TestNewRepoUpdateProgress(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+
+	for _, tc := range []struct {
+		name      string
+		queue     *protocol.RepoQueueState
+		clone     gitserverprotocol.RepoCloneProgress
+		lastError string
+		want      protocol.RepoUpdateProgress
+	}{
+		{
+			name: "not cloned",
+			want: protocol.RepoUpdateProgress{State: protocol.RepoUpdateStateNotCloned},
+		},
+		{
+			name:  "queued",
+			queue: &protocol.RepoQueueState{Position: 3},
+			want:  protocol.RepoUpdateProgress{State: protocol.RepoUpdateStateQueued, Position: 3},
+		},
+		{
+			name:  "cloning",
+			queue: &protocol.RepoQueueState{Updating: true},
+			clone: gitserverprotocol.RepoCloneProgress{
+				CloneInProgress: true,
+				CloneProgress:   "Receiving objects:  95% (2041/2148), 292.01 KiB | 515.00 KiB/s",
+			},
+			want: protocol.RepoUpdateProgress{
+				State:   protocol.RepoUpdateStateCloning,
+				Percent: intPtr(95),
+				Message: "Receiving objects:  95% (2041/2148), 292.01 KiB | 515.00 KiB/s",
+			},
+		},
+		{
+			name:  "cloning without progress",
+			queue: &protocol.RepoQueueState{Updating: true},
+			want:  protocol.RepoUpdateProgress{State: protocol.RepoUpdateStateCloning},
+		},
+		{
+			name:  "updating",
+			queue: &protocol.RepoQueueState{Updating: true},
+			clone: gitserverprotocol.RepoCloneProgress{Cloned: true},
+			want:  protocol.RepoUpdateProgress{State: protocol.RepoUpdateStateUpdating, Cloned: true},
+		},
+		{
+			name:  "done",
+			clone: gitserverprotocol.RepoCloneProgress{Cloned: true},
+			want:  protocol.RepoUpdateProgress{State: protocol.RepoUpdateStateDone, Cloned: true},
+		},
+		{
+			name:      "failed",
+			lastError: "repository not found",
+			want:      protocol.RepoUpdateProgress{State: protocol.RepoUpdateStateFailed, Error: "repository not found"},
+		},
+		{
+			name:      "retrying",
+			queue:     &protocol.RepoQueueState{Position: 1},
+			lastError: "repository not found",
+			want:      protocol.RepoUpdateProgress{State: protocol.RepoUpdateStateQueued, Position: 1, Error: "repository not found"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := newRepoUpdateProgress(tc.queue, &tc.clone, tc.lastError)
+			if diff := cmp.Diff(&tc.want, got); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 type fakeScheduler struct{}
 
-func (s *fakeScheduler) UpdateOnce(_ api.RepoID, _ api.RepoName) {}
+func (s *fakeScheduler) UpdateOnce(_ api.RepoID, _ api.RepoName, _ protocol.RepoUpdatePriority) {}
 func (s *fakeScheduler) ScheduleInfo(id api.RepoID) *protocol.RepoUpdateSchedulerInfoResult {
 	return &protocol.RepoUpdateSchedulerInfoResult{}
 }
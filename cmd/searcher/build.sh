@@ -19,6 +19,8 @@ export CGO_ENABLED=0
 pkg="github.com/sourcegraph/sourcegraph/cmd/searcher"
 go build -trimpath -ldflags "-X github.com/sourcegraph/sourcegraph/internal/version.version=$VERSION  -X github.com/sourcegraph/sourcegraph/internal/version.timestamp=$(date +%s)" -buildmode exe -tags dist -o "$OUTPUT/$(basename $pkg)" "$pkg"
 
+cp -a ./cmd/symbols/ctags-install-alpine.sh "$OUTPUT"
+
 docker build -f cmd/searcher/Dockerfile -t "$IMAGE" "$OUTPUT" \
   --progress=plain \
   --build-arg COMMIT_SHA \
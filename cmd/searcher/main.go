@@ -3,6 +3,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"log"
@@ -11,7 +12,10 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/inconshreveable/log15"
@@ -20,6 +24,9 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/conf"
 	"github.com/sourcegraph/sourcegraph/internal/debugserver"
+	"github.com/sourcegraph/sourcegraph/internal/encryption"
+	"github.com/sourcegraph/sourcegraph/internal/encryption/keyring"
+	"github.com/sourcegraph/sourcegraph/internal/endpoint"
 	"github.com/sourcegraph/sourcegraph/internal/env"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
 	"github.com/sourcegraph/sourcegraph/internal/logging"
@@ -28,10 +35,38 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/trace"
 	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
 	"github.com/sourcegraph/sourcegraph/internal/tracer"
+	"github.com/sourcegraph/sourcegraph/schema"
 )
 
 var cacheDir = env.Get("CACHE_DIR", "/tmp", "directory to store cached archives.")
 var cacheSizeMB = env.Get("SEARCHER_CACHE_SIZE_MB", "100000", "maximum size of the on disk cache in megabytes")
+var fetchFromIndex, _ = strconv.ParseBool(env.Get("SEARCHER_FETCH_FROM_INDEX", "true", "build archives from the content held by zoekt if it has indexed the searched commit, instead of fetching them from gitserver"))
+var buildTrigramIndexes, _ = strconv.ParseBool(env.Get("SEARCHER_TRIGRAM_INDEX", "false", "build a trigram index next to each cached archive, which lets repeated searches of the archive skip files that can't match"))
+var archiveDepth = env.MustGetInt("SEARCHER_ARCHIVE_DEPTH", 0, "number of levels of nested archives, like jars and tarballs, whose files are searched by searches which include archive members. Zero disables it")
+var archiveMaxSizeMB = env.MustGetInt("SEARCHER_ARCHIVE_MAX_SIZE_MB", 100, "maximum size in megabytes of an archive whose files are searched, and of all files extracted from it")
+var compressArchives, _ = strconv.ParseBool(env.Get("SEARCHER_COMPRESS_ARCHIVES", "false", "compress the files of cached archives with zstd, which uses several times less disk at the cost of CPU and of holding opened archives in memory"))
+var verifyArchives, _ = strconv.ParseBool(env.Get("SEARCHER_VERIFY_ARCHIVES", "true", "check the checksums of the files of a cached archive when it is opened, and fetch it again if it is corrupt"))
+var minFreeDiskMB = env.MustGetInt("SEARCHER_MIN_FREE_DISK_MB", 100, "free space in megabytes on the disk of CACHE_DIR below which the replica reports it is not ready, so that searches are routed to other replicas. Zero disables the check, but a disk which can't be written to is still reported")
+var zipCacheSizeMB = env.MustGetInt("SEARCHER_ZIP_CACHE_SIZE_MB", 0, "maximum total size in megabytes of the cached archives kept open in memory. The least recently used archives which are not being searched are closed once it is exceeded. Zero means no limit")
+var reachabilityCheckInterval = env.MustGetDuration("SEARCHER_REACHABILITY_CHECK_INTERVAL", 6*time.Hour, "interval between checks which remove the cached archives of commits no longer reachable from a ref, for example because of a force push. Zero disables them")
+var maxDeltaFiles = env.MustGetInt("SEARCHER_MAX_DELTA_FILES", 100, "maximum number of files changed since a cached commit of a repo for the archive of another commit to be built from it and the changed files, instead of fetching the whole archive. Zero disables it")
+var fetchTimeout = env.MustGetDuration("SEARCHER_FETCH_TIMEOUT", 2*time.Minute, "time the fetch of an archive, including retries, has to finish")
+var fetchMaxAttempts = env.MustGetInt("SEARCHER_FETCH_MAX_ATTEMPTS", 3, "maximum number of attempts to fetch an archive from gitserver when it fails with an error which may be transient")
+var fetchBreakerThreshold = env.MustGetInt("SEARCHER_FETCH_BREAKER_THRESHOLD", 10, "number of consecutive failed fetches from a gitserver after which fetches from it fail immediately for SEARCHER_FETCH_BREAKER_COOLDOWN. Zero disables it")
+var fetchBreakerCooldown = env.MustGetDuration("SEARCHER_FETCH_BREAKER_COOLDOWN", 30*time.Second, "time fetches from a gitserver fail immediately once it failed SEARCHER_FETCH_BREAKER_THRESHOLD consecutive fetches")
+var maxFetchesPerGitserver = env.MustGetInt("SEARCHER_MAX_FETCHES_PER_GITSERVER", 8, "maximum number of concurrent archive fetches from a gitserver. Fetches over it wait in a queue. Zero means no limit other than the limit on all fetches")
+var peersURL = env.Get("SEARCHER_PEERS", "", "URL specifier of the searcher replicas, like SEARCHER_URL of the frontend. If set, replicas get the archives of commits they don't fetch themselves from the replicas which do. Empty disables it")
+var peerSelf = env.Get("SEARCHER_PEER_SELF", "", "URL of this replica in SEARCHER_PEERS. Defaults to http://$HOSTNAME:3181")
+var peerReplicas = env.MustGetInt("SEARCHER_PEER_REPLICAS", 1, "number of the replicas in SEARCHER_PEERS which fetch and cache the archive of a commit")
+var shutdownGracePeriod = env.MustGetDuration("SEARCHER_SHUTDOWN_GRACE_PERIOD", 20*time.Second, "time in-flight searches have to finish when shutting down, before they are stopped and return partial results")
+
+// shutdownFlushTimeout is the time stopped searches have to send their partial
+// results once the shutdown grace period is over.
+const shutdownFlushTimeout = 5 * time.Second
+
+// archiveKeyTimeout is the time building the encryption key of archives, which
+// may call a KMS, has when site config changes.
+const archiveKeyTimeout = 30 * time.Second
 
 const port = "3181"
 
@@ -45,11 +80,6 @@ func main() {
 	sentry.Init()
 	trace.Init()
 
-	// Ready immediately
-	ready := make(chan struct{})
-	close(ready)
-	go debugserver.NewServerRoutine(ready).Start()
-
 	var cacheSizeBytes int64
 	if i, err := strconv.ParseInt(cacheSizeMB, 10, 64); err != nil {
 		log.Fatalf("invalid int %q for SEARCHER_CACHE_SIZE_MB: %s", cacheSizeMB, err)
@@ -57,20 +87,146 @@ func main() {
 		cacheSizeBytes = i * 1000 * 1000
 	}
 
+	fetchTar := func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		return gitserver.DefaultClient.Archive(ctx, repo, gitserver.ArchiveOptions{Treeish: string(commit), Format: "tar"})
+	}
+	if fetchFromIndex {
+		fetchTar = search.FetchTarFromIndex(fetchTar)
+	}
+
+	upstream := func(repo api.RepoName) string {
+		if len(gitserver.DefaultClient.Addrs()) == 0 {
+			return ""
+		}
+		return gitserver.DefaultClient.AddrForRepo(repo)
+	}
+
+	fetchTarPaths := func(ctx context.Context, repo api.RepoName, commit api.CommitID, paths []string) (io.ReadCloser, error) {
+		return gitserver.DefaultClient.Archive(ctx, repo, gitserver.ArchiveOptions{Treeish: string(commit), Format: "tar", Paths: paths})
+	}
+
+	diffFiles := func(ctx context.Context, repo api.RepoName, base, head api.CommitID) (modified, deleted []string, err error) {
+		cmd := gitserver.DefaultClient.Command("git", "diff", "--name-status", "-z", "--no-renames", string(base), string(head), "--")
+		cmd.Repo = repo
+		out, err := cmd.Output(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The output is a status and a path per file, each NUL terminated.
+		fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+		for i := 0; i+1 < len(fields); i += 2 {
+			if fields[i] == "D" {
+				deleted = append(deleted, fields[i+1])
+			} else {
+				modified = append(modified, fields[i+1])
+			}
+		}
+		return modified, deleted, nil
+	}
+
+	changedFiles := func(ctx context.Context, repo api.RepoName, base, head api.CommitID) ([]string, error) {
+		cmd := gitserver.DefaultClient.Command("git", "diff", "--name-only", "-z", "--no-renames", string(base), string(head), "--")
+		cmd.Repo = repo
+		out, err := cmd.Output(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return strings.FieldsFunc(string(out), func(r rune) bool { return r == 0 }), nil
+	}
+
+	diff := func(ctx context.Context, repo api.RepoName, base, head api.CommitID) ([]byte, error) {
+		// Diff content searches only search added and removed lines, so we
+		// don't need context lines.
+		cmd := gitserver.DefaultClient.Command("git", "diff", "--no-prefix", "--no-color", "--no-ext-diff", "--no-renames", "-U0", string(base), string(head), "--")
+		cmd.Repo = repo
+		return cmd.Output(ctx)
+	}
+
+	commitReachable := func(ctx context.Context, repo api.RepoName, commit api.CommitID) (bool, error) {
+		cmd := gitserver.DefaultClient.Command("git", "for-each-ref", "--count=1", "--format=%(refname)", "--contains", string(commit))
+		cmd.Repo = repo
+		stdout, stderr, err := cmd.DividedOutput(ctx)
+		if err != nil {
+			// The commit was garbage collected.
+			if bytes.Contains(stderr, []byte("no such commit")) || bytes.Contains(stderr, []byte("malformed object name")) {
+				return false, nil
+			}
+			return false, err
+		}
+		return len(bytes.TrimSpace(stdout)) > 0, nil
+	}
+
+	var peers func(api.RepoName, api.CommitID) []string
+	if peersURL != "" {
+		self := peerSelf
+		if self == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				log.Fatalf("failed to get hostname for SEARCHER_PEER_SELF: %s", err)
+			}
+			self = "http://" + net.JoinHostPort(hostname, port)
+		}
+		peers = search.Peers(endpoint.New(peersURL), self, peerReplicas)
+	}
+
 	service := &search.Service{
 		Store: &store.Store{
-			FetchTar: func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
-				return gitserver.DefaultClient.Archive(ctx, repo, gitserver.ArchiveOptions{Treeish: string(commit), Format: "tar"})
-			},
+			FetchTar:          fetchTar,
 			FilterTar:         search.NewFilter,
 			Path:              filepath.Join(cacheDir, "searcher-archives"),
 			MaxCacheSizeBytes: cacheSizeBytes,
+			MinFreeDiskBytes:  int64(minFreeDiskMB) * 1000 * 1000,
+
+			FetchTimeout:          fetchTimeout,
+			FetchMaxAttempts:      fetchMaxAttempts,
+			FetchBreakerThreshold: fetchBreakerThreshold,
+			FetchBreakerCooldown:  fetchBreakerCooldown,
+			Upstream:              upstream,
+			MaxFetchesPerUpstream: maxFetchesPerGitserver,
+			Peers:                 peers,
+			Submodules:            search.Submodules,
+
+			BuildTrigramIndexes: buildTrigramIndexes,
+			MaxArchiveDepth:     archiveDepth,
+			MaxArchiveSize:      int64(archiveMaxSizeMB) * 1000 * 1000,
+			CompressArchives:    compressArchives,
+			VerifyArchives:      verifyArchives,
+
+			CommitReachable:           commitReachable,
+			ReachabilityCheckInterval: reachabilityCheckInterval,
+
+			DiffFiles:     diffFiles,
+			FetchTarPaths: fetchTarPaths,
+			MaxDeltaFiles: maxDeltaFiles,
 		},
-		Log: log15.Root(),
+		Log:          log15.Root(),
+		ChangedFiles: changedFiles,
+		Diff:         diff,
 	}
+	service.Store.ZipCache.SetMaxBytes(int64(zipCacheSizeMB) * 1000 * 1000)
+	watchArchiveKey(service.Store)
 	service.Store.Start()
 
+	// Ready immediately
+	ready := make(chan struct{})
+	close(ready)
+	go debugserver.NewServerRoutine(ready, debugserver.Endpoint{
+		Name:    "Search profiles",
+		Path:    "/search-profiles",
+		Handler: search.ProfilesHandler(),
+	}, debugserver.Endpoint{
+		Name:    "Cached archives",
+		Path:    "/cached-archives",
+		Handler: service.Store.EntriesHandler(),
+	}).Start()
+	service.WatchConfig()
+
 	handler := ot.Middleware(trace.HTTPTraceMiddleware(service))
+	replaceHandler := ot.Middleware(trace.HTTPTraceMiddleware(http.HandlerFunc(service.ServeReplace)))
+	archiveHandler := ot.Middleware(trace.HTTPTraceMiddleware(http.HandlerFunc(service.ServeArchive)))
+	evictHandler := ot.Middleware(trace.HTTPTraceMiddleware(http.HandlerFunc(service.ServeEvict)))
+	prefetchHandler := ot.Middleware(trace.HTTPTraceMiddleware(http.HandlerFunc(service.ServePrefetch)))
+	batchHandler := ot.Middleware(trace.HTTPTraceMiddleware(http.HandlerFunc(service.ServeBatch)))
 
 	host := ""
 	if env.InsecureDev {
@@ -84,29 +240,121 @@ func main() {
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// For cluster liveness and readiness probes
 			if r.URL.Path == "/healthz" {
-				w.WriteHeader(200)
-				_, _ = w.Write([]byte("ok"))
+				service.ServeHealthz(w, r)
+				return
+			}
+			if r.URL.Path == "/ready" {
+				service.ServeReady(w, r)
+				return
+			}
+			if r.URL.Path == "/replace" {
+				replaceHandler.ServeHTTP(w, r)
+				return
+			}
+			if r.URL.Path == "/archive" {
+				archiveHandler.ServeHTTP(w, r)
+				return
+			}
+			if r.URL.Path == "/evict" {
+				evictHandler.ServeHTTP(w, r)
+				return
+			}
+			if r.URL.Path == "/prefetch" {
+				prefetchHandler.ServeHTTP(w, r)
+				return
+			}
+			if r.URL.Path == "/batch" {
+				batchHandler.ServeHTTP(w, r)
 				return
 			}
 			handler.ServeHTTP(w, r)
 		}),
 	}
-	go shutdownOnSIGINT(server)
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		shutdownOnSignal(server, service)
+	}()
 
 	log15.Info("searcher: listening", "addr", server.Addr)
 	if err := server.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+	<-shutdownDone
+}
+
+// watchArchiveKey sets the key which encrypts the archives cached by s to the
+// searcherArchiveKey of site config, and sets it again whenever it changes. The
+// other keys of the keyring aren't built, since searcher doesn't use them. If
+// the key can't be built, the error is logged and archives are cached
+// unencrypted.
+func watchArchiveKey(s *store.Store) {
+	var last *schema.EncryptionKeys
+	conf.Watch(func() {
+		// Only the fields which affect the key.
+		var config schema.EncryptionKeys
+		if keys := conf.Get().EncryptionKeys; keys != nil {
+			config = schema.EncryptionKeys{
+				SearcherArchiveKey: keys.SearcherArchiveKey,
+				EnableCache:        keys.EnableCache,
+				CacheSize:          keys.CacheSize,
+			}
+		}
+		if last != nil && reflect.DeepEqual(*last, config) {
+			return
+		}
+		last = &config
+
+		ctx, cancel := context.WithTimeout(context.Background(), archiveKeyTimeout)
+		defer cancel()
+
+		var key encryption.Key
+		if config.SearcherArchiveKey != nil {
+			var err error
+			if key, err = keyring.NewKey(ctx, config.SearcherArchiveKey, &config); err != nil {
+				log15.Error("searcher: failed to build the encryption key of archives, caching them unencrypted", "error", err)
+				key = nil
+			}
+		}
+		if err := s.SetEncryptionKey(ctx, key); err != nil {
+			log15.Error("searcher: failed to set the encryption key of archives, caching them unencrypted", "error", err)
+			_ = s.SetEncryptionKey(ctx, nil)
+		}
+	})
 }
 
-func shutdownOnSIGINT(s *http.Server) {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+// shutdownOnSignal gracefully shuts down the server on SIGINT or SIGTERM. The
+// server stops accepting new requests and in-flight searches have the grace
+// period to finish. Searches still running after that are stopped and send
+// the results they found so far. A second signal exits immediately.
+func shutdownOnSignal(s *http.Server, service *search.Service) {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 	<-c
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	go func() {
+		<-c
+		os.Exit(1)
+	}()
+
+	log15.Info("searcher: shutting down", "gracePeriod", shutdownGracePeriod)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
 	defer cancel()
-	err := s.Shutdown(ctx)
-	if err != nil {
-		log.Fatal("graceful server shutdown failed, will exit:", err)
+	if err := s.Shutdown(ctx); err != nil {
+		log15.Warn("searcher: in-flight searches didn't finish within the grace period, stopping them")
+		service.StopSearches()
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			log15.Error("searcher: graceful server shutdown failed, will exit", "error", err)
+			return
+		}
+	}
+
+	// All searches are done, so no zip file is in use anymore.
+	service.Store.ZipCache.Close()
+	if err := service.Store.SaveManifest(); err != nil {
+		log15.Error("searcher: failed to save the manifest of cached archives", "error", err)
 	}
 }
@@ -25,6 +25,30 @@ type Request struct {
 	// "599cba5e7b6137d46ddf58fb1765f5d928e69604"
 	Commit api.CommitID
 
+	// BaseCommit if set is a resolved commit whose results the caller
+	// already has, for example from the indexed backend. Only the files
+	// which differ between BaseCommit and Commit are searched, so that the
+	// caller can replace the results of those files. Files deleted in Commit
+	// have no results.
+	BaseCommit api.CommitID
+
+	// DiffContent if true searches the lines added and removed between
+	// BaseCommit and Commit instead of the files at Commit, like a search of
+	// type:diff. It requires BaseCommit and is not supported for structural
+	// and symbol searches.
+	DiffContent bool
+
+	// IncludeArchiveMembers if true also searches the files inside the
+	// archives of the repository, like jars and tarballs, if searcher is
+	// configured to expand them. Their paths are like "outer.jar!inner/path".
+	IncludeArchiveMembers bool
+
+	// IncludeSubmodules if true also searches the files of the submodules of
+	// the repository, at the commits they are pinned to, if searcher is
+	// configured to fetch them. Their paths are prefixed with the path of
+	// the submodule. Submodules whose repository isn't cloned are skipped.
+	IncludeSubmodules bool
+
 	// Branch is used for structural search as an alternative to Commit
 	// because Zoekt only takes branch names
 	Branch string
@@ -50,14 +74,136 @@ type Request struct {
 	Deadline string
 
 	// Endpoint(s) for reaching Zoekt. See description in
-	// endpoint.go:Static(...)
+	// endpoint.go:Static(...). Besides indexed structural search, they are
+	// used to build the archive from Zoekt if it has indexed Commit.
 	IndexerEndpoints []string
 
+	// MaxFileMatches if positive is the maximum number of matching files to
+	// return. The server may enforce a lower limit.
+	MaxFileMatches int
+
+	// MaxLineMatches if positive is the maximum number of matching lines to
+	// return per file, or of match ranges for ChunkMatches. The server may
+	// enforce a lower limit.
+	MaxLineMatches int
+
+	// MaxLineSize if positive is the maximum size in bytes of the Preview of
+	// a LineMatch. Longer lines are truncated. The server may enforce a lower
+	// limit.
+	MaxLineSize int
+
+	// MaxResultBytes if positive is the maximum total size in bytes of the
+	// Previews of the LineMatches returned, or of the Content of the
+	// ChunkMatches. Once it is reached the search stops. The server may
+	// enforce a lower limit.
+	MaxResultBytes int
+
+	// IncludeContent if true returns the content of each matched file in
+	// FileMatch.Content, so that clients which highlight the matches
+	// themselves don't need to fetch the file from gitserver. It is not
+	// supported for diff content searches.
+	IncludeContent bool
+
+	// MaxContentSize if positive is the maximum size in bytes of the
+	// Content of a FileMatch. The content of larger files is truncated after
+	// the last line which fits. The server may enforce a lower limit.
+	MaxContentSize int
+
+	// Workers if positive is the number of workers which concurrently search
+	// the files of the repository. The server may use fewer.
+	Workers int
+
+	// Priority is the priority class of the search. It defaults to
+	// PriorityInteractive.
+	Priority Priority
+
+	// OffsetUnit is the unit of the OffsetAndLengths of the returned
+	// LineMatches, and of the columns of ChunkMatches. It defaults to
+	// characters (runes).
+	OffsetUnit OffsetUnit
+
+	// ProtocolVersion is the version of the result format the client
+	// understands. It defaults to ProtocolVersionLineMatches.
+	ProtocolVersion ProtocolVersion
+
+	// Ranking if set orders the returned file matches. When a limit is hit
+	// the best ranked files are returned instead of the first ones found,
+	// which requires searching all files. It is ignored by indexed
+	// structural searches.
+	Ranking Ranking
+
 	// Whether the revision to be searched is indexed or unindexed. This matters for
 	// structural search because it will query Zoekt for indexed structural search.
 	Indexed bool
+
+	// Profile if true captures a CPU profile of the search. The ID of the
+	// profile is returned in the done event.
+	Profile bool
 }
 
+// Priority is the priority class of a search.
+type Priority string
+
+const (
+	// PriorityInteractive is for searches a user is waiting for.
+	PriorityInteractive Priority = ""
+
+	// PriorityBatch is for background searches, like code insights
+	// backfills and saved searches. Searcher limits the share of its CPUs
+	// used by batch searches, so that they don't slow down interactive
+	// searches.
+	PriorityBatch Priority = "batch"
+)
+
+// ProtocolVersion is a version of the format of the results of a search.
+type ProtocolVersion int
+
+const (
+	// ProtocolVersionLineMatches returns the matches of a file as
+	// LineMatches. A match spanning several lines is split into a LineMatch
+	// for each line.
+	ProtocolVersionLineMatches ProtocolVersion = 0
+
+	// ProtocolVersionChunkMatches returns the matches of a file as
+	// ChunkMatches, which hold the range of each match. It is not supported
+	// for structural, symbol, diff content and capture group searches.
+	ProtocolVersionChunkMatches ProtocolVersion = 1
+)
+
+// Ranking is a way to order the file matches of a search.
+type Ranking string
+
+const (
+	// RankingNone returns file matches in the order they are found.
+	RankingNone Ranking = ""
+
+	// RankingPath prefers files whose name matches the pattern, then files
+	// with shallower and shorter paths.
+	RankingPath Ranking = "path"
+
+	// RankingDensity prefers files with the most matches per byte.
+	RankingDensity Ranking = "density"
+
+	// RankingRecency prefers the most recently modified files, according to
+	// the modification times in the repository archive.
+	RankingRecency Ranking = "recency"
+)
+
+// OffsetUnit is the unit of the offsets and lengths in a LineMatch.
+type OffsetUnit string
+
+const (
+	// OffsetUnitRunes measures offsets in Unicode code points.
+	OffsetUnitRunes OffsetUnit = ""
+
+	// OffsetUnitUTF16 measures offsets in UTF-16 code units, like
+	// JavaScript strings and the Language Server Protocol do.
+	OffsetUnitUTF16 OffsetUnit = "utf16"
+
+	// OffsetUnitBytes measures offsets in bytes of the UTF-8 Preview.
+	OffsetUnitBytes OffsetUnit = "bytes"
+)
+
 // PatternInfo describes a search request on a repo. Most of the fields
 // are based on PatternInfo used in vscode.
 type PatternInfo struct {
@@ -65,19 +211,49 @@ type PatternInfo struct {
 	// is true, otherwise a fixed string. eg "route variable"
 	Pattern string
 
+	// PatternExpr if non-nil is a boolean expression of patterns which must
+	// hold for a file's content to match. It is used instead of Pattern, which
+	// must then be empty, so that a query like "foo AND bar" is evaluated per
+	// file in a single request. It is not supported for structural searches.
+	PatternExpr *PatternExpr
+
 	// IsNegated if true will invert the matching logic for regexp searches. IsNegated=true is
 	// not supported for structural searches.
 	IsNegated bool
 
+	// ExcludeContentPattern if non-empty is a pattern that may not match the
+	// returned files' content. It is interpreted like Pattern, respecting
+	// IsRegExp, IsWordMatch and IsCaseSensitive. It is not supported for
+	// structural searches.
+	ExcludeContentPattern string
+
 	// IsRegExp if true will treat the Pattern as a regular expression.
 	IsRegExp bool
 
+	// IncludeCaptureGroups if true returns the offsets of the capture groups
+	// of each match in LineMatch.CaptureGroups. It only applies to regular
+	// expression patterns with capture groups.
+	IncludeCaptureGroups bool
+
 	// IsStructuralPat if true will treat the pattern as a Comby structural search pattern.
 	IsStructuralPat bool
 
+	// IsSymbolSearch if true will match the pattern against the names of the
+	// symbols found by ctags in the content of files, rather than against
+	// the content itself. It is not supported for structural searches,
+	// negated patterns and pattern expressions.
+	IsSymbolSearch bool
+
 	// IsWordMatch if true will only match the pattern at word boundaries.
 	IsWordMatch bool
 
+	// IsTokenMatch if true splits Pattern on whitespace into tokens and
+	// matches the lines which contain all of them, in any order. Each token
+	// is a fixed string, respecting IsWordMatch and IsCaseSensitive. It is
+	// not supported for regular expressions, structural, symbol and negated
+	// searches and pattern expressions.
+	IsTokenMatch bool
+
 	// IsCaseSensitive if false will ignore the case of text and pattern
 	// when finding matches.
 	IsCaseSensitive bool
@@ -116,7 +292,34 @@ type PatternInfo struct {
 	// considered a match.
 	PatternMatchesPath bool
 
+	// ExcludeIgnored if true excludes the files ignored by the .gitignore
+	// files of the repository. Files ignored by .sourcegraph/ignore are always
+	// excluded. It is not supported for structural searches.
+	ExcludeIgnored bool
+
+	// ExcludeVendored if true excludes vendored and generated files, like
+	// node_modules or minified bundles, as detected by linguist's heuristics.
+	// It is not supported for structural searches.
+	ExcludeVendored bool
+
+	// CollapseDuplicates if true returns a single match for files with
+	// identical content, like vendored copies of a library. The paths of the
+	// other files are listed in the DuplicatePaths of the match. It is not
+	// supported for structural searches.
+	CollapseDuplicates bool
+
+	// MaxFileSizeBytes if positive is the size of the largest file whose
+	// content is searched. Larger files are skipped and counted in the done
+	// event instead.
+	MaxFileSizeBytes int64
+
 	// Languages is the languages passed via the lang filters (e.g., "lang:c")
+	//
+	// For regexp and literal searches only files detected to be written in
+	// one of Languages are searched. Detection uses the name, extension,
+	// shebang and modeline of a file, so that unlike path patterns it finds
+	// files like Makefiles and scripts without an extension. For structural
+	// searches it is only used to choose the matcher.
 	Languages []string
 
 	// CombyRule is a rule that constrains matching for structural search.
@@ -134,9 +337,18 @@ type PatternInfo struct {
 
 func (p *PatternInfo) String() string {
 	args := []string{fmt.Sprintf("%q", p.Pattern)}
+	if p.PatternExpr != nil {
+		args[0] = p.PatternExpr.String()
+	}
+	if p.ExcludeContentPattern != "" {
+		args = append(args, fmt.Sprintf("-content:%q", p.ExcludeContentPattern))
+	}
 	if p.IsRegExp {
 		args = append(args, "re")
 	}
+	if p.IncludeCaptureGroups {
+		args = append(args, "groups")
+	}
 	if p.IsStructuralPat {
 		if p.CombyRule != "" {
 			args = append(args, fmt.Sprintf("comby:%s", p.CombyRule))
@@ -144,9 +356,15 @@ func (p *PatternInfo) String() string {
 			args = append(args, "comby")
 		}
 	}
+	if p.IsSymbolSearch {
+		args = append(args, "symbols")
+	}
 	if p.IsWordMatch {
 		args = append(args, "word")
 	}
+	if p.IsTokenMatch {
+		args = append(args, "tokens")
+	}
 	if p.IsCaseSensitive {
 		args = append(args, "case")
 	}
@@ -159,6 +377,18 @@ func (p *PatternInfo) String() string {
 	if p.Limit > 0 {
 		args = append(args, fmt.Sprintf("limit:%d", p.Limit))
 	}
+	if p.MaxFileSizeBytes > 0 {
+		args = append(args, fmt.Sprintf("maxsize:%d", p.MaxFileSizeBytes))
+	}
+	if p.ExcludeIgnored {
+		args = append(args, "noignored")
+	}
+	if p.ExcludeVendored {
+		args = append(args, "novendored")
+	}
+	if p.CollapseDuplicates {
+		args = append(args, "nodups")
+	}
 	for _, lang := range p.Languages {
 		args = append(args, fmt.Sprintf("lang:%s", lang))
 	}
@@ -183,6 +413,43 @@ func (p *PatternInfo) String() string {
 	return fmt.Sprintf("PatternInfo{%s}", strings.Join(args, ","))
 }
 
+// PatternExpr is a node of a boolean expression of patterns. Exactly one of
+// its fields is set. The patterns are interpreted like PatternInfo.Pattern,
+// respecting IsRegExp, IsWordMatch and IsCaseSensitive.
+type PatternExpr struct {
+	// Pattern matches if it is found in the file.
+	Pattern string `json:",omitempty"`
+
+	// And matches if all of its operands match.
+	And []*PatternExpr `json:",omitempty"`
+
+	// Or matches if any of its operands match.
+	Or []*PatternExpr `json:",omitempty"`
+
+	// Not matches if its operand does not match.
+	Not *PatternExpr `json:",omitempty"`
+}
+
+func (e *PatternExpr) String() string {
+	operands := func(op string, es []*PatternExpr) string {
+		args := []string{op}
+		for _, e := range es {
+			args = append(args, e.String())
+		}
+		return "(" + strings.Join(args, " ") + ")"
+	}
+	switch {
+	case e.And != nil:
+		return operands("and", e.And)
+	case e.Or != nil:
+		return operands("or", e.Or)
+	case e.Not != nil:
+		return operands("not", []*PatternExpr{e.Not})
+	default:
+		return fmt.Sprintf("%q", e.Pattern)
+	}
+}
+
 // Response represents the response from a Search request.
 type Response struct {
 	Matches []FileMatch
@@ -205,6 +472,103 @@ type FileMatch struct {
 
 	// LimitHit is true if LineMatches may not include all LineMatches.
 	LimitHit bool
+
+	// LimitReasons are the reasons LineMatches may not include all
+	// LineMatches.
+	LimitReasons []LimitReason `json:",omitempty"`
+
+	// ChunkMatches are the matches of the file if the request uses
+	// ProtocolVersionChunkMatches, in which case LineMatches is empty.
+	ChunkMatches []ChunkMatch `json:",omitempty"`
+
+	// Symbols are the symbols matched by a symbol search. Symbols[i] is
+	// found on LineMatches[i].
+	Symbols []SymbolMatch `json:",omitempty"`
+
+	// Hunks are the hunks of the LineMatches of a diff content search.
+	Hunks []DiffHunk `json:",omitempty"`
+
+	// DuplicatePaths are the paths of the files with the same content as
+	// Path, which are not returned as separate matches because the search
+	// collapses duplicates.
+	DuplicatePaths []string `json:",omitempty"`
+
+	// Content is the content of the file, if the request includes content.
+	Content string `json:",omitempty"`
+
+	// ContentTruncated is true if Content is only the beginning of the
+	// file, because the file is larger than MaxContentSize.
+	ContentTruncated bool `json:",omitempty"`
+}
+
+// DiffHunk is a hunk of the diff between BaseCommit and Commit. Like in a
+// unified diff, line numbers are 1-based.
+type DiffHunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+
+	// Section is the optional heading of the hunk, like the enclosing
+	// function.
+	Section string `json:",omitempty"`
+}
+
+// DiffOp is whether a line of a diff was added or removed.
+type DiffOp string
+
+const (
+	DiffOpAdded   DiffOp = "+"
+	DiffOpRemoved DiffOp = "-"
+)
+
+// SymbolMatch is a symbol found by ctags whose name matches the pattern of
+// a symbol search.
+type SymbolMatch struct {
+	Name       string
+	Kind       string
+	Language   string
+	Parent     string `json:",omitempty"`
+	ParentKind string `json:",omitempty"`
+	Signature  string `json:",omitempty"`
+
+	// LineNumber is the 0-based line number of the symbol.
+	LineNumber int
+}
+
+// ChunkMatch is a chunk of consecutive lines of a file with the ranges of
+// the matches on them. A match spanning several lines is a single Range.
+type ChunkMatch struct {
+	// Content is the lines of the chunk, without the newline of the last
+	// line.
+	Content string
+
+	// ContentStart is the location of the start of Content in the file.
+	ContentStart Location
+
+	// Ranges are the ranges of the matches in the chunk, in order.
+	Ranges []Range
+}
+
+// Location is a location in a file.
+type Location struct {
+	// Offset is the offset in bytes from the start of the file, decoded to
+	// UTF-8.
+	Offset int
+
+	// Line is the 0-based line number.
+	Line int
+
+	// Column is the offset from the start of Line, measured in the
+	// OffsetUnit of the request.
+	Column int
+}
+
+// Range is the range of a match. End is exclusive, so a match which ends
+// with a newline ends at the start of the next line.
+type Range struct {
+	Start Location
+	End   Location
 }
 
 // LineMatch is the struct used by vscode to receive search results for a line.
@@ -218,6 +582,188 @@ type LineMatch struct {
 
 	// OffsetAndLengths is a slice of 2-tuples (Offset, Length)
 	// representing each match on a line.
-	// Offsets and lengths are measured in characters, not bytes.
+	// Offsets and lengths are measured in characters, not bytes, unless
+	// the request asks for a different OffsetUnit.
 	OffsetAndLengths [][2]int
+
+	// CaptureGroups is set if the request includes capture groups. It has an
+	// entry for each entry of OffsetAndLengths, which holds the (Offset,
+	// Length) of each capture group of the match, measured like
+	// OffsetAndLengths. Groups which didn't participate in the match or
+	// don't start on this line have an Offset of -1. Entries for the
+	// continuation of a multiline match are nil.
+	CaptureGroups [][][2]int `json:",omitempty"`
+
+	// LimitReasons are the reasons Preview or OffsetAndLengths may not
+	// include the whole line or all of its matches.
+	LimitReasons []LimitReason `json:",omitempty"`
+
+	// DiffOp is set by diff content searches. If it is DiffOpAdded,
+	// LineNumber is the line number in Commit. If it is DiffOpRemoved,
+	// LineNumber is the line number in BaseCommit.
+	DiffOp DiffOp `json:",omitempty"`
+
+	// Hunk is the index in FileMatch.Hunks of the hunk of the line, for diff
+	// content searches.
+	Hunk int `json:",omitempty"`
+}
+
+// LimitReason is the reason results were truncated.
+type LimitReason string
+
+const (
+	// LimitReasonFileMatches means the search stopped because the maximum
+	// number of matches or of matching files was reached.
+	LimitReasonFileMatches LimitReason = "file_matches"
+
+	// LimitReasonLineMatches means the line matches of a file were
+	// truncated to the maximum number of line matches or of matches.
+	LimitReasonLineMatches LimitReason = "line_matches"
+
+	// LimitReasonOffsets means some match ranges of a line were dropped or
+	// shortened because they extend past its truncated preview.
+	LimitReasonOffsets LimitReason = "offsets"
+
+	// LimitReasonLineTooLong means the preview of a line was truncated to
+	// the maximum line size.
+	LimitReasonLineTooLong LimitReason = "line_too_long"
+
+	// LimitReasonResultBytes means the search stopped because the maximum
+	// total size of the previews of its line matches was reached.
+	LimitReasonResultBytes LimitReason = "result_bytes"
+
+	// LimitReasonDeadline means the search stopped because its deadline was
+	// hit.
+	LimitReasonDeadline LimitReason = "deadline"
+)
+
+// AddLimitReason returns reasons with r added, unless it already includes r.
+func AddLimitReason(reasons []LimitReason, r LimitReason) []LimitReason {
+	for _, reason := range reasons {
+		if reason == r {
+			return reasons
+		}
+	}
+	return append(reasons, r)
+}
+
+// ReplaceRequest is a request to preview replacing the matches of a pattern
+// in a repository. The files to search are selected like for a Request.
+type ReplaceRequest struct {
+	Request
+
+	// Replacement is the template each match is replaced with. If IsRegExp
+	// is true it may refer to capture groups of the pattern, like $1 or
+	// ${name}. Otherwise it is a fixed string.
+	Replacement string
+}
+
+// ReplaceResponse is the response to a ReplaceRequest.
+type ReplaceResponse struct {
+	Diffs []FileDiff
+
+	// LimitHit is true if Diffs may not include all files or all
+	// replacements because a match limit was hit.
+	LimitHit bool
+
+	// LimitReasons are the reasons Diffs may not include all files or all
+	// replacements.
+	LimitReasons []LimitReason `json:",omitempty"`
+}
+
+// FileDiff is the result of replacing the matches in a single file.
+type FileDiff struct {
+	Path string
+
+	// Diff is a unified diff of the file before and after the replacement.
+	Diff string
+
+	// MatchCount is the number of replaced matches.
+	MatchCount int
+}
+
+// MaxPrefetchArchives is the maximum number of archives of a PrefetchRequest.
+const MaxPrefetchArchives = 1000
+
+// PrefetchRequest is a request to fetch the archives of repositories into
+// the cache of searcher ahead of searches, for example to warm the cache
+// after a restart. Archives are only cached by the replica the request is
+// sent to, so requests are sent to the replicas which searches of the
+// archives are sent to. See the Prefetch function of the searcher client.
+type PrefetchRequest struct {
+	// Archives holds at most MaxPrefetchArchives archives.
+	Archives []Archive
+
+	// Deadline if set is the time by which the response is sent, in
+	// RFC3339Nano format. Archives still being fetched then keep being
+	// fetched in the background, and their error is the error of the
+	// deadline.
+	Deadline string `json:",omitempty"`
+}
+
+// Archive is a repository at a commit.
+type Archive struct {
+	Repo api.RepoName
+
+	// Commit is required to be resolved, like the Commit of a Request.
+	Commit api.CommitID
+}
+
+// PrefetchResponse is the response to a PrefetchRequest.
+type PrefetchResponse struct {
+	// Errors[i] is the error fetching Archives[i] of the request, or empty
+	// if it is cached.
+	Errors []string
+}
+
+// EvictRequest is a request to remove archives from the cache of searcher,
+// for example after the permissions of a repository changed or to debug
+// stale results.
+type EvictRequest struct {
+	Repo api.RepoName
+
+	// Commit if set is the commit whose archives are removed. Otherwise the
+	// archives of all commits of Repo are removed.
+	Commit api.CommitID `json:",omitempty"`
+}
+
+// EvictResponse is the response to an EvictRequest.
+type EvictResponse struct {
+	// Evicted is the number of archives removed.
+	Evicted int
+}
+
+// BatchRequest is a request to search a repository at a commit for several
+// patterns in a single pass over its files, for example for the operands of
+// an OR or the series of a code insight. The files to search are selected
+// like for a Request, whose PatternInfo is ignored.
+type BatchRequest struct {
+	Request
+
+	// Patterns are the patterns to search for. Each has its own Limit,
+	// path filters and options, but structural and symbol patterns are not
+	// supported.
+	Patterns []PatternInfo
+}
+
+// BatchResponse is the response to a BatchRequest.
+type BatchResponse struct {
+	// Results[i] are the results of Patterns[i] of the request.
+	Results []PatternResult
+
+	// DeadlineHit is true if the results may be incomplete because the
+	// deadline of the request was hit.
+	DeadlineHit bool
+}
+
+// PatternResult are the results of a pattern of a BatchRequest.
+type PatternResult struct {
+	Matches []FileMatch
+
+	// LimitHit is true if Matches may not include all FileMatches because a
+	// limit of the pattern or of the request was hit.
+	LimitHit bool
+
+	// LimitReasons are the reasons Matches may be incomplete.
+	LimitReasons []LimitReason `json:",omitempty"`
 }
@@ -0,0 +1,22 @@
+package search
+
+import (
+	"github.com/sourcegraph/sourcegraph/internal/store"
+)
+
+// withoutArchiveMembers returns a view of zf without the files inside the
+// archives of the repository. The view shares the data of zf, so it must not
+// be used after zf is closed.
+func withoutArchiveMembers(zf *store.ZipFile) *store.ZipFile {
+	view := &store.ZipFile{Data: zf.Data}
+	for _, f := range zf.Files {
+		if _, ok := store.ArchiveOf(f.Name); ok {
+			continue
+		}
+		view.Files = append(view.Files, f)
+		if int(f.Len) > view.MaxLen {
+			view.MaxLen = int(f.Len)
+		}
+	}
+	return view
+}
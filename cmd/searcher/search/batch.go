@@ -0,0 +1,454 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/errcode"
+	"github.com/sourcegraph/sourcegraph/internal/search/casetransform"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
+)
+
+// maxBatchPatterns is the maximum number of patterns of a BatchRequest, so
+// that a single request can't hold the workers for too long.
+const maxBatchPatterns = 100
+
+// ServeBatch handles HTTP requests to search a repository for several
+// patterns at once. The files of the archive are iterated over, decoded and
+// lowercased once for all patterns, which is much cheaper than a request per
+// pattern.
+func (s *Service) ServeBatch(w http.ResponseWriter, r *http.Request) {
+	w, closeCompression := negotiateCompression(w, r)
+	defer closeCompression()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	running.Inc()
+	defer running.Dec()
+
+	var p protocol.BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "failed to decode form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if p.Deadline != "" {
+		var deadline time.Time
+		if err := deadline.UnmarshalText([]byte(p.Deadline)); err != nil {
+			http.Error(w, "invalid deadline: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		dctx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		ctx = dctx
+	}
+	if maxTimeout := getTuning().maxTimeout; maxTimeout > 0 {
+		dctx, cancel := context.WithTimeout(ctx, maxTimeout)
+		defer cancel()
+		ctx = dctx
+	}
+
+	if err := validateBatchParams(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.batch(ctx, &p)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errcode.IsBadRequest(err) {
+			code = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.Log.Warn("searcher: failed to write batch response", "error", err)
+	}
+}
+
+func validateBatchParams(p *protocol.BatchRequest) error {
+	if len(p.Patterns) == 0 {
+		return errors.New("Patterns must be non-empty")
+	}
+	if len(p.Patterns) > maxBatchPatterns {
+		return errors.Errorf("At most %d patterns are supported, got %d", maxBatchPatterns, len(p.Patterns))
+	}
+	if p.DiffContent || p.IncludeContent || p.Ranking != protocol.RankingNone {
+		return errors.New("DiffContent, IncludeContent and Ranking are not supported for batch searches")
+	}
+	for i := range p.Patterns {
+		req := p.Request
+		req.PatternInfo = p.Patterns[i]
+		if err := validateParams(&req); err != nil {
+			return errors.Wrapf(err, "Patterns[%d]", i)
+		}
+		if req.IsStructuralPat || req.IsSymbolSearch || req.CollapseDuplicates {
+			return errors.Errorf("Patterns[%d]: structural, symbol and CollapseDuplicates patterns are not supported for batch searches", i)
+		}
+	}
+	return nil
+}
+
+func (s *Service) batch(ctx context.Context, p *protocol.BatchRequest) (_ *protocol.BatchResponse, err error) {
+	span, ctx := ot.StartSpanFromContext(ctx, "Batch")
+	span.SetTag("repo", p.Repo)
+	span.SetTag("commit", p.Commit)
+	span.SetTag("patterns", len(p.Patterns))
+	defer func() {
+		if err != nil {
+			span.SetTag("err", err.Error())
+		}
+		span.Finish()
+	}()
+
+	// Compile the patterns before fetching from store in case one is bad.
+	rgs := make([]*readerGrep, len(p.Patterns))
+	for i := range p.Patterns {
+		rgs[i], err = compile(&p.Patterns[i])
+		if err != nil {
+			return nil, badRequestError{fmt.Sprintf("Patterns[%d]: %s", i, err)}
+		}
+		rgs[i].chunkMatches = p.ProtocolVersion == protocol.ProtocolVersionChunkMatches
+	}
+
+	release, err := quotas.acquire(ctx, p.Repo, getTuning().maxConcurrentSearchesPerRepo)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	_, zf, err := s.getZipFile(ctx, &p.Request)
+	if err != nil {
+		return nil, err
+	}
+	defer zf.Close()
+
+	// The .gitignore files are read from the whole archive, once for all
+	// patterns which exclude ignored files.
+	var ignored gitignore.Matcher
+	for i := range p.Patterns {
+		if p.Patterns[i].ExcludeIgnored {
+			if ignored == nil {
+				ignored = newGitignoreMatcher(zf)
+			}
+			rgs[i].ignored = ignored
+		}
+	}
+	if !p.IncludeArchiveMembers && s.Store.MaxArchiveDepth > 0 {
+		zf = withoutArchiveMembers(zf)
+	}
+	if p.BaseCommit != "" {
+		zf, err = s.changedFilesOnly(ctx, &p.Request, zf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx = withWorkerOptions(ctx, &p.Request)
+	limits := newRequestLimits(&p.Request, getTuning())
+	resp := &protocol.BatchResponse{Results: make([]protocol.PatternResult, len(p.Patterns))}
+	searches := make([]*patternSearch, len(p.Patterns))
+	for i := range p.Patterns {
+		limit := p.Patterns[i].Limit
+		if limit <= 0 {
+			limit = math.MaxInt32
+		}
+		if maxMatches := getTuning().maxMatches; maxMatches > 0 && limit > maxMatches {
+			limit = maxMatches
+		}
+		result := &resp.Results[i]
+		patternCtx, cancel, sender := newLimitedStream(ctx, limit, limits, func(fm protocol.FileMatch) {
+			result.Matches = append(result.Matches, convertOffsets(fm, p.OffsetUnit))
+		})
+		defer cancel()
+		searches[i] = newPatternSearch(patternCtx, rgs[i], &p.Patterns[i], sender)
+	}
+
+	err = searchPatterns(ctx, searches, zf)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// The search stopped early to finish before the deadline. The
+		// matches found so far are partial results rather than a failure.
+		resp.DeadlineHit, err = true, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, ps := range searches {
+		resp.Results[i].LimitHit = ps.sender.LimitHit()
+		resp.Results[i].LimitReasons = ps.sender.LimitReasons()
+	}
+	return resp, nil
+}
+
+// patternSearch is the search for one of the patterns of a batch.
+type patternSearch struct {
+	rg *readerGrep
+
+	// ctx is done once the limit of the pattern is hit.
+	ctx    context.Context
+	sender matchSender
+
+	matchesContent, matchesPath, negated bool
+
+	// candidates are the files which may match according to the trigram
+	// index of the archive, or nil if all files may match.
+	candidates []bool
+}
+
+func newPatternSearch(ctx context.Context, rg *readerGrep, p *protocol.PatternInfo, sender matchSender) *patternSearch {
+	ps := &patternSearch{
+		rg:             rg,
+		ctx:            ctx,
+		sender:         sender,
+		matchesContent: p.PatternMatchesContent,
+		matchesPath:    p.PatternMatchesPath,
+		negated:        p.IsNegated,
+	}
+	if !ps.matchesContent && !ps.matchesPath {
+		ps.matchesContent = true
+	}
+	return ps
+}
+
+// pathOnly returns whether only the paths of the files are matched, like the
+// fast path of regexSearch.
+func (ps *patternSearch) pathOnly() bool {
+	return (ps.rg.re == nil && ps.rg.expr == nil && ps.rg.tokens == nil) || (ps.matchesPath && !ps.matchesContent)
+}
+
+// searchPatterns searches the files of zf for the patterns of searches
+// concurrently, like regexSearch. Each file is taken by a single worker,
+// which matches it against all patterns which haven't hit their limit yet.
+func searchPatterns(ctx context.Context, searches []*patternSearch, zf *store.ZipFile) (err error) {
+	span, ctx := ot.StartSpanFromContext(ctx, "SearchPatterns")
+	ext.Component.Set(span, "regex_search")
+	defer func() {
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.SetTag("err", err.Error())
+		}
+		span.Finish()
+	}()
+
+	var cancel context.CancelFunc
+	if deadline, ok := ctx.Deadline(); ok {
+		// If a deadline is set, try to finish before the deadline expires.
+		timeout := time.Duration(0.9 * float64(time.Until(deadline)))
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	if ix := zf.TrigramIndex(); ix != nil {
+		for _, ps := range searches {
+			if !ps.pathOnly() && ps.rg.expr == nil && !ps.matchesPath && !ps.negated {
+				ps.candidates = ix.Candidates(ps.rg.indexLiterals)
+			}
+		}
+	}
+
+	var (
+		filesmu sync.Mutex // protects files
+		files   = zf.Files
+		stats   = searchStatsFromContext(ctx)
+	)
+
+	// done returns whether all patterns have hit their limit.
+	done := func() bool {
+		for _, ps := range searches {
+			if ps.ctx.Err() == nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	workers, releaseWorkers := acquireWorkers(ctx)
+	defer releaseWorkers()
+	span.SetTag("workers", workers)
+
+	for i := 0; i < workers; i++ {
+		// Each worker needs its own copies, since readerGrep isn't
+		// concurrency safe.
+		rgs := make([]*readerGrep, len(searches))
+		for j, ps := range searches {
+			rgs[j] = ps.rg.Copy()
+			rgs[j].searchStats = stats
+		}
+		g.Go(func() error {
+			// Batch priority searches share a limited number of workers.
+			releaseSlot, err := acquireWorkerSlot(ctx)
+			if err != nil {
+				return nil
+			}
+			defer releaseSlot()
+
+			var bufs fileBufs
+			for ctx.Err() == nil && !done() {
+				filesmu.Lock()
+				if len(files) == 0 {
+					filesmu.Unlock()
+					return nil
+				}
+				idx := len(zf.Files) - len(files)
+				f := &files[0]
+				files = files[1:]
+				filesmu.Unlock()
+
+				start := time.Now()
+				bufs.reset(zf, f)
+				for j, ps := range searches {
+					if err := ps.searchFile(ctx, rgs[j], zf, f, idx, &bufs); err != nil {
+						if ctx.Err() != nil {
+							// Stopped while searching f, like between files.
+							return nil
+						}
+						return err
+					}
+				}
+				if bufs.isDecoded {
+					stats.searched(f, time.Since(start))
+				}
+			}
+			return nil
+		})
+	}
+
+	err = g.Wait()
+	if err == nil && ctx.Err() == context.DeadlineExceeded {
+		// We stopped early because we were about to hit the deadline.
+		err = ctx.Err()
+	}
+
+	filesmu.Lock()
+	scanned := len(zf.Files) - len(files)
+	filesmu.Unlock()
+	for _, ps := range searches {
+		ps.sender.Scanned(scanned, len(zf.Files))
+	}
+	span.LogFields(otlog.Int("filesScanned", scanned))
+
+	return err
+}
+
+// searchFile matches f, the file at idx in zf, against the pattern of ps
+// with rg, and sends f if it matches. It does nothing once the pattern has
+// hit its limit.
+func (ps *patternSearch) searchFile(ctx context.Context, rg *readerGrep, zf *store.ZipFile, f *store.SrcFile, idx int, bufs *fileBufs) error {
+	if ps.ctx.Err() != nil {
+		return nil
+	}
+
+	if ps.pathOnly() {
+		if match := rg.matchPath.MatchPath(f.Name) && rg.matchString(f.Name); match != !ps.negated {
+			return nil
+		}
+		if rg.skipFile(zf, f) {
+			return nil
+		}
+		if rg.excludeRe != nil && rg.excludeRe.Match(bufs.matchBuf(rg.ignoreCase)) {
+			return nil
+		}
+		ps.sender.Send(protocol.FileMatch{Path: f.Name, MatchCount: 1})
+		return nil
+	}
+
+	if !rg.matchPath.MatchPath(f.Name) || rg.skipFile(zf, f) {
+		return nil
+	}
+	if rg.maxFileSize > 0 && int64(f.Len) > rg.maxFileSize {
+		ps.sender.SkipTooLarge()
+		return nil
+	}
+	if ps.candidates != nil && !ps.candidates[idx] {
+		return nil
+	}
+
+	// Don't build previews the sender would drop anyway.
+	rg.maxPreviewBytes = ps.sender.RemainingBytes()
+
+	lm, chunks, matched, excluded, err := rg.findBuf(ctx, bufs.data(), bufs.matchBuf(rg.ignoreCase), ps.sender.Remaining())
+	if err != nil || excluded {
+		return err
+	}
+	fm := newFileMatch(f.Name, lm, chunks, matched)
+	match := fm.MatchCount > 0
+	if !match && ps.matchesPath {
+		// Try matching against the file path.
+		match = rg.matchString(f.Name)
+	}
+	if match == !ps.negated {
+		ps.sender.Send(fm)
+	}
+	return nil
+}
+
+// fileBufs holds the content of the file a worker matches against all
+// patterns, so that it is decoded and lowercased at most once.
+type fileBufs struct {
+	zf *store.ZipFile
+	f  *store.SrcFile
+
+	decoded, lowered     []byte
+	isDecoded, isLowered bool
+
+	// lowerBuf is reused between the files of a worker.
+	lowerBuf []byte
+}
+
+func (b *fileBufs) reset(zf *store.ZipFile, f *store.SrcFile) {
+	b.zf, b.f = zf, f
+	b.decoded, b.lowered = nil, nil
+	b.isDecoded, b.isLowered = false, false
+}
+
+// data returns the content of the file decoded to UTF-8.
+func (b *fileBufs) data() []byte {
+	if !b.isDecoded {
+		b.decoded = decodeFile(b.zf.DataFor(b.f))
+		b.isDecoded = true
+	}
+	return b.decoded
+}
+
+// matchBuf returns the content of the file to run the regexps of a pattern
+// on, like readerGrep.matchBuf.
+func (b *fileBufs) matchBuf(ignoreCase bool) []byte {
+	data := b.data()
+	if !ignoreCase {
+		return data
+	}
+	if !b.isLowered {
+		if len(b.lowerBuf) < len(data) {
+			// Decoded files may be larger than zf.MaxLen.
+			n := b.zf.MaxLen
+			if n < len(data) {
+				n = len(data)
+			}
+			b.lowerBuf = make([]byte, n)
+		}
+		b.lowered = b.lowerBuf[:len(data)]
+		casetransform.BytesToLowerASCII(b.lowered, data)
+		b.isLowered = true
+	}
+	return b.lowered
+}
@@ -0,0 +1,105 @@
+package search_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/search"
+)
+
+func TestServeBatch(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("Hello world")
+}
+`,
+		"README.md": "Hello world example in go\n",
+		"abc.txt":   "hello\nHELLO\n",
+	}
+
+	s, cleanup, err := newStore(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	ts := httptest.NewServer(http.HandlerFunc((&search.Service{Store: s}).ServeBatch))
+	defer ts.Close()
+
+	post := func(req protocol.BatchRequest) (*http.Response, protocol.BatchResponse) {
+		req.Repo = "foo"
+		req.Commit = "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"
+		req.FetchTimeout = "500ms"
+		body, err := json.Marshal(&req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var got protocol.BatchResponse
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp, got
+	}
+
+	resp, got := post(protocol.BatchRequest{Patterns: []protocol.PatternInfo{
+		{Pattern: "hello"},
+		{Pattern: "Hello", IsCaseSensitive: true},
+		{Pattern: "hello", Limit: 1},
+		{IncludePatterns: []string{`\.go$`}, PathPatternsAreRegExps: true},
+		{Pattern: "fmt", IsNegated: true},
+	}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", resp.StatusCode)
+	}
+
+	type result struct {
+		Paths    []string
+		Matches  int
+		LimitHit bool
+	}
+	var results []result
+	for _, r := range got.Results {
+		res := result{LimitHit: r.LimitHit}
+		for _, fm := range r.Matches {
+			res.Paths = append(res.Paths, fm.Path)
+			res.Matches += fm.MatchCount
+		}
+		sort.Strings(res.Paths)
+		results = append(results, res)
+	}
+	want := []result{
+		{Paths: []string{"README.md", "abc.txt", "main.go"}, Matches: 4},
+		{Paths: []string{"README.md", "main.go"}, Matches: 2},
+		{Paths: results[2].Paths, Matches: 1, LimitHit: true},
+		{Paths: []string{"main.go"}, Matches: 1},
+		{Paths: []string{"README.md", "abc.txt"}},
+	}
+	if d := cmp.Diff(want, results); d != "" {
+		t.Errorf("unexpected results (-want +got):\n%s", d)
+	}
+
+	resp, _ = post(protocol.BatchRequest{Patterns: []protocol.PatternInfo{
+		{Pattern: "hello"},
+		{Pattern: ":[x]", IsStructuralPat: true},
+	}})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for a structural pattern, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
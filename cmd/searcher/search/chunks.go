@@ -0,0 +1,122 @@
+package search
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+)
+
+// chunkBuilder builds the ChunkMatches of a file from the locations of its
+// matches, for protocol.ProtocolVersionChunkMatches. Matches must be added
+// in order and must not overlap. Matches sharing a line are in the same
+// chunk.
+type chunkBuilder struct {
+	buf    []byte
+	chunks []protocol.ChunkMatch
+	// contentEnd is the end offset of the content of the last chunk, which
+	// is set once the chunks are built.
+	contentEnd int
+	// size is the total size of the contents of the chunks.
+	size int
+
+	// pos is the offset of the last location, line and lineStart its line
+	// and the offset of the start of its line.
+	pos, line, lineStart int
+}
+
+func newChunkBuilder(buf []byte) *chunkBuilder {
+	return &chunkBuilder{buf: buf}
+}
+
+// location returns the location of offset, which must not be before the
+// last location.
+func (b *chunkBuilder) location(offset int) protocol.Location {
+	skipped := b.buf[b.pos:offset]
+	if i := bytes.LastIndexByte(skipped, '\n'); i >= 0 {
+		b.line += bytes.Count(skipped, []byte{'\n'})
+		b.lineStart = b.pos + i + 1
+	}
+	b.pos = offset
+	return protocol.Location{
+		Offset: offset,
+		Line:   b.line,
+		Column: utf8.RuneCount(b.buf[b.lineStart:offset]),
+	}
+}
+
+// add adds the match buf[start:end].
+func (b *chunkBuilder) add(start, end int) {
+	r := protocol.Range{Start: b.location(start)}
+	contentStart := b.lineStart
+	r.End = b.location(end)
+
+	// The content ends with the line of the last byte of the match, since a
+	// match ending with a newline doesn't match on the next line.
+	last := end
+	if end > start && b.buf[end-1] == '\n' {
+		last = end - 1
+	}
+	contentEnd := len(b.buf)
+	if i := bytes.IndexByte(b.buf[last:], '\n'); i >= 0 {
+		contentEnd = last + i
+	}
+
+	if n := len(b.chunks); n > 0 && contentStart <= b.contentEnd {
+		c := &b.chunks[n-1]
+		c.Ranges = append(c.Ranges, r)
+		if contentEnd > b.contentEnd {
+			b.size += contentEnd - b.contentEnd
+			b.contentEnd = contentEnd
+		}
+		return
+	}
+	b.finishChunk()
+	b.chunks = append(b.chunks, protocol.ChunkMatch{
+		ContentStart: protocol.Location{Offset: contentStart, Line: r.Start.Line},
+		Ranges:       []protocol.Range{r},
+	})
+	b.contentEnd = contentEnd
+	b.size += contentEnd - contentStart
+}
+
+// finishChunk sets the content of the last chunk.
+func (b *chunkBuilder) finishChunk() {
+	if n := len(b.chunks); n > 0 && b.chunks[n-1].Content == "" {
+		c := &b.chunks[n-1]
+		// The content is copied, since the file is not safe to use after
+		// the ZipFile is closed.
+		c.Content = string(b.buf[c.ContentStart.Offset:b.contentEnd])
+	}
+}
+
+// build returns the chunks.
+func (b *chunkBuilder) build() []protocol.ChunkMatch {
+	b.finishChunk()
+	return b.chunks
+}
+
+// countRanges returns the number of ranges of chunks.
+func countRanges(chunks []protocol.ChunkMatch) int {
+	n := 0
+	for _, c := range chunks {
+		n += len(c.Ranges)
+	}
+	return n
+}
+
+// truncateChunks returns the chunks with the first n ranges of chunks.
+func truncateChunks(chunks []protocol.ChunkMatch, n int) []protocol.ChunkMatch {
+	if n <= 0 {
+		return nil
+	}
+	for i, c := range chunks {
+		if len(c.Ranges) >= n {
+			truncated := append([]protocol.ChunkMatch(nil), chunks[:i+1]...)
+			truncated[i].Ranges = c.Ranges[:n]
+			return truncated
+		}
+		n -= len(c.Ranges)
+	}
+	return chunks
+}
@@ -0,0 +1,97 @@
+package search
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+)
+
+func TestChunkBuilder(t *testing.T) {
+	buf := []byte("abc\ndéf\nabc\n")
+	loc := func(offset, line, column int) protocol.Location {
+		return protocol.Location{Offset: offset, Line: line, Column: column}
+	}
+
+	cases := []struct {
+		expr string
+		want []protocol.ChunkMatch
+	}{{
+		expr: "b",
+		want: []protocol.ChunkMatch{{
+			Content:      "abc",
+			ContentStart: loc(0, 0, 0),
+			Ranges:       []protocol.Range{{Start: loc(1, 0, 1), End: loc(2, 0, 2)}},
+		}, {
+			Content:      "abc",
+			ContentStart: loc(9, 2, 0),
+			Ranges:       []protocol.Range{{Start: loc(10, 2, 1), End: loc(11, 2, 2)}},
+		}},
+	}, {
+		// Matches sharing a line are in the same chunk.
+		expr: "[bf]|c\nd",
+		want: []protocol.ChunkMatch{{
+			Content:      "abc\ndéf",
+			ContentStart: loc(0, 0, 0),
+			Ranges: []protocol.Range{
+				{Start: loc(1, 0, 1), End: loc(2, 0, 2)},
+				{Start: loc(2, 0, 2), End: loc(5, 1, 1)},
+				{Start: loc(7, 1, 2), End: loc(8, 1, 3)},
+			},
+		}, {
+			Content:      "abc",
+			ContentStart: loc(9, 2, 0),
+			Ranges:       []protocol.Range{{Start: loc(10, 2, 1), End: loc(11, 2, 2)}},
+		}},
+	}, {
+		// A match ending with a newline doesn't include the next line.
+		expr: "c\n",
+		want: []protocol.ChunkMatch{{
+			Content:      "abc",
+			ContentStart: loc(0, 0, 0),
+			Ranges:       []protocol.Range{{Start: loc(2, 0, 2), End: loc(4, 1, 0)}},
+		}, {
+			Content:      "abc",
+			ContentStart: loc(9, 2, 0),
+			Ranges:       []protocol.Range{{Start: loc(11, 2, 2), End: loc(13, 3, 0)}},
+		}},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			b := newChunkBuilder(buf)
+			for _, m := range regexp.MustCompile(tc.expr).FindAllIndex(buf, -1) {
+				b.add(m[0], m[1])
+			}
+			got := b.build()
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("unexpected chunks (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTruncateChunks(t *testing.T) {
+	chunks := []protocol.ChunkMatch{
+		{Content: "a", Ranges: make([]protocol.Range, 2)},
+		{Content: "b", Ranges: make([]protocol.Range, 3)},
+	}
+	for _, tc := range []struct {
+		n, wantChunks, wantRanges int
+	}{
+		{0, 0, 0},
+		{1, 1, 1},
+		{2, 1, 2},
+		{4, 2, 4},
+		{10, 2, 5},
+	} {
+		got := truncateChunks(chunks, tc.n)
+		if len(got) != tc.wantChunks || countRanges(got) != tc.wantRanges {
+			t.Errorf("n=%d: got %d chunks with %d ranges, want %d with %d", tc.n, len(got), countRanges(got), tc.wantChunks, tc.wantRanges)
+		}
+	}
+	if countRanges(chunks) != 5 {
+		t.Fatal("truncateChunks modified its input")
+	}
+}
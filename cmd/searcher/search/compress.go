@@ -0,0 +1,102 @@
+package search
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedResponseWriter compresses the body of a response. Flushing it
+// flushes the compressed data written so far, so that streamed events still
+// reach the client as they are written.
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	enc interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+func (w *compressedResponseWriter) WriteHeader(code int) {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressedResponseWriter) Write(b []byte) (int, error) {
+	return w.enc.Write(b)
+}
+
+func (w *compressedResponseWriter) Flush() {
+	_ = w.enc.Flush()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// negotiateCompression returns a ResponseWriter which compresses the response
+// to r with the best encoding it accepts, preferring zstd over gzip. If r
+// accepts neither, it returns w. The returned function must be called once
+// the response is written.
+func negotiateCompression(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	var encoding string
+	for _, e := range []string{"zstd", "gzip"} {
+		if acceptsEncoding(r.Header.Get("Accept-Encoding"), e) {
+			encoding = e
+			break
+		}
+	}
+
+	cw := &compressedResponseWriter{ResponseWriter: w}
+	switch encoding {
+	case "zstd":
+		// Responses are small and streamed, so we favour speed over ratio.
+		enc, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return w, func() {}
+		}
+		cw.enc = enc
+	case "gzip":
+		enc, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
+		if err != nil {
+			return w, func() {}
+		}
+		cw.enc = enc
+	default:
+		return w, func() {}
+	}
+
+	w.Header().Set("Content-Encoding", encoding)
+	w.Header().Add("Vary", "Accept-Encoding")
+	return cw, func() { _ = cw.enc.Close() }
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header value header
+// accepts encoding.
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		// A quality of zero means the encoding is not acceptable.
+		params = strings.TrimSpace(params)
+		if !strings.HasPrefix(params, "q=") {
+			return true
+		}
+		q, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+		return err != nil || q > 0
+	}
+	return false
+}
+
+// cut slices s around the first instance of sep.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
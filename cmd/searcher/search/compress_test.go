@@ -0,0 +1,93 @@
+package search
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	cases := []struct {
+		header   string
+		encoding string
+		want     bool
+	}{
+		{"", "gzip", false},
+		{"gzip", "gzip", true},
+		{"zstd, gzip", "gzip", true},
+		{"deflate, GZIP;q=0.5", "gzip", true},
+		{"gzip;q=0", "gzip", false},
+		{"gzip; q=0.0", "gzip", false},
+		{"gzip;q=0.05", "gzip", true},
+		{"xgzip", "gzip", false},
+	}
+	for _, tc := range cases {
+		if got := acceptsEncoding(tc.header, tc.encoding); got != tc.want {
+			t.Errorf("acceptsEncoding(%q, %q) = %v, want %v", tc.header, tc.encoding, got, tc.want)
+		}
+	}
+}
+
+func TestNegotiateCompression(t *testing.T) {
+	const body = "event: matches\ndata: []\n\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, closeCompression := negotiateCompression(w, r)
+		defer closeCompression()
+		_, _ = io.WriteString(w, body)
+		w.(http.Flusher).Flush()
+	}))
+	defer ts.Close()
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"": func(r io.Reader) (io.Reader, error) { return r, nil },
+		"gzip": func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+		"zstd": func(r io.Reader) (io.Reader, error) {
+			return zstd.NewReader(r)
+		},
+	}
+
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "identity", want: ""},
+		{accept: "gzip", want: "gzip"},
+		{accept: "gzip, zstd", want: "zstd"},
+		{accept: "gzip, zstd;q=0", want: "gzip"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.accept, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept-Encoding", tc.accept)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.Header.Get("Content-Encoding"); got != tc.want {
+				t.Fatalf("got Content-Encoding %q, want %q", got, tc.want)
+			}
+			r, err := decoders[tc.want](resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != body {
+				t.Fatalf("got body %q, want %q", got, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package search
+
+import (
+	"bytes"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+)
+
+// contentSender adds the content of the matched files to their matches, for
+// protocol.Request.IncludeContent.
+type contentSender struct {
+	matchSender
+	zf *store.ZipFile
+	// files are the indexes in zf.Files of the files by path.
+	files   map[string]int
+	maxSize int
+}
+
+func newContentSender(sender matchSender, zf *store.ZipFile, maxSize int) *contentSender {
+	files := make(map[string]int, len(zf.Files))
+	for i := range zf.Files {
+		files[zf.Files[i].Name] = i
+	}
+	return &contentSender{matchSender: sender, zf: zf, files: files, maxSize: maxSize}
+}
+
+func (s *contentSender) Send(match protocol.FileMatch) {
+	if i, ok := s.files[match.Path]; ok {
+		// The content is copied, since zf is closed once the search is done.
+		content, truncated := truncateContent(s.zf.DataFor(&s.zf.Files[i]), s.maxSize)
+		match.Content, match.ContentTruncated = string(content), truncated
+	}
+	s.matchSender.Send(match)
+}
+
+// truncateContent returns the lines of b which fit in maxSize bytes, and
+// whether b was truncated. Zero means no limit.
+func truncateContent(b []byte, maxSize int) ([]byte, bool) {
+	if maxSize <= 0 || len(b) <= maxSize {
+		return b, false
+	}
+	return b[:bytes.LastIndexByte(b[:maxSize], '\n')+1], true
+}
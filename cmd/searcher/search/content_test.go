@@ -0,0 +1,52 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	storetest "github.com/sourcegraph/sourcegraph/internal/store/testutil"
+)
+
+func TestContentSender(t *testing.T) {
+	zipData, err := storetest.CreateZip(map[string]string{
+		"small.go": "foo\n",
+		"large.go": "foo\nbar\nbaz\n",
+		"other.go": "bar\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rg, err := compile(&protocol.PatternInfo{Pattern: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []protocol.FileMatch
+	ctx, cancel, stream := newLimitedStream(context.Background(), 100, requestLimits{}, func(fm protocol.FileMatch) {
+		got = append(got, fm)
+	})
+	defer cancel()
+	sender := newContentSender(stream, zf, 10)
+	if err := regexSearch(ctx, rg, zf, 100, true, false, false, sender); err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Path < got[j].Path })
+
+	if len(got) != 2 {
+		t.Fatalf("got %d matches, want 2", len(got))
+	}
+	// The content of large.go is truncated after the last line which fits.
+	if got[0].Path != "large.go" || got[0].Content != "foo\nbar\n" || !got[0].ContentTruncated {
+		t.Errorf("unexpected match %+v", got[0])
+	}
+	if got[1].Path != "small.go" || got[1].Content != "foo\n" || got[1].ContentTruncated {
+		t.Errorf("unexpected match %+v", got[1])
+	}
+}
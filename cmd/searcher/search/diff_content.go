@@ -0,0 +1,165 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/sourcegraph/go-diff/diff"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+)
+
+// diffContent holds the lines added and removed between BaseCommit and
+// Commit, which diff content searches search instead of the archive of
+// Commit. The content of each changed file in zf is its added and removed
+// lines, in the order of the diff.
+type diffContent struct {
+	zf    *store.ZipFile
+	files map[string]*diffFile
+}
+
+// diffFile describes the content of a changed file in diffContent.zf.
+type diffFile struct {
+	hunks []protocol.DiffHunk
+	// lines has an entry for each line of the content.
+	lines []diffLine
+}
+
+type diffLine struct {
+	op protocol.DiffOp
+	// lineNumber is the 0-based line number in Commit for added lines, and
+	// in BaseCommit for removed lines.
+	lineNumber int
+	// hunk is the index of the hunk of the line in diffFile.hunks.
+	hunk int
+}
+
+// diffContent returns the content searched by the diff content search p.
+func (s *Service) diffContent(ctx context.Context, p *protocol.Request) (*diffContent, error) {
+	if s.Diff == nil {
+		return nil, badRequestError{"DiffContent is not supported by this searcher"}
+	}
+	raw, err := s.Diff(ctx, p.Repo, p.BaseCommit, p.Commit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to diff %s and %s", p.BaseCommit, p.Commit)
+	}
+	return parseDiffContent(raw)
+}
+
+// parseDiffContent returns the diffContent of raw, a diff in the format of
+// git diff --no-prefix.
+func parseDiffContent(raw []byte) (*diffContent, error) {
+	fds, err := diff.ParseMultiFileDiff(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse diff")
+	}
+
+	var buf bytes.Buffer
+	dc := &diffContent{
+		zf:    &store.ZipFile{},
+		files: make(map[string]*diffFile, len(fds)),
+	}
+	for _, fd := range fds {
+		name := diffPath(fd.NewName)
+		if fd.NewName == "/dev/null" {
+			name = diffPath(fd.OrigName)
+		}
+
+		df := &diffFile{}
+		off := buf.Len()
+		for _, h := range fd.Hunks {
+			hunk := len(df.hunks)
+			df.hunks = append(df.hunks, protocol.DiffHunk{
+				OldStart: int(h.OrigStartLine),
+				OldLines: int(h.OrigLines),
+				NewStart: int(h.NewStartLine),
+				NewLines: int(h.NewLines),
+				Section:  h.Section,
+			})
+
+			// Line numbers are 1-based in the hunk header. Without context
+			// lines, the start of an empty side is the line before the hunk.
+			oldLine, newLine := int(h.OrigStartLine)-1, int(h.NewStartLine)-1
+			for _, line := range bytes.SplitAfter(h.Body, []byte{'\n'}) {
+				if len(line) == 0 {
+					continue
+				}
+				switch line[0] {
+				case '+':
+					df.lines = append(df.lines, diffLine{op: protocol.DiffOpAdded, lineNumber: newLine, hunk: hunk})
+					newLine++
+				case '-':
+					df.lines = append(df.lines, diffLine{op: protocol.DiffOpRemoved, lineNumber: oldLine, hunk: hunk})
+					oldLine++
+				case ' ':
+					oldLine++
+					newLine++
+					continue
+				default:
+					// "\ No newline at end of file"
+					continue
+				}
+				buf.Write(line[1:])
+				if line[len(line)-1] != '\n' {
+					buf.WriteByte('\n')
+				}
+			}
+		}
+
+		size := buf.Len() - off
+		dc.zf.Files = append(dc.zf.Files, store.SrcFile{Name: name, Off: int64(off), Len: int32(size)})
+		if size > dc.zf.MaxLen {
+			dc.zf.MaxLen = size
+		}
+		dc.files[name] = df
+	}
+	dc.zf.Data = buf.Bytes()
+	return dc, nil
+}
+
+// diffPath returns the path of a file name in a diff, which git quotes if it
+// contains unusual characters.
+func diffPath(name string) string {
+	if strings.HasPrefix(name, `"`) {
+		if unquoted, err := strconv.Unquote(name); err == nil {
+			return unquoted
+		}
+	}
+	return name
+}
+
+// diffSender translates the matches of a diff content search, found in the
+// content of a diffContent, to the lines of the diff.
+type diffSender struct {
+	matchSender
+	diff *diffContent
+}
+
+func (s *diffSender) Send(match protocol.FileMatch) {
+	df, ok := s.diff.files[match.Path]
+	if !ok || len(match.LineMatches) == 0 {
+		s.matchSender.Send(match)
+		return
+	}
+
+	// Only the hunks of the matched lines are returned.
+	hunks := map[int]int{}
+	lms := make([]protocol.LineMatch, len(match.LineMatches))
+	for i, lm := range match.LineMatches {
+		dl := df.lines[lm.LineNumber]
+		hunk, ok := hunks[dl.hunk]
+		if !ok {
+			hunk = len(match.Hunks)
+			hunks[dl.hunk] = hunk
+			match.Hunks = append(match.Hunks, df.hunks[dl.hunk])
+		}
+		lm.LineNumber, lm.DiffOp, lm.Hunk = dl.lineNumber, dl.op, hunk
+		lms[i] = lm
+	}
+	match.LineMatches = lms
+	s.matchSender.Send(match)
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+)
+
+// collapseDuplicates returns a view of zf with only one of the files rg
+// would search which have identical content, and the paths of the removed
+// files by the path of the file they duplicate. The view shares the
+// data of zf, so it must not be used after zf is closed.
+func collapseDuplicates(rg *readerGrep, zf *store.ZipFile) (*store.ZipFile, map[string][]string) {
+	// first is the index in view.Files of the first file with a content
+	// hash. Files whose hashes collide but whose content differs are kept.
+	first := make(map[uint64]int, len(zf.Files))
+	duplicates := map[string][]string{}
+
+	view := &store.ZipFile{Data: zf.Data, MaxLen: zf.MaxLen}
+	for i := range zf.Files {
+		f := &zf.Files[i]
+		if !rg.matchPath.MatchPath(f.Name) || rg.skipFile(zf, f) || (rg.maxFileSize > 0 && int64(f.Len) > rg.maxFileSize) {
+			// Skipped files are left to the search, which counts them.
+			view.Files = append(view.Files, *f)
+			continue
+		}
+
+		data := zf.DataFor(f)
+		h := xxhash.Sum64(data)
+		j, ok := first[h]
+		if !ok {
+			first[h] = len(view.Files)
+		} else if rep := &view.Files[j]; bytes.Equal(zf.DataFor(rep), data) {
+			// The smallest path is searched, so that the results don't
+			// depend on the order of the archive.
+			if f.Name < rep.Name {
+				duplicates[f.Name] = append(duplicates[rep.Name], rep.Name)
+				delete(duplicates, rep.Name)
+				*rep = *f
+			} else {
+				duplicates[rep.Name] = append(duplicates[rep.Name], f.Name)
+			}
+			continue
+		}
+		view.Files = append(view.Files, *f)
+	}
+	for _, paths := range duplicates {
+		sort.Strings(paths)
+	}
+	return view, duplicates
+}
+
+// duplicatesSender adds the paths of the files collapsed by
+// collapseDuplicates to the matches of the files they duplicate.
+type duplicatesSender struct {
+	matchSender
+	duplicates map[string][]string
+}
+
+func (s *duplicatesSender) Send(match protocol.FileMatch) {
+	match.DuplicatePaths = s.duplicates[match.Path]
+	s.matchSender.Send(match)
+}
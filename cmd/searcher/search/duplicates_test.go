@@ -0,0 +1,66 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	storetest "github.com/sourcegraph/sourcegraph/internal/store/testutil"
+)
+
+func TestCollapseDuplicates(t *testing.T) {
+	zipData, err := storetest.CreateZip(map[string]string{
+		"a/lib.go":        "foo\n",
+		"vendor/a/lib.go": "foo\n",
+		"vendor/b/lib.go": "foo\n",
+		"other.go":        "foo bar\n",
+		"excluded.txt":    "foo\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rg, err := compile(&protocol.PatternInfo{Pattern: "foo", IncludePatterns: []string{`\.go$`}, PathPatternsAreRegExps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, duplicates := collapseDuplicates(rg, zf)
+
+	// Files skipped by the search are left in the view.
+	var paths []string
+	for _, f := range view.Files {
+		paths = append(paths, f.Name)
+	}
+	sort.Strings(paths)
+	if diff := cmp.Diff([]string{"a/lib.go", "excluded.txt", "other.go"}, paths); diff != "" {
+		t.Fatalf("unexpected files (-want +got):\n%s", diff)
+	}
+
+	var got []protocol.FileMatch
+	ctx, cancel, stream := newLimitedStream(context.Background(), 100, requestLimits{}, func(fm protocol.FileMatch) {
+		got = append(got, fm)
+	})
+	defer cancel()
+	sender := &duplicatesSender{matchSender: stream, duplicates: duplicates}
+	if err := regexSearch(ctx, rg, view, 100, true, false, false, sender); err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Path < got[j].Path })
+
+	if len(got) != 2 || got[0].Path != "a/lib.go" || got[1].Path != "other.go" {
+		t.Fatalf("unexpected matches %v", got)
+	}
+	if diff := cmp.Diff([]string{"vendor/a/lib.go", "vendor/b/lib.go"}, got[0].DuplicatePaths); diff != "" {
+		t.Errorf("unexpected duplicate paths (-want +got):\n%s", diff)
+	}
+	if got[1].DuplicatePaths != nil {
+		t.Errorf("unexpected duplicate paths %v", got[1].DuplicatePaths)
+	}
+}
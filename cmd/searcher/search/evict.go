@@ -0,0 +1,45 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+)
+
+// ServeEvict handles HTTP requests to remove the archives of a repository
+// from the cache, so that the next search fetches them again.
+func (s *Service) ServeEvict(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var p protocol.EvictRequest
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "failed to decode form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if p.Repo == "" {
+		http.Error(w, "Repo must be non-empty", http.StatusBadRequest)
+		return
+	}
+	if p.Commit != "" && len(p.Commit) != 40 {
+		http.Error(w, "Commit must be resolved", http.StatusBadRequest)
+		return
+	}
+
+	n, err := s.Store.EvictRepo(p.Repo, p.Commit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if s.Log != nil {
+		s.Log.Info("searcher: evicted archives", "repo", p.Repo, "commit", p.Commit, "evicted", n)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(protocol.EvictResponse{Evicted: n}); err != nil && s.Log != nil {
+		s.Log.Warn("searcher: failed to write evict response", "error", err)
+	}
+}
@@ -0,0 +1,81 @@
+package search_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/search"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestServeEvict(t *testing.T) {
+	s, cleanup, err := newStore(map[string]string{"README.md": "Hello world\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	ts := httptest.NewServer(http.HandlerFunc((&search.Service{Store: s}).ServeEvict))
+	defer ts.Close()
+
+	const (
+		commit1 = api.CommitID("deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+		commit2 = api.CommitID("feedfacefeedfacefeedfacefeedfacefeedface")
+	)
+	paths := map[string]string{}
+	for _, a := range []protocol.Archive{{Repo: "foo", Commit: commit1}, {Repo: "foo", Commit: commit2}, {Repo: "bar", Commit: commit1}} {
+		path, err := s.PrepareZip(context.Background(), a.Repo, a.Commit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zf, err := s.ZipCache.Get(context.Background(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zf.Close()
+		paths[string(a.Repo)+"@"+string(a.Commit)] = path
+	}
+
+	evict := func(req protocol.EvictRequest) int {
+		body, err := json.Marshal(&req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d", resp.StatusCode)
+		}
+		var got protocol.EvictResponse
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got.Evicted
+	}
+	exists := func(key string) bool {
+		_, err := os.Stat(paths[key])
+		return err == nil
+	}
+
+	if n := evict(protocol.EvictRequest{Repo: "foo", Commit: commit1}); n != 1 {
+		t.Errorf("got %d archives evicted, want 1", n)
+	}
+	if exists("foo@"+string(commit1)) || !exists("foo@"+string(commit2)) || !exists("bar@"+string(commit1)) {
+		t.Error("expected only foo@commit1 to be evicted")
+	}
+
+	if n := evict(protocol.EvictRequest{Repo: "foo"}); n != 1 {
+		t.Errorf("got %d archives evicted, want 1", n)
+	}
+	if exists("foo@"+string(commit2)) || !exists("bar@"+string(commit1)) {
+		t.Error("expected all archives of foo to be evicted")
+	}
+}
@@ -2,13 +2,17 @@ package search
 
 import (
 	"archive/tar"
-	"bytes"
 	"context"
+	"path"
+	"sort"
 	"strings"
 
-	"github.com/google/zoekt/ignore"
+	"github.com/cockroachdb/errors"
+	"github.com/go-enry/go-enry/v2"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
 
 	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/search/ignore"
 	"github.com/sourcegraph/sourcegraph/internal/store"
 	"github.com/sourcegraph/sourcegraph/internal/vcs/git"
 )
@@ -34,12 +38,102 @@ func NewFilter(ctx context.Context, repo api.RepoName, commit api.CommitID) (sto
 // newIgnoreMatcher calls gitserver to retrieve the ignore-file.
 // If the file doesn't exist we return an empty ignore.Matcher.
 func newIgnoreMatcher(ctx context.Context, repo api.RepoName, commit api.CommitID) (*ignore.Matcher, error) {
-	ignoreFile, err := git.ReadFile(ctx, repo, commit, ignore.IgnoreFile, 0)
+	ignoreFile, err := git.ReadFile(ctx, repo, commit, ignore.File, 0)
 	if err != nil {
 		if strings.Contains(err.Error(), "file does not exist") {
 			return &ignore.Matcher{}, nil
 		}
 		return nil, err
 	}
-	return ignore.ParseIgnoreFile(bytes.NewReader(ignoreFile))
+	return ignore.ParseBytes(ignoreFile)
+}
+
+// newGitignoreMatcher returns a matcher for the paths ignored by the
+// .gitignore files in zf, or nil if there are none.
+func newGitignoreMatcher(zf *store.ZipFile) gitignore.Matcher {
+	var files []*store.SrcFile
+	for i := range zf.Files {
+		if path.Base(zf.Files[i].Name) == ".gitignore" {
+			files = append(files, &zf.Files[i])
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	// Patterns of nested .gitignore files take precedence, so they must come
+	// last.
+	depth := func(name string) int { return strings.Count(name, "/") }
+	sort.SliceStable(files, func(i, j int) bool { return depth(files[i].Name) < depth(files[j].Name) })
+
+	var ps []gitignore.Pattern
+	for _, f := range files {
+		var domain []string
+		if dir := path.Dir(f.Name); dir != "." {
+			domain = strings.Split(dir, "/")
+		}
+		for _, line := range strings.Split(string(zf.DataFor(f)), "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+				continue
+			}
+			ps = append(ps, gitignore.ParsePattern(line, domain))
+		}
+	}
+	return gitignore.NewMatcher(ps)
+}
+
+// isIgnored returns whether m matches name or one of its parent directories.
+func isIgnored(m gitignore.Matcher, name string) bool {
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.Match(parts[:i], true) {
+			return true
+		}
+	}
+	return m.Match(parts, false)
+}
+
+// isVendored returns whether f is a vendored or generated file.
+func isVendored(zf *store.ZipFile, f *store.SrcFile) bool {
+	return enry.IsVendor(f.Name) || enry.IsGenerated(f.Name, zf.DataFor(f))
+}
+
+// languageMatcher matches the files written in a set of languages. The
+// languages of a file are detected with linguist's strategies which don't
+// require a classifier. A file matches if any of its candidate languages is in
+// the set, so that ambiguous extensions like .h match all of their languages.
+type languageMatcher map[string]struct{}
+
+// newLanguageMatcher returns a languageMatcher for languages, which may be
+// names or aliases of linguist languages.
+func newLanguageMatcher(languages []string) (languageMatcher, error) {
+	m := make(languageMatcher, len(languages))
+	for _, l := range languages {
+		lang, ok := enry.GetLanguageByAlias(l)
+		if !ok {
+			return nil, errors.Errorf("unknown language %q", l)
+		}
+		m[lang] = struct{}{}
+	}
+	return m, nil
+}
+
+// Match returns whether the file with name and content is written in one of
+// the languages of m.
+func (m languageMatcher) Match(name string, content []byte) bool {
+	base := path.Base(name)
+	for _, strategy := range []func(string, []byte, []string) []string{
+		enry.GetLanguagesByFilename,
+		enry.GetLanguagesByShebang,
+		enry.GetLanguagesByModeline,
+		enry.GetLanguagesByExtension,
+	} {
+		for _, lang := range strategy(base, content, nil) {
+			if _, ok := m[lang]; ok {
+				return true
+			}
+		}
+	}
+	return false
 }
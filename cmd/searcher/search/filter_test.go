@@ -3,12 +3,16 @@ package search
 import (
 	"context"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/cockroachdb/errors"
-	"github.com/google/zoekt/ignore"
 
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/search/ignore"
+	storetest "github.com/sourcegraph/sourcegraph/internal/store/testutil"
 	"github.com/sourcegraph/sourcegraph/internal/vcs/git"
 )
 
@@ -41,3 +45,77 @@ func TestMissingIgnoreFile(t *testing.T) {
 		t.Error("newIgnoreMatchers should have returned &ignore.Matcher{} if the ignore-file is missing")
 	}
 }
+
+func TestSkipFile(t *testing.T) {
+	zipData, err := storetest.CreateZip(map[string]string{
+		".gitignore":                 "# build output\n/build\n*.log\n",
+		"main.go":                    "foo",
+		"debug.log":                  "foo",
+		"build/out.go":               "foo",
+		"web/.gitignore":             "dist/\n!keep.log\n",
+		"web/keep.log":               "foo",
+		"web/dist/app.js":            "foo",
+		"web/src/app.js":             "foo",
+		"node_modules/left-pad/i.js": "foo",
+		"web/app.min.js":             "foo",
+		"vendor/github.com/a/b.go":   "foo",
+		"scripts/deploy":             "#!/bin/bash\nfoo",
+		"scripts/Makefile":           "foo:",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(p protocol.PatternInfo) string {
+		rg, err := compile(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ExcludeIgnored {
+			rg.ignored = newGitignoreMatcher(zf)
+		}
+		fms, _, err := regexSearchBatch(context.Background(), rg, zf, 100, true, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, fm := range fms {
+			paths = append(paths, fm.Path)
+		}
+		sort.Strings(paths)
+		return strings.Join(paths, " ")
+	}
+
+	cases := []struct {
+		p    protocol.PatternInfo
+		want string
+	}{{
+		p:    protocol.PatternInfo{Pattern: "foo"},
+		want: "build/out.go debug.log main.go node_modules/left-pad/i.js scripts/Makefile scripts/deploy vendor/github.com/a/b.go web/app.min.js web/dist/app.js web/keep.log web/src/app.js",
+	}, {
+		p:    protocol.PatternInfo{Pattern: "foo", ExcludeIgnored: true},
+		want: "main.go node_modules/left-pad/i.js scripts/Makefile scripts/deploy vendor/github.com/a/b.go web/app.min.js web/keep.log web/src/app.js",
+	}, {
+		p: protocol.PatternInfo{Pattern: "foo", ExcludeVendored: true},
+		// dist directories and dotfiles are vendored according to linguist.
+		want: "build/out.go debug.log main.go scripts/Makefile scripts/deploy web/keep.log web/src/app.js",
+	}, {
+		p:    protocol.PatternInfo{Pattern: "", ExcludeIgnored: true, ExcludeVendored: true},
+		want: "main.go scripts/Makefile scripts/deploy web/keep.log web/src/app.js",
+	}, {
+		p:    protocol.PatternInfo{Pattern: "foo", Languages: []string{"shell", "Makefile"}},
+		want: "scripts/Makefile scripts/deploy",
+	}, {
+		p:    protocol.PatternInfo{Pattern: "foo", Languages: []string{"go"}, ExcludeVendored: true},
+		want: "build/out.go main.go",
+	}}
+	for _, tc := range cases {
+		if got := search(tc.p); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.p.String(), got, tc.want)
+		}
+	}
+}
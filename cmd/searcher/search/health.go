@@ -0,0 +1,37 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ServeHealthz handles liveness probes. It responds with the health of the
+// store, but always with a 200 since restarting searcher doesn't free or fix
+// its disk.
+func (s *Service) ServeHealthz(w http.ResponseWriter, r *http.Request) {
+	s.serveHealth(w, false)
+}
+
+// ServeReady handles readiness probes. It responds with a 503 while the store
+// is unhealthy, for example because its disk is full or failing, so that
+// searches are routed to other replicas.
+func (s *Service) ServeReady(w http.ResponseWriter, r *http.Request) {
+	s.serveHealth(w, true)
+}
+
+func (s *Service) serveHealth(w http.ResponseWriter, ready bool) {
+	h := s.Store.Health()
+	status := http.StatusOK
+	if ready && !h.Healthy() {
+		status = http.StatusServiceUnavailable
+		if s.Log != nil {
+			s.Log.Warn("searcher: not ready", "problems", h.Problems)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&h); err != nil && s.Log != nil {
+		s.Log.Warn("searcher: failed to write health response", "error", err)
+	}
+}
@@ -0,0 +1,47 @@
+package search_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/search"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+)
+
+func TestServeReady(t *testing.T) {
+	s, cleanup, err := newStore(map[string]string{"README.md": "Hello world\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if err := os.MkdirAll(s.Path, 0700); err != nil {
+		t.Fatal(err)
+	}
+	service := &search.Service{Store: s}
+
+	get := func(handler http.HandlerFunc) (int, store.Health) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("GET", "/", nil))
+		var h store.Health
+		if err := json.NewDecoder(rec.Body).Decode(&h); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, h
+	}
+
+	if code, h := get(service.ServeReady); code != http.StatusOK || !h.Writable {
+		t.Errorf("got status %d and %+v, want a healthy 200", code, h)
+	}
+
+	// A disk can't have more free space than its size.
+	s.MinFreeDiskBytes = 1 << 62
+	if code, h := get(service.ServeReady); code != http.StatusServiceUnavailable || len(h.Problems) == 0 {
+		t.Errorf("got status %d and %+v, want an unhealthy 503", code, h)
+	}
+	if code, _ := get(service.ServeHealthz); code != http.StatusOK {
+		t.Errorf("got liveness status %d, want 200", code)
+	}
+}
@@ -0,0 +1,45 @@
+package search
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+)
+
+// changedFilesOnly returns a view of zf with only the files which differ
+// between p.BaseCommit and p.Commit. The view shares the data of zf, so it
+// must not be used after zf is closed.
+func (s *Service) changedFilesOnly(ctx context.Context, p *protocol.Request, zf *store.ZipFile) (*store.ZipFile, error) {
+	if s.ChangedFiles == nil {
+		return nil, badRequestError{"BaseCommit is not supported by this searcher"}
+	}
+	paths, err := s.ChangedFiles(ctx, p.Repo, p.BaseCommit, p.Commit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list files changed since %s", p.BaseCommit)
+	}
+
+	changed := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		changed[path] = struct{}{}
+	}
+
+	view := &store.ZipFile{Data: zf.Data}
+	for _, f := range zf.Files {
+		path := f.Name
+		if archive, ok := store.ArchiveOf(path); ok {
+			// The members of an archive change with it.
+			path = archive
+		}
+		if _, ok := changed[path]; !ok {
+			continue
+		}
+		view.Files = append(view.Files, f)
+		if int(f.Len) > view.MaxLen {
+			view.MaxLen = int(f.Len)
+		}
+	}
+	return view, nil
+}
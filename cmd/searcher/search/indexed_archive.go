@@ -0,0 +1,161 @@
+package search
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/google/zoekt"
+	zoektquery "github.com/google/zoekt/query"
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// maxIndexedArchiveBytes is the maximum size of the indexed content of a
+// repository we build an archive from. Larger repositories are fetched from
+// gitserver, since zoekt has to return all of their content in a single
+// response.
+const maxIndexedArchiveBytes = 256 * 1000 * 1000
+
+// notIndexedMarker is the content zoekt stores instead of the content of
+// files it skipped, e.g. because they are too large or binary.
+var notIndexedMarker = []byte("NOT-INDEXED: ")
+
+var errNotIndexed = errors.New("commit is not indexed")
+
+var indexedArchiveTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "searcher_store_indexed_archive_total",
+	Help: "Number of archives fetched from zoekt instead of gitserver, by result.",
+}, []string{"result"})
+
+type indexerEndpointsKey struct{}
+
+// withIndexerEndpoints returns a context which tells the FetchTar returned by
+// FetchTarFromIndex which zoekt replicas to ask for an archive.
+func withIndexerEndpoints(ctx context.Context, endpoints []string) context.Context {
+	if len(endpoints) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, indexerEndpointsKey{}, endpoints)
+}
+
+// FetchTarFromIndex returns a FetchTar for the store which builds the archive
+// from the content held by zoekt if zoekt has indexed the requested commit.
+// This avoids fetching the same content from gitserver again, e.g. when the
+// indexed revision of a repository is searched by structural search, or
+// while a repository is being reindexed. Otherwise it calls fetchTar.
+func FetchTarFromIndex(fetchTar func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error)) func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+	return func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		endpoints, _ := ctx.Value(indexerEndpointsKey{}).([]string)
+		if len(endpoints) == 0 {
+			return fetchTar(ctx, repo, commit)
+		}
+
+		rc, err := fetchTarFromZoekt(ctx, getZoektClient(endpoints), repo, commit)
+		switch {
+		case err == nil:
+			indexedArchiveTotal.WithLabelValues("hit").Inc()
+			return rc, nil
+		case errors.Is(err, errNotIndexed):
+			indexedArchiveTotal.WithLabelValues("miss").Inc()
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		default:
+			indexedArchiveTotal.WithLabelValues("error").Inc()
+			log15.Warn("searcher: failed to build archive from zoekt, fetching from gitserver", "repo", repo, "commit", commit, "error", err)
+		}
+		return fetchTar(ctx, repo, commit)
+	}
+}
+
+// fetchTarFromZoekt returns a tar archive of the files zoekt indexed for repo
+// at commit. It returns errNotIndexed if no branch of repo is indexed at
+// commit or zoekt can't return all of its files.
+func fetchTarFromZoekt(ctx context.Context, client zoekt.Searcher, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+	rl, err := client.List(ctx, zoektquery.NewRepoSet(string(repo)), &zoekt.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		repoID uint32
+		branch string
+		size   int64
+	)
+	for _, r := range rl.Repos {
+		if r.Repository.Name != string(repo) {
+			continue
+		}
+		size += r.Stats.ContentBytes
+		for _, b := range r.Repository.Branches {
+			if b.Version == string(commit) {
+				repoID, branch = r.Repository.ID, b.Name
+			}
+		}
+	}
+	if branch == "" {
+		return nil, errNotIndexed
+	}
+	if size > maxIndexedArchiveBytes {
+		return nil, errors.Wrapf(errNotIndexed, "indexed content of %d bytes is too large", size)
+	}
+
+	q := zoektquery.NewAnd(zoektquery.NewSingleBranchesRepos(branch, repoID), &zoektquery.Const{Value: true})
+	resp, err := client.Search(ctx, q, &zoekt.SearchOptions{
+		Whole:              true,
+		ShardMaxMatchCount: math.MaxInt32,
+		TotalMaxMatchCount: math.MaxInt32,
+		MaxWallTime:        time.Minute,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Stats.Crashes > 0 || resp.Stats.FilesSkipped > 0 || resp.Stats.ShardsSkipped > 0 {
+		return nil, errors.Wrap(errNotIndexed, "zoekt returned partial results")
+	}
+
+	files := resp.Files
+	for _, f := range files {
+		// The branch may have been reindexed since we listed it.
+		if f.Version != string(commit) {
+			return nil, errors.Wrap(errNotIndexed, "commit was reindexed")
+		}
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(writeTar(w, files))
+	}()
+	return r, nil
+}
+
+// writeTar writes the files to w as a tar archive. Files zoekt didn't index
+// the content of are omitted, like searcher doesn't search them either.
+func writeTar(w io.Writer, files []zoekt.FileMatch) error {
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		if bytes.HasPrefix(f.Content, notIndexedMarker) {
+			continue
+		}
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.FileName,
+			Mode:     0644,
+			Size:     int64(len(f.Content)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.Content); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/zoekt"
+
+	"github.com/sourcegraph/sourcegraph/internal/search/backend"
+)
+
+func TestFetchTarFromZoekt(t *testing.T) {
+	const commit = "0123456789012345678901234567890123456789"
+	repos := []*zoekt.RepoListEntry{{
+		Repository: zoekt.Repository{
+			ID:       1,
+			Name:     "foo",
+			Branches: []zoekt.RepositoryBranch{{Name: "HEAD", Version: commit}},
+		},
+	}}
+	files := []zoekt.FileMatch{
+		{FileName: "a.go", Content: []byte("package a"), Version: commit},
+		{FileName: "big.bin", Content: []byte("NOT-INDEXED: file size exceeds maximum size"), Version: commit},
+		{FileName: "dir/b.go", Content: []byte("package b"), Version: commit},
+	}
+
+	t.Run("indexed", func(t *testing.T) {
+		client := &backend.FakeSearcher{Repos: repos, Result: &zoekt.SearchResult{Files: files}}
+		rc, err := fetchTarFromZoekt(context.Background(), client, "foo", commit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+
+		got := map[string]string{}
+		tr := tar.NewReader(rc)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[hdr.Name] = string(b)
+		}
+		want := map[string]string{"a.go": "package a", "dir/b.go": "package b"}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("other commit", func(t *testing.T) {
+		client := &backend.FakeSearcher{Repos: repos, Result: &zoekt.SearchResult{Files: files}}
+		_, err := fetchTarFromZoekt(context.Background(), client, "foo", "9876543210987654321098765432109876543210")
+		if !errors.Is(err, errNotIndexed) {
+			t.Fatalf("expected errNotIndexed, got %v", err)
+		}
+	})
+
+	t.Run("reindexed", func(t *testing.T) {
+		reindexed := []zoekt.FileMatch{{FileName: "a.go", Content: []byte("package a"), Version: "9876543210987654321098765432109876543210"}}
+		client := &backend.FakeSearcher{Repos: repos, Result: &zoekt.SearchResult{Files: reindexed}}
+		_, err := fetchTarFromZoekt(context.Background(), client, "foo", commit)
+		if !errors.Is(err, errNotIndexed) {
+			t.Fatalf("expected errNotIndexed, got %v", err)
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		client := &backend.FakeSearcher{Repos: repos, Result: &zoekt.SearchResult{
+			Stats: zoekt.Stats{ShardsSkipped: 1},
+			Files: files,
+		}}
+		_, err := fetchTarFromZoekt(context.Background(), client, "foo", commit)
+		if !errors.Is(err, errNotIndexed) {
+			t.Fatalf("expected errNotIndexed, got %v", err)
+		}
+	})
+}
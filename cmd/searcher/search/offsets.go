@@ -0,0 +1,121 @@
+package search
+
+import (
+	"unicode/utf16"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+)
+
+// convertOffsets converts the OffsetAndLengths of the LineMatches of fm,
+// and the columns of its ChunkMatches, which are measured in runes, to unit.
+func convertOffsets(fm protocol.FileMatch, unit protocol.OffsetUnit) protocol.FileMatch {
+	if unit == protocol.OffsetUnitRunes || (len(fm.LineMatches) == 0 && len(fm.ChunkMatches) == 0) {
+		return fm
+	}
+	if len(fm.LineMatches) > 0 {
+		lineMatches := make([]protocol.LineMatch, len(fm.LineMatches))
+		for i, lm := range fm.LineMatches {
+			lineMatches[i] = convertLineOffsets(lm, unit)
+		}
+		fm.LineMatches = lineMatches
+	}
+	if len(fm.ChunkMatches) > 0 {
+		chunkMatches := make([]protocol.ChunkMatch, len(fm.ChunkMatches))
+		for i, cm := range fm.ChunkMatches {
+			chunkMatches[i] = convertChunkOffsets(cm, unit)
+		}
+		fm.ChunkMatches = chunkMatches
+	}
+	return fm
+}
+
+func convertChunkOffsets(cm protocol.ChunkMatch, unit protocol.OffsetUnit) protocol.ChunkMatch {
+	// lineStarts[i] is the offset in Content of its i-th line.
+	lineStarts := []int{0}
+	for i := 0; i < len(cm.Content); i++ {
+		if cm.Content[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	convert := func(loc protocol.Location) protocol.Location {
+		i := loc.Line - cm.ContentStart.Line
+		if i >= len(lineStarts) {
+			// The end of a match ending with the newline of the last line.
+			return loc
+		}
+		start := lineStarts[i]
+		end := loc.Offset - cm.ContentStart.Offset
+		if unit == protocol.OffsetUnitBytes {
+			loc.Column = end - start
+		} else if end <= len(cm.Content) {
+			loc.Column = len(utf16.Encode([]rune(cm.Content[start:end])))
+		}
+		return loc
+	}
+
+	ranges := make([]protocol.Range, len(cm.Ranges))
+	for i, r := range cm.Ranges {
+		ranges[i] = protocol.Range{Start: convert(r.Start), End: convert(r.End)}
+	}
+	cm.Ranges = ranges
+	return cm
+}
+
+func convertLineOffsets(lm protocol.LineMatch, unit protocol.OffsetUnit) protocol.LineMatch {
+	// columns[i] is the offset in unit of the i-th rune of the preview.
+	columns := make([]int, 0, len(lm.Preview)+1)
+	column := 0
+	for i, r := range lm.Preview {
+		if unit == protocol.OffsetUnitBytes {
+			column = i
+		}
+		columns = append(columns, column)
+		if r > 0xFFFF {
+			// Encoded as a surrogate pair in UTF-16.
+			column += 2
+		} else {
+			column++
+		}
+	}
+	if unit == protocol.OffsetUnitBytes {
+		column = len(lm.Preview)
+	}
+	columns = append(columns, column)
+
+	// Matches may extend past the preview, for example the newline of a
+	// multiline match. Those runes are counted as one unit each.
+	at := func(i int) int {
+		if i >= len(columns) {
+			return column + i - (len(columns) - 1)
+		}
+		return columns[i]
+	}
+
+	convert := func(ols [][2]int) [][2]int {
+		if ols == nil {
+			return nil
+		}
+		converted := make([][2]int, len(ols))
+		for i, ol := range ols {
+			if ol[0] < 0 {
+				// A capture group which isn't on this line.
+				converted[i] = ol
+				continue
+			}
+			start, end := at(ol[0]), at(ol[0]+ol[1])
+			converted[i] = [2]int{start, end - start}
+		}
+		return converted
+	}
+
+	lm.OffsetAndLengths = convert(lm.OffsetAndLengths)
+	if lm.CaptureGroups != nil {
+		captureGroups := make([][][2]int, len(lm.CaptureGroups))
+		for i, groups := range lm.CaptureGroups {
+			captureGroups[i] = convert(groups)
+		}
+		lm.CaptureGroups = captureGroups
+	}
+	return lm
+}
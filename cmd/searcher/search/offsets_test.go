@@ -0,0 +1,97 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+)
+
+func TestConvertOffsets(t *testing.T) {
+	// "héllo 😀 wörld" with matches on "héllo", "😀" and "wörld".
+	fm := protocol.FileMatch{Path: "a", LineMatches: []protocol.LineMatch{{
+		Preview:          "héllo 😀 wörld",
+		OffsetAndLengths: [][2]int{{0, 5}, {6, 1}, {8, 5}},
+	}, {
+		// A multiline match extends past the preview.
+		Preview:          "ä",
+		OffsetAndLengths: [][2]int{{0, 2}},
+	}}}
+
+	cases := []struct {
+		unit protocol.OffsetUnit
+		want [][][2]int
+	}{
+		{protocol.OffsetUnitRunes, [][][2]int{{{0, 5}, {6, 1}, {8, 5}}, {{0, 2}}}},
+		{protocol.OffsetUnitUTF16, [][][2]int{{{0, 5}, {6, 2}, {9, 5}}, {{0, 2}}}},
+		{protocol.OffsetUnitBytes, [][][2]int{{{0, 6}, {7, 4}, {12, 6}}, {{0, 3}}}},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.unit), func(t *testing.T) {
+			got := convertOffsets(fm, tc.unit)
+			var offsets [][][2]int
+			for _, lm := range got.LineMatches {
+				offsets = append(offsets, lm.OffsetAndLengths)
+			}
+			if diff := cmp.Diff(tc.want, offsets); diff != "" {
+				t.Fatalf("unexpected offsets (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// The input is not modified.
+	if fm.LineMatches[0].OffsetAndLengths[2] != [2]int{8, 5} {
+		t.Fatal("convertOffsets modified its input")
+	}
+}
+
+func TestConvertOffsets_captureGroups(t *testing.T) {
+	fm := protocol.FileMatch{Path: "a", LineMatches: []protocol.LineMatch{{
+		Preview:          "func (ä) öf(",
+		OffsetAndLengths: [][2]int{{0, 12}},
+		CaptureGroups:    [][][2]int{{{6, 1}, {-1, 0}, {9, 2}}},
+	}}}
+	got := convertOffsets(fm, protocol.OffsetUnitBytes).LineMatches[0].CaptureGroups
+	want := [][][2]int{{{6, 2}, {-1, 0}, {10, 3}}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected capture groups (-want +got):\n%s", diff)
+	}
+}
+
+func TestConvertOffsets_chunkMatches(t *testing.T) {
+	// A match on "ö" and a match from "😀" to the end of "wörld\n".
+	content := "ab\nö 😀 x\nwörld"
+	fm := protocol.FileMatch{Path: "a", ChunkMatches: []protocol.ChunkMatch{{
+		Content:      content,
+		ContentStart: protocol.Location{Offset: 10, Line: 2},
+		Ranges: []protocol.Range{{
+			Start: protocol.Location{Offset: 13, Line: 3, Column: 0},
+			End:   protocol.Location{Offset: 15, Line: 3, Column: 1},
+		}, {
+			Start: protocol.Location{Offset: 16, Line: 3, Column: 2},
+			End:   protocol.Location{Offset: 10 + len(content) + 1, Line: 5, Column: 0},
+		}},
+	}}}
+
+	cases := []struct {
+		unit protocol.OffsetUnit
+		want [][2]int
+	}{
+		{protocol.OffsetUnitRunes, [][2]int{{0, 1}, {2, 0}}},
+		{protocol.OffsetUnitUTF16, [][2]int{{0, 1}, {2, 0}}},
+		{protocol.OffsetUnitBytes, [][2]int{{0, 2}, {3, 0}}},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.unit), func(t *testing.T) {
+			got := convertOffsets(fm, tc.unit)
+			var columns [][2]int
+			for _, r := range got.ChunkMatches[0].Ranges {
+				columns = append(columns, [2]int{r.Start.Column, r.End.Column})
+			}
+			if diff := cmp.Diff(tc.want, columns); diff != "" {
+				t.Fatalf("unexpected columns (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package search
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+)
+
+// exprMatcher evaluates a protocol.PatternExpr. Exactly one of its fields is
+// set, mirroring the node it was compiled from.
+type exprMatcher struct {
+	re  *regexp.Regexp
+	and []*exprMatcher
+	or  []*exprMatcher
+	not *exprMatcher
+}
+
+// compileExpr returns an exprMatcher for e, compiling its patterns with the
+// options of p.
+func compileExpr(e *protocol.PatternExpr, p *protocol.PatternInfo) (*exprMatcher, error) {
+	if e == nil {
+		return nil, errors.New("empty pattern expression")
+	}
+
+	set := 0
+	for _, ok := range []bool{e.Pattern != "", e.And != nil, e.Or != nil, e.Not != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.Errorf("pattern expression %s must have exactly one of Pattern, And, Or and Not set", e)
+	}
+
+	compileAll := func(es []*protocol.PatternExpr) ([]*exprMatcher, error) {
+		if len(es) == 0 {
+			return nil, errors.New("pattern expression operator must have operands")
+		}
+		ms := make([]*exprMatcher, 0, len(es))
+		for _, e := range es {
+			m, err := compileExpr(e, p)
+			if err != nil {
+				return nil, err
+			}
+			ms = append(ms, m)
+		}
+		return ms, nil
+	}
+
+	var (
+		m   exprMatcher
+		err error
+	)
+	switch {
+	case e.And != nil:
+		m.and, err = compileAll(e.And)
+	case e.Or != nil:
+		m.or, err = compileAll(e.Or)
+	case e.Not != nil:
+		m.not, err = compileExpr(e.Not, p)
+	default:
+		var expr string
+		expr, err = patternExpr(e.Pattern, p)
+		if err == nil {
+			m.re, err = regexp.Compile(expr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// match evaluates m, using match to report whether a pattern matches.
+func (m *exprMatcher) match(match func(*regexp.Regexp) bool) bool {
+	switch {
+	case m.re != nil:
+		return match(m.re)
+	case m.not != nil:
+		return !m.not.match(match)
+	case m.and != nil:
+		for _, o := range m.and {
+			if !o.match(match) {
+				return false
+			}
+		}
+		return true
+	default:
+		for _, o := range m.or {
+			if o.match(match) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// positive appends the patterns of m which are not negated to res. Their
+// locations are the ones reported as matches.
+func (m *exprMatcher) positive(negated bool, res []*regexp.Regexp) []*regexp.Regexp {
+	switch {
+	case m.re != nil:
+		if !negated {
+			res = append(res, m.re)
+		}
+	case m.not != nil:
+		res = m.not.positive(!negated, res)
+	default:
+		for _, o := range append(m.and, m.or...) {
+			res = o.positive(negated, res)
+		}
+	}
+	return res
+}
+
+// findAllIndex returns the locations of the positive patterns of m in b,
+// ordered by position. At most n locations are returned.
+func (m *exprMatcher) findAllIndex(b []byte, n int) [][]int {
+	var locs [][]int
+	for _, re := range m.positive(false, nil) {
+		locs = append(locs, re.FindAllIndex(b, n)...)
+	}
+	sort.Slice(locs, func(i, j int) bool {
+		if locs[i][0] != locs[j][0] {
+			return locs[i][0] < locs[j][0]
+		}
+		return locs[i][1] < locs[j][1]
+	})
+	if len(locs) > n {
+		locs = locs[:n]
+	}
+	return locs
+}
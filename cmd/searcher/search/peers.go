@@ -0,0 +1,81 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/endpoint"
+	"github.com/sourcegraph/sourcegraph/internal/errcode"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+)
+
+// Peers returns a function for store.Store.Peers which hashes repo@commit
+// onto the given number of the searcher replicas in peers, like the frontend
+// hashes it to pick the searcher of a search. The archives of a commit are
+// fetched by the replicas it hashes onto, and the other replicas get them
+// from those. self is the URL of this replica in peers.
+func Peers(peers *endpoint.Map, self string, replicas int) func(repo api.RepoName, commit api.CommitID) []string {
+	return func(repo api.RepoName, commit api.CommitID) []string {
+		urls, err := peers.GetN(string(repo)+"@"+string(commit), replicas)
+		if err != nil {
+			return nil
+		}
+		for _, u := range urls {
+			if u == self {
+				// We are one of the replicas which fetch the archive.
+				return nil
+			}
+		}
+		return urls
+	}
+}
+
+// ServeArchive handles HTTP requests of searcher peers for the archive of a
+// repo at a commit, fetching it if it isn't cached. Requests whose archive
+// name doesn't match the name of our archive, because the replicas archive
+// repos with different settings, are not found.
+func (s *Service) ServeArchive(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	repo := api.RepoName(q.Get("repo"))
+	commit := api.CommitID(q.Get("commit"))
+	if repo == "" || len(commit) != 40 {
+		http.Error(w, "repo and an absolute commit must be specified", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Minute)
+	defer cancel()
+	ctx = store.WithoutPeers(ctx)
+	if q.Get("submodules") == "true" {
+		ctx = store.WithSubmodules(ctx)
+	}
+	path, err := s.Store.PrepareZip(ctx, repo, commit)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errcode.IsBadRequest(err) {
+			code = http.StatusBadRequest
+		} else if errcode.IsTemporary(err) {
+			code = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if name := q.Get("name"); name != "" && name != filepath.Base(path) {
+		http.Error(w, "archive has different settings", http.StatusNotFound)
+		return
+	}
+
+	// The file stays readable if it is evicted while we serve it.
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/zip")
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
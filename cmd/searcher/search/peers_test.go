@@ -0,0 +1,50 @@
+package search_test
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/search"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestServeArchive_peers(t *testing.T) {
+	owner, cleanup, err := newStore(map[string]string{"README.md": "Hello world\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	ts := httptest.NewServer(http.HandlerFunc((&search.Service{Store: owner}).ServeArchive))
+	defer ts.Close()
+
+	replica, cleanup, err := newStore(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	replica.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		return nil, errors.New("expected the archive to come from the peer")
+	}
+	replica.Peers = func(repo api.RepoName, commit api.CommitID) []string {
+		return []string{ts.URL}
+	}
+
+	path, err := replica.PrepareZip(context.Background(), "foo", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.File) != 1 || r.File[0].Name != "README.md" {
+		t.Errorf("unexpected files %v", r.File)
+	}
+}
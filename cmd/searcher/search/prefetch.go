@@ -0,0 +1,117 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
+)
+
+// prefetchConcurrency is the number of archives of a PrefetchRequest fetched
+// at once. The store further limits the concurrent fetches of all requests.
+const prefetchConcurrency = 4
+
+// ServePrefetch handles HTTP requests to fetch archives into the cache ahead
+// of searches. It responds once all archives are cached or failed, or the
+// deadline of the request is hit.
+func (s *Service) ServePrefetch(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var p protocol.PrefetchRequest
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "failed to decode form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if p.Deadline != "" {
+		var deadline time.Time
+		if err := deadline.UnmarshalText([]byte(p.Deadline)); err != nil {
+			http.Error(w, "invalid deadline: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		dctx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		ctx = dctx
+	}
+
+	if err := validatePrefetchParams(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	errs := s.Prefetch(ctx, p.Archives)
+	resp := protocol.PrefetchResponse{Errors: make([]string, len(errs))}
+	for i, err := range errs {
+		if err != nil {
+			resp.Errors[i] = err.Error()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil && s.Log != nil {
+		s.Log.Warn("searcher: failed to write prefetch response", "error", err)
+	}
+}
+
+func validatePrefetchParams(p *protocol.PrefetchRequest) error {
+	if len(p.Archives) > protocol.MaxPrefetchArchives {
+		return errors.Errorf("At most %d archives can be prefetched at once, got %d", protocol.MaxPrefetchArchives, len(p.Archives))
+	}
+	for _, a := range p.Archives {
+		if a.Repo == "" {
+			return errors.New("Repo must be non-empty")
+		}
+		if len(a.Commit) != 40 {
+			return errors.Errorf("Commit must be resolved (Repo=%q, Commit=%q)", a.Repo, a.Commit)
+		}
+	}
+	return nil
+}
+
+// Prefetch fetches archives into the cache of the store, unless they are
+// cached already. The i-th error is the error fetching archives[i]. Fetches
+// which are still running when ctx is done continue in the background.
+func (s *Service) Prefetch(ctx context.Context, archives []protocol.Archive) []error {
+	span, ctx := ot.StartSpanFromContext(ctx, "Prefetch")
+	span.SetTag("archives", len(archives))
+	defer span.Finish()
+
+	errs := make([]error, len(archives))
+	sem := make(chan struct{}, prefetchConcurrency)
+	var wg sync.WaitGroup
+	for i, a := range archives {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(i int, a protocol.Archive) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			_, errs[i] = s.Store.PrepareZip(ctx, a.Repo, a.Commit)
+			if errs[i] == nil {
+				prefetchedArchives.Inc()
+			}
+		}(i, a)
+	}
+	wg.Wait()
+	return errs
+}
+
+var prefetchedArchives = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "searcher_service_prefetched_archives_total",
+	Help: "The total number of archives of prefetch requests which are cached.",
+})
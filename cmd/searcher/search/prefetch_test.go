@@ -0,0 +1,88 @@
+package search_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/search"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestServePrefetch(t *testing.T) {
+	s, cleanup, err := newStore(map[string]string{"README.md": "Hello world\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	fetchTar := s.FetchTar
+	var fetches int64
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		atomic.AddInt64(&fetches, 1)
+		if repo == "missing" {
+			return nil, errors.New("repository not found")
+		}
+		return fetchTar(ctx, repo, commit)
+	}
+	ts := httptest.NewServer(http.HandlerFunc((&search.Service{Store: s}).ServePrefetch))
+	defer ts.Close()
+
+	prefetch := func(req protocol.PrefetchRequest) (int, protocol.PrefetchResponse) {
+		body, err := json.Marshal(&req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var got protocol.PrefetchResponse
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, got
+	}
+
+	req := protocol.PrefetchRequest{Archives: []protocol.Archive{
+		{Repo: "foo", Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"},
+		{Repo: "bar", Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"},
+		{Repo: "missing", Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"},
+	}}
+	code, got := prefetch(req)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+	if len(got.Errors) != 3 || got.Errors[0] != "" || got.Errors[1] != "" || got.Errors[2] == "" {
+		t.Fatalf("unexpected errors %q", got.Errors)
+	}
+
+	// Cached archives are not fetched again.
+	code, got = prefetch(protocol.PrefetchRequest{Archives: req.Archives[:2]})
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+	if diff := cmp.Diff([]string{"", ""}, got.Errors); diff != "" {
+		t.Fatalf("unexpected errors (-want +got):\n%s", diff)
+	}
+	if n := atomic.LoadInt64(&fetches); n != 3 {
+		t.Errorf("got %d fetches, want 3", n)
+	}
+
+	// Commits must be resolved.
+	code, _ = prefetch(protocol.PrefetchRequest{Archives: []protocol.Archive{{Repo: "foo", Commit: "HEAD"}}})
+	if code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", code, http.StatusBadRequest)
+	}
+}
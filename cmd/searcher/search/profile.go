@@ -0,0 +1,125 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inconshreveable/log15"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+)
+
+// maxSearchProfiles is the number of CPU profiles of individual searches kept
+// in memory. Older profiles are discarded.
+const maxSearchProfiles = 20
+
+// searchProfiles stores the CPU profiles captured for individual searches
+// which requested one with protocol.Request.Profile.
+type searchProfiles struct {
+	mu       sync.Mutex
+	profiles []*searchProfile // oldest first
+}
+
+type searchProfile struct {
+	id       string
+	request  string
+	start    time.Time
+	duration time.Duration
+	data     []byte
+}
+
+var profiles = &searchProfiles{}
+
+// ProfilesHandler returns the debug handler which lists the CPU profiles
+// captured for individual searches, and serves the profile with the ID given
+// in the "id" query parameter.
+func ProfilesHandler() http.Handler {
+	return profiles
+}
+
+// capture runs search while capturing a CPU profile and returns the ID of the
+// profile. If another profile is being captured, search runs without
+// profiling and the returned ID is empty.
+//
+// The CPU profile covers the whole process, so the goroutines of search are
+// labeled with the ID of the profile. Use "go tool pprof -tagfocus
+// search=<ID>" to only look at the samples of this search.
+func (s *searchProfiles) capture(ctx context.Context, p *protocol.Request, search func(ctx context.Context)) string {
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		log15.Warn("searcher: not profiling search", "repo", p.Repo, "error", err)
+		search(ctx)
+		return ""
+	}
+
+	id := uuid.New().String()
+	start := time.Now()
+	pprof.Do(ctx, pprof.Labels("search", id), search)
+	pprof.StopCPUProfile()
+
+	s.add(&searchProfile{
+		id:       id,
+		request:  fmt.Sprintf("%s@%s %s", p.Repo, p.Commit, p.PatternInfo.String()),
+		start:    start,
+		duration: time.Since(start),
+		data:     buf.Bytes(),
+	})
+	return id
+}
+
+func (s *searchProfiles) add(p *searchProfile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.profiles = append(s.profiles, p)
+	if len(s.profiles) > maxSearchProfiles {
+		s.profiles = s.profiles[len(s.profiles)-maxSearchProfiles:]
+	}
+}
+
+func (s *searchProfiles) get(id string) *searchProfile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.profiles {
+		if p.id == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *searchProfiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if id := r.URL.Query().Get("id"); id != "" {
+		p := s.get(id)
+		if p == nil {
+			http.Error(w, "profile not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="search-%s.pprof"`, p.id))
+		_, _ = w.Write(p.data)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if len(s.profiles) == 0 {
+		fmt.Fprintf(w, "No search profiles captured.<br>")
+		return
+	}
+	for i := len(s.profiles) - 1; i >= 0; i-- {
+		p := s.profiles[i]
+		fmt.Fprintf(w, `<a href="?id=%s">%s</a> %s (%s): %s<br>`, p.id, p.id, p.start.Format(time.RFC3339), p.duration, html.EscapeString(p.request))
+	}
+}
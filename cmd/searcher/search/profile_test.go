@@ -0,0 +1,80 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+)
+
+func TestSearchProfiles(t *testing.T) {
+	s := &searchProfiles{}
+	p := &protocol.Request{Repo: "foo", Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef", PatternInfo: protocol.PatternInfo{Pattern: "bar"}}
+
+	var label string
+	id := s.capture(context.Background(), p, func(ctx context.Context) {
+		label, _ = pprof.Label(ctx, "search")
+	})
+	if id == "" {
+		t.Fatal("expected a profile to be captured")
+	}
+	if label != id {
+		t.Fatalf("search wasn't labeled with the profile ID. want=%q have=%q", id, label)
+	}
+
+	serve := func(query string) *http.Response {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", "/search-profiles"+query, nil))
+		return rec.Result()
+	}
+
+	body, _ := io.ReadAll(serve("").Body)
+	if !strings.Contains(string(body), id) {
+		t.Fatalf("profile isn't listed: %s", body)
+	}
+
+	resp := serve("?id=" + id)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status. want=%d have=%d", http.StatusOK, resp.StatusCode)
+	}
+	if body, _ := io.ReadAll(resp.Body); len(body) == 0 {
+		t.Fatal("empty profile")
+	}
+
+	if resp := serve("?id=missing"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected status. want=%d have=%d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	// Only the latest profiles are kept.
+	for i := 0; i < maxSearchProfiles; i++ {
+		s.add(&searchProfile{id: "other"})
+	}
+	if s.get(id) != nil {
+		t.Fatal("expected oldest profile to be discarded")
+	}
+}
+
+func TestSearchProfilesConcurrent(t *testing.T) {
+	// Only one CPU profile can be captured at a time.
+	if err := pprof.StartCPUProfile(&bytes.Buffer{}); err != nil {
+		t.Skipf("CPU profiling unavailable: %s", err)
+	}
+	defer pprof.StopCPUProfile()
+
+	searched := false
+	id := (&searchProfiles{}).capture(context.Background(), &protocol.Request{}, func(context.Context) {
+		searched = true
+	})
+	if id != "" {
+		t.Fatalf("unexpected profile %q", id)
+	}
+	if !searched {
+		t.Fatal("search didn't run")
+	}
+}
@@ -0,0 +1,169 @@
+package search
+
+import (
+	"container/heap"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+)
+
+// rankedMatch is a file match with the information it is ranked by.
+type rankedMatch struct {
+	fm        protocol.FileMatch
+	size      int64
+	modTime   int64
+	nameMatch bool
+}
+
+// rankingLess returns a function reporting whether a ranks before b for
+// ranking r. Ties are broken by path, so that the order is deterministic.
+func rankingLess(r protocol.Ranking) func(a, b *rankedMatch) bool {
+	byPath := func(a, b *rankedMatch) bool { return a.fm.Path < b.fm.Path }
+	switch r {
+	case protocol.RankingPath:
+		return func(a, b *rankedMatch) bool {
+			if a.nameMatch != b.nameMatch {
+				return a.nameMatch
+			}
+			if da, db := strings.Count(a.fm.Path, "/"), strings.Count(b.fm.Path, "/"); da != db {
+				return da < db
+			}
+			if len(a.fm.Path) != len(b.fm.Path) {
+				return len(a.fm.Path) < len(b.fm.Path)
+			}
+			return byPath(a, b)
+		}
+	case protocol.RankingDensity:
+		return func(a, b *rankedMatch) bool {
+			// Compare a.MatchCount/a.size with b.MatchCount/b.size without
+			// dividing.
+			da, db := int64(a.fm.MatchCount)*b.size, int64(b.fm.MatchCount)*a.size
+			if da != db {
+				return da > db
+			}
+			return byPath(a, b)
+		}
+	case protocol.RankingRecency:
+		return func(a, b *rankedMatch) bool {
+			if a.modTime != b.modTime {
+				return a.modTime > b.modTime
+			}
+			return byPath(a, b)
+		}
+	default:
+		return byPath
+	}
+}
+
+// rankedHeap is a heap of matches with the worst ranked match on top.
+type rankedHeap struct {
+	matches []*rankedMatch
+	less    func(a, b *rankedMatch) bool
+}
+
+func (h *rankedHeap) Len() int           { return len(h.matches) }
+func (h *rankedHeap) Less(i, j int) bool { return h.less(h.matches[j], h.matches[i]) }
+func (h *rankedHeap) Swap(i, j int)      { h.matches[i], h.matches[j] = h.matches[j], h.matches[i] }
+func (h *rankedHeap) Push(x interface{}) { h.matches = append(h.matches, x.(*rankedMatch)) }
+func (h *rankedHeap) Pop() interface{} {
+	m := h.matches[len(h.matches)-1]
+	h.matches = h.matches[:len(h.matches)-1]
+	return m
+}
+
+// rankedSender collects the matches of a search and sends them to sender in
+// ranked order once the search is done. It only keeps the best matches,
+// but enough of them for the limits of sender to still be hit, so that
+// sender reports LimitHit if matches were dropped.
+type rankedSender struct {
+	sender   matchSender
+	files    map[string]*store.SrcFile
+	rg       *readerGrep
+	limit    int
+	maxFiles int
+
+	mu      sync.Mutex
+	matches rankedHeap
+	total   int // the sum of MatchCount of matches
+}
+
+// newRankedSender returns a rankedSender for the files in zf, ranked by r.
+// rg if non-nil is used to match file names for protocol.RankingPath.
+// maxFiles if positive is the file limit of sender.
+func newRankedSender(r protocol.Ranking, zf *store.ZipFile, rg *readerGrep, sender matchSender, maxFiles int) *rankedSender {
+	files := make(map[string]*store.SrcFile, len(zf.Files))
+	for i := range zf.Files {
+		files[zf.Files[i].Name] = &zf.Files[i]
+	}
+	return &rankedSender{
+		sender:   sender,
+		files:    files,
+		rg:       rg,
+		limit:    sender.Remaining(),
+		maxFiles: maxFiles,
+		matches:  rankedHeap{less: rankingLess(r)},
+	}
+}
+
+func (s *rankedSender) Send(fm protocol.FileMatch) {
+	m := &rankedMatch{fm: fm, size: 1}
+	if f, ok := s.files[fm.Path]; ok {
+		if f.Len > 0 {
+			m.size = int64(f.Len)
+		}
+		m.modTime = f.ModTime
+	}
+	if s.rg != nil {
+		m.nameMatch = s.rg.matchString(path.Base(fm.Path))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	heap.Push(&s.matches, m)
+	s.total += fm.MatchCount
+	for s.matches.Len() > 1 {
+		worst := s.matches.matches[0]
+		tooManyMatches := s.total-worst.fm.MatchCount > s.limit
+		tooManyFiles := s.maxFiles > 0 && s.matches.Len() > s.maxFiles+1
+		if !tooManyMatches && !tooManyFiles {
+			break
+		}
+		heap.Pop(&s.matches)
+		s.total -= worst.fm.MatchCount
+	}
+}
+
+// flush sends the collected matches to the underlying sender, best first.
+func (s *rankedSender) flush() {
+	s.mu.Lock()
+	matches := s.matches.matches
+	s.matches.matches = nil
+	s.total = 0
+	s.mu.Unlock()
+
+	less := s.matches.less
+	sort.Slice(matches, func(i, j int) bool { return less(matches[i], matches[j]) })
+	for _, m := range matches {
+		s.sender.Send(m.fm)
+	}
+}
+
+func (s *rankedSender) SkipTooLarge()      { s.sender.SkipTooLarge() }
+func (s *rankedSender) TooLargeCount() int { return s.sender.TooLargeCount() }
+func (s *rankedSender) SentCount() int     { return s.sender.SentCount() }
+func (s *rankedSender) LimitHit() bool     { return s.sender.LimitHit() }
+
+func (s *rankedSender) LimitReasons() []protocol.LimitReason { return s.sender.LimitReasons() }
+
+func (s *rankedSender) Scanned(n, total int)         { s.sender.Scanned(n, total) }
+func (s *rankedSender) ScannedCount() (n, total int) { return s.sender.ScannedCount() }
+
+// Remaining is the limit of the underlying sender, since any match may rank
+// better than the ones collected so far.
+func (s *rankedSender) Remaining() int { return s.limit }
+
+func (s *rankedSender) RemainingBytes() int { return s.sender.RemainingBytes() }
@@ -0,0 +1,70 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+)
+
+func TestRankedSender(t *testing.T) {
+	zf := &store.ZipFile{Files: []store.SrcFile{
+		{Name: "a/b/c/foo.go", Len: 10, ModTime: 3},
+		{Name: "a/bar.go", Len: 100, ModTime: 1},
+		{Name: "baz.go", Len: 1000, ModTime: 2},
+		{Name: "a/foo.go", Len: 1000, ModTime: 0},
+	}}
+	matches := []protocol.FileMatch{
+		{Path: "a/b/c/foo.go", MatchCount: 1},
+		{Path: "a/bar.go", MatchCount: 2},
+		{Path: "baz.go", MatchCount: 3},
+		{Path: "a/foo.go", MatchCount: 1},
+	}
+
+	rg, err := compile(&protocol.PatternInfo{Pattern: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ranking  protocol.Ranking
+		limit    int
+		maxFiles int
+		want     []string
+		limitHit bool
+	}{
+		{ranking: protocol.RankingPath, limit: 100, want: []string{"a/foo.go", "a/b/c/foo.go", "baz.go", "a/bar.go"}},
+		{ranking: protocol.RankingPath, limit: 2, want: []string{"a/foo.go", "a/b/c/foo.go"}, limitHit: true},
+		{ranking: protocol.RankingDensity, limit: 100, want: []string{"a/b/c/foo.go", "a/bar.go", "baz.go", "a/foo.go"}},
+		{ranking: protocol.RankingDensity, limit: 100, maxFiles: 1, want: []string{"a/b/c/foo.go"}, limitHit: true},
+		{ranking: protocol.RankingRecency, limit: 4, want: []string{"a/b/c/foo.go", "baz.go"}, limitHit: true},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.ranking), func(t *testing.T) {
+			var got []string
+			_, cancel, stream := newLimitedStream(context.Background(), tc.limit, requestLimits{maxFileMatches: tc.maxFiles}, func(fm protocol.FileMatch) {
+				got = append(got, fm.Path)
+			})
+			defer cancel()
+
+			s := newRankedSender(tc.ranking, zf, rg, stream, tc.maxFiles)
+			for _, fm := range matches {
+				s.Send(fm)
+			}
+			if len(got) != 0 {
+				t.Fatal("matches sent before flush")
+			}
+			s.flush()
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected order (-want +got):\n%s", diff)
+			}
+			if stream.LimitHit() != tc.limitHit {
+				t.Errorf("got limitHit %v, want %v", stream.LimitHit(), tc.limitHit)
+			}
+		})
+	}
+}
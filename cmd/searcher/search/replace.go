@@ -0,0 +1,224 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/errcode"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
+)
+
+// ServeReplace handles HTTP requests to preview replacing the matches of a
+// pattern. It responds with a unified diff per file of what the replacement
+// would produce, so that callers don't have to fetch the files themselves.
+func (s *Service) ServeReplace(w http.ResponseWriter, r *http.Request) {
+	w, closeCompression := negotiateCompression(w, r)
+	defer closeCompression()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	running.Inc()
+	defer running.Dec()
+
+	var p protocol.ReplaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "failed to decode form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if p.Deadline != "" {
+		var deadline time.Time
+		if err := deadline.UnmarshalText([]byte(p.Deadline)); err != nil {
+			http.Error(w, "invalid deadline: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		dctx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		ctx = dctx
+	}
+	if maxTimeout := getTuning().maxTimeout; maxTimeout > 0 {
+		dctx, cancel := context.WithTimeout(ctx, maxTimeout)
+		defer cancel()
+		ctx = dctx
+	}
+
+	// Replacements only apply to file content.
+	p.PatternMatchesContent = true
+	p.PatternMatchesPath = false
+	if err := validateReplaceParams(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.replace(ctx, &p)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errcode.IsBadRequest(err) {
+			code = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.Log.Warn("searcher: failed to write replace response", "error", err)
+	}
+}
+
+func validateReplaceParams(p *protocol.ReplaceRequest) error {
+	if err := validateParams(&p.Request); err != nil {
+		return err
+	}
+	if p.Pattern == "" {
+		return errors.New("Pattern must be non-empty")
+	}
+	if p.IsStructuralPat || p.IsSymbolSearch || p.IsNegated || p.PatternExpr != nil || p.IsTokenMatch {
+		return errors.New("Replacements are not supported for structural, symbol, negated, expression or token patterns")
+	}
+	return nil
+}
+
+func (s *Service) replace(ctx context.Context, p *protocol.ReplaceRequest) (_ *protocol.ReplaceResponse, err error) {
+	span, ctx := ot.StartSpanFromContext(ctx, "Replace")
+	span.SetTag("repo", p.Repo)
+	span.SetTag("commit", p.Commit)
+	span.SetTag("pattern", p.Pattern)
+	span.SetTag("replacement", p.Replacement)
+	defer func() {
+		if err != nil {
+			span.SetTag("err", err.Error())
+		}
+		span.Finish()
+	}()
+
+	limit := p.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	if maxMatches := getTuning().maxMatches; maxMatches > 0 && limit > maxMatches {
+		limit = maxMatches
+	}
+
+	rg, err := compile(&p.PatternInfo)
+	if err != nil {
+		return nil, badRequestError{err.Error()}
+	}
+
+	release, err := quotas.acquire(ctx, p.Repo, getTuning().maxConcurrentSearchesPerRepo)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	_, zf, err := s.getZipFile(ctx, &p.Request)
+	if err != nil {
+		return nil, err
+	}
+	defer zf.Close()
+
+	if p.ExcludeIgnored {
+		rg.ignored = newGitignoreMatcher(zf)
+	}
+	if p.BaseCommit != "" {
+		zf, err = s.changedFilesOnly(ctx, &p.Request, zf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx = withWorkerOptions(ctx, &p.Request)
+	searchCtx, cancel, sender := newLimitedStreamCollector(ctx, limit)
+	defer cancel()
+	if err := regexSearch(searchCtx, rg, zf, limit, true, false, false, sender); err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*store.SrcFile, len(zf.Files))
+	for i := range zf.Files {
+		files[zf.Files[i].Name] = &zf.Files[i]
+	}
+
+	resp := &protocol.ReplaceResponse{LimitHit: sender.LimitHit(), LimitReasons: sender.LimitReasons()}
+	for _, fm := range sender.Collected() {
+		f, ok := files[fm.Path]
+		if !ok {
+			continue
+		}
+		fd, err := rg.replaceDiff(zf, f, p.Replacement, !p.IsRegExp, fm.MatchCount)
+		if err != nil {
+			return nil, err
+		}
+		if fd.Diff != "" {
+			resp.Diffs = append(resp.Diffs, fd)
+		}
+	}
+	sort.Slice(resp.Diffs, func(i, j int) bool {
+		return resp.Diffs[i].Path < resp.Diffs[j].Path
+	})
+	return resp, nil
+}
+
+// replaceDiff returns the diff of replacing at most n matches of rg in f by
+// replacement. If literal is false, replacement is expanded like
+// regexp.Expand.
+func (rg *readerGrep) replaceDiff(zf *store.ZipFile, f *store.SrcFile, replacement string, literal bool, n int) (protocol.FileDiff, error) {
+	data := zf.DataFor(f)
+	fd := protocol.FileDiff{Path: f.Name}
+
+	// Lowercasing preserves byte offsets, so locations found in the buffer
+	// matched against apply to data. Captures are expanded from data to keep
+	// their case.
+	locs := rg.re.FindAllSubmatchIndex(rg.matchBuf(zf, data), n)
+	if len(locs) == 0 {
+		return fd, nil
+	}
+
+	replaced := make([]byte, 0, len(data))
+	last := 0
+	for _, loc := range locs {
+		replaced = append(replaced, data[last:loc[0]]...)
+		if literal {
+			replaced = append(replaced, replacement...)
+		} else {
+			replaced = rg.re.Expand(replaced, []byte(replacement), data, loc)
+		}
+		last = loc[1]
+	}
+	replaced = append(replaced, data[last:]...)
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(string(data)),
+		B:        splitLines(string(replaced)),
+		FromFile: "a/" + f.Name,
+		ToFile:   "b/" + f.Name,
+		Context:  3,
+	})
+	if err != nil {
+		return fd, errors.Wrapf(err, "diffing %s", f.Name)
+	}
+	fd.Diff = diff
+	fd.MatchCount = len(locs)
+	return fd, nil
+}
+
+// splitLines splits s into lines for diffing, keeping the newlines. Unlike
+// difflib.SplitLines it doesn't report an empty last line if s ends with a
+// newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,147 @@
+package search_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/search"
+)
+
+func TestServeReplace(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("Hello world")
+}
+`,
+		"README.md": "Hello world example in go\n",
+	}
+
+	s, cleanup, err := newStore(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	ts := httptest.NewServer(http.HandlerFunc((&search.Service{Store: s}).ServeReplace))
+	defer ts.Close()
+
+	cases := []struct {
+		name string
+		req  protocol.ReplaceRequest
+		want protocol.ReplaceResponse
+	}{{
+		name: "literal",
+		req: protocol.ReplaceRequest{
+			Request: protocol.Request{
+				PatternInfo:  protocol.PatternInfo{Pattern: "hello", IncludePatterns: []string{"README"}, PathPatternsAreRegExps: true},
+				FetchTimeout: "500ms",
+			},
+			Replacement: "Goodbye $1",
+		},
+		want: protocol.ReplaceResponse{Diffs: []protocol.FileDiff{{
+			Path:       "README.md",
+			MatchCount: 1,
+			Diff: `--- a/README.md
++++ b/README.md
+@@ -1 +1 @@
+-Hello world example in go
++Goodbye $1 world example in go
+`,
+		}}},
+	}, {
+		name: "regexp",
+		req: protocol.ReplaceRequest{
+			Request: protocol.Request{
+				PatternInfo:  protocol.PatternInfo{Pattern: `println\((".*")\)`, IsRegExp: true},
+				FetchTimeout: "500ms",
+			},
+			Replacement: "Printf(${1})",
+		},
+		want: protocol.ReplaceResponse{Diffs: []protocol.FileDiff{{
+			Path:       "main.go",
+			MatchCount: 1,
+			Diff: "--- a/main.go\n" +
+				"+++ b/main.go\n" +
+				"@@ -3,5 +3,5 @@\n" +
+				" import \"fmt\"\n" +
+				" \n" +
+				" func main() {\n" +
+				"-\tfmt.Println(\"Hello world\")\n" +
+				"+\tfmt.Printf(\"Hello world\")\n" +
+				" }\n",
+		}}},
+	}, {
+		name: "no matches",
+		req: protocol.ReplaceRequest{
+			Request: protocol.Request{
+				PatternInfo:  protocol.PatternInfo{Pattern: "foo"},
+				FetchTimeout: "500ms",
+			},
+			Replacement: "bar",
+		},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.req.Repo = "foo"
+			tc.req.URL = "u"
+			tc.req.Commit = "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"
+
+			body, err := json.Marshal(&tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("got status %d", resp.StatusCode)
+			}
+
+			var got protocol.ReplaceResponse
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("unexpected response (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServeReplace_badrequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc((&search.Service{}).ServeReplace))
+	defer ts.Close()
+
+	req := protocol.ReplaceRequest{
+		Request: protocol.Request{
+			Repo:        "foo",
+			Commit:      "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			PatternInfo: protocol.PatternInfo{Pattern: "fmt.Println(:[_])", IsStructuralPat: true},
+		},
+		Replacement: "fmt.Print(:[_])",
+	}
+	body, err := json.Marshal(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,106 @@
+package search
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// repoQuotas limits the number of concurrent searches of each repository, so
+// that a burst of searches of a single large repository can't use up all
+// resources of searcher and starve the searches of other repositories.
+type repoQuotas struct {
+	mu    sync.Mutex
+	repos map[api.RepoName]*repoQuota
+}
+
+type repoQuota struct {
+	running int
+	// released is closed and replaced whenever a search of the repository
+	// finishes, to wake up the searches waiting for the quota.
+	released chan struct{}
+}
+
+var quotas = &repoQuotas{}
+
+// acquire waits until less than limit searches of repo are running and
+// returns a function which must be called once the search is done. A limit
+// less than or equal to zero means unlimited.
+func (q *repoQuotas) acquire(ctx context.Context, repo api.RepoName, limit int) (release func(), err error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	var waitStart time.Time
+	defer func() {
+		if !waitStart.IsZero() {
+			repoQuotaWaiting.Dec()
+			repoQuotaWaitDuration.Observe(time.Since(waitStart).Seconds())
+		}
+	}()
+
+	for {
+		q.mu.Lock()
+		if q.repos == nil {
+			q.repos = make(map[api.RepoName]*repoQuota)
+		}
+		r, ok := q.repos[repo]
+		if !ok {
+			r = &repoQuota{released: make(chan struct{})}
+			q.repos[repo] = r
+		}
+		if r.running < limit {
+			r.running++
+			q.mu.Unlock()
+			return func() { q.release(repo) }, nil
+		}
+		released := r.released
+		q.mu.Unlock()
+
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+			repoQuotaWaiting.Inc()
+			repoQuotaWaits.Inc()
+		}
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (q *repoQuotas) release(repo api.RepoName) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	r := q.repos[repo]
+	r.running--
+	close(r.released)
+	r.released = make(chan struct{})
+	if r.running == 0 {
+		delete(q.repos, repo)
+	}
+}
+
+var (
+	repoQuotaWaiting = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "searcher_service_repo_quota_waiting",
+		Help: "Number of search requests waiting because their repository reached its limit of concurrent searches.",
+	})
+	repoQuotaWaits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "searcher_service_repo_quota_waits_total",
+		Help: "Number of search requests which had to wait because their repository reached its limit of concurrent searches.",
+	})
+	repoQuotaWaitDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "searcher_service_repo_quota_wait_seconds",
+		Help:    "Time search requests waited because their repository reached its limit of concurrent searches.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+)
@@ -0,0 +1,68 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRepoQuotas(t *testing.T) {
+	q := &repoQuotas{}
+	ctx := context.Background()
+
+	releaseA1, err := q.acquire(ctx, "a", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseA2, err := q.acquire(ctx, "a", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Other repositories are not affected by the quota of "a".
+	releaseB, err := q.acquire(ctx, "b", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseB()
+
+	// The third search of "a" waits until another one finishes.
+	acquired := make(chan func())
+	go func() {
+		release, err := q.acquire(ctx, "a", 2)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- release
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired more than the quota")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	releaseA1()
+	releaseA3 := <-acquired
+
+	// Waiting stops when the context is done.
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.acquire(ctx, "a", 2); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	releaseA2()
+	releaseA3()
+	if len(q.repos) != 0 {
+		t.Fatalf("expected no tracked repositories, got %d", len(q.repos))
+	}
+}
+
+func TestRepoQuotas_unlimited(t *testing.T) {
+	q := &repoQuotas{}
+	for i := 0; i < 10; i++ {
+		if _, err := q.acquire(context.Background(), "a", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -19,6 +19,8 @@ import (
 	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	nettrace "golang.org/x/net/trace"
@@ -31,7 +33,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/errcode"
+	"github.com/sourcegraph/sourcegraph/internal/requestid"
 	"github.com/sourcegraph/sourcegraph/internal/search/searcher"
 	streamhttp "github.com/sourcegraph/sourcegraph/internal/search/streaming/http"
 	"github.com/sourcegraph/sourcegraph/internal/store"
@@ -39,24 +43,77 @@ import (
 )
 
 const (
-	// numWorkers is how many concurrent readerGreps run in the case of
-	// regexSearch, and the number of parallel workers in the case of
-	// structuralSearch.
+	// numWorkers is the default number of concurrent readerGreps run in
+	// the case of regexSearch. It can be changed with the SEARCHER_WORKERS
+	// environment variable and the "search.searcher" site configuration.
 	numWorkers = 8
+
+	// matchesFlushInterval is how often buffered matches are sent to the
+	// client while a search is running, so that they can be shown before the
+	// search completes or the buffer fills up.
+	matchesFlushInterval = 100 * time.Millisecond
 )
 
 // Service is the search service. It is an http.Handler.
 type Service struct {
 	Store *store.Store
 	Log   log15.Logger
+
+	// ChangedFiles returns the paths of the files which differ between the
+	// commits base and head of repo. It is required to search requests with
+	// a BaseCommit.
+	ChangedFiles func(ctx context.Context, repo api.RepoName, base, head api.CommitID) ([]string, error)
+
+	// Diff returns the diff between the commits base and head of repo, in
+	// the format of git diff --no-prefix. It is required to search requests
+	// with DiffContent.
+	Diff func(ctx context.Context, repo api.RepoName, base, head api.CommitID) ([]byte, error)
+
+	initOnce sync.Once
+	stopOnce sync.Once
+	stopped  chan struct{} // closed by StopSearches
+}
+
+// StopSearches makes all in-flight searches stop and report the results they
+// found so far as if they had hit their deadline. It is called when searcher
+// shuts down and in-flight searches don't finish within the grace period.
+func (s *Service) StopSearches() {
+	stopped := s.stoppedChan()
+	s.stopOnce.Do(func() { close(stopped) })
+}
+
+func (s *Service) stoppedChan() chan struct{} {
+	s.initOnce.Do(func() { s.stopped = make(chan struct{}) })
+	return s.stopped
+}
+
+func (s *Service) isStopped() bool {
+	select {
+	case <-s.stoppedChan():
+		return true
+	default:
+		return false
+	}
 }
 
 // ServeHTTP handles HTTP based search requests
 func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	w, closeCompression := negotiateCompression(w, r)
+	defer closeCompression()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
 	running.Inc()
 	defer running.Dec()
 
+	go func() {
+		select {
+		case <-s.stoppedChan():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
 	var p protocol.Request
 	dec := json.NewDecoder(r.Body)
 	if err := dec.Decode(&p); err != nil {
@@ -74,6 +131,11 @@ func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		defer cancel()
 		ctx = dctx
 	}
+	if maxTimeout := getTuning().maxTimeout; maxTimeout > 0 {
+		dctx, cancel := context.WithTimeout(ctx, maxTimeout)
+		defer cancel()
+		ctx = dctx
+	}
 	if !p.PatternMatchesContent && !p.PatternMatchesPath {
 		// BACKCOMPAT: Old frontends send neither of these fields, but we still want to
 		// search file content in that case.
@@ -94,37 +156,102 @@ func (s *Service) streamSearch(ctx context.Context, w http.ResponseWriter, p pro
 		// a cancelled context.
 		p.Limit = math.MaxInt32
 	}
+	if maxMatches := getTuning().maxMatches; maxMatches > 0 && p.Limit > maxMatches {
+		p.Limit = maxMatches
+	}
 	eventWriter, err := streamhttp.NewWriter(w)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	var matchesMu sync.Mutex
 	matchesBuf := streamhttp.NewJSONArrayBuf(32*1024, func(data []byte) error {
 		return eventWriter.EventBytes("matches", data)
 	})
 	onMatches := func(match protocol.FileMatch) {
+		match = convertOffsets(match, p.OffsetUnit)
+		matchesMu.Lock()
+		defer matchesMu.Unlock()
 		if err := matchesBuf.Append(match); err != nil {
 			log.Printf("failed appending match to buffer: %s", err)
 		}
 	}
+	flushMatches := func() {
+		matchesMu.Lock()
+		defer matchesMu.Unlock()
+		if err := matchesBuf.Flush(); err != nil {
+			log.Printf("failed to flush matches: %s", err)
+		}
+	}
 
-	ctx, cancel, stream := newLimitedStream(ctx, p.Limit, onMatches)
+	stats := &searchStats{}
+	ctx = withSearchStats(ctx, stats)
+	ctx, cancel, stream := newLimitedStream(ctx, p.Limit, newRequestLimits(&p, getTuning()), onMatches)
 	defer cancel()
 
-	deadlineHit, err := s.search(ctx, &p, stream)
+	// Flush matches periodically while searching. The flusher is stopped
+	// before the done event, which must be the last event written.
+	stopFlusher := make(chan struct{})
+	var flusher sync.WaitGroup
+	flusher.Add(1)
+	go func() {
+		defer flusher.Done()
+		ticker := time.NewTicker(matchesFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				flushMatches()
+			case <-stopFlusher:
+				return
+			}
+		}
+	}()
+
+	var (
+		deadlineHit bool
+		profileID   string
+	)
+	start := time.Now()
+	search := func(ctx context.Context) {
+		deadlineHit, err = s.search(ctx, &p, stream)
+	}
+	if p.Profile {
+		profileID = profiles.capture(ctx, &p, search)
+	} else {
+		search(ctx)
+	}
+
+	if err != nil && ctx.Err() != nil && !stream.LimitHit() && s.isStopped() {
+		// The search was stopped because searcher is shutting down. Report
+		// the results found so far as partial results instead of failing.
+		deadlineHit, err = true, nil
+	}
+
+	limitReasons := stream.LimitReasons()
+	if deadlineHit {
+		limitReasons = protocol.AddLimitReason(limitReasons, protocol.LimitReasonDeadline)
+	}
+
 	doneEvent := searcher.EventDone{
-		DeadlineHit: deadlineHit,
-		LimitHit:    stream.LimitHit(),
+		DeadlineHit:   deadlineHit,
+		LimitHit:      stream.LimitHit(),
+		LimitReasons:  limitReasons,
+		ProfileID:     profileID,
+		FilesTooLarge: stream.TooLargeCount(),
+		Stats:         stats.toProto(time.Since(start)),
 	}
+	doneEvent.FilesScanned, doneEvent.FilesTotal = stream.ScannedCount()
 	if err != nil {
 		doneEvent.Error = err.Error()
 	}
 
+	close(stopFlusher)
+	flusher.Wait()
+
 	// Flush remaining matches before sending a different event
-	if err := matchesBuf.Flush(); err != nil {
-		log.Printf("failed to flush matches: %s", err)
-	}
+	flushMatches()
 	if err := eventWriter.Event("done", doneEvent); err != nil {
 		log.Printf("failed to send done event: %s", err)
 	}
@@ -139,20 +266,38 @@ func (s *Service) search(ctx context.Context, p *protocol.Request, sender matchS
 	span.SetTag("repo", p.Repo)
 	span.SetTag("url", p.URL)
 	span.SetTag("commit", p.Commit)
+	span.SetTag("baseCommit", p.BaseCommit)
 	span.SetTag("pattern", p.Pattern)
 	span.SetTag("isRegExp", strconv.FormatBool(p.IsRegExp))
 	span.SetTag("isStructuralPat", strconv.FormatBool(p.IsStructuralPat))
+	span.SetTag("isSymbolSearch", strconv.FormatBool(p.IsSymbolSearch))
 	span.SetTag("languages", p.Languages)
 	span.SetTag("isWordMatch", strconv.FormatBool(p.IsWordMatch))
 	span.SetTag("isCaseSensitive", strconv.FormatBool(p.IsCaseSensitive))
 	span.SetTag("pathPatternsAreRegExps", strconv.FormatBool(p.PathPatternsAreRegExps))
 	span.SetTag("pathPatternsAreCaseSensitive", strconv.FormatBool(p.PathPatternsAreCaseSensitive))
 	span.SetTag("limit", p.Limit)
+	span.SetTag("maxFileMatches", p.MaxFileMatches)
+	span.SetTag("maxLineMatches", p.MaxLineMatches)
+	span.SetTag("maxLineSize", p.MaxLineSize)
+	span.SetTag("maxFileSizeBytes", p.MaxFileSizeBytes)
+	span.SetTag("ranking", string(p.Ranking))
 	span.SetTag("patternMatchesContent", p.PatternMatchesContent)
 	span.SetTag("patternMatchesPath", p.PatternMatchesPath)
 	span.SetTag("deadline", p.Deadline)
 	span.SetTag("indexerEndpoints", p.IndexerEndpoints)
 	span.SetTag("select", p.Select)
+	span.SetTag("profile", p.Profile)
+	span.SetTag("workers", p.Workers)
+	span.SetTag("priority", string(p.Priority))
+
+	// The statistics of the search are logged on its span, so that a slow
+	// search can be attributed to fetching or searching.
+	stats := searchStatsFromContext(ctx)
+	ctx = withSearchStats(ctx, stats)
+	if ot.ShouldTrace(ctx) {
+		stats.slowest = &slowestFiles{}
+	}
 	defer func(start time.Time) {
 		code := "200"
 		// We often have canceled and timed out requests. We do not want to
@@ -183,13 +328,40 @@ func (s *Service) search(ctx context.Context, p *protocol.Request, sender matchS
 		requestTotal.WithLabelValues(code).Inc()
 		span.LogFields(otlog.Int("matches.len", sender.SentCount()))
 		span.SetTag("limitHit", sender.LimitHit())
+		span.SetTag("filesTooLarge", sender.TooLargeCount())
+		if scanned, total := sender.ScannedCount(); scanned < total {
+			span.LogFields(otlog.Int("filesScanned", scanned), otlog.Int("filesTotal", total))
+		}
 		span.SetTag("deadlineHit", deadlineHit)
+		if reasons := sender.LimitReasons(); len(reasons) > 0 {
+			span.SetTag("limitReasons", fmt.Sprint(reasons))
+		}
+		span.LogFields(
+			otlog.String("fetchDuration", stats.fetchTime.Load().String()),
+			otlog.String("searchCPUDuration", stats.cpuTime.Load().String()),
+			otlog.Int64("filesSearched", stats.filesSearched.Load()),
+			otlog.Int64("bytesSearched", stats.bytesSearched.Load()))
+		if stats.slowest != nil {
+			span.LogFields(otlog.String("slowestFiles", stats.slowest.String()))
+		}
 		span.Finish()
 		if s.Log != nil {
-			s.Log.Debug("search request", "repo", p.Repo, "commit", p.Commit, "pattern", p.Pattern, "isRegExp", p.IsRegExp, "isStructuralPat", p.IsStructuralPat, "languages", p.Languages, "isWordMatch", p.IsWordMatch, "isCaseSensitive", p.IsCaseSensitive, "patternMatchesContent", p.PatternMatchesContent, "patternMatchesPath", p.PatternMatchesPath, "matches", sender.SentCount(), "code", code, "duration", time.Since(start), "indexerEndpoints", p.IndexerEndpoints, "err", err)
+			s.Log.Debug("search request", "repo", p.Repo, "commit", p.Commit, "pattern", p.Pattern, "isRegExp", p.IsRegExp, "isStructuralPat", p.IsStructuralPat, "languages", p.Languages, "isWordMatch", p.IsWordMatch, "isCaseSensitive", p.IsCaseSensitive, "patternMatchesContent", p.PatternMatchesContent, "patternMatchesPath", p.PatternMatchesPath, "matches", sender.SentCount(), "code", code, "duration", time.Since(start), "indexerEndpoints", p.IndexerEndpoints, "requestID", requestid.FromContext(ctx), "err", err)
 		}
 	}(time.Now())
 
+	// Wait for our turn if the repository already has its maximum number of
+	// concurrent searches.
+	waitStart := time.Now()
+	release, err := quotas.acquire(ctx, p.Repo, getTuning().maxConcurrentSearchesPerRepo)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	span.LogFields(otlog.String("repoQuotaWait", time.Since(waitStart).String()))
+
+	ctx = withWorkerOptions(ctx, p)
+
 	if p.IsStructuralPat && p.Indexed {
 		// Execute the new structural search path that directly calls Zoekt.
 		// TODO use limit in indexed structural search
@@ -203,47 +375,139 @@ func (s *Service) search(ctx context.Context, p *protocol.Request, sender matchS
 		if err != nil {
 			return false, badRequestError{err.Error()}
 		}
+		rg.chunkMatches = p.ProtocolVersion == protocol.ProtocolVersionChunkMatches
 	}
 
-	if p.FetchTimeout == "" {
-		p.FetchTimeout = "500ms"
-	}
-	fetchTimeout, err := time.ParseDuration(p.FetchTimeout)
+	fetchStart := time.Now()
+	zipPath, zf, err := s.getZipFile(ctx, p)
+	stats.fetchTime.Store(time.Since(fetchStart))
 	if err != nil {
 		return false, err
 	}
+	defer zf.Close()
+
+	nFiles := uint64(len(zf.Files))
+	bytes := int64(len(zf.Data))
+	tr.LazyPrintf("files=%d bytes=%d", nFiles, bytes)
+	span.LogFields(
+		otlog.Uint64("archive.files", nFiles),
+		otlog.Int64("archive.size", bytes))
+	archiveFiles.Observe(float64(nFiles))
+	archiveSize.Observe(float64(bytes))
+
+	if rg != nil && p.ExcludeIgnored {
+		rg.ignored = newGitignoreMatcher(zf)
+	}
+
+	if !p.IncludeArchiveMembers && s.Store.MaxArchiveDepth > 0 {
+		zf = withoutArchiveMembers(zf)
+	}
+
+	searchSender := sender
+	if p.DiffContent {
+		// The .gitignore files are read from the whole archive above.
+		diff, err := s.diffContent(ctx, p)
+		if err != nil {
+			return false, err
+		}
+		zf = diff.zf
+		searchSender = &diffSender{matchSender: sender, diff: diff}
+		span.LogFields(otlog.Int("changedFiles", len(zf.Files)))
+	} else if p.BaseCommit != "" {
+		// The .gitignore files are read from the whole archive above, since
+		// they may not have changed.
+		zf, err = s.changedFilesOnly(ctx, p, zf)
+		if err != nil {
+			return false, err
+		}
+		span.LogFields(otlog.Int("changedFiles", len(zf.Files)))
+	}
+
+	if p.CollapseDuplicates && rg != nil {
+		var duplicates map[string][]string
+		n := len(zf.Files)
+		zf, duplicates = collapseDuplicates(rg, zf)
+		searchSender = &duplicatesSender{matchSender: searchSender, duplicates: duplicates}
+		span.LogFields(otlog.Int("duplicateFiles", n-len(zf.Files)))
+	}
+
+	if p.IncludeContent {
+		searchSender = newContentSender(searchSender, zf, newRequestLimits(p, getTuning()).maxContentSize)
+	}
+
+	if p.Ranking != protocol.RankingNone {
+		// Matches are only sent once all files are searched, in ranked order.
+		ranked := newRankedSender(p.Ranking, zf, rg, searchSender, newRequestLimits(p, getTuning()).maxFileMatches)
+		defer ranked.flush()
+		searchSender = ranked
+	}
+
+	matchStart := time.Now()
+	switch {
+	case p.IsSymbolSearch:
+		err = symbolSearch(ctx, rg, zf, searchSender)
+	case p.IsStructuralPat:
+		if !s.Store.ReadableArchives() {
+			zipPath = ""
+		}
+		err = filteredStructuralSearch(ctx, zipPath, zf, &p.PatternInfo, p.Repo, searchSender)
+	default:
+		err = regexSearch(ctx, rg, zf, p.Limit, p.PatternMatchesContent, p.PatternMatchesPath, p.IsNegated, searchSender)
+	}
+	span.LogFields(otlog.String("matchDuration", time.Since(matchStart).String()))
+	if errors.Is(err, context.DeadlineExceeded) {
+		// The search stopped early to finish before the deadline. The
+		// matches sent so far are partial results rather than a failure.
+		return true, nil
+	}
+	return false, err
+}
+
+// getZipFile fetches the archive of the repository at the commit requested
+// by p, waiting at most for the fetch timeout of p.
+func (s *Service) getZipFile(ctx context.Context, p *protocol.Request) (string, *store.ZipFile, error) {
+	fetchTimeout := getTuning().fetchTimeout
+	if p.FetchTimeout != "" {
+		var err error
+		fetchTimeout, err = time.ParseDuration(p.FetchTimeout)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	span, ctx := ot.StartSpanFromContext(ctx, "GetZipFile")
+	ext.Component.Set(span, "service")
+	span.SetTag("fetchTimeout", fetchTimeout.String())
+	attempts := 0
+	defer func() {
+		span.LogFields(otlog.Int("attempts", attempts))
+		span.Finish()
+	}()
+
 	prepareCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
 	defer cancel()
+	prepareCtx = withIndexerEndpoints(prepareCtx, p.IndexerEndpoints)
+	if p.IncludeSubmodules {
+		prepareCtx = store.WithSubmodules(prepareCtx)
+	}
 
 	getZf := func() (string, *store.ZipFile, error) {
+		attempts++
 		path, err := s.Store.PrepareZip(prepareCtx, p.Repo, p.Commit)
 		if err != nil {
 			return "", nil, err
 		}
-		zf, err := s.Store.ZipCache.Get(path)
+		zf, err := s.Store.ZipCache.Get(ctx, path)
 		return path, zf, err
 	}
 
 	zipPath, zf, err := store.GetZipFileWithRetry(getZf)
 	if err != nil {
-		return false, errors.Wrap(err, "failed to get archive")
-	}
-	defer zf.Close()
-
-	nFiles := uint64(len(zf.Files))
-	bytes := int64(len(zf.Data))
-	tr.LazyPrintf("files=%d bytes=%d", nFiles, bytes)
-	span.LogFields(
-		otlog.Uint64("archive.files", nFiles),
-		otlog.Int64("archive.size", bytes))
-	archiveFiles.Observe(float64(nFiles))
-	archiveSize.Observe(float64(bytes))
-
-	if p.IsStructuralPat {
-		return false, filteredStructuralSearch(ctx, zipPath, zf, &p.PatternInfo, p.Repo, sender)
-	} else {
-		return false, regexSearch(ctx, rg, zf, p.Limit, p.PatternMatchesContent, p.PatternMatchesPath, p.IsNegated, sender)
+		ext.Error.Set(span, true)
+		span.SetTag("err", err.Error())
+		return "", nil, errors.Wrap(err, "failed to get archive")
 	}
+	return zipPath, zf, nil
 }
 
 func validateParams(p *protocol.Request) error {
@@ -254,12 +518,63 @@ func validateParams(p *protocol.Request) error {
 	if len(p.Commit) != 40 {
 		return errors.Errorf("Commit must be resolved (Commit=%q)", p.Commit)
 	}
-	if p.Pattern == "" && p.ExcludePattern == "" && len(p.IncludePatterns) == 0 {
+	if p.Pattern == "" && p.PatternExpr == nil && p.ExcludePattern == "" && len(p.IncludePatterns) == 0 {
 		return errors.New("At least one of pattern and include/exclude pattners must be non-empty")
 	}
 	if p.IsNegated && p.IsStructuralPat {
 		return errors.New("Negated patterns are not supported for structural searches")
 	}
+	if p.PatternExpr != nil && p.IsStructuralPat {
+		return errors.New("Pattern expressions are not supported for structural searches")
+	}
+	if p.ExcludeContentPattern != "" && p.IsStructuralPat {
+		return errors.New("Exclude content patterns are not supported for structural searches")
+	}
+	switch p.OffsetUnit {
+	case protocol.OffsetUnitRunes, protocol.OffsetUnitUTF16, protocol.OffsetUnitBytes:
+	default:
+		return errors.Errorf("Unknown offset unit %q", p.OffsetUnit)
+	}
+	switch p.Ranking {
+	case protocol.RankingNone, protocol.RankingPath, protocol.RankingDensity, protocol.RankingRecency:
+	default:
+		return errors.Errorf("Unknown ranking %q", p.Ranking)
+	}
+	switch p.ProtocolVersion {
+	case protocol.ProtocolVersionLineMatches:
+	case protocol.ProtocolVersionChunkMatches:
+		if p.IsStructuralPat || p.IsSymbolSearch || p.DiffContent || p.IncludeCaptureGroups {
+			return errors.New("ChunkMatches are not supported for structural, symbol, diff content and capture group searches")
+		}
+	default:
+		return errors.Errorf("Unknown protocol version %d", p.ProtocolVersion)
+	}
+	switch p.Priority {
+	case protocol.PriorityInteractive, protocol.PriorityBatch:
+	default:
+		return errors.Errorf("Unknown priority %q", p.Priority)
+	}
+	if p.BaseCommit != "" && (len(p.BaseCommit) != 40 || strings.Trim(string(p.BaseCommit), "0123456789abcdef") != "") {
+		return errors.Errorf("BaseCommit must be resolved (BaseCommit=%q)", p.BaseCommit)
+	}
+	if p.BaseCommit != "" && p.IsStructuralPat && p.Indexed {
+		return errors.New("BaseCommit is not supported for indexed structural searches")
+	}
+	if p.CollapseDuplicates && p.IsStructuralPat {
+		return errors.New("CollapseDuplicates is not supported for structural searches")
+	}
+	if p.DiffContent && (p.BaseCommit == "" || p.IsStructuralPat || p.IsSymbolSearch) {
+		return errors.New("DiffContent requires BaseCommit and is not supported for structural and symbol searches")
+	}
+	if p.IncludeContent && p.DiffContent {
+		return errors.New("IncludeContent is not supported for diff content searches")
+	}
+	if p.IsTokenMatch && (p.IsRegExp || p.IsStructuralPat || p.IsSymbolSearch || p.IsNegated || p.PatternExpr != nil) {
+		return errors.New("Token matches do not support regular expression, structural, symbol, negated or expression patterns")
+	}
+	if p.IsSymbolSearch && (p.IsStructuralPat || p.IsNegated || p.PatternExpr != nil) {
+		return errors.New("Symbol searches do not support structural, negated or expression patterns")
+	}
 	return nil
 }
 
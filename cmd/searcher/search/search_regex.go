@@ -16,6 +16,7 @@ import (
 	otlog "github.com/opentracing/opentracing-go/log"
 	"go.uber.org/atomic"
 	"golang.org/x/sync/errgroup"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
 
 	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/pathmatch"
@@ -38,12 +39,18 @@ import (
 //
 // If there is no more low-hanging fruit and perf is not acceptable, we could
 // consider using ripgrep directly (modify it to search zip archives).
-//
-// TODO(keegan) return search statistics
 type readerGrep struct {
 	// re is the regexp to match, or nil if empty ("match all files' content").
 	re *regexp.Regexp
 
+	// expr is the boolean expression of regexps to match. It is set instead of
+	// re if the request has a PatternExpr.
+	expr *exprMatcher
+
+	// excludeRe is the regexp the content of matching files may not match,
+	// or nil.
+	excludeRe *regexp.Regexp
+
 	// ignoreCase if true means we need to do case insensitive matching.
 	ignoreCase bool
 
@@ -57,59 +64,172 @@ type readerGrep struct {
 	// whether a file path matches (and should be searched).
 	matchPath pathmatch.PathMatcher
 
-	// literalSubstring is used to test if a file is worth considering for
-	// matches. literalSubstring is guaranteed to appear in any match found by
-	// re. It is the output of the longestLiteral function. It is only set if
+	// ignored if non-nil matches the paths ignored by .gitignore files, which
+	// are excluded from the search.
+	ignored gitignore.Matcher
+
+	// excludeVendored if true excludes vendored and generated files from the
+	// search.
+	excludeVendored bool
+
+	// maxFileSize if positive is the size of the largest file to search.
+	maxFileSize int64
+
+	// languages if non-nil restricts the search to the files written in one
+	// of its languages.
+	languages languageMatcher
+
+	// literals are used to test if a file is worth considering for matches.
+	// At least one of literals is guaranteed to appear in any match found by
+	// re. It is the output of the requiredLiterals function. It is only set if
 	// the regex has an empty LiteralPrefix.
-	literalSubstring []byte
+	literals [][]byte
+
+	// indexLiterals are the output of requiredLiterals regardless of the
+	// LiteralPrefix of re. They select the files to search with the trigram
+	// index of an archive.
+	indexLiterals [][]byte
+
+	// captureGroups is true if the offsets of the capture groups of re are
+	// returned for each match.
+	captureGroups bool
+
+	// chunkMatches is true if matches are returned as ChunkMatches instead
+	// of LineMatches.
+	chunkMatches bool
+
+	// lineLocal is true if matches of re never span multiple lines. If
+	// literals is set, we then only need to run re on the lines containing
+	// one of literals.
+	lineLocal bool
+
+	// leadingIdentChars and trailingIdentChars are the characters which may
+	// not precede and follow a word match of re, since they are part of
+	// identifiers in the languages searched.
+	leadingIdentChars, trailingIdentChars string
+
+	// spanLines is the maximum number of newlines in a match of re, or -1 if
+	// it is unbounded or matches depend on the start or end of the text. If
+	// it is not -1 we can search large files in chunks of lines.
+	spanLines int
+
+	// stats, if non-nil, accumulates statistics about the files searched. It
+	// is only set when the search is traced, since timing every file has a
+	// cost.
+	stats *findStats
+
+	// tokens if non-nil is used instead of re to match the lines which
+	// contain all tokens of the pattern.
+	tokens *tokenMatcher
+
+	// searchStats, if non-nil, counts the files rejected by literals.
+	searchStats *searchStats
+
+	// maxPreviewBytes if positive makes find stop once the previews of the
+	// matches of a file are larger, so that files matching on nearly every
+	// line don't exhaust memory before the sender enforces its budget.
+	maxPreviewBytes int
+}
+
+// findStats are the statistics of the files searched by a readerGrep, which
+// are recorded on the span of a search worker.
+type findStats struct {
+	bytes     int
+	lowercase time.Duration
+	match     time.Duration
 }
 
 // compile returns a readerGrep for matching p.
 func compile(p *protocol.PatternInfo) (*readerGrep, error) {
 	var (
-		re               *regexp.Regexp
-		literalSubstring []byte
+		re            *regexp.Regexp
+		literals      [][]byte
+		indexLiterals [][]byte
+		lineLocal     bool
+		spanLines     int
+
+		leadingIdentChars, trailingIdentChars string
 	)
-	if p.Pattern != "" {
-		expr := p.Pattern
-		if !p.IsRegExp {
-			expr = regexp.QuoteMeta(expr)
+	var tokens *tokenMatcher
+	if p.IsTokenMatch {
+		var err error
+		tokens, err = compileTokens(p)
+		if err != nil {
+			return nil, err
 		}
-		if p.IsWordMatch {
-			expr = `\b` + expr + `\b`
+		// Every matching file contains the longest token.
+		indexLiterals = tokens.literals[:1]
+	} else if p.Pattern != "" {
+		expr, err := patternExpr(p.Pattern, p)
+		if err != nil {
+			return nil, err
 		}
-		if p.IsRegExp {
-			// We don't do the search line by line, therefore we want the
-			// regex engine to consider newlines for anchors (^$).
-			expr = "(?m:" + expr + ")"
-		}
-		if !p.IsCaseSensitive {
-			// We don't just use (?i) because regexp library doesn't seem
-			// to contain good optimizations for case insensitive
-			// search. Instead we lowercase the input and pattern.
-			re, err := syntax.Parse(expr, syntax.Perl)
-			if err != nil {
-				return nil, err
+
+		re, err = regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		ast, err := syntax.Parse(expr, syntax.Perl)
+		if err != nil {
+			return nil, err
+		}
+		ast = ast.Simplify()
+		for _, lit := range requiredLiterals(ast) {
+			indexLiterals = append(indexLiterals, []byte(lit))
+		}
+
+		lineLocal = isLineLocal(ast)
+		spanLines = maxNewlines(ast)
+
+		if p.IsWordMatch {
+			leading, trailing := languageIdentifierChars(p.Languages)
+			start, end := wordBoundaries(p.Pattern, p.IsRegExp)
+			if start {
+				leadingIdentChars = leading
+			}
+			if end {
+				trailingIdentChars = trailing
 			}
-			casetransform.LowerRegexpASCII(re)
-			expr = re.String()
 		}
 
+		// Only use literals optimization if the regex engine doesn't have a
+		// prefix to use.
+		if pre, _ := re.LiteralPrefix(); pre == "" {
+			literals = indexLiterals
+		}
+	}
+
+	var expr *exprMatcher
+	if p.PatternExpr != nil {
+		if p.Pattern != "" {
+			return nil, errors.New("Pattern must be empty if PatternExpr is set")
+		}
 		var err error
-		re, err = regexp.Compile(expr)
+		expr, err = compileExpr(p.PatternExpr, p)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		// Only use literalSubstring optimization if the regex engine doesn't
-		// have a prefix to use.
-		if pre, _ := re.LiteralPrefix(); pre == "" {
-			ast, err := syntax.Parse(expr, syntax.Perl)
-			if err != nil {
-				return nil, err
-			}
-			ast = ast.Simplify()
-			literalSubstring = []byte(longestLiteral(ast))
+	var excludeRe *regexp.Regexp
+	if p.ExcludeContentPattern != "" {
+		expr, err := patternExpr(p.ExcludeContentPattern, p)
+		if err != nil {
+			return nil, err
+		}
+		excludeRe, err = regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var languages languageMatcher
+	if len(p.Languages) > 0 {
+		var err error
+		languages, err = newLanguageMatcher(p.Languages)
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -123,56 +243,156 @@ func compile(p *protocol.PatternInfo) (*readerGrep, error) {
 	}
 
 	return &readerGrep{
-		re:               re,
-		ignoreCase:       !p.IsCaseSensitive,
-		matchPath:        matchPath,
-		literalSubstring: literalSubstring,
+		re:         re,
+		expr:       expr,
+		tokens:     tokens,
+		excludeRe:  excludeRe,
+		ignoreCase: !p.IsCaseSensitive,
+		matchPath:  matchPath,
+		literals:   literals,
+		lineLocal:  lineLocal,
+		spanLines:  spanLines,
+
+		leadingIdentChars:  leadingIdentChars,
+		trailingIdentChars: trailingIdentChars,
+
+		indexLiterals:   indexLiterals,
+		captureGroups:   p.IncludeCaptureGroups && re != nil && re.NumSubexp() > 0,
+		excludeVendored: p.ExcludeVendored,
+		languages:       languages,
+		maxFileSize:     p.MaxFileSizeBytes,
 	}, nil
 }
 
+// patternExpr returns the regular expression syntax for matching pattern
+// with the options of p. If p is case insensitive the expression is
+// lowercased, since we lowercase the input instead of using (?i).
+func patternExpr(pattern string, p *protocol.PatternInfo) (string, error) {
+	expr := pattern
+	if !p.IsRegExp {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if p.IsWordMatch {
+		start, end := wordBoundaries(pattern, p.IsRegExp)
+		if p.IsRegExp {
+			expr = "(?:" + expr + ")"
+		}
+		if start {
+			expr = `\b` + expr
+		}
+		if end {
+			expr += `\b`
+		}
+	}
+	if p.IsRegExp {
+		// We don't do the search line by line, therefore we want the
+		// regex engine to consider newlines for anchors (^$).
+		expr = "(?m:" + expr + ")"
+	}
+	if !p.IsCaseSensitive {
+		// We don't just use (?i) because regexp library doesn't seem
+		// to contain good optimizations for case insensitive
+		// search. Instead we lowercase the input and pattern.
+		re, err := syntax.Parse(expr, syntax.Perl)
+		if err != nil {
+			return "", err
+		}
+		casetransform.LowerRegexpASCII(re)
+		expr = re.String()
+	}
+	return expr, nil
+}
+
 // Copy returns a copied version of rg that is safe to use from another
 // goroutine.
 func (rg *readerGrep) Copy() *readerGrep {
 	return &readerGrep{
-		re:               rg.re,
-		ignoreCase:       rg.ignoreCase,
-		matchPath:        rg.matchPath,
-		literalSubstring: rg.literalSubstring,
+		re:         rg.re,
+		expr:       rg.expr,
+		tokens:     rg.tokens,
+		excludeRe:  rg.excludeRe,
+		ignoreCase: rg.ignoreCase,
+		matchPath:  rg.matchPath,
+		literals:   rg.literals,
+		lineLocal:  rg.lineLocal,
+		spanLines:  rg.spanLines,
+
+		leadingIdentChars:  rg.leadingIdentChars,
+		trailingIdentChars: rg.trailingIdentChars,
+
+		indexLiterals:   rg.indexLiterals,
+		captureGroups:   rg.captureGroups,
+		chunkMatches:    rg.chunkMatches,
+		ignored:         rg.ignored,
+		excludeVendored: rg.excludeVendored,
+		languages:       rg.languages,
+		maxFileSize:     rg.maxFileSize,
 	}
 }
 
+// skipFile returns whether f is excluded from the search because it is ignored
+// by a .gitignore file, vendored or not written in one of rg.languages.
+func (rg *readerGrep) skipFile(zf *store.ZipFile, f *store.SrcFile) bool {
+	if rg.ignored != nil && isIgnored(rg.ignored, f.Name) {
+		return true
+	}
+	if rg.excludeVendored && isVendored(zf, f) {
+		return true
+	}
+	return rg.languages != nil && !rg.languages.Match(f.Name, zf.DataFor(f))
+}
+
 // matchString returns whether rg's regexp pattern matches s. It is intended to be
 // used to match file paths.
 func (rg *readerGrep) matchString(s string) bool {
-	if rg.re == nil {
+	if rg.re == nil && rg.expr == nil && rg.tokens == nil {
 		return true
 	}
 	if rg.ignoreCase {
 		s = strings.ToLower(s)
 	}
+	if rg.tokens != nil {
+		return rg.tokens.matchString(s)
+	}
+	if rg.expr != nil {
+		return rg.expr.match(func(re *regexp.Regexp) bool { return re.MatchString(s) })
+	}
 	return rg.re.MatchString(s)
 }
 
 // Find returns a LineMatch for each line that matches rg in reader.
 // LimitHit is true if some matches may not have been included in the result.
 // NOTE: This is not safe to use concurrently.
-func (rg *readerGrep) Find(zf *store.ZipFile, f *store.SrcFile, limit int) (matches []protocol.LineMatch, err error) {
+func (rg *readerGrep) Find(ctx context.Context, zf *store.ZipFile, f *store.SrcFile, limit int) (matches []protocol.LineMatch, err error) {
+	matches, _, _, _, err = rg.find(ctx, zf, f, limit)
+	return matches, err
+}
+
+// find is like Find, but additionally reports whether f matched and whether
+// f was excluded because its content matches rg.excludeRe. A file can match
+// without any LineMatch if rg.expr only holds because of negated patterns.
+// If rg.chunkMatches is set the matches are returned as chunks instead of
+// LineMatches. It returns the error of ctx if ctx is done before f is
+// searched.
+func (rg *readerGrep) find(ctx context.Context, zf *store.ZipFile, f *store.SrcFile, limit int) (matches []protocol.LineMatch, chunks []protocol.ChunkMatch, matched, excluded bool, err error) {
 	// fileMatchBuf is what we run match on, fileBuf is the original
-	// data (for Preview).
-	fileBuf := zf.DataFor(f)
-	fileMatchBuf := fileBuf
-
-	// If we are ignoring case, we transform the input instead of
-	// relying on the regular expression engine which can be
-	// slow. compile has already lowercased the pattern. We also
-	// trade some correctness for perf by using a non-utf8 aware
-	// lowercase function.
-	if rg.ignoreCase {
-		if rg.transformBuf == nil {
-			rg.transformBuf = make([]byte, zf.MaxLen)
-		}
-		fileMatchBuf = rg.transformBuf[:len(fileBuf)]
-		casetransform.BytesToLowerASCII(fileMatchBuf, fileBuf)
+	// data (for Preview) decoded to UTF-8.
+	fileBuf := decodeFile(zf.DataFor(f))
+	fileMatchBuf := rg.matchBuf(zf, fileBuf)
+
+	if rg.stats != nil {
+		rg.stats.bytes += len(fileBuf)
+		start := time.Now()
+		defer func() { rg.stats.match += time.Since(start) }()
+	}
+	return rg.findBuf(ctx, fileBuf, fileMatchBuf, limit)
+}
+
+// findBuf is like find, for a file whose decoded content is fileBuf and
+// fileMatchBuf is fileBuf as returned by matchBuf.
+func (rg *readerGrep) findBuf(ctx context.Context, fileBuf, fileMatchBuf []byte, limit int) (matches []protocol.LineMatch, chunks []protocol.ChunkMatch, matched, excluded bool, err error) {
+	if rg.excludeRe != nil && rg.excludeRe.Match(fileMatchBuf) {
+		return nil, nil, false, true, nil
 	}
 
 	// Most files will not have a match and we bound the number of matched
@@ -180,21 +400,57 @@ func (rg *readerGrep) Find(zf *store.ZipFile, f *store.SrcFile, limit int) (matc
 	// and repeatedly running the regex engine by running a single match over
 	// the whole file. This does mean we duplicate work when actually
 	// searching for results. We use the same approach when we search
-	// per-line. Additionally if we have a non-empty literalSubstring, we use
-	// that to prune out files since doing bytes.Index is very fast.
-	if !bytes.Contains(fileMatchBuf, rg.literalSubstring) {
-		return nil, nil
+	// per-line. Additionally if we have literals, we use them to prune out
+	// files since doing bytes.Index is very fast. If matches can't span
+	// lines, findLineLocal does the pruning line by line instead.
+	if (len(rg.literals) > 0 && !rg.lineLocal && !containsAny(fileMatchBuf, rg.literals)) ||
+		(rg.tokens != nil && !containsAll(fileMatchBuf, rg.tokens.literals)) {
+		if rg.searchStats != nil {
+			rg.searchStats.filesPrefiltered.Inc()
+		}
+		return nil, nil, false, false, nil
 	}
 
 	// find limit+1 matches so we know whether we hit the limit
-	locs := rg.re.FindAllIndex(fileMatchBuf, limit+1)
+	var locs [][]int
+	if rg.expr != nil {
+		if !rg.expr.match(func(re *regexp.Regexp) bool { return re.Match(fileMatchBuf) }) {
+			return nil, nil, false, false, nil
+		}
+		matched = true
+		locs = rg.expr.findAllIndex(fileMatchBuf, limit+1)
+	} else if rg.tokens != nil {
+		locs, err = rg.tokens.findAllIndex(ctx, fileMatchBuf, limit+1)
+	} else if len(rg.literals) > 0 && rg.lineLocal {
+		locs, err = rg.findLineLocal(ctx, fileMatchBuf, limit+1)
+	} else {
+		locs, err = rg.findAllChunked(ctx, fileMatchBuf, limit+1)
+	}
+	if err != nil {
+		return nil, nil, false, false, err
+	}
 	lastStart := 0
 	lastLineNumber := 0
 	lastMatchIndex := 0
 	lastLineStartIndex := 0
+	previewBytes, previewed := 0, 0
 
+	var cb *chunkBuilder
+	if rg.chunkMatches {
+		cb = newChunkBuilder(fileBuf)
+	}
 	for _, match := range locs {
 		start, end := match[0], match[1]
+		if !rg.atIdentifierBoundary(fileMatchBuf, start, end) {
+			continue
+		}
+		if cb != nil {
+			cb.add(start, end)
+			if rg.maxPreviewBytes > 0 && cb.size > rg.maxPreviewBytes {
+				break
+			}
+			continue
+		}
 		lineStart := lastLineStartIndex
 		if idx := bytes.LastIndex(fileMatchBuf[lastStart:start], []byte{'\n'}); idx >= 0 {
 			lineStart = lastStart + idx + 1
@@ -218,9 +474,225 @@ func (rg *readerGrep) Find(zf *store.ZipFile, f *store.SrcFile, limit int) (matc
 
 		lastMatchIndex = matchIndex
 		lastLineNumber = lineNumber
+
+		// first is the index of the LineMatch of the first line of the
+		// match, entry the index of the match in its OffsetAndLengths.
+		first, entry := len(matches), 0
+		if n := len(matches); n > 0 && matches[n-1].LineNumber == lineNumber {
+			first, entry = n-1, len(matches[n-1].OffsetAndLengths)
+		}
 		matches = appendMatches(matches, fileBuf[lineStart:lineEnd], fileMatchBuf[lineStart:lineEnd], lineNumber, start-lineStart, end-lineStart)
+		if rg.captureGroups && first < len(matches) {
+			for i := first; i < len(matches); i++ {
+				for len(matches[i].CaptureGroups) < len(matches[i].OffsetAndLengths) {
+					matches[i].CaptureGroups = append(matches[i].CaptureGroups, nil)
+				}
+			}
+			matches[first].CaptureGroups[entry] = captureGroups(fileBuf[lineStart:lineEnd], match[2:], lineStart)
+		}
+
+		if rg.maxPreviewBytes > 0 {
+			for _, lm := range matches[previewed:] {
+				previewBytes += len(lm.Preview)
+			}
+			previewed = len(matches)
+			if previewBytes > rg.maxPreviewBytes {
+				break
+			}
+		}
+	}
+	if cb != nil {
+		chunks = cb.build()
+	}
+	return matches, chunks, matched || len(matches) > 0 || len(chunks) > 0, false, nil
+}
+
+// matchBuf returns the data of a file to run the regexps on. If we are
+// ignoring case, we transform the input instead of relying on the regular
+// expression engine which can be slow. compile has already lowercased the
+// patterns. We also trade some correctness for perf by using a non-utf8
+// aware lowercase function.
+func (rg *readerGrep) matchBuf(zf *store.ZipFile, fileBuf []byte) []byte {
+	if !rg.ignoreCase {
+		return fileBuf
+	}
+	if len(rg.transformBuf) < len(fileBuf) {
+		// Decoded files may be larger than zf.MaxLen.
+		n := zf.MaxLen
+		if n < len(fileBuf) {
+			n = len(fileBuf)
+		}
+		rg.transformBuf = make([]byte, n)
+	}
+	fileMatchBuf := rg.transformBuf[:len(fileBuf)]
+	if rg.stats != nil {
+		start := time.Now()
+		casetransform.BytesToLowerASCII(fileMatchBuf, fileBuf)
+		rg.stats.lowercase += time.Since(start)
+	} else {
+		casetransform.BytesToLowerASCII(fileMatchBuf, fileBuf)
 	}
-	return matches, nil
+	return fileMatchBuf
+}
+
+// excludes returns whether the content of f matches rg.excludeRe.
+func (rg *readerGrep) excludes(zf *store.ZipFile, f *store.SrcFile) bool {
+	return rg.excludeRe != nil && rg.excludeRe.Match(rg.matchBuf(zf, decodeFile(zf.DataFor(f))))
+}
+
+// findAll returns the locations of at most n matches of rg.re in b. If
+// rg.captureGroups is set the locations include the capture groups, like
+// for FindAllSubmatchIndex.
+func (rg *readerGrep) findAll(b []byte, n int) [][]int {
+	if rg.captureGroups {
+		return rg.re.FindAllSubmatchIndex(b, n)
+	}
+	return rg.re.FindAllIndex(b, n)
+}
+
+// findChunkSize is about the number of bytes of a file searched between
+// checks of whether the search is canceled, so that abandoned searches of
+// large files stop promptly.
+const findChunkSize = 256 * 1024
+
+// findAllChunked is equivalent to rg.findAll(b, n), but if the number of
+// lines a match can span is bounded it searches b in chunks of whole lines
+// of about findChunkSize bytes, and returns the error of ctx if ctx is done
+// between chunks. Each chunk is searched together with the rg.spanLines lines
+// after it, so that multiline matches starting in it are found whole.
+func (rg *readerGrep) findAllChunked(ctx context.Context, b []byte, n int) ([][]int, error) {
+	if rg.spanLines < 0 || len(b) <= findChunkSize {
+		return rg.findAll(b, n), nil
+	}
+
+	var locs [][]int
+	// lastEnd is the end of the last match. Like in rg.findAll, matches
+	// don't overlap, so a match found in the lines after a chunk which
+	// continues into the next chunk is searched for again there.
+	// Approximation: we drop matches of the next chunk overlapping it
+	// instead of resuming the search at its end.
+	lastEnd := 0
+	for start := 0; start <= len(b) && len(locs) < n; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// A chunk ends before a newline, so that anchors and word
+		// boundaries behave as in the whole of b.
+		end := len(b)
+		if start+findChunkSize < len(b) {
+			if i := bytes.IndexByte(b[start+findChunkSize:], '\n'); i >= 0 {
+				end = start + findChunkSize + i
+			}
+		}
+		windowEnd := end
+		for i := 0; i < rg.spanLines && windowEnd < len(b); i++ {
+			windowEnd++
+			if j := bytes.IndexByte(b[windowEnd:], '\n'); j >= 0 {
+				windowEnd += j
+			} else {
+				windowEnd = len(b)
+			}
+		}
+
+		// Matches overlapping the last one are dropped, so we need all of
+		// them if matches can span lines.
+		limit := -1
+		if rg.spanLines == 0 {
+			limit = n - len(locs)
+		}
+		for _, loc := range rg.findAll(b[start:windowEnd], limit) {
+			if start+loc[0] > end || len(locs) == n {
+				// The rest are found with the next chunk.
+				break
+			}
+			if start+loc[0] < lastEnd {
+				continue
+			}
+			for i := range loc {
+				if loc[i] >= 0 {
+					loc[i] += start
+				}
+			}
+			locs = append(locs, loc)
+			lastEnd = loc[1]
+		}
+		start = end + 1
+	}
+	return locs, nil
+}
+
+// findLineLocal is equivalent to rg.findAll(b, n), but only runs the
+// regex engine on the lines which contain one of rg.literals. This is a lot
+// faster for regexes without a literal prefix, like ^func +[A-Z], since most
+// lines can be skipped with bytes.Index. It requires rg.lineLocal. It returns
+// the error of ctx if ctx is done while searching a large b.
+func (rg *readerGrep) findLineLocal(ctx context.Context, b []byte, n int) ([][]int, error) {
+	// next is the index of the next occurrence of each literal, or -1 if
+	// there is none.
+	next := make([]int, len(rg.literals))
+	for i, lit := range rg.literals {
+		next[i] = bytes.Index(b, lit)
+	}
+
+	var locs [][]int
+	pos := 0
+	nextCheck := findChunkSize
+	for len(locs) < n {
+		if pos >= nextCheck {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			nextCheck = pos + findChunkSize
+		}
+
+		idx := -1
+		for i, lit := range rg.literals {
+			if next[i] >= 0 && next[i] < pos {
+				if j := bytes.Index(b[pos:], lit); j >= 0 {
+					next[i] = pos + j
+				} else {
+					next[i] = -1
+				}
+			}
+			if next[i] >= 0 && (idx < 0 || next[i] < idx) {
+				idx = next[i]
+			}
+		}
+		if idx < 0 {
+			break
+		}
+
+		// pos is always the start of a line.
+		lineStart := pos + bytes.LastIndexByte(b[pos:idx], '\n') + 1
+		lineEnd := len(b)
+		if j := bytes.IndexByte(b[idx:], '\n'); j >= 0 {
+			lineEnd = idx + j
+		}
+		for _, loc := range rg.findAll(b[lineStart:lineEnd], n-len(locs)) {
+			for i := range loc {
+				if loc[i] >= 0 {
+					loc[i] += lineStart
+				}
+			}
+			locs = append(locs, loc)
+		}
+		if lineEnd == len(b) {
+			break
+		}
+		pos = lineEnd + 1
+	}
+	return locs, nil
+}
+
+// containsAny returns whether any of subslices is within b.
+func containsAny(b []byte, subslices [][]byte) bool {
+	for _, s := range subslices {
+		if bytes.Contains(b, s) {
+			return true
+		}
+	}
+	return false
 }
 
 func hydrateLineNumbers(fileBuf []byte, lastLineNumber, lastMatchIndex, lineStart int, match []int) (lineNumber, matchIndex int) {
@@ -228,6 +700,29 @@ func hydrateLineNumbers(fileBuf []byte, lastLineNumber, lastMatchIndex, lineStar
 	return lineNumber, lineStart
 }
 
+// captureGroups returns the (offset, length) in runes of each group in
+// locs, which are pairs of indexes into the file like the ones returned by
+// FindSubmatchIndex. lineBuf is the content of the lines of the match,
+// which starts at index lineStart of the file. Groups which don't start on
+// the first line of lineBuf have an offset of -1.
+func captureGroups(lineBuf []byte, locs []int, lineStart int) [][2]int {
+	firstLineEnd := len(lineBuf)
+	if i := bytes.IndexByte(lineBuf, '\n'); i >= 0 {
+		firstLineEnd = i
+	}
+
+	groups := make([][2]int, 0, len(locs)/2)
+	for i := 0; i+1 < len(locs); i += 2 {
+		start, end := locs[i]-lineStart, locs[i+1]-lineStart
+		if locs[i] < 0 || start > firstLineEnd {
+			groups = append(groups, [2]int{-1, 0})
+			continue
+		}
+		groups = append(groups, [2]int{utf8.RuneCount(lineBuf[:start]), utf8.RuneCount(lineBuf[start:end])})
+	}
+	return groups
+}
+
 // matchLineBuf is a byte slice that contains the full line(s) that the match appears on.
 func appendMatches(matches []protocol.LineMatch, fileBuf []byte, matchLineBuf []byte, lineNumber, start, end int) []protocol.LineMatch {
 	// If any newlines appear between start and end, we need to append multiple LineMatch.
@@ -285,15 +780,31 @@ func appendMatches(matches []protocol.LineMatch, fileBuf []byte, matchLineBuf []
 	return matches
 }
 
-// FindZip is a convenience function to run Find on f.
-func (rg *readerGrep) FindZip(zf *store.ZipFile, f *store.SrcFile, limit int) (protocol.FileMatch, error) {
-	lm, err := rg.Find(zf, f, limit)
+// FindZip is a convenience function to run Find on f. excluded is true if
+// the content of f matches rg.excludeRe.
+func (rg *readerGrep) FindZip(ctx context.Context, zf *store.ZipFile, f *store.SrcFile, limit int) (fm protocol.FileMatch, excluded bool, err error) {
+	lm, chunks, matched, excluded, err := rg.find(ctx, zf, f, limit)
+	return newFileMatch(f.Name, lm, chunks, matched), excluded, err
+}
+
+// newFileMatch returns the FileMatch of the file at path for the results of
+// find.
+func newFileMatch(path string, lm []protocol.LineMatch, chunks []protocol.ChunkMatch, matched bool) protocol.FileMatch {
+	matchCount := len(lm)
+	if chunks != nil {
+		matchCount = countRanges(chunks)
+	}
+	if matched && matchCount == 0 {
+		// The file matched without a location to report, like a path match.
+		matchCount = 1
+	}
 	return protocol.FileMatch{
-		Path:        f.Name,
-		LineMatches: lm,
-		MatchCount:  len(lm),
-		LimitHit:    false,
-	}, err
+		Path:         path,
+		LineMatches:  lm,
+		ChunkMatches: chunks,
+		MatchCount:   matchCount,
+		LimitHit:     false,
+	}
 }
 
 func regexSearchBatch(ctx context.Context, rg *readerGrep, zf *store.ZipFile, limit int, patternMatchesContent, patternMatchesPaths bool, isPatternNegated bool) ([]protocol.FileMatch, bool, error) {
@@ -341,32 +852,92 @@ func regexSearch(ctx context.Context, rg *readerGrep, zf *store.ZipFile, limit i
 		files   = zf.Files
 	)
 
-	if rg.re == nil || (patternMatchesPaths && !patternMatchesContent) {
+	if (rg.re == nil && rg.expr == nil && rg.tokens == nil) || (patternMatchesPaths && !patternMatchesContent) {
 		// Fast path for only matching file paths (or with a nil pattern, which matches all files,
 		// so is effectively matching only on file paths).
-		for _, f := range files {
+		for i, f := range files {
 			if match := rg.matchPath.MatchPath(f.Name) && rg.matchString(f.Name); match == !isPatternNegated {
 				if ctx.Err() != nil {
+					sender.Scanned(i, len(zf.Files))
 					return ctx.Err()
 				}
+				if rg.skipFile(zf, &f) {
+					continue
+				}
+				if rg.excludes(zf, &f) {
+					continue
+				}
 				fm := protocol.FileMatch{Path: f.Name, MatchCount: 1}
 				sender.Send(fm)
 			}
 		}
+		sender.Scanned(len(zf.Files), len(zf.Files))
 		return nil
 	}
 
+	// The trigram index of the archive, if it has one, tells which files
+	// contain the literals required by a content match. We can't prune if
+	// files also match by path or are returned for not matching.
+	var candidates []bool
+	if ix := zf.TrigramIndex(); ix != nil && rg.expr == nil && !patternMatchesPaths && !isPatternNegated {
+		candidates = ix.Candidates(rg.indexLiterals)
+	}
+	span.SetTag("trigramIndex", candidates != nil)
+
 	var (
 		filesSkipped  atomic.Uint32
 		filesSearched atomic.Uint32
+		filesPruned   atomic.Uint32
+		stats         = searchStatsFromContext(ctx)
 	)
 
 	g, ctx := errgroup.WithContext(ctx)
 
+	// Only collect the statistics of the workers if they are recorded.
+	collectStats := ot.ShouldTrace(ctx)
+
 	// Start workers. They read from files and write to matches.
-	for i := 0; i < numWorkers; i++ {
+	workers, releaseWorkers := acquireWorkers(ctx)
+	defer releaseWorkers()
+	span.SetTag("workers", workers)
+
+	for i := 0; i < workers; i++ {
 		rg := rg.Copy()
-		g.Go(func() error {
+		worker := i
+		g.Go(func() (err error) {
+			var searched, matched int
+			if collectStats {
+				rg.stats = &findStats{}
+			}
+			rg.searchStats = stats
+			span, _ := ot.StartSpanFromContext(ctx, "RegexSearchWorker")
+			defer func() {
+				span.SetTag("worker", worker)
+				span.LogFields(
+					otlog.Int("filesSearched", searched),
+					otlog.Int("filesMatched", matched),
+				)
+				if rg.stats != nil {
+					span.LogFields(
+						otlog.Int("bytesSearched", rg.stats.bytes),
+						otlog.String("lowercaseDuration", rg.stats.lowercase.String()),
+						otlog.String("matchDuration", rg.stats.match.String()),
+					)
+				}
+				if err != nil {
+					ext.Error.Set(span, true)
+					span.SetTag("err", err.Error())
+				}
+				span.Finish()
+			}()
+
+			// Batch priority searches share a limited number of workers.
+			releaseSlot, err := acquireWorkerSlot(ctx)
+			if err != nil {
+				return nil
+			}
+			defer releaseSlot()
+
 			for ctx.Err() == nil {
 				// grab a file to work on
 				filesmu.Lock()
@@ -374,6 +945,7 @@ func regexSearch(ctx context.Context, rg *readerGrep, zf *store.ZipFile, limit i
 					filesmu.Unlock()
 					return nil
 				}
+				idx := len(zf.Files) - len(files)
 				f := &files[0]
 				files = files[1:]
 				filesmu.Unlock()
@@ -381,16 +953,47 @@ func regexSearch(ctx context.Context, rg *readerGrep, zf *store.ZipFile, limit i
 				// decide whether to process, record that decision
 				if !rg.matchPath.MatchPath(f.Name) {
 					filesSkipped.Inc()
+					stats.skippedPath.Inc()
+					continue
+				}
+				if rg.skipFile(zf, f) {
+					filesSkipped.Inc()
+					stats.skippedFilter.Inc()
+					continue
+				}
+				if rg.maxFileSize > 0 && int64(f.Len) > rg.maxFileSize {
+					filesSkipped.Inc()
+					stats.skippedTooLarge.Inc()
+					sender.SkipTooLarge()
+					continue
+				}
+				if candidates != nil && !candidates[idx] {
+					filesSkipped.Inc()
+					filesPruned.Inc()
+					stats.skippedIndex.Inc()
 					continue
 				}
 				filesSearched.Inc()
+				searched++
+
+				// Don't build previews the sender would drop anyway.
+				rg.maxPreviewBytes = sender.RemainingBytes()
 
 				// process
-				fm, err := rg.FindZip(zf, f, sender.Remaining())
+				start := time.Now()
+				fm, excluded, err := rg.FindZip(ctx, zf, f, sender.Remaining())
+				stats.searched(f, time.Since(start))
 				if err != nil {
+					if ctx.Err() != nil {
+						// Stopped while searching f, like between files.
+						return nil
+					}
 					return err
 				}
-				match := len(fm.LineMatches) > 0
+				if excluded {
+					continue
+				}
+				match := fm.MatchCount > 0
 				if !match && patternMatchesPaths {
 					// Try matching against the file path.
 					match = rg.matchString(f.Name)
@@ -399,6 +1002,7 @@ func regexSearch(ctx context.Context, rg *readerGrep, zf *store.ZipFile, limit i
 					}
 				}
 				if match == !isPatternNegated {
+					matched++
 					sender.Send(fm)
 				}
 			}
@@ -412,41 +1016,163 @@ func regexSearch(ctx context.Context, rg *readerGrep, zf *store.ZipFile, limit i
 		err = ctx.Err()
 	}
 
+	// Files taken by a worker count as scanned, even if the worker was
+	// stopped while searching them.
+	filesmu.Lock()
+	scanned := len(zf.Files) - len(files)
+	filesmu.Unlock()
+	sender.Scanned(scanned, len(zf.Files))
+
 	span.LogFields(
 		otlog.Int("filesSkipped", int(filesSkipped.Load())),
+		otlog.Int("filesPruned", int(filesPruned.Load())),
 		otlog.Int("filesSearched", int(filesSearched.Load())),
+		otlog.Int("filesScanned", scanned),
 	)
 
 	return err
 }
 
-// longestLiteral finds the longest substring that is guaranteed to appear in
-// a match of re.
-//
-// Note: There may be a longer substring that is guaranteed to appear. For
-// example we do not find the longest common substring in alternating
-// group. Nor do we handle concatting simple capturing groups.
-func longestLiteral(re *syntax.Regexp) string {
+// maxRequiredLiterals is the maximum number of literals requiredLiterals
+// returns. Each literal is searched for separately, so it isn't worth
+// pruning with too many of them.
+const maxRequiredLiterals = 8
+
+// requiredLiterals returns literals of which at least one appears in any
+// match of re, or nil if it can't find such literals. Of the candidates it
+// prefers the ones with the longest shortest literal, since those prune the
+// most.
+func requiredLiterals(re *syntax.Regexp) []string {
+	if re.Flags&syntax.FoldCase != 0 {
+		// The literal could match in any case.
+		return nil
+	}
 	switch re.Op {
 	case syntax.OpLiteral:
-		return string(re.Rune)
+		return []string{string(re.Rune)}
 	case syntax.OpCapture, syntax.OpPlus:
-		return longestLiteral(re.Sub[0])
+		return requiredLiterals(re.Sub[0])
 	case syntax.OpRepeat:
 		if re.Min >= 1 {
-			return longestLiteral(re.Sub[0])
+			return requiredLiterals(re.Sub[0])
 		}
 	case syntax.OpConcat:
-		longest := ""
+		var best []string
+		for _, sub := range re.Sub {
+			if lits := requiredLiterals(sub); shortestLen(lits) > shortestLen(best) {
+				best = lits
+			}
+		}
+		return best
+	case syntax.OpAlternate:
+		var lits []string
 		for _, sub := range re.Sub {
-			l := longestLiteral(sub)
-			if len(l) > len(longest) {
-				longest = l
+			l := requiredLiterals(sub)
+			if len(l) == 0 {
+				return nil
 			}
+			lits = append(lits, l...)
+		}
+		if len(lits) > maxRequiredLiterals {
+			return nil
+		}
+		return lits
+	}
+	return nil
+}
+
+// shortestLen returns the length of the shortest string in ss, or 0 if ss is
+// empty.
+func shortestLen(ss []string) int {
+	shortest := 0
+	for i, s := range ss {
+		if i == 0 || len(s) < shortest {
+			shortest = len(s)
+		}
+	}
+	return shortest
+}
+
+// maxNewlines returns the maximum number of newlines in a match of re, or -1
+// if it is unbounded or matches of re depend on the start or end of the
+// text.
+func maxNewlines(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpBeginText, syntax.OpEndText:
+		return -1
+	case syntax.OpLiteral:
+		n := 0
+		for _, r := range re.Rune {
+			if r == '\n' {
+				n++
+			}
+		}
+		return n
+	case syntax.OpAnyChar:
+		return 1
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			if re.Rune[i] <= '\n' && '\n' <= re.Rune[i+1] {
+				return 1
+			}
+		}
+		return 0
+	case syntax.OpCapture, syntax.OpQuest:
+		return maxNewlines(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpRepeat:
+		sub := maxNewlines(re.Sub[0])
+		if sub <= 0 {
+			return sub
+		}
+		if re.Op != syntax.OpRepeat || re.Max < 0 {
+			return -1
+		}
+		return sub * re.Max
+	case syntax.OpConcat, syntax.OpAlternate:
+		n := 0
+		for _, sub := range re.Sub {
+			m := maxNewlines(sub)
+			if m < 0 {
+				return -1
+			}
+			if re.Op == syntax.OpConcat {
+				n += m
+			} else if m > n {
+				n = m
+			}
+		}
+		return n
+	default:
+		return 0
+	}
+}
+
+// isLineLocal returns whether all matches of re are within a single line
+// and don't depend on the start or end of the text, so that re can be run on
+// individual lines instead of the whole text.
+func isLineLocal(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpAnyChar, syntax.OpBeginText, syntax.OpEndText:
+		return false
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if r == '\n' {
+				return false
+			}
+		}
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			if re.Rune[i] <= '\n' && '\n' <= re.Rune[i+1] {
+				return false
+			}
+		}
+	}
+	for _, sub := range re.Sub {
+		if !isLineLocal(sub) {
+			return false
 		}
-		return longest
 	}
-	return ""
+	return true
 }
 
 // readAll will read r until EOF into b. It returns the number of bytes
@@ -4,14 +4,21 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"fmt"
+	"math"
 	"os"
 	"reflect"
 	"regexp"
 	"regexp/syntax"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"testing/iotest"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/google/go-cmp/cmp"
 
 	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/pathmatch"
@@ -65,12 +72,8 @@ func BenchmarkSearchRegex_large_re_common(b *testing.B) {
 }
 
 func BenchmarkSearchRegex_large_re_anchor(b *testing.B) {
-	// TODO(keegan) PERF regex engine performs poorly since LiteralPrefix
-	// is empty when ^. We can improve this by:
-	// * Transforming the regex we use to prune a file to be more
-	// performant/permissive.
-	// * Searching for any literal (Rabin-Karp aka bytes.Index) or group
-	// of literals (Aho-Corasick).
+	// The regex engine performs poorly since LiteralPrefix is empty when
+	// ^, so this exercises findLineLocal.
 	benchSearchRegex(b, &protocol.Request{
 		Repo:   "github.com/golang/go",
 		Commit: "0ebaca6ba27534add5930a95acffa9acff182e2b",
@@ -180,7 +183,7 @@ func benchSearchRegex(b *testing.B, p *protocol.Request) {
 	}
 
 	var zc store.ZipCache
-	zf, err := zc.Get(path)
+	zf, err := zc.Get(context.Background(), path)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -196,32 +199,38 @@ func benchSearchRegex(b *testing.B, p *protocol.Request) {
 	}
 }
 
-func TestLongestLiteral(t *testing.T) {
-	cases := map[string]string{
-		"foo":       "foo",
-		"FoO":       "FoO",
-		"(?m:^foo)": "foo",
-		"(?m:^FoO)": "FoO",
-		"[Z]":       "Z",
-
-		`\wddSuballocation\(dump`:    "ddSuballocation(dump",
-		`\wfoo(\dlongest\wbam)\dbar`: "longest",
-
-		`(foo\dlongest\dbar)`:  "longest",
-		`(foo\dlongest\dbar)+`: "longest",
-		`(foo\dlongest\dbar)*`: "",
-
-		"(foo|bar)":     "",
-		"[A-Z]":         "",
-		"[^A-Z]":        "",
-		"[abB-Z]":       "",
-		"([abB-Z]|FoO)": "",
-		`[@-\[]`:        "",
-		`\S`:            "",
+func TestRequiredLiterals(t *testing.T) {
+	cases := map[string][]string{
+		"foo":       {"foo"},
+		"FoO":       {"FoO"},
+		"(?m:^foo)": {"foo"},
+		"(?m:^FoO)": {"FoO"},
+		"[Z]":       {"Z"},
+
+		`\wddSuballocation\(dump`:    {"ddSuballocation(dump"},
+		`\wfoo(\dlongest\wbam)\dbar`: {"longest"},
+
+		`(foo\dlongest\dbar)`:  {"longest"},
+		`(foo\dlongest\dbar)+`: {"longest"},
+		`(foo\dlongest\dbar)*`: nil,
+
+		"(foo|bar)":           {"foo", "bar"},
+		"(?m:^(func|type) +)": {"func", "type"},
+		"a(bcd|efg)":          {"bcd", "efg"},
+		"(foo|ba?)":           {"foo", "b"},
+		"(foo|b*)":            nil,
+		"(?i)foo":             nil,
+		"(a|b|c|d|e|f|g|h|i)": nil,
+		"[A-Z]":               nil,
+		"[^A-Z]":              nil,
+		"[abB-Z]":             nil,
+		"([abB-Z]|FoO)":       nil,
+		`[@-\[]`:              nil,
+		`\S`:                  nil,
 	}
 
 	metaLiteral := "AddSuballocation(dump->guid(), system_allocator_name)"
-	cases[regexp.QuoteMeta(metaLiteral)] = metaLiteral
+	cases[regexp.QuoteMeta(metaLiteral)] = []string{metaLiteral}
 
 	for expr, want := range cases {
 		re, err := syntax.Parse(expr, syntax.Perl)
@@ -229,10 +238,124 @@ func TestLongestLiteral(t *testing.T) {
 			t.Fatal(expr, err)
 		}
 		re = re.Simplify()
-		got := longestLiteral(re)
-		if want != got {
-			t.Errorf("longestLiteral(%q) == %q != %q", expr, got, want)
+		got := requiredLiterals(re)
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("requiredLiterals(%q) == %q != %q", expr, got, want)
+		}
+	}
+}
+
+func TestIsLineLocal(t *testing.T) {
+	cases := map[string]bool{
+		"foo":               true,
+		"(?m:^func +[A-Z])": true,
+		"(?m:foo$)":         true,
+		"foo.*bar":          true,
+		`foo\s+bar`:         false,
+		"foo[^a]bar":        false,
+		"(?s:foo.*bar)":     false,
+		`foo\nbar`:          false,
+		"^foo":              false,
+		`foo\z`:             false,
+	}
+	for expr, want := range cases {
+		re, err := syntax.Parse(expr, syntax.Perl)
+		if err != nil {
+			t.Fatal(expr, err)
+		}
+		if got := isLineLocal(re.Simplify()); got != want {
+			t.Errorf("isLineLocal(%q) == %v != %v", expr, got, want)
+		}
+	}
+}
+
+func TestFindLineLocal(t *testing.T) {
+	data := []byte("package main\n\nfunc main() {}\n\nfunc  Exported() {}\ntype T struct{}\n// func Foo\nfunc Last()")
+	for _, expr := range []string{`(?m:^func +[A-Z])`, `(?m:^(func|type) +[A-Z]\w*)`, `(?m:[a-z]\(\)$)`, `(?m:[a-z]+\(\))`} {
+		p := &protocol.PatternInfo{Pattern: expr, IsRegExp: true, IsCaseSensitive: true}
+		rg, err := compile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rg.literals) == 0 || !rg.lineLocal {
+			t.Fatalf("%s: expected line local literals", expr)
+		}
+		for _, n := range []int{1, 2, 100} {
+			want := rg.re.FindAllIndex(data, n)
+			if got, err := rg.findLineLocal(context.Background(), data, n); err != nil || !reflect.DeepEqual(want, got) {
+				t.Errorf("%s n=%d: got %v, want %v", expr, n, got, want)
+			}
+		}
+	}
+}
+
+func TestFindAllChunked(t *testing.T) {
+	var b bytes.Buffer
+	for i := 0; b.Len() < 3*findChunkSize; i++ {
+		fmt.Fprintf(&b, "foo %d bar\nbaz\n\nqux foo%d\n", i, i)
+	}
+	data := b.Bytes()
+
+	for _, expr := range []string{`(?m:^foo)`, `(?m:bar$)`, `\bbaz\b`, `(?m:^$)`, `foo\d+`} {
+		rg, err := compile(&protocol.PatternInfo{Pattern: expr, IsRegExp: true, IsCaseSensitive: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rg.lineLocal {
+			t.Fatalf("%s: expected line local pattern", expr)
 		}
+		for _, n := range []int{1, 1000, math.MaxInt32} {
+			want := rg.re.FindAllIndex(data, n)
+			got, err := rg.findAllChunked(context.Background(), data, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("%s n=%d: got %d matches, want %d", expr, n, len(got), len(want))
+			}
+		}
+	}
+
+	// Matches spanning a bounded number of lines are searched in
+	// overlapping chunks, others in the whole of data.
+	for _, tc := range []struct {
+		expr      string
+		spanLines int
+	}{
+		{`bar\nbaz`, 1},
+		{`(?m:baz\n\n^qux foo\d)`, 2},
+		{`(?s:\d+ bar.{0,8}qux)`, 8},
+		{`\d\s+\w`, -1},
+		{`\Abaz`, -1},
+	} {
+		rg, err := compile(&protocol.PatternInfo{Pattern: tc.expr, IsRegExp: true, IsCaseSensitive: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rg.spanLines != tc.spanLines {
+			t.Fatalf("%s: got %d span lines, want %d", tc.expr, rg.spanLines, tc.spanLines)
+		}
+		for _, n := range []int{1, 1000, math.MaxInt32} {
+			want := rg.re.FindAllIndex(data, n)
+			got, err := rg.findAllChunked(context.Background(), data, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("%s n=%d: got %d matches, want %d", tc.expr, n, len(got), len(want))
+			}
+		}
+	}
+
+	// A canceled search stops between chunks.
+	rg, err := compile(&protocol.PatternInfo{Pattern: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := rg.findAllChunked(ctx, data, math.MaxInt32); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
 	}
 }
 
@@ -388,6 +511,42 @@ func TestPathMatches(t *testing.T) {
 	}
 }
 
+func TestFindStats(t *testing.T) {
+	zipData, err := storetest.CreateZip(map[string]string{
+		"a": "Foo bar\n",
+		"b": "baz\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rg, err := compile(&protocol.PatternInfo{Pattern: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rg.stats = &findStats{}
+
+	matches := 0
+	for i := range zf.Files {
+		lm, err := rg.Find(context.Background(), zf, &zf.Files[i], 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matches += len(lm)
+	}
+
+	if matches != 1 {
+		t.Fatalf("unexpected number of matches. want=1 have=%d", matches)
+	}
+	if rg.stats.bytes != len("Foo bar\n")+len("baz\n") {
+		t.Fatalf("unexpected number of bytes searched: %d", rg.stats.bytes)
+	}
+}
+
 // githubStore fetches from github and caches across test runs.
 var githubStore = &store.Store{
 	FetchTar: testutil.FetchTarFromGithub,
@@ -463,3 +622,263 @@ func TestRegexSearch(t *testing.T) {
 		})
 	}
 }
+
+func TestMaxFileSize(t *testing.T) {
+	zipData, err := storetest.CreateZip(map[string]string{
+		"small": "foo\n",
+		"large": strings.Repeat("foo\n", 100),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rg, err := compile(&protocol.PatternInfo{Pattern: "foo", MaxFileSizeBytes: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel, sender := newLimitedStreamCollector(context.Background(), 1000)
+	defer cancel()
+	if err := regexSearch(ctx, rg, zf, 1000, true, false, false, sender); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sender.Collected(); len(got) != 1 || got[0].Path != "small" {
+		t.Fatalf("got %v, want only a match in small", got)
+	}
+	if got := sender.TooLargeCount(); got != 1 {
+		t.Fatalf("got %d files too large, want 1", got)
+	}
+}
+
+func TestMaxResultBytes(t *testing.T) {
+	zipData, err := storetest.CreateZip(map[string]string{
+		"a": strings.Repeat("foo\n", 100),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rg, err := compile(&protocol.PatternInfo{Pattern: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// find stops building previews once they exceed its budget.
+	rg.maxPreviewBytes = 10
+	lms, err := rg.Find(context.Background(), zf, &zf.Files[0], 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lms) != 4 {
+		t.Fatalf("got %d line matches, want 4", len(lms))
+	}
+
+	var got []protocol.FileMatch
+	ctx, cancel, sender := newLimitedStream(context.Background(), 1000, requestLimits{maxResultBytes: 30}, func(fm protocol.FileMatch) {
+		got = append(got, fm)
+	})
+	defer cancel()
+	if err := regexSearch(ctx, rg.Copy(), zf, 1000, true, false, false, sender); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 || len(got[0].LineMatches) != 10 || got[0].MatchCount != 10 {
+		t.Fatalf("got %v, want 10 line matches of a", got)
+	}
+	if !sender.LimitHit() || sender.RemainingBytes() != 0 {
+		t.Fatalf("expected the byte budget to be used up")
+	}
+	if diff := cmp.Diff([]protocol.LimitReason{protocol.LimitReasonResultBytes}, sender.LimitReasons()); diff != "" {
+		t.Fatalf("unexpected limit reasons (-want +got):\n%s", diff)
+	}
+}
+
+func TestRegexSearch_deadline(t *testing.T) {
+	zipData, err := storetest.CreateZip(map[string]string{
+		"a": "foo\n",
+		"b": "foo\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rg, err := compile(&protocol.PatternInfo{Pattern: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The search stops right away, since its deadline has passed.
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	ctx, cancel, sender := newLimitedStreamCollector(ctx, 1000)
+	defer cancel()
+	err = regexSearch(ctx, rg, zf, 1000, true, false, false, sender)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n, total := sender.ScannedCount(); n != 0 || total != 2 {
+		t.Fatalf("got %d of %d files scanned, want 0 of 2", n, total)
+	}
+
+	ctx, cancel, sender = newLimitedStreamCollector(context.Background(), 1000)
+	defer cancel()
+	if err := regexSearch(ctx, rg, zf, 1000, true, false, false, sender); err != nil {
+		t.Fatal(err)
+	}
+	if n, total := sender.ScannedCount(); n != 2 || total != 2 {
+		t.Fatalf("got %d of %d files scanned, want 2 of 2", n, total)
+	}
+}
+
+func TestCaptureGroups(t *testing.T) {
+	zipData, err := storetest.CreateZip(map[string]string{
+		"main.go": "package main\n\nfunc héllo() {}\nfunc (s *S) World() {}\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		pattern string
+		want    []protocol.LineMatch
+	}{{
+		pattern: `func (\(\w+ \*?(\w+)\) )?(\pL+)\(`,
+		want: []protocol.LineMatch{{
+			Preview:          "func héllo() {}",
+			LineNumber:       2,
+			OffsetAndLengths: [][2]int{{0, 11}},
+			CaptureGroups:    [][][2]int{{{-1, 0}, {-1, 0}, {5, 5}}},
+		}, {
+			Preview:          "func (s *S) World() {}",
+			LineNumber:       3,
+			OffsetAndLengths: [][2]int{{0, 18}},
+			CaptureGroups:    [][][2]int{{{5, 7}, {9, 1}, {12, 5}}},
+		}},
+	}, {
+		// A multiline match has no groups on its continuation lines.
+		pattern: `(main)\n\n(func)`,
+		want: []protocol.LineMatch{{
+			Preview:          "package main",
+			OffsetAndLengths: [][2]int{{8, 5}},
+			CaptureGroups:    [][][2]int{{{8, 4}, {-1, 0}}},
+		}, {
+			Preview:          "",
+			LineNumber:       1,
+			OffsetAndLengths: [][2]int{{0, 1}},
+			CaptureGroups:    [][][2]int{nil},
+		}, {
+			Preview:          "func héllo() {}",
+			LineNumber:       2,
+			OffsetAndLengths: [][2]int{{0, 4}},
+			CaptureGroups:    [][][2]int{nil},
+		}},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			rg, err := compile(&protocol.PatternInfo{Pattern: tc.pattern, IsRegExp: true, IsCaseSensitive: true, IncludeCaptureGroups: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := rg.Find(context.Background(), zf, &zf.Files[0], 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRegexSearch_trigramIndex(t *testing.T) {
+	files := map[string]string{
+		"main.go":    "package main\n\nfunc main() {}\n",
+		"README.md":  "# Hello World\n",
+		"latin1.txt": "caf\xe9 main\n",
+		"empty":      "",
+	}
+	s, cleanup, err := storetest.NewStore(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	s.BuildTrigramIndexes = true
+
+	path, err := s.PrepareZip(context.Background(), "foo", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the index to be built in the background.
+	var zf *store.ZipFile
+	for i := 0; i < 500; i++ {
+		zf, err = s.ZipCache.Get(context.Background(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if zf.TrigramIndex() != nil {
+			break
+		}
+		zf.Close()
+		zf = nil
+		time.Sleep(10 * time.Millisecond)
+	}
+	if zf == nil {
+		t.Fatal("timed out waiting for the trigram index")
+	}
+	defer zf.Close()
+
+	zipData, err := storetest.CreateZip(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unindexed, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The index must not change the results of a search.
+	for _, p := range []*protocol.PatternInfo{
+		{Pattern: "main"},
+		{Pattern: "MAIN", IsCaseSensitive: true},
+		{Pattern: "hello world"},
+		{Pattern: "café"},
+		{Pattern: `func \w+\(`, IsRegExp: true},
+		{Pattern: "world|package", IsRegExp: true},
+		{Pattern: "nothing"},
+	} {
+		rg, err := compile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _, err := regexSearchBatch(context.Background(), rg, unindexed, 100, true, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, err := regexSearchBatch(context.Background(), rg, zf, 100, true, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(want, func(i, j int) bool { return want[i].Path < want[j].Path })
+		sort.Slice(got, func(i, j int) bool { return got[i].Path < got[j].Path })
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %v, want %v", p, got, want)
+		}
+	}
+}
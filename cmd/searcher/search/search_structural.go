@@ -1,6 +1,7 @@
 package search
 
 import (
+	"archive/zip"
 	"context"
 	"os"
 	"path/filepath"
@@ -10,6 +11,8 @@ import (
 	"github.com/RoaringBitmap/roaring"
 	zoektquery "github.com/google/zoekt/query"
 	"github.com/inconshreveable/log15"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
@@ -19,6 +22,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/lazyregexp"
 	"github.com/sourcegraph/sourcegraph/internal/search"
 	"github.com/sourcegraph/sourcegraph/internal/store"
+	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
 )
 
 // The Sourcegraph frontend and interface only allow LineMatches (matches on a
@@ -177,13 +181,26 @@ func lookupMatcher(language string) string {
 	return ".generic"
 }
 
-// filteredStructuralSearch filters the list of files with a regex search before passing the zip to comby
-func filteredStructuralSearch(ctx context.Context, zipPath string, zipFile *store.ZipFile, p *protocol.PatternInfo, repo api.RepoName, sender matchSender) error {
+// filteredStructuralSearch filters the list of files with a regex search before passing the zip to comby.
+// zipPath is the zip of zipFile on disk, or empty if comby can't read it.
+func filteredStructuralSearch(ctx context.Context, zipPath string, zipFile *store.ZipFile, p *protocol.PatternInfo, repo api.RepoName, sender matchSender) (err error) {
+	span, ctx := ot.StartSpanFromContext(ctx, "FilteredStructuralSearch")
+	ext.Component.Set(span, "structural_search")
+	defer func() {
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.SetTag("err", err.Error())
+		}
+		span.Finish()
+	}()
+
 	// Make a copy of the pattern info to modify it to work for a regex search
 	rp := *p
 	rp.Pattern = comby.StructuralPatToRegexpQuery(p.Pattern, false)
 	rp.IsStructuralPat = false
 	rp.IsRegExp = true
+	// Languages only choose the matcher of structural searches.
+	rp.Languages = nil
 	rg, err := compile(&rp)
 	if err != nil {
 		return err
@@ -193,6 +210,8 @@ func filteredStructuralSearch(ctx context.Context, zipPath string, zipFile *stor
 	if err != nil {
 		return err
 	}
+	// The files which comby searches, after the regex search above.
+	span.LogFields(otlog.Int("candidateFiles", len(fileMatches)))
 
 	matchedPaths := make([]string, 0, len(fileMatches))
 	for _, fm := range fileMatches {
@@ -204,6 +223,17 @@ func filteredStructuralSearch(ctx context.Context, zipPath string, zipFile *stor
 		extensionHint = filepath.Ext(matchedPaths[0])
 	}
 
+	if zipPath == "" {
+		// comby can't read the zip on disk, so it searches a temporary zip
+		// of the candidate files instead.
+		tmp, err := writeCandidatesZip(zipFile, matchedPaths)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp)
+		zipPath = tmp
+	}
+
 	return structuralSearch(ctx, zipPath, Subset(matchedPaths), extensionHint, p.Pattern, p.CombyRule, p.Languages, repo, sender)
 }
 
@@ -331,6 +361,45 @@ func structuralSearchWithZoekt(ctx context.Context, p *protocol.Request, sender
 	return false, structuralSearch(ctx, zipFile.Name(), All, extensionHint, p.Pattern, p.CombyRule, p.Languages, p.Repo, sender)
 }
 
+// writeCandidatesZip writes the files of zf with the given paths to a
+// temporary zip, and returns its path. The caller must remove it.
+func writeCandidatesZip(zf *store.ZipFile, paths []string) (_ string, err error) {
+	f, err := os.CreateTemp("", "*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err1 := f.Close(); err == nil {
+			err = err1
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	want := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		want[p] = struct{}{}
+	}
+	zw := zip.NewWriter(f)
+	for i := range zf.Files {
+		if _, ok := want[zf.Files[i].Name]; !ok {
+			continue
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: zf.Files[i].Name, Method: zip.Store})
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write(zf.DataFor(&zf.Files[i])); err != nil {
+			return "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
 var requestTotalStructuralSearch = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name: "searcher_service_request_total_structural_search",
 	Help: "Number of returned structural search requests.",
@@ -0,0 +1,223 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/errors"
+	"github.com/inconshreveable/log15"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/atomic"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/sourcegraph/go-ctags"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/env"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
+)
+
+var ctagsCommand = env.Get("CTAGS_COMMAND", "universal-ctags", "ctags command used by symbol searches (should point to universal-ctags executable compiled with JSON and seccomp support)")
+
+// symbolParsers is the pool of ctags processes used by symbol searches. A
+// nil parser in the pool indicates that the receiver should start a new
+// process. The pool starts out with only nil parsers, so that searcher runs
+// without ctags installed until a symbol search is requested.
+var symbolParsers = func() chan ctags.Parser {
+	n := runtime.GOMAXPROCS(0)
+	parsers := make(chan ctags.Parser, n)
+	for i := 0; i < n; i++ {
+		parsers <- nil
+	}
+	return parsers
+}()
+
+// parseSymbols returns the ctags entries of the file at path with content
+// data, using a parser from symbolParsers.
+func parseSymbols(ctx context.Context, path string, data []byte) (entries []*ctags.Entry, err error) {
+	var parser ctags.Parser
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case parser = <-symbolParsers:
+	}
+
+	if parser == nil {
+		parser, err = ctags.New(ctags.Options{Bin: ctagsCommand})
+		if err != nil {
+			symbolParsers <- nil
+			return nil, errors.Wrap(err, "starting ctags")
+		}
+	}
+
+	defer func() {
+		if err == nil {
+			if e := recover(); e != nil {
+				err = errors.Errorf("panic: %s", e)
+			}
+		}
+		if err != nil {
+			// Close the parser and let the next receiver start a new one.
+			log15.Error("searcher: closing failed ctags parser", "path", path, "error", err)
+			parser.Close()
+			parser = nil
+		}
+		symbolParsers <- parser
+	}()
+	return parser.Parse(path, data)
+}
+
+// symbolSearch concurrently searches files in zf for symbols whose names
+// match rg.
+func symbolSearch(ctx context.Context, rg *readerGrep, zf *store.ZipFile, sender matchSender) (err error) {
+	span, ctx := ot.StartSpanFromContext(ctx, "SymbolSearch")
+	ext.Component.Set(span, "symbol_search")
+	if rg.re != nil {
+		span.SetTag("re", rg.re.String())
+	}
+	span.SetTag("path", rg.matchPath.String())
+
+	var filesSearched atomic.Uint32
+	defer func() {
+		span.LogFields(otlog.Int("filesSearched", int(filesSearched.Load())))
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.SetTag("err", err.Error())
+		}
+		span.Finish()
+	}()
+
+	var (
+		filesmu sync.Mutex // protects files
+		files   = zf.Files
+		stats   = searchStatsFromContext(ctx)
+	)
+
+	g, ctx := errgroup.WithContext(ctx)
+	workers, releaseWorkers := acquireWorkers(ctx)
+	defer releaseWorkers()
+	span.SetTag("workers", workers)
+
+	for i := 0; i < workers; i++ {
+		rg := rg.Copy()
+		g.Go(func() error {
+			releaseSlot, err := acquireWorkerSlot(ctx)
+			if err != nil {
+				return nil
+			}
+			defer releaseSlot()
+
+			for ctx.Err() == nil {
+				filesmu.Lock()
+				if len(files) == 0 {
+					filesmu.Unlock()
+					return nil
+				}
+				f := &files[0]
+				files = files[1:]
+				filesmu.Unlock()
+
+				if !rg.matchPath.MatchPath(f.Name) {
+					stats.skippedPath.Inc()
+					continue
+				}
+				if rg.skipFile(zf, f) {
+					stats.skippedFilter.Inc()
+					continue
+				}
+				if rg.maxFileSize > 0 && int64(f.Len) > rg.maxFileSize {
+					stats.skippedTooLarge.Inc()
+					sender.SkipTooLarge()
+					continue
+				}
+				filesSearched.Inc()
+
+				start := time.Now()
+				fm, err := rg.findSymbols(ctx, zf, f)
+				stats.searched(f, time.Since(start))
+				if err != nil {
+					return err
+				}
+				if fm.MatchCount > 0 && !rg.excludes(zf, f) {
+					sender.Send(fm)
+				}
+			}
+			return nil
+		})
+	}
+
+	err = g.Wait()
+	if err == nil && ctx.Err() == context.DeadlineExceeded {
+		err = ctx.Err()
+	}
+
+	filesmu.Lock()
+	sender.Scanned(len(zf.Files)-len(files), len(zf.Files))
+	filesmu.Unlock()
+	return err
+}
+
+// findSymbols returns a FileMatch with the symbols of f whose names match
+// rg. Each symbol is accompanied by a LineMatch for the line it is found on.
+func (rg *readerGrep) findSymbols(ctx context.Context, zf *store.ZipFile, f *store.SrcFile) (protocol.FileMatch, error) {
+	fm := protocol.FileMatch{Path: f.Name}
+
+	data := zf.DataFor(f)
+	entries, err := parseSymbols(ctx, f.Name, data)
+	if err != nil {
+		return fm, err
+	}
+
+	var lines [][]byte
+	for _, e := range entries {
+		if isAnonymousSymbol(e) || !rg.matchString(e.Name) {
+			continue
+		}
+		if lines == nil {
+			lines = bytes.Split(data, []byte{'\n'})
+		}
+
+		// ctags line numbers are 1-based.
+		lineNumber := e.Line - 1
+		var line string
+		if lineNumber >= 0 && lineNumber < len(lines) {
+			line = string(bytes.TrimSuffix(lines[lineNumber], []byte{'\r'}))
+		}
+
+		lm := protocol.LineMatch{Preview: line, LineNumber: lineNumber}
+		if i := strings.Index(line, e.Name); i >= 0 {
+			lm.OffsetAndLengths = [][2]int{{utf8.RuneCountInString(line[:i]), utf8.RuneCountInString(e.Name)}}
+		}
+
+		fm.LineMatches = append(fm.LineMatches, lm)
+		fm.Symbols = append(fm.Symbols, protocol.SymbolMatch{
+			Name:       e.Name,
+			Kind:       e.Kind,
+			Language:   e.Language,
+			Parent:     e.Parent,
+			ParentKind: e.ParentKind,
+			Signature:  e.Signature,
+			LineNumber: lineNumber,
+		})
+	}
+	fm.MatchCount = len(fm.Symbols)
+	return fm, nil
+}
+
+// isAnonymousSymbol reports whether e is a symbol ctags generated for an
+// anonymous construct, which isn't worth returning.
+func isAnonymousSymbol(e *ctags.Entry) bool {
+	for _, name := range []string{e.Name, e.Parent} {
+		if strings.HasPrefix(name, "__anon") || strings.HasPrefix(name, "AnonymousFunction") {
+			return true
+		}
+	}
+	return e.Name == ""
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"context"
+	"os/exec"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	storetest "github.com/sourcegraph/sourcegraph/internal/store/testutil"
+)
+
+func TestSymbolSearch(t *testing.T) {
+	if _, err := exec.LookPath(ctagsCommand); err != nil {
+		t.Skip("command not in PATH: universal-ctags")
+	}
+
+	zipData, err := storetest.CreateZip(map[string]string{
+		"main.go": `package main
+
+type Server struct{}
+
+func (s *Server) ServeHTTP() {}
+
+func main() {
+	serve := 1
+	_ = serve
+}
+`,
+		"README.md": "serve the files\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rg, err := compile(&protocol.PatternInfo{Pattern: "serve", IsSymbolSearch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel, sender := newLimitedStreamCollector(context.Background(), 1000)
+	defer cancel()
+	if err := symbolSearch(ctx, rg, zf, sender); err != nil {
+		t.Fatal(err)
+	}
+
+	got := sender.Collected()
+	if len(got) != 1 || got[0].Path != "main.go" {
+		t.Fatalf("got %v, want only matches in main.go", got)
+	}
+	var names []string
+	for i, s := range got[0].Symbols {
+		if lm := got[0].LineMatches[i]; lm.LineNumber != s.LineNumber {
+			t.Errorf("symbol %s is on line %d, but its line match is on line %d", s.Name, s.LineNumber, lm.LineNumber)
+		}
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"Server", "ServeHTTP"}; !cmp.Equal(want, names) {
+		t.Fatalf("got symbols %v, want %v", names, want)
+	}
+}
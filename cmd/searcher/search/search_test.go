@@ -15,12 +15,14 @@ import (
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/google/go-cmp/cmp"
 
 	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
 	"github.com/sourcegraph/sourcegraph/cmd/searcher/search"
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/search/searcher"
 	"github.com/sourcegraph/sourcegraph/internal/store"
+	storetest "github.com/sourcegraph/sourcegraph/internal/store/testutil"
 	"github.com/sourcegraph/sourcegraph/internal/testutil"
 )
 
@@ -207,6 +209,41 @@ README.md
 abc.txt
 file++.plus
 milton.png
+`},
+
+		{protocol.PatternInfo{Pattern: "world", ExcludeContentPattern: "fmt"}, `
+README.md:1:# Hello World
+README.md:3:Hello world example in go
+`},
+
+		{protocol.PatternInfo{Pattern: "world", ExcludeContentPattern: "EXAMPLE", IsCaseSensitive: true}, `
+README.md:3:Hello world example in go
+main.go:6:	fmt.Println("Hello world")
+`},
+
+		{protocol.PatternInfo{PatternExpr: &protocol.PatternExpr{And: []*protocol.PatternExpr{{Pattern: "world"}, {Pattern: "fmt"}}}}, `
+main.go:3:import "fmt"
+main.go:6:	fmt.Println("Hello world")
+`},
+
+		{protocol.PatternInfo{PatternExpr: &protocol.PatternExpr{Or: []*protocol.PatternExpr{{Pattern: "example"}, {Pattern: "import"}}}}, `
+README.md:3:Hello world example in go
+main.go:3:import "fmt"
+`},
+
+		{protocol.PatternInfo{PatternExpr: &protocol.PatternExpr{And: []*protocol.PatternExpr{{Pattern: "world"}, {Not: &protocol.PatternExpr{Pattern: "fmt"}}}}}, `
+README.md:1:# Hello World
+README.md:3:Hello world example in go
+`},
+
+		{protocol.PatternInfo{PatternExpr: &protocol.PatternExpr{Not: &protocol.PatternExpr{Pattern: "world"}}}, `
+abc.txt
+file++.plus
+milton.png
+`},
+
+		{protocol.PatternInfo{Pattern: "", IncludePatterns: []string{"\\.(go|md)$"}, PathPatternsAreRegExps: true, ExcludeContentPattern: "println", PatternMatchesPath: true}, `
+README.md
 `},
 	}
 
@@ -268,6 +305,243 @@ milton.png
 	}
 }
 
+func TestSearch_encodings(t *testing.T) {
+	// "Grüße from Windows" in UTF-16LE with a byte order mark.
+	utf16 := []byte{0xFF, 0xFE}
+	for _, r := range "line one\r\nGrüße from Windows\r\n" {
+		utf16 = append(utf16, byte(r), byte(r>>8))
+	}
+
+	s, cleanup, err := newStore(map[string]string{
+		"utf16.txt":  string(utf16),
+		"latin1.txt": "first\ncaf\xe9 au lait\n",
+		"utf8.txt":   "café noir\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	ts := httptest.NewServer(&search.Service{Store: s})
+	defer ts.Close()
+
+	cases := []struct {
+		pattern string
+		want    []protocol.FileMatch
+	}{{
+		pattern: "grüße",
+		want: []protocol.FileMatch{{
+			Path:       "utf16.txt",
+			MatchCount: 1,
+			LineMatches: []protocol.LineMatch{{
+				Preview:          "Grüße from Windows\r",
+				LineNumber:       1,
+				OffsetAndLengths: [][2]int{{0, 5}},
+			}},
+		}},
+	}, {
+		pattern: "café",
+		want: []protocol.FileMatch{{
+			Path:       "latin1.txt",
+			MatchCount: 1,
+			LineMatches: []protocol.LineMatch{{
+				Preview:          "café au lait",
+				LineNumber:       1,
+				OffsetAndLengths: [][2]int{{0, 4}},
+			}},
+		}, {
+			Path:       "utf8.txt",
+			MatchCount: 1,
+			LineMatches: []protocol.LineMatch{{
+				Preview:          "café noir",
+				OffsetAndLengths: [][2]int{{0, 4}},
+			}},
+		}},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			req := protocol.Request{
+				Repo:         "foo",
+				URL:          "u",
+				Commit:       "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+				PatternInfo:  protocol.PatternInfo{Pattern: tc.pattern, PatternMatchesContent: true},
+				FetchTimeout: "500ms",
+			}
+			got, err := doSearch(ts.URL, &req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Sort(sortByPath(got))
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("unexpected matches (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSearch_baseCommit(t *testing.T) {
+	s, cleanup, err := newStore(map[string]string{
+		"changed.go":   "package main // foo\n",
+		"unchanged.go": "package main // foo\n",
+		"added.go":     "package added\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	wantBase := api.CommitID("0123456789012345678901234567890123456789")
+	ts := httptest.NewServer(&search.Service{
+		Store: s,
+		ChangedFiles: func(ctx context.Context, repo api.RepoName, base, head api.CommitID) ([]string, error) {
+			if base != wantBase {
+				return nil, errors.Errorf("got base %q, want %q", base, wantBase)
+			}
+			return []string{"changed.go", "added.go", "deleted.go"}, nil
+		},
+	})
+	defer ts.Close()
+
+	req := protocol.Request{
+		Repo:         "foo",
+		URL:          "u",
+		Commit:       "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+		BaseCommit:   wantBase,
+		PatternInfo:  protocol.PatternInfo{Pattern: "package", PatternMatchesContent: true},
+		FetchTimeout: "500ms",
+	}
+	got, err := doSearch(ts.URL, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Sort(sortByPath(got))
+	if diff := cmp.Diff([]string{"added.go", "changed.go"}, toPaths(got)); diff != "" {
+		t.Fatalf("unexpected matches (-want +got):\n%s", diff)
+	}
+}
+
+func TestSearch_archiveMembers(t *testing.T) {
+	jar, err := storetest.CreateZip(map[string]string{"a/B.java": "class B { foo }\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, cleanup, err := newStore(map[string]string{
+		"main.go": "package main // foo\n",
+		"lib.jar": string(jar),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	s.MaxArchiveDepth = 1
+	s.MaxArchiveSize = 1 << 20
+
+	ts := httptest.NewServer(&search.Service{Store: s})
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		includeArchiveMembers bool
+		want                  []string
+	}{
+		{includeArchiveMembers: false, want: []string{"main.go"}},
+		{includeArchiveMembers: true, want: []string{"lib.jar!a/B.java", "main.go"}},
+	} {
+		req := protocol.Request{
+			Repo:                  "foo",
+			URL:                   "u",
+			Commit:                "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			IncludeArchiveMembers: tc.includeArchiveMembers,
+			PatternInfo:           protocol.PatternInfo{Pattern: "foo", PatternMatchesContent: true},
+			FetchTimeout:          "500ms",
+		}
+		got, err := doSearch(ts.URL, &req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Sort(sortByPath(got))
+		if diff := cmp.Diff(tc.want, toPaths(got)); diff != "" {
+			t.Errorf("IncludeArchiveMembers=%v: unexpected matches (-want +got):\n%s", tc.includeArchiveMembers, diff)
+		}
+	}
+}
+
+func TestSearch_diffContent(t *testing.T) {
+	s, cleanup, err := newStore(map[string]string{
+		"changed.go": "package main\n\nfunc main() {\n\tbar()\n}\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	const rawDiff = `diff --git changed.go changed.go
+index 1111111..2222222 100644
+--- changed.go
++++ changed.go
+@@ -4 +4,2 @@ func main() {
+-	foo()
++	bar()
++	foobar()
+diff --git deleted.go deleted.go
+deleted file mode 100644
+index 3333333..0000000
+--- deleted.go
++++ /dev/null
+@@ -1 +0,0 @@
+-var foo = 1
+`
+	ts := httptest.NewServer(&search.Service{
+		Store: s,
+		Diff: func(ctx context.Context, repo api.RepoName, base, head api.CommitID) ([]byte, error) {
+			return []byte(rawDiff), nil
+		},
+	})
+	defer ts.Close()
+
+	req := protocol.Request{
+		Repo:         "foo",
+		URL:          "u",
+		Commit:       "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+		BaseCommit:   "0123456789012345678901234567890123456789",
+		DiffContent:  true,
+		PatternInfo:  protocol.PatternInfo{Pattern: "foo", PatternMatchesContent: true},
+		FetchTimeout: "500ms",
+	}
+	got, err := doSearch(ts.URL, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Sort(sortByPath(got))
+
+	want := []protocol.FileMatch{{
+		Path:       "changed.go",
+		MatchCount: 2,
+		LineMatches: []protocol.LineMatch{
+			{Preview: "\tfoo()", LineNumber: 3, OffsetAndLengths: [][2]int{{1, 3}}, DiffOp: protocol.DiffOpRemoved},
+			{Preview: "\tfoobar()", LineNumber: 4, OffsetAndLengths: [][2]int{{1, 3}}, DiffOp: protocol.DiffOpAdded},
+		},
+		Hunks: []protocol.DiffHunk{{OldStart: 4, OldLines: 1, NewStart: 4, NewLines: 2, Section: "func main() {"}},
+	}, {
+		Path:       "deleted.go",
+		MatchCount: 1,
+		LineMatches: []protocol.LineMatch{
+			{Preview: "var foo = 1", LineNumber: 0, OffsetAndLengths: [][2]int{{4, 3}}, DiffOp: protocol.DiffOpRemoved},
+		},
+		Hunks: []protocol.DiffHunk{{OldStart: 1, OldLines: 1, NewStart: 0, NewLines: 0}},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected matches (-want +got):\n%s", diff)
+	}
+}
+
+func toPaths(matches []protocol.FileMatch) []string {
+	paths := make([]string, 0, len(matches))
+	for _, m := range matches {
+		paths = append(paths, m.Path)
+	}
+	return paths
+}
+
 func TestSearch_badrequest(t *testing.T) {
 	cases := []protocol.Request{
 		// Bad regexp
@@ -379,6 +653,130 @@ func TestSearch_badrequest(t *testing.T) {
 				IsStructuralPat:        true,
 			},
 		},
+
+		// pattern expression with an empty operator
+		{
+			Repo:   "foo",
+			URL:    "u",
+			Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			PatternInfo: protocol.PatternInfo{
+				PatternExpr: &protocol.PatternExpr{And: []*protocol.PatternExpr{}},
+			},
+		},
+
+		// pattern expression with both Pattern and Not set
+		{
+			Repo:   "foo",
+			URL:    "u",
+			Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			PatternInfo: protocol.PatternInfo{
+				PatternExpr: &protocol.PatternExpr{Pattern: "foo", Not: &protocol.PatternExpr{Pattern: "bar"}},
+			},
+		},
+
+		// pattern expression and pattern
+		{
+			Repo:   "foo",
+			URL:    "u",
+			Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			PatternInfo: protocol.PatternInfo{
+				Pattern:     "foo",
+				PatternExpr: &protocol.PatternExpr{Pattern: "bar"},
+			},
+		},
+
+		// structural search with exclude content pattern
+		{
+			Repo:   "foo",
+			URL:    "u",
+			Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			PatternInfo: protocol.PatternInfo{
+				Pattern:               "fmt.Println(:[_])",
+				ExcludeContentPattern: "fmt",
+				IsStructuralPat:       true,
+			},
+		},
+
+		// structural symbol search
+		{
+			Repo:   "foo",
+			URL:    "u",
+			Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			PatternInfo: protocol.PatternInfo{
+				Pattern:         "fmt.Println(:[_])",
+				IsSymbolSearch:  true,
+				IsStructuralPat: true,
+			},
+		},
+
+		// Non-absolute base commit
+		{
+			Repo:       "foo",
+			URL:        "u",
+			Commit:     "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			BaseCommit: "HEAD~1",
+			PatternInfo: protocol.PatternInfo{
+				Pattern: "test",
+			},
+		},
+
+		// base commit without a ChangedFiles hook
+		{
+			Repo:       "foo",
+			URL:        "u",
+			Commit:     "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			BaseCommit: "0123456789012345678901234567890123456789",
+			PatternInfo: protocol.PatternInfo{
+				Pattern: "test",
+			},
+		},
+
+		// Token match of a regular expression
+		{
+			Repo:   "foo",
+			URL:    "u",
+			Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			PatternInfo: protocol.PatternInfo{
+				Pattern:      "foo.* bar",
+				IsRegExp:     true,
+				IsTokenMatch: true,
+			},
+		},
+
+		// Diff content without a base commit
+		{
+			Repo:        "foo",
+			URL:         "u",
+			Commit:      "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			DiffContent: true,
+			PatternInfo: protocol.PatternInfo{
+				Pattern: "test",
+			},
+		},
+
+		// Content of diff content searches
+		{
+			Repo:           "foo",
+			URL:            "u",
+			Commit:         "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			BaseCommit:     "0123456789012345678901234567890123456789",
+			DiffContent:    true,
+			IncludeContent: true,
+			PatternInfo: protocol.PatternInfo{
+				Pattern: "test",
+			},
+		},
+
+		// Unknown priority
+		{
+			Repo:     "foo",
+			URL:      "u",
+			Commit:   "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+			Priority: "urgent",
+			PatternInfo: protocol.PatternInfo{
+				Pattern: "test",
+			},
+		},
 	}
 
 	store, cleanup, err := newStore(nil)
@@ -534,3 +932,39 @@ type sortByLineNumber []protocol.LineMatch
 func (m sortByLineNumber) Len() int           { return len(m) }
 func (m sortByLineNumber) Less(i, j int) bool { return m[i].LineNumber < m[j].LineNumber }
 func (m sortByLineNumber) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+func TestSearch_stopSearches(t *testing.T) {
+	s, cleanup, err := newStore(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	fetching := make(chan struct{})
+	unblock := make(chan struct{})
+	defer close(unblock)
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		close(fetching)
+		<-unblock
+		return nil, errors.New("unblocked")
+	}
+
+	service := &search.Service{Store: s}
+	ts := httptest.NewServer(service)
+	defer ts.Close()
+
+	go func() {
+		<-fetching
+		service.StopSearches()
+	}()
+
+	_, err = doSearch(ts.URL, &protocol.Request{
+		Repo:         "foo",
+		Commit:       "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+		PatternInfo:  protocol.PatternInfo{Pattern: "foo", PatternMatchesContent: true},
+		FetchTimeout: "1m",
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected the stopped search to report a deadline hit, got %v", err)
+	}
+}
@@ -3,15 +3,31 @@ package search
 import (
 	"context"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
 )
 
 type matchSender interface {
 	Send(protocol.FileMatch)
+	// SkipTooLarge records that a file wasn't searched because it is larger
+	// than the maximum file size of the request.
+	SkipTooLarge()
+	TooLargeCount() int
+	// Scanned records that n of the total files of the archive were
+	// considered by the search. n is less than total if the search stopped
+	// early, for example because its deadline was hit.
+	Scanned(n, total int)
+	ScannedCount() (n, total int)
 	SentCount() int
 	Remaining() int
+	// RemainingBytes is the size of the previews which may still be sent,
+	// or a negative number if it is unlimited.
+	RemainingBytes() int
 	LimitHit() bool
+	// LimitReasons are the reasons the matches sent may be incomplete,
+	// including the reasons of the matches themselves.
+	LimitReasons() []protocol.LimitReason
 }
 
 type limitedStreamCollector struct {
@@ -20,6 +36,10 @@ type limitedStreamCollector struct {
 	sentCount int
 	remaining int
 	limitHit  bool
+	reasons   []protocol.LimitReason
+	tooLarge  int
+	scanned   int
+	total     int
 	cancel    context.CancelFunc
 }
 
@@ -36,6 +56,7 @@ func (m *limitedStreamCollector) Send(match protocol.FileMatch) {
 	m.mux.Lock()
 	if match.MatchCount <= m.remaining {
 		m.collected = append(m.collected, match)
+		m.reasons = addMatchLimitReasons(m.reasons, match)
 		m.remaining -= match.MatchCount
 		m.sentCount += match.MatchCount
 		m.mux.Unlock()
@@ -43,10 +64,11 @@ func (m *limitedStreamCollector) Send(match protocol.FileMatch) {
 	}
 
 	m.limitHit = true
+	m.reasons = protocol.AddLimitReason(m.reasons, protocol.LimitReasonFileMatches)
 	m.cancel()
 
 	// Can't truncate a path match
-	if len(match.LineMatches) == 0 {
+	if len(match.LineMatches) == 0 && len(match.ChunkMatches) == 0 {
 		m.mux.Unlock()
 		return
 	}
@@ -57,15 +79,41 @@ func (m *limitedStreamCollector) Send(match protocol.FileMatch) {
 	// information required to properly limit. However, multiline matches
 	// are also not limited correctly in the frontend, so doing it correctly
 	// here won't fix that.
-	match.LineMatches = match.LineMatches[:m.remaining]
+	match = truncateMatches(match, m.remaining)
 	match.LimitHit = true
+	match.LimitReasons = protocol.AddLimitReason(match.LimitReasons, protocol.LimitReasonLineMatches)
 	match.MatchCount = m.remaining
 	m.sentCount += m.remaining
 	m.remaining = 0
 	m.collected = append(m.collected, match)
+	m.reasons = addMatchLimitReasons(m.reasons, match)
 	m.mux.Unlock()
 }
 
+func (m *limitedStreamCollector) SkipTooLarge() {
+	m.mux.Lock()
+	m.tooLarge++
+	m.mux.Unlock()
+}
+
+func (m *limitedStreamCollector) TooLargeCount() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.tooLarge
+}
+
+func (m *limitedStreamCollector) Scanned(n, total int) {
+	m.mux.Lock()
+	m.scanned, m.total = n, total
+	m.mux.Unlock()
+}
+
+func (m *limitedStreamCollector) ScannedCount() (n, total int) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.scanned, m.total
+}
+
 func (m *limitedStreamCollector) SentCount() int {
 	m.mux.Lock()
 	defer m.mux.Unlock()
@@ -82,29 +130,183 @@ func (m *limitedStreamCollector) Remaining() int {
 	return m.remaining
 }
 
+func (m *limitedStreamCollector) RemainingBytes() int {
+	return -1
+}
+
 func (m *limitedStreamCollector) LimitHit() bool {
 	m.mux.Lock()
 	defer m.mux.Unlock()
 	return m.limitHit
 }
 
+func (m *limitedStreamCollector) LimitReasons() []protocol.LimitReason {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return append([]protocol.LimitReason(nil), m.reasons...)
+}
+
+// addMatchLimitReasons returns reasons with the limit reasons of match and of
+// its line matches added.
+func addMatchLimitReasons(reasons []protocol.LimitReason, match protocol.FileMatch) []protocol.LimitReason {
+	for _, r := range match.LimitReasons {
+		reasons = protocol.AddLimitReason(reasons, r)
+	}
+	for _, lm := range match.LineMatches {
+		for _, r := range lm.LimitReasons {
+			reasons = protocol.AddLimitReason(reasons, r)
+		}
+	}
+	return reasons
+}
+
+// requestLimits are the limits of a request on the files and lines returned,
+// in addition to its limit on the number of matches. Zero means no limit.
+type requestLimits struct {
+	maxFileMatches int
+	maxLineMatches int
+	maxLineSize    int
+	maxResultBytes int
+	maxContentSize int
+}
+
+// newRequestLimits returns the limits requested by p, capped by the limits
+// of t.
+func newRequestLimits(p *protocol.Request, t tuning) requestLimits {
+	return requestLimits{
+		maxFileMatches: capLimit(p.MaxFileMatches, t.maxFileMatches),
+		maxLineMatches: capLimit(p.MaxLineMatches, t.maxLineMatches),
+		maxLineSize:    capLimit(p.MaxLineSize, t.maxLineSize),
+		maxResultBytes: capLimit(p.MaxResultBytes, t.maxResultBytes),
+		maxContentSize: capLimit(p.MaxContentSize, t.maxContentSize),
+	}
+}
+
+// capLimit returns requested capped by max. Values less than or equal to
+// zero mean no limit.
+func capLimit(requested, max int) int {
+	if requested < 0 {
+		requested = 0
+	}
+	if max > 0 && (requested == 0 || requested > max) {
+		return max
+	}
+	return requested
+}
+
+// truncate applies the per file limits of l to match.
+func (l requestLimits) truncate(match protocol.FileMatch) protocol.FileMatch {
+	if l.maxLineMatches > 0 && len(match.LineMatches) > l.maxLineMatches {
+		match.LineMatches = match.LineMatches[:l.maxLineMatches]
+		match.Symbols = alignSymbols(match)
+		match.MatchCount = len(match.LineMatches)
+		match.LimitHit = true
+		match.LimitReasons = protocol.AddLimitReason(match.LimitReasons, protocol.LimitReasonLineMatches)
+	}
+	if l.maxLineMatches > 0 && countRanges(match.ChunkMatches) > l.maxLineMatches {
+		match.ChunkMatches = truncateChunks(match.ChunkMatches, l.maxLineMatches)
+		match.MatchCount = l.maxLineMatches
+		match.LimitHit = true
+		match.LimitReasons = protocol.AddLimitReason(match.LimitReasons, protocol.LimitReasonLineMatches)
+	}
+	if l.maxLineSize > 0 {
+		for i, lm := range match.LineMatches {
+			if len(lm.Preview) > l.maxLineSize {
+				match.LineMatches[i] = truncateLine(lm, l.maxLineSize)
+			}
+		}
+	}
+	return match
+}
+
+// truncateMatches returns match with only its first n LineMatches, or the
+// first n ranges of its ChunkMatches.
+func truncateMatches(match protocol.FileMatch, n int) protocol.FileMatch {
+	if len(match.ChunkMatches) > 0 {
+		match.ChunkMatches = truncateChunks(match.ChunkMatches, n)
+		return match
+	}
+	match.LineMatches = match.LineMatches[:n]
+	match.Symbols = alignSymbols(match)
+	return match
+}
+
+// alignSymbols returns the Symbols of match which are found on its
+// LineMatches, after the LineMatches have been truncated.
+func alignSymbols(match protocol.FileMatch) []protocol.SymbolMatch {
+	if len(match.Symbols) > len(match.LineMatches) {
+		return match.Symbols[:len(match.LineMatches)]
+	}
+	return match.Symbols
+}
+
+// truncateLine truncates the preview of lm to at most size bytes, without
+// splitting a rune. size must be less than the length of the preview. Match
+// ranges past the end of the preview are clipped.
+func truncateLine(lm protocol.LineMatch, size int) protocol.LineMatch {
+	for size > 0 && !utf8.RuneStart(lm.Preview[size]) {
+		size--
+	}
+	lm.Preview = lm.Preview[:size]
+	lm.LimitReasons = protocol.AddLimitReason(lm.LimitReasons, protocol.LimitReasonLineTooLong)
+
+	n := utf8.RuneCountInString(lm.Preview)
+	clip := func(ols [][2]int) [][2]int {
+		clipped := make([][2]int, 0, len(ols))
+		for _, ol := range ols {
+			offset, length := ol[0], ol[1]
+			if offset > n {
+				offset = n
+			}
+			if offset+length > n {
+				length = n - offset
+			}
+			if offset != ol[0] || length != ol[1] {
+				lm.LimitReasons = protocol.AddLimitReason(lm.LimitReasons, protocol.LimitReasonOffsets)
+			}
+			clipped = append(clipped, [2]int{offset, length})
+		}
+		return clipped
+	}
+
+	lm.OffsetAndLengths = clip(lm.OffsetAndLengths)
+	if lm.CaptureGroups != nil {
+		captureGroups := make([][][2]int, len(lm.CaptureGroups))
+		for i, groups := range lm.CaptureGroups {
+			if groups != nil {
+				captureGroups[i] = clip(groups)
+			}
+		}
+		lm.CaptureGroups = captureGroups
+	}
+	return lm
+}
+
 type limitedStream struct {
 	cb        func(protocol.FileMatch)
+	limits    requestLimits
 	mux       sync.Mutex
 	sentCount int
+	sentFiles int
+	sentBytes int
 	remaining int
 	limitHit  bool
+	reasons   []protocol.LimitReason
+	tooLarge  int
+	scanned   int
+	total     int
 	cancel    context.CancelFunc
 }
 
 // newLimitedStream creates a stream that will limit the number of matches passed through it,
 // cancelling the context it returns when that happens. For each match sent to the stream,
 // if it hasn't hit the limit, it will call the onMatch callback with that match. The onMatch
-// callback will never be called concurrently.
-func newLimitedStream(ctx context.Context, limit int, cb func(protocol.FileMatch)) (context.Context, context.CancelFunc, *limitedStream) {
+// callback will never be called concurrently. Matches are additionally truncated to limits.
+func newLimitedStream(ctx context.Context, limit int, limits requestLimits, cb func(protocol.FileMatch)) (context.Context, context.CancelFunc, *limitedStream) {
 	ctx, cancel := context.WithCancel(ctx)
 	s := &limitedStream{
 		cb:        cb,
+		limits:    limits,
 		cancel:    cancel,
 		remaining: limit,
 	}
@@ -112,20 +314,86 @@ func newLimitedStream(ctx context.Context, limit int, cb func(protocol.FileMatch
 }
 
 func (m *limitedStream) Send(match protocol.FileMatch) {
+	match = m.limits.truncate(match)
+
 	m.mux.Lock()
+	if m.limits.maxFileMatches > 0 && m.sentFiles >= m.limits.maxFileMatches {
+		m.limitHit = true
+		m.reasons = protocol.AddLimitReason(m.reasons, protocol.LimitReasonFileMatches)
+		m.cancel()
+		m.mux.Unlock()
+		return
+	}
+	m.sentFiles++
+
+	if m.limits.maxResultBytes > 0 && len(match.ChunkMatches) > 0 {
+		n, size := 0, m.sentBytes
+		for ; n < len(match.ChunkMatches); n++ {
+			if size+len(match.ChunkMatches[n].Content) > m.limits.maxResultBytes {
+				break
+			}
+			size += len(match.ChunkMatches[n].Content)
+		}
+		m.sentBytes = size
+
+		if n < len(match.ChunkMatches) {
+			m.limitHit = true
+			m.reasons = protocol.AddLimitReason(m.reasons, protocol.LimitReasonResultBytes)
+			m.cancel()
+			if n == 0 {
+				m.mux.Unlock()
+				return
+			}
+			match.ChunkMatches = match.ChunkMatches[:n]
+			match.LimitHit = true
+			match.LimitReasons = protocol.AddLimitReason(match.LimitReasons, protocol.LimitReasonResultBytes)
+			if count := countRanges(match.ChunkMatches); match.MatchCount > count {
+				match.MatchCount = count
+			}
+		}
+	} else if m.limits.maxResultBytes > 0 {
+		n, size := 0, m.sentBytes
+		for ; n < len(match.LineMatches); n++ {
+			if size+len(match.LineMatches[n].Preview) > m.limits.maxResultBytes {
+				break
+			}
+			size += len(match.LineMatches[n].Preview)
+		}
+		m.sentBytes = size
+
+		if n < len(match.LineMatches) {
+			m.limitHit = true
+			m.reasons = protocol.AddLimitReason(m.reasons, protocol.LimitReasonResultBytes)
+			m.cancel()
+			if n == 0 {
+				m.mux.Unlock()
+				return
+			}
+			match.LineMatches = match.LineMatches[:n]
+			match.Symbols = alignSymbols(match)
+			match.LimitHit = true
+			match.LimitReasons = protocol.AddLimitReason(match.LimitReasons, protocol.LimitReasonResultBytes)
+			if match.MatchCount > n {
+				match.MatchCount = n
+			}
+		}
+	}
+
 	if match.MatchCount <= m.remaining {
 		m.remaining -= match.MatchCount
 		m.sentCount += match.MatchCount
+		m.reasons = addMatchLimitReasons(m.reasons, match)
 		m.cb(match)
 		m.mux.Unlock()
 		return
 	}
 
 	m.limitHit = true
+	m.reasons = protocol.AddLimitReason(m.reasons, protocol.LimitReasonFileMatches)
 	m.cancel()
 
 	// Can't truncate a path match
-	if len(match.LineMatches) == 0 {
+	if len(match.LineMatches) == 0 && len(match.ChunkMatches) == 0 {
 		m.mux.Unlock()
 		return
 	}
@@ -136,15 +404,41 @@ func (m *limitedStream) Send(match protocol.FileMatch) {
 	// information required to properly limit. However, multiline matches
 	// are also not limited correctly in the frontend, so doing it correctly
 	// here won't fix that.
-	match.LineMatches = match.LineMatches[:m.remaining]
+	match = truncateMatches(match, m.remaining)
 	match.LimitHit = true
+	match.LimitReasons = protocol.AddLimitReason(match.LimitReasons, protocol.LimitReasonLineMatches)
 	match.MatchCount = m.remaining
 	m.sentCount += m.remaining
 	m.remaining = 0
+	m.reasons = addMatchLimitReasons(m.reasons, match)
 	m.cb(match)
 	m.mux.Unlock()
 }
 
+func (m *limitedStream) SkipTooLarge() {
+	m.mux.Lock()
+	m.tooLarge++
+	m.mux.Unlock()
+}
+
+func (m *limitedStream) TooLargeCount() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.tooLarge
+}
+
+func (m *limitedStream) Scanned(n, total int) {
+	m.mux.Lock()
+	m.scanned, m.total = n, total
+	m.mux.Unlock()
+}
+
+func (m *limitedStream) ScannedCount() (n, total int) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.scanned, m.total
+}
+
 func (m *limitedStream) SentCount() int {
 	m.mux.Lock()
 	defer m.mux.Unlock()
@@ -157,8 +451,23 @@ func (m *limitedStream) Remaining() int {
 	return m.remaining
 }
 
+func (m *limitedStream) RemainingBytes() int {
+	if m.limits.maxResultBytes <= 0 {
+		return -1
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.limits.maxResultBytes - m.sentBytes
+}
+
 func (m *limitedStream) LimitHit() bool {
 	m.mux.Lock()
 	defer m.mux.Unlock()
 	return m.limitHit
 }
+
+func (m *limitedStream) LimitReasons() []protocol.LimitReason {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return append([]protocol.LimitReason(nil), m.reasons...)
+}
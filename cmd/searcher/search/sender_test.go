@@ -0,0 +1,75 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+)
+
+func TestNewRequestLimits(t *testing.T) {
+	p := &protocol.Request{MaxFileMatches: 5, MaxLineMatches: 0, MaxLineSize: -1}
+	got := newRequestLimits(p, tuning{maxFileMatches: 2, maxLineMatches: 10})
+	want := requestLimits{maxFileMatches: 2, maxLineMatches: 10, maxLineSize: 0}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(requestLimits{})); diff != "" {
+		t.Fatalf("unexpected limits (-want +got):\n%s", diff)
+	}
+
+	p = &protocol.Request{MaxFileMatches: 1, MaxLineMatches: 3}
+	got = newRequestLimits(p, tuning{maxFileMatches: 2})
+	want = requestLimits{maxFileMatches: 1, maxLineMatches: 3}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(requestLimits{})); diff != "" {
+		t.Fatalf("unexpected limits (-want +got):\n%s", diff)
+	}
+}
+
+func TestLimitedStream_requestLimits(t *testing.T) {
+	var got []protocol.FileMatch
+	limits := requestLimits{maxFileMatches: 2, maxLineMatches: 2, maxLineSize: 10}
+	ctx, cancel, stream := newLimitedStream(context.Background(), 100, limits, func(fm protocol.FileMatch) {
+		got = append(got, fm)
+	})
+	defer cancel()
+
+	stream.Send(protocol.FileMatch{Path: "a", MatchCount: 3, LineMatches: []protocol.LineMatch{
+		{Preview: "foo", OffsetAndLengths: [][2]int{{0, 3}}},
+		{Preview: "bar foo bär baz", OffsetAndLengths: [][2]int{{4, 3}, {8, 3}, {12, 3}}},
+		{Preview: "foo", OffsetAndLengths: [][2]int{{0, 3}}},
+	}})
+	stream.Send(protocol.FileMatch{Path: "b", MatchCount: 1})
+	if stream.LimitHit() {
+		t.Fatal("unexpected limit hit")
+	}
+	stream.Send(protocol.FileMatch{Path: "c", MatchCount: 1})
+	if !stream.LimitHit() || ctx.Err() == nil {
+		t.Fatal("expected the file limit to be hit")
+	}
+
+	want := []protocol.FileMatch{
+		{Path: "a", MatchCount: 2, LimitHit: true, LimitReasons: []protocol.LimitReason{protocol.LimitReasonLineMatches}, LineMatches: []protocol.LineMatch{
+			{Preview: "foo", OffsetAndLengths: [][2]int{{0, 3}}},
+			// The preview is cut before ä, which is two bytes.
+			{
+				Preview:          "bar foo b",
+				OffsetAndLengths: [][2]int{{4, 3}, {8, 1}, {9, 0}},
+				LimitReasons:     []protocol.LimitReason{protocol.LimitReasonLineTooLong, protocol.LimitReasonOffsets},
+			},
+		}},
+		{Path: "b", MatchCount: 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected matches (-want +got):\n%s", diff)
+	}
+
+	wantReasons := []protocol.LimitReason{
+		protocol.LimitReasonLineMatches,
+		protocol.LimitReasonLineTooLong,
+		protocol.LimitReasonOffsets,
+		protocol.LimitReasonFileMatches,
+	}
+	if diff := cmp.Diff(wantReasons, stream.LimitReasons()); diff != "" {
+		t.Fatalf("unexpected limit reasons (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,139 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"github.com/sourcegraph/sourcegraph/internal/search/searcher"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+)
+
+// searchStats accumulates the statistics of a search which are returned in
+// its done event. It is safe for concurrent use.
+type searchStats struct {
+	filesSearched    atomic.Int64
+	filesPrefiltered atomic.Int64
+	bytesSearched    atomic.Int64
+
+	skippedPath     atomic.Int64
+	skippedFilter   atomic.Int64
+	skippedTooLarge atomic.Int64
+	skippedIndex    atomic.Int64
+
+	fetchTime atomic.Duration
+	cpuTime   atomic.Duration
+
+	// slowest is the files which took the longest to search. It is only
+	// recorded for traced searches, and is nil otherwise.
+	slowest *slowestFiles
+}
+
+type searchStatsKey struct{}
+
+// withSearchStats returns a context which makes the searches run with it
+// record their statistics in stats.
+func withSearchStats(ctx context.Context, stats *searchStats) context.Context {
+	return context.WithValue(ctx, searchStatsKey{}, stats)
+}
+
+// searchStatsFromContext returns the stats of ctx. If ctx has none, the
+// returned stats are discarded.
+func searchStatsFromContext(ctx context.Context) *searchStats {
+	if stats, ok := ctx.Value(searchStatsKey{}).(*searchStats); ok {
+		return stats
+	}
+	return &searchStats{}
+}
+
+// searched records that the content of f was searched in d.
+func (s *searchStats) searched(f *store.SrcFile, d time.Duration) {
+	s.filesSearched.Inc()
+	s.bytesSearched.Add(int64(f.Len))
+	s.cpuTime.Add(d)
+	if s.slowest != nil {
+		s.slowest.add(f.Name, d)
+	}
+}
+
+// toProto returns the stats of a search which ran for wallTime.
+func (s *searchStats) toProto(wallTime time.Duration) *searcher.SearchStats {
+	skipped := map[string]int{}
+	for reason, n := range map[string]int64{
+		"path":      s.skippedPath.Load(),
+		"filter":    s.skippedFilter.Load(),
+		"too_large": s.skippedTooLarge.Load(),
+		"index":     s.skippedIndex.Load(),
+	} {
+		if n > 0 {
+			skipped[reason] = int(n)
+		}
+	}
+	if len(skipped) == 0 {
+		skipped = nil
+	}
+
+	return &searcher.SearchStats{
+		FilesSearched:    int(s.filesSearched.Load()),
+		FilesSkipped:     skipped,
+		FilesPrefiltered: int(s.filesPrefiltered.Load()),
+		BytesSearched:    s.bytesSearched.Load(),
+		FetchTimeMs:      s.fetchTime.Load().Milliseconds(),
+		WallTimeMs:       wallTime.Milliseconds(),
+		CPUTimeMs:        s.cpuTime.Load().Milliseconds(),
+	}
+}
+
+// maxSlowestFiles is the number of files a slowestFiles keeps.
+const maxSlowestFiles = 10
+
+// slowestFiles keeps the maxSlowestFiles files which took the longest to
+// search, so that a slow search can be attributed to the files it spent its
+// time on. It is safe for concurrent use.
+type slowestFiles struct {
+	mu    sync.Mutex
+	files []fileDuration
+}
+
+type fileDuration struct {
+	name string
+	d    time.Duration
+}
+
+func (s *slowestFiles) add(name string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.files) < maxSlowestFiles {
+		s.files = append(s.files, fileDuration{name: name, d: d})
+		return
+	}
+	fastest := 0
+	for i, f := range s.files {
+		if f.d < s.files[fastest].d {
+			fastest = i
+		}
+	}
+	if d > s.files[fastest].d {
+		s.files[fastest] = fileDuration{name: name, d: d}
+	}
+}
+
+// String returns the files slowest first, with the time it took to search
+// them.
+func (s *slowestFiles) String() string {
+	s.mu.Lock()
+	files := append([]fileDuration(nil), s.files...)
+	s.mu.Unlock()
+	sort.Slice(files, func(i, j int) bool { return files[i].d > files[j].d })
+
+	parts := make([]string, 0, len(files))
+	for _, f := range files {
+		parts = append(parts, fmt.Sprintf("%s=%s", f.name, f.d))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,82 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/search/searcher"
+	storetest "github.com/sourcegraph/sourcegraph/internal/store/testutil"
+)
+
+func TestSearchStats(t *testing.T) {
+	zipData, err := storetest.CreateZip(map[string]string{
+		"match.go":    "foo\nx\n",
+		"nomatch.go":  "bar\n",
+		"skipped.txt": "foo\nx\n",
+		"large.go":    "foo\nx\nfoo\nx\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rg, err := compile(&protocol.PatternInfo{
+		// Matches span lines, so files without the required literal "oo"
+		// are rejected before running the regexp.
+		Pattern:                `\woo\s+x`,
+		IsRegExp:               true,
+		IncludePatterns:        []string{`\.go$`},
+		MaxFileSizeBytes:       8,
+		PathPatternsAreRegExps: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := &searchStats{}
+	ctx := withSearchStats(context.Background(), stats)
+	fms, _, err := regexSearchBatch(ctx, rg, zf, 100, true, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fms) != 1 || fms[0].Path != "match.go" {
+		t.Fatalf("unexpected matches %v", fms)
+	}
+
+	want := &searcher.SearchStats{
+		FilesSearched:    2,
+		FilesSkipped:     map[string]int{"path": 1, "too_large": 1},
+		FilesPrefiltered: 1,
+		BytesSearched:    int64(len("foo\nx\n") + len("bar\n")),
+	}
+	got := stats.toProto(0)
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(searcher.SearchStats{}, "CPUTimeMs")); diff != "" {
+		t.Errorf("unexpected stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestSlowestFiles(t *testing.T) {
+	var s slowestFiles
+	for i := 0; i < 2*maxSlowestFiles; i++ {
+		s.add(fmt.Sprintf("f%d", i), time.Duration(i)*time.Millisecond)
+	}
+	s.add("fast", 0)
+
+	var want []string
+	for i := 2*maxSlowestFiles - 1; i >= maxSlowestFiles; i-- {
+		want = append(want, fmt.Sprintf("f%d=%dms", i, i))
+	}
+	if got := s.String(); got != strings.Join(want, " ") {
+		t.Errorf("got %q, want %q", got, strings.Join(want, " "))
+	}
+}
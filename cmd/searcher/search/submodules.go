@@ -0,0 +1,124 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/config"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/store"
+)
+
+// Submodules returns the submodules of repo at commit, read from gitserver.
+// Submodules whose URL doesn't map to a repository name are left out.
+func Submodules(ctx context.Context, repo api.RepoName, commit api.CommitID) ([]store.Submodule, error) {
+	cmd := gitserver.DefaultClient.Command("git", "ls-tree", "-r", "-z", "--full-tree", string(commit))
+	cmd.Repo = repo
+	lsTree, err := cmd.Output(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gitlinks := parseGitlinks(lsTree)
+	if len(gitlinks) == 0 {
+		return nil, nil
+	}
+
+	cmd = gitserver.DefaultClient.Command("git", "show", string(commit)+":.gitmodules")
+	cmd.Repo = repo
+	gitmodules, err := cmd.Output(ctx)
+	if err != nil {
+		// A repository may have gitlinks without a .gitmodules, which git
+		// can't check out either.
+		return nil, nil
+	}
+	urls, err := parseGitmodules(gitmodules)
+	if err != nil {
+		return nil, err
+	}
+
+	var submodules []store.Submodule
+	for p, c := range gitlinks {
+		name := submoduleRepoName(repo, urls[p])
+		if name == "" {
+			continue
+		}
+		submodules = append(submodules, store.Submodule{Path: p, Repo: name, Commit: c})
+	}
+	return submodules, nil
+}
+
+// parseGitlinks returns the commit of each submodule in the output of git
+// ls-tree -z, by path.
+func parseGitlinks(lsTree []byte) map[string]api.CommitID {
+	gitlinks := map[string]api.CommitID{}
+	for _, line := range bytes.Split(lsTree, []byte{0}) {
+		// Each line is "<mode> <type> <object>\t<path>".
+		i := bytes.IndexByte(line, '\t')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(line[:i]))
+		if len(fields) != 3 || fields[1] != "commit" {
+			continue
+		}
+		gitlinks[string(line[i+1:])] = api.CommitID(fields[2])
+	}
+	return gitlinks
+}
+
+// parseGitmodules returns the URL of each submodule in a .gitmodules file,
+// by path.
+func parseGitmodules(gitmodules []byte) (map[string]string, error) {
+	var cfg config.Config
+	if err := config.NewDecoder(bytes.NewReader(gitmodules)).Decode(&cfg); err != nil {
+		return nil, errors.Wrap(err, "error parsing .gitmodules")
+	}
+	urls := map[string]string{}
+	for _, s := range cfg.Section("submodule").Subsections {
+		urls[s.Option("path")] = s.Option("url")
+	}
+	return urls, nil
+}
+
+// submoduleRepoName returns the name of the repository of a submodule of repo
+// cloned from rawURL, or an empty name if it has none. It assumes the
+// repository is named like its clone URL without scheme, user and ".git"
+// suffix, which is the default for code hosts.
+func submoduleRepoName(repo api.RepoName, rawURL string) api.RepoName {
+	var name string
+	switch {
+	case rawURL == "":
+		return ""
+	case strings.HasPrefix(rawURL, "./") || strings.HasPrefix(rawURL, "../"):
+		// Relative URLs are relative to the URL of repo.
+		name = path.Join(string(repo), rawURL)
+	case strings.Contains(rawURL, "://"):
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Hostname() == "" {
+			return ""
+		}
+		name = u.Hostname() + "/" + strings.TrimPrefix(u.Path, "/")
+	default:
+		// An scp-like URL, e.g. git@github.com:owner/repo.git.
+		i := strings.IndexByte(rawURL, ':')
+		if i < 0 {
+			return ""
+		}
+		host := rawURL[:i]
+		if j := strings.LastIndexByte(host, '@'); j >= 0 {
+			host = host[j+1:]
+		}
+		name = host + "/" + strings.TrimPrefix(rawURL[i+1:], "/")
+	}
+	name = strings.TrimSuffix(strings.TrimSuffix(name, "/"), ".git")
+	if strings.HasPrefix(name, "../") || !strings.Contains(name, "/") {
+		return ""
+	}
+	return api.RepoName(name)
+}
@@ -0,0 +1,48 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestParseSubmodules(t *testing.T) {
+	lsTree := "100644 blob 3b18e512dba79e4c8300dd08aeb37f8e728b8dad\t.gitmodules\x00" +
+		"160000 commit deadbeefdeadbeefdeadbeefdeadbeefdeadbeef\tvendor/lib\x00" +
+		"100644 blob 3b18e512dba79e4c8300dd08aeb37f8e728b8dad\tmain.go\x00"
+	if diff := cmp.Diff(map[string]api.CommitID{"vendor/lib": "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"}, parseGitlinks([]byte(lsTree))); diff != "" {
+		t.Errorf("unexpected gitlinks (-want +got):\n%s", diff)
+	}
+
+	gitmodules := `[submodule "lib"]
+	path = vendor/lib
+	url = https://github.com/owner/lib.git
+`
+	urls, err := parseGitmodules([]byte(gitmodules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]string{"vendor/lib": "https://github.com/owner/lib.git"}, urls); diff != "" {
+		t.Errorf("unexpected urls (-want +got):\n%s", diff)
+	}
+}
+
+func TestSubmoduleRepoName(t *testing.T) {
+	for url, want := range map[string]api.RepoName{
+		"https://github.com/owner/lib.git":      "github.com/owner/lib",
+		"https://user@gitlab.com:8443/a/b/lib/": "gitlab.com/a/b/lib",
+		"git@github.com:owner/lib.git":          "github.com/owner/lib",
+		"ssh://git@github.com/owner/lib":        "github.com/owner/lib",
+		"../lib.git":                            "github.com/owner/lib",
+		"./sub":                                 "github.com/owner/repo/sub",
+		"../../../../lib":                       "",
+		"/srv/git/lib":                          "",
+		"":                                      "",
+	} {
+		if got := submoduleRepoName("github.com/owner/repo", url); got != want {
+			t.Errorf("%q: got %q, want %q", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/search/casetransform"
+)
+
+// tokenMatcher matches the lines which contain all tokens of a pattern, in
+// any order. It is used for protocol.PatternInfo.IsTokenMatch.
+type tokenMatcher struct {
+	// res match each token with the options of the request.
+	res []*regexp.Regexp
+	// literals are the tokens as they appear in the input of res, ordered
+	// longest first since longer tokens are usually rarer. A line can only
+	// match if it contains all of them.
+	literals [][]byte
+}
+
+// compileTokens returns a tokenMatcher for the tokens of p.Pattern.
+func compileTokens(p *protocol.PatternInfo) (*tokenMatcher, error) {
+	tokens := strings.Fields(p.Pattern)
+	if len(tokens) == 0 {
+		return nil, errors.New("token match patterns must have at least one token")
+	}
+	sort.SliceStable(tokens, func(i, j int) bool { return len(tokens[i]) > len(tokens[j]) })
+
+	m := &tokenMatcher{}
+	for _, token := range tokens {
+		expr, err := patternExpr(token, p)
+		if err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		m.res = append(m.res, re)
+
+		lit := []byte(token)
+		if !p.IsCaseSensitive {
+			casetransform.BytesToLowerASCII(lit, lit)
+		}
+		m.literals = append(m.literals, lit)
+	}
+	return m, nil
+}
+
+// matchLine returns whether line contains all tokens of m.
+func (m *tokenMatcher) matchLine(line []byte) bool {
+	if !containsAll(line, m.literals) {
+		return false
+	}
+	for _, re := range m.res {
+		if !re.Match(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchString returns whether s contains all tokens of m. It is intended to
+// be used to match file paths.
+func (m *tokenMatcher) matchString(s string) bool {
+	return m.matchLine([]byte(s))
+}
+
+// findAllIndex returns the locations of the tokens on the lines of b which
+// contain all of them, ordered by position. At most n locations are
+// returned. Only the lines containing the longest token are considered, so
+// most lines are skipped with bytes.Index. It returns the error of ctx if
+// ctx is done while searching a large b.
+func (m *tokenMatcher) findAllIndex(ctx context.Context, b []byte, n int) ([][]int, error) {
+	var locs [][]int
+	nextCheck := findChunkSize
+	for pos := 0; pos < len(b) && len(locs) < n; {
+		if pos >= nextCheck {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			nextCheck = pos + findChunkSize
+		}
+
+		i := bytes.Index(b[pos:], m.literals[0])
+		if i < 0 {
+			break
+		}
+		lineStart := pos + bytes.LastIndexByte(b[pos:pos+i], '\n') + 1
+		lineEnd := len(b)
+		if j := bytes.IndexByte(b[pos+i:], '\n'); j >= 0 {
+			lineEnd = pos + i + j
+		}
+		pos = lineEnd + 1
+
+		line := b[lineStart:lineEnd]
+		if !m.matchLine(line) {
+			continue
+		}
+		for _, loc := range m.lineLocs(line) {
+			if len(locs) == n {
+				break
+			}
+			locs = append(locs, []int{lineStart + loc[0], lineStart + loc[1]})
+		}
+	}
+	return locs, nil
+}
+
+// lineLocs returns the locations of all tokens on line, ordered by position.
+// Locations overlapping an earlier one are dropped, so that a token which is
+// part of another one is only highlighted once.
+func (m *tokenMatcher) lineLocs(line []byte) [][]int {
+	var all [][]int
+	for _, re := range m.res {
+		all = append(all, re.FindAllIndex(line, -1)...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i][0] != all[j][0] {
+			return all[i][0] < all[j][0]
+		}
+		return all[i][1] > all[j][1]
+	})
+
+	locs := all[:0]
+	end := -1
+	for _, loc := range all {
+		if loc[0] < end {
+			continue
+		}
+		locs = append(locs, loc)
+		end = loc[1]
+	}
+	return locs
+}
+
+func containsAll(b []byte, subslices [][]byte) bool {
+	for _, s := range subslices {
+		if !bytes.Contains(b, s) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	storetest "github.com/sourcegraph/sourcegraph/internal/store/testutil"
+)
+
+func TestTokenMatch(t *testing.T) {
+	zipData, err := storetest.CreateZip(map[string]string{
+		"a.go": "func Route(w http.ResponseWriter)\nroute only\nhttp only\nhttp.Route\n",
+		"b.go": "route\nhttp\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rg, err := compile(&protocol.PatternInfo{Pattern: " http  route ", IsTokenMatch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fms, _, err := regexSearchBatch(context.Background(), rg, zf, 100, true, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []protocol.FileMatch{{
+		Path:       "a.go",
+		MatchCount: 2,
+		LineMatches: []protocol.LineMatch{
+			{Preview: "func Route(w http.ResponseWriter)", LineNumber: 0, OffsetAndLengths: [][2]int{{5, 5}, {13, 4}}},
+			{Preview: "http.Route", LineNumber: 3, OffsetAndLengths: [][2]int{{0, 4}, {5, 5}}},
+		},
+	}}
+	if diff := cmp.Diff(want, fms); diff != "" {
+		t.Fatalf("unexpected matches (-want +got):\n%s", diff)
+	}
+}
+
+func TestTokenMatcher(t *testing.T) {
+	m, err := compileTokens(&protocol.PatternInfo{Pattern: "foo foobar", IsCaseSensitive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// foo is part of foobar, so it is only highlighted on its own.
+	line := []byte("foobar and foo")
+	if got, want := m.lineLocs(line), [][]int{{0, 6}, {11, 14}}; !cmp.Equal(got, want) {
+		t.Errorf("got locations %v, want %v", got, want)
+	}
+
+	for s, want := range map[string]bool{
+		"foobar/foo.go": true,
+		"foo/bar.go":    false,
+		"Foobar/foo.go": false,
+	} {
+		if got := m.matchString(s); got != want {
+			t.Errorf("matchString(%q) = %v, want %v", s, got, want)
+		}
+	}
+
+	if _, err := compileTokens(&protocol.PatternInfo{Pattern: " \t"}); err == nil {
+		t.Error("expected a pattern without tokens to fail")
+	}
+}
@@ -0,0 +1,43 @@
+package search
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var (
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// decodeFile returns the content b of a file as UTF-8, so that patterns match
+// files written in other encodings:
+//
+//   - files starting with a UTF-16 byte order mark are decoded as UTF-16.
+//   - files which aren't valid UTF-8 are decoded as latin-1. We use
+//     Windows-1252, its superset, since that is what Windows editors write.
+//
+// Other files are returned as is. Decoding preserves the lines and the
+// number of characters on each line, so line numbers and character offsets
+// in the decoded content also apply to b.
+func decodeFile(b []byte) []byte {
+	var enc encoding.Encoding
+	switch {
+	case bytes.HasPrefix(b, utf16LEBOM) || bytes.HasPrefix(b, utf16BEBOM):
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case !utf8.Valid(b):
+		enc = charmap.Windows1252
+	default:
+		return b
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return b
+	}
+	return decoded
+}
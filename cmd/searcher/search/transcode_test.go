@@ -0,0 +1,28 @@
+package search
+
+import (
+	"testing"
+)
+
+func TestDecodeFile(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"utf8", []byte("café\n"), "café\n"},
+		{"ascii", []byte("cafe\n"), "cafe\n"},
+		{"latin1", []byte("caf\xe9\n"), "café\n"},
+		{"windows1252", []byte("\x80 5\n"), "€ 5\n"},
+		{"utf16le", []byte{0xFF, 0xFE, 'h', 0, 0xE9, 0, '\n', 0}, "hé\n"},
+		{"utf16be", []byte{0xFE, 0xFF, 0, 'h', 0, 0xE9, 0, '\n'}, "hé\n"},
+		{"empty", nil, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := string(decodeFile(tc.in)); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
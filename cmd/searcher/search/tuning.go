@@ -0,0 +1,146 @@
+package search
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/inconshreveable/log15"
+
+	"github.com/sourcegraph/sourcegraph/internal/conf"
+	"github.com/sourcegraph/sourcegraph/internal/env"
+	"github.com/sourcegraph/sourcegraph/schema"
+)
+
+// tuning contains the limits and tuning of searcher which can be changed at
+// runtime with the "search.searcher" site configuration.
+type tuning struct {
+	// workers is the number of concurrent readerGreps in regexSearch.
+	workers int
+	// maxTotalWorkers limits the workers of all concurrent searches. Zero
+	// means no limit.
+	maxTotalWorkers int
+	// maxBatchWorkers limits the workers of all concurrent batch priority
+	// searches.
+	maxBatchWorkers int
+	// maxMatches caps the limit of each search. Zero means no cap.
+	maxMatches int
+	// maxFileMatches, maxLineMatches and maxLineSize cap the corresponding
+	// limits of each search. Zero means no cap.
+	maxFileMatches int
+	maxLineMatches int
+	maxLineSize    int
+	// maxResultBytes caps the total size of the previews of each search.
+	// Zero means no cap.
+	maxResultBytes int
+	// maxContentSize caps the size of the content of each file returned.
+	// Zero means no cap.
+	maxContentSize int
+	// fetchTimeout is used for searches which don't specify a fetch timeout.
+	fetchTimeout time.Duration
+	// maxTimeout caps the duration of each search. Zero means no cap.
+	maxTimeout time.Duration
+	// maxConcurrentSearchesPerRepo limits the concurrent searches of each
+	// repository. Zero means unlimited.
+	maxConcurrentSearchesPerRepo int
+	// cacheSizeBytes overrides Store.MaxCacheSizeBytes. Zero means no
+	// override.
+	cacheSizeBytes int64
+}
+
+var defaultTuning = tuning{
+	workers:      env.MustGetInt("SEARCHER_WORKERS", numWorkers, "number of workers which concurrently search the files of a repository for a single search"),
+	fetchTimeout: 500 * time.Millisecond,
+
+	maxBatchWorkers: defaultMaxBatchWorkers(),
+	maxResultBytes:  100 * 1000 * 1000,
+	maxContentSize:  1000 * 1000,
+}
+
+// defaultMaxBatchWorkers lets batch priority searches use half the CPUs.
+func defaultMaxBatchWorkers() int {
+	if n := runtime.GOMAXPROCS(0) / 2; n > 1 {
+		return n
+	}
+	return 1
+}
+
+var currentTuning atomic.Value // tuning
+
+func getTuning() tuning {
+	if t, ok := currentTuning.Load().(tuning); ok {
+		return t
+	}
+	return defaultTuning
+}
+
+func tuningFromConfig(c *schema.SearchSearcher) tuning {
+	t := defaultTuning
+	if c == nil {
+		return t
+	}
+
+	if c.Workers > 0 {
+		t.workers = c.Workers
+	}
+	if c.MaxTotalWorkers > 0 {
+		t.maxTotalWorkers = c.MaxTotalWorkers
+	}
+	if c.MaxBatchWorkers > 0 {
+		t.maxBatchWorkers = c.MaxBatchWorkers
+	}
+	if c.MaxMatches > 0 {
+		t.maxMatches = c.MaxMatches
+	}
+	if c.MaxFileMatches > 0 {
+		t.maxFileMatches = c.MaxFileMatches
+	}
+	if c.MaxLineMatches > 0 {
+		t.maxLineMatches = c.MaxLineMatches
+	}
+	if c.MaxLineSize > 0 {
+		t.maxLineSize = c.MaxLineSize
+	}
+	if c.MaxResultBytes > 0 {
+		t.maxResultBytes = c.MaxResultBytes
+	}
+	if c.MaxContentSize > 0 {
+		t.maxContentSize = c.MaxContentSize
+	}
+	if c.FetchTimeoutMilliseconds > 0 {
+		t.fetchTimeout = time.Duration(c.FetchTimeoutMilliseconds) * time.Millisecond
+	}
+	if c.MaxTimeoutSeconds > 0 {
+		t.maxTimeout = time.Duration(c.MaxTimeoutSeconds) * time.Second
+	}
+	if c.MaxConcurrentSearchesPerRepo > 0 {
+		t.maxConcurrentSearchesPerRepo = c.MaxConcurrentSearchesPerRepo
+	}
+	if c.CacheSizeMB > 0 {
+		t.cacheSizeBytes = int64(c.CacheSizeMB) * 1000 * 1000
+	}
+	return t
+}
+
+// WatchConfig applies the "search.searcher" site configuration now and
+// whenever it changes, so that operators can tune searcher without
+// restarting it.
+func (s *Service) WatchConfig() {
+	defaultCacheSizeBytes := s.Store.MaxCacheSizeBytes
+
+	conf.Watch(func() {
+		t := tuningFromConfig(conf.Get().SearchSearcher)
+		if t == getTuning() {
+			return
+		}
+		currentTuning.Store(t)
+
+		cacheSizeBytes := defaultCacheSizeBytes
+		if t.cacheSizeBytes > 0 {
+			cacheSizeBytes = t.cacheSizeBytes
+		}
+		s.Store.SetMaxCacheSizeBytes(cacheSizeBytes)
+
+		log15.Info("searcher: applied configuration", "workers", t.workers, "maxTotalWorkers", t.maxTotalWorkers, "maxBatchWorkers", t.maxBatchWorkers, "maxMatches", t.maxMatches, "maxFileMatches", t.maxFileMatches, "maxLineMatches", t.maxLineMatches, "maxLineSize", t.maxLineSize, "maxResultBytes", t.maxResultBytes, "maxContentSize", t.maxContentSize, "fetchTimeout", t.fetchTimeout, "maxTimeout", t.maxTimeout, "maxConcurrentSearchesPerRepo", t.maxConcurrentSearchesPerRepo, "cacheSizeBytes", cacheSizeBytes)
+	})
+}
@@ -0,0 +1,53 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/schema"
+)
+
+func TestTuningFromConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		c    *schema.SearchSearcher
+		want tuning
+	}{
+		{name: "unset", c: nil, want: defaultTuning},
+		{name: "empty", c: &schema.SearchSearcher{}, want: defaultTuning},
+		{
+			name: "invalid values use defaults",
+			c:    &schema.SearchSearcher{Workers: -1, MaxTotalWorkers: -1, MaxBatchWorkers: -1, MaxMatches: -1, MaxFileMatches: -1, MaxLineMatches: -1, MaxLineSize: -1, MaxResultBytes: -1, MaxContentSize: -1, FetchTimeoutMilliseconds: -1, MaxTimeoutSeconds: -1, MaxConcurrentSearchesPerRepo: -1, CacheSizeMB: -1},
+			want: defaultTuning,
+		},
+		{
+			name: "all",
+			c:    &schema.SearchSearcher{Workers: 2, MaxTotalWorkers: 16, MaxBatchWorkers: 3, MaxMatches: 100, MaxFileMatches: 10, MaxLineMatches: 5, MaxLineSize: 200, MaxResultBytes: 1000, MaxContentSize: 500, FetchTimeoutMilliseconds: 2000, MaxTimeoutSeconds: 30, MaxConcurrentSearchesPerRepo: 4, CacheSizeMB: 10},
+			want: tuning{
+				workers:                      2,
+				maxTotalWorkers:              16,
+				maxBatchWorkers:              3,
+				maxMatches:                   100,
+				maxFileMatches:               10,
+				maxLineMatches:               5,
+				maxLineSize:                  200,
+				maxResultBytes:               1000,
+				maxContentSize:               500,
+				fetchTimeout:                 2 * time.Second,
+				maxTimeout:                   30 * time.Second,
+				maxConcurrentSearchesPerRepo: 4,
+				cacheSizeBytes:               10 * 1000 * 1000,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, tuningFromConfig(tt.c), cmp.AllowUnexported(tuning{})); diff != "" {
+				t.Fatalf("unexpected tuning (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
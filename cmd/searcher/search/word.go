@@ -0,0 +1,115 @@
+package search
+
+import (
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-enry/go-enry/v2"
+)
+
+// wordBoundaries returns whether a match of pattern starts and ends with a
+// word character. A word match only requires a word boundary at those ends,
+// since punctuation like the "-" of "-foo" or the "()" of "foo()" already
+// delimits the pattern. Ends which can't be determined are assumed to be
+// word characters.
+func wordBoundaries(pattern string, isRegExp bool) (start, end bool) {
+	if !isRegExp {
+		first, _ := utf8.DecodeRuneInString(pattern)
+		last, _ := utf8.DecodeLastRuneInString(pattern)
+		return isWordChar(first), isWordChar(last)
+	}
+
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return true, true
+	}
+	re = re.Simplify()
+	return edgeIsWordChar(re, false), edgeIsWordChar(re, true)
+}
+
+// edgeIsWordChar returns whether matches of re may start, or end if last
+// is true, with a word character.
+func edgeIsWordChar(re *syntax.Regexp, last bool) bool {
+	switch re.Op {
+	case syntax.OpCapture:
+		return edgeIsWordChar(re.Sub[0], last)
+	case syntax.OpConcat:
+		if len(re.Sub) == 0 {
+			return true
+		}
+		if last {
+			return edgeIsWordChar(re.Sub[len(re.Sub)-1], last)
+		}
+		return edgeIsWordChar(re.Sub[0], last)
+	case syntax.OpLiteral:
+		if len(re.Rune) == 0 {
+			return true
+		}
+		if last {
+			return isWordChar(re.Rune[len(re.Rune)-1])
+		}
+		return isWordChar(re.Rune[0])
+	default:
+		return true
+	}
+}
+
+// isWordChar returns whether r matches \w.
+func isWordChar(r rune) bool {
+	return r < utf8.RuneSelf && syntax.IsWordChar(r)
+}
+
+// identifierChars are the characters besides letters, digits and underscore
+// which are part of identifiers, by language. A word match doesn't match
+// next to them, so that foo doesn't match $foo in JavaScript.
+var identifierChars = map[string]struct{ leading, trailing string }{
+	"JavaScript":  {"$", "$"},
+	"TypeScript":  {"$", "$"},
+	"PHP":         {"$", ""},
+	"CSS":         {"-", "-"},
+	"SCSS":        {"-", "-"},
+	"Less":        {"-", "-"},
+	"Clojure":     {"-*?!", "-*?!"},
+	"Common Lisp": {"-*?!", "-*?!"},
+	"Emacs Lisp":  {"-*?!", "-*?!"},
+	"Scheme":      {"-*?!", "-*?!"},
+	"Ruby":        {"", "?!"},
+	"Elixir":      {"", "?!"},
+}
+
+// languageIdentifierChars returns the characters which may not precede and
+// follow a word match in the files of languages.
+func languageIdentifierChars(languages []string) (leading, trailing string) {
+	for _, l := range languages {
+		lang, ok := enry.GetLanguageByAlias(l)
+		if !ok {
+			continue
+		}
+		chars := identifierChars[lang]
+		leading = addChars(leading, chars.leading)
+		trailing = addChars(trailing, chars.trailing)
+	}
+	return leading, trailing
+}
+
+func addChars(set, chars string) string {
+	for _, c := range chars {
+		if !strings.ContainsRune(set, c) {
+			set += string(c)
+		}
+	}
+	return set
+}
+
+// atIdentifierBoundary returns whether the match b[start:end] is neither
+// preceded nor followed by the identifier characters of rg.
+func (rg *readerGrep) atIdentifierBoundary(b []byte, start, end int) bool {
+	if rg.leadingIdentChars != "" && start > 0 && strings.IndexByte(rg.leadingIdentChars, b[start-1]) >= 0 {
+		return false
+	}
+	if rg.trailingIdentChars != "" && end < len(b) && strings.IndexByte(rg.trailingIdentChars, b[end]) >= 0 {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	storetest "github.com/sourcegraph/sourcegraph/internal/store/testutil"
+)
+
+func TestWordBoundaries(t *testing.T) {
+	cases := []struct {
+		pattern    string
+		isRegExp   bool
+		start, end bool
+	}{
+		{pattern: "foo", start: true, end: true},
+		{pattern: "-foo", start: false, end: true},
+		{pattern: "foo()", start: true, end: false},
+		{pattern: "$foo.bar", start: false, end: true},
+		{pattern: `\(foo\)`, isRegExp: true, start: false, end: false},
+		{pattern: `(-foo|bar)`, isRegExp: true, start: true, end: true},
+		{pattern: `foo\.`, isRegExp: true, start: true, end: false},
+		{pattern: `.*foo`, isRegExp: true, start: true, end: true},
+	}
+	for _, tc := range cases {
+		start, end := wordBoundaries(tc.pattern, tc.isRegExp)
+		if start != tc.start || end != tc.end {
+			t.Errorf("wordBoundaries(%q) = %v, %v, want %v, %v", tc.pattern, start, end, tc.start, tc.end)
+		}
+	}
+}
+
+func TestWordMatch(t *testing.T) {
+	zipData, err := storetest.CreateZip(map[string]string{
+		"main.js": "-foo x-foo\nfoo() foo()x\n$bar bar bar$\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := storetest.MockZipFile(zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		pattern   string
+		languages []string
+		want      []protocol.LineMatch
+	}{{
+		// Punctuation delimits the pattern, so x-foo matches.
+		pattern: "-foo",
+		want: []protocol.LineMatch{
+			{Preview: "-foo x-foo", LineNumber: 0, OffsetAndLengths: [][2]int{{0, 4}, {6, 4}}},
+		},
+	}, {
+		pattern: "foo()",
+		want: []protocol.LineMatch{
+			{Preview: "foo() foo()x", LineNumber: 1, OffsetAndLengths: [][2]int{{0, 5}, {6, 5}}},
+		},
+	}, {
+		pattern: "bar",
+		want: []protocol.LineMatch{
+			{Preview: "$bar bar bar$", LineNumber: 2, OffsetAndLengths: [][2]int{{1, 3}, {5, 3}, {9, 3}}},
+		},
+	}, {
+		// $ is part of identifiers in JavaScript.
+		pattern:   "bar",
+		languages: []string{"javascript"},
+		want: []protocol.LineMatch{
+			{Preview: "$bar bar bar$", LineNumber: 2, OffsetAndLengths: [][2]int{{5, 3}}},
+		},
+	}}
+	for _, tc := range cases {
+		rg, err := compile(&protocol.PatternInfo{Pattern: tc.pattern, IsWordMatch: true, Languages: tc.languages})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fms, _, err := regexSearchBatch(context.Background(), rg, zf, 100, true, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []protocol.LineMatch
+		for _, fm := range fms {
+			got = append(got, fm.LineMatches...)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%s %v: unexpected matches (-want +got):\n%s", tc.pattern, tc.languages, diff)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package search
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+)
+
+// activeSearches is the number of searches running workers on this replica.
+var activeSearches atomic.Int64
+
+var batchWorkers = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "searcher_service_batch_workers",
+	Help: "Number of running workers of batch priority searches.",
+})
+
+// workerOptions are the options of a request for the workers of its searches.
+type workerOptions struct {
+	// requested if positive is the number of workers requested.
+	requested int
+	priority  protocol.Priority
+}
+
+type workerOptionsKey struct{}
+
+// withWorkerOptions returns a context which makes the searches run with it
+// use the workers requested by p.
+func withWorkerOptions(ctx context.Context, p *protocol.Request) context.Context {
+	return context.WithValue(ctx, workerOptionsKey{}, workerOptions{requested: p.Workers, priority: p.Priority})
+}
+
+func workerOptionsFromContext(ctx context.Context) workerOptions {
+	opts, _ := ctx.Value(workerOptionsKey{}).(workerOptions)
+	return opts
+}
+
+// acquireWorkers returns the number of workers a search with ctx runs. It is
+// the number of workers of the tuning, or fewer if the search requested
+// fewer or if the searches already running use up most of maxTotalWorkers.
+// The returned function must be called once the workers are done.
+func acquireWorkers(ctx context.Context) (int, func()) {
+	active := activeSearches.Inc()
+	return searchWorkers(ctx, getTuning(), int(active)), func() { activeSearches.Dec() }
+}
+
+// searchWorkers returns the number of workers of a search with ctx while
+// active searches, including it, are running.
+func searchWorkers(ctx context.Context, t tuning, active int) int {
+	n := t.workers
+	if requested := workerOptionsFromContext(ctx).requested; requested > 0 && requested < n {
+		n = requested
+	}
+	if t.maxTotalWorkers > 0 && active > 0 {
+		if share := t.maxTotalWorkers / active; share < n {
+			n = share
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// batchSlots is the semaphore for the workers of batch priority searches. It
+// is replaced when maxBatchWorkers changes. Workers holding a slot of the
+// previous semaphore release it there.
+var batchSlots struct {
+	sync.Mutex
+	n   int
+	sem *semaphore.Weighted
+}
+
+func batchSemaphore(n int) *semaphore.Weighted {
+	batchSlots.Lock()
+	defer batchSlots.Unlock()
+	if batchSlots.sem == nil || batchSlots.n != n {
+		batchSlots.n = n
+		batchSlots.sem = semaphore.NewWeighted(int64(n))
+	}
+	return batchSlots.sem
+}
+
+// acquireWorkerSlot waits until a worker of a search with ctx may run. Only
+// the workers of batch priority searches wait, for one of maxBatchWorkers
+// slots. The returned function releases the slot once the worker is done.
+func acquireWorkerSlot(ctx context.Context) (func(), error) {
+	if workerOptionsFromContext(ctx).priority != protocol.PriorityBatch {
+		return func() {}, nil
+	}
+	sem := batchSemaphore(getTuning().maxBatchWorkers)
+	if err := sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	batchWorkers.Inc()
+	return func() {
+		batchWorkers.Dec()
+		sem.Release(1)
+	}, nil
+}
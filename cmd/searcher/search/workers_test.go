@@ -0,0 +1,71 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+)
+
+func TestSearchWorkers(t *testing.T) {
+	cases := []struct {
+		name      string
+		tuning    tuning
+		requested int
+		active    int
+		want      int
+	}{
+		{name: "default", tuning: tuning{workers: 8}, active: 1, want: 8},
+		{name: "requested fewer", tuning: tuning{workers: 8}, requested: 2, active: 1, want: 2},
+		{name: "requested more", tuning: tuning{workers: 8}, requested: 16, active: 1, want: 8},
+		{name: "unlimited total", tuning: tuning{workers: 8}, active: 100, want: 8},
+		{name: "total not used up", tuning: tuning{workers: 8, maxTotalWorkers: 32}, active: 4, want: 8},
+		{name: "share of total", tuning: tuning{workers: 8, maxTotalWorkers: 32}, active: 8, want: 4},
+		{name: "at least one", tuning: tuning{workers: 8, maxTotalWorkers: 32}, active: 100, want: 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := withWorkerOptions(context.Background(), &protocol.Request{Workers: tc.requested})
+			if got := searchWorkers(ctx, tc.tuning, tc.active); got != tc.want {
+				t.Errorf("got %d workers, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAcquireWorkerSlot(t *testing.T) {
+	old := getTuning()
+	defer currentTuning.Store(old)
+	tun := old
+	tun.maxBatchWorkers = 1
+	currentTuning.Store(tun)
+
+	batch := withWorkerOptions(context.Background(), &protocol.Request{Priority: protocol.PriorityBatch})
+	release, err := acquireWorkerSlot(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Interactive workers never wait for a slot.
+	interactive := withWorkerOptions(context.Background(), &protocol.Request{})
+	releaseInteractive, err := acquireWorkerSlot(interactive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseInteractive()
+
+	// A second batch worker waits until the first is done.
+	ctx, cancel := context.WithTimeout(batch, 10*time.Millisecond)
+	defer cancel()
+	if _, err := acquireWorkerSlot(ctx); err == nil {
+		t.Fatal("expected second batch worker to wait for a slot")
+	}
+
+	release()
+	release, err = acquireWorkerSlot(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
@@ -7203,7 +7203,7 @@ type MockRepoUpdaterClient struct {
 func NewMockRepoUpdaterClient() *MockRepoUpdaterClient {
 	return &MockRepoUpdaterClient{
 		EnqueueRepoUpdateFunc: &RepoUpdaterClientEnqueueRepoUpdateFunc{
-			defaultHook: func(context.Context, api.RepoName) (*protocol.RepoUpdateResponse, error) {
+			defaultHook: func(context.Context, api.RepoName, protocol.RepoUpdatePriority) (*protocol.RepoUpdateResponse, error) {
 				return nil, nil
 			},
 		},
@@ -7225,24 +7225,24 @@ func NewMockRepoUpdaterClientFrom(i RepoUpdaterClient) *MockRepoUpdaterClient {
 // EnqueueRepoUpdate method of the parent MockRepoUpdaterClient instance is
 // invoked.
 type RepoUpdaterClientEnqueueRepoUpdateFunc struct {
-	defaultHook func(context.Context, api.RepoName) (*protocol.RepoUpdateResponse, error)
-	hooks       []func(context.Context, api.RepoName) (*protocol.RepoUpdateResponse, error)
+	defaultHook func(context.Context, api.RepoName, protocol.RepoUpdatePriority) (*protocol.RepoUpdateResponse, error)
+	hooks       []func(context.Context, api.RepoName, protocol.RepoUpdatePriority) (*protocol.RepoUpdateResponse, error)
 	history     []RepoUpdaterClientEnqueueRepoUpdateFuncCall
 	mutex       sync.Mutex
 }
 
 // EnqueueRepoUpdate delegates to the next hook function in the queue and
 // stores the parameter and result values of this invocation.
-func (m *MockRepoUpdaterClient) EnqueueRepoUpdate(v0 context.Context, v1 api.RepoName) (*protocol.RepoUpdateResponse, error) {
-	r0, r1 := m.EnqueueRepoUpdateFunc.nextHook()(v0, v1)
-	m.EnqueueRepoUpdateFunc.appendCall(RepoUpdaterClientEnqueueRepoUpdateFuncCall{v0, v1, r0, r1})
+func (m *MockRepoUpdaterClient) EnqueueRepoUpdate(v0 context.Context, v1 api.RepoName, v2 protocol.RepoUpdatePriority) (*protocol.RepoUpdateResponse, error) {
+	r0, r1 := m.EnqueueRepoUpdateFunc.nextHook()(v0, v1, v2)
+	m.EnqueueRepoUpdateFunc.appendCall(RepoUpdaterClientEnqueueRepoUpdateFuncCall{v0, v1, v2, r0, r1})
 	return r0, r1
 }
 
 // SetDefaultHook sets function that is called when the EnqueueRepoUpdate
 // method of the parent MockRepoUpdaterClient instance is invoked and the
 // hook queue is empty.
-func (f *RepoUpdaterClientEnqueueRepoUpdateFunc) SetDefaultHook(hook func(context.Context, api.RepoName) (*protocol.RepoUpdateResponse, error)) {
+func (f *RepoUpdaterClientEnqueueRepoUpdateFunc) SetDefaultHook(hook func(context.Context, api.RepoName, protocol.RepoUpdatePriority) (*protocol.RepoUpdateResponse, error)) {
 	f.defaultHook = hook
 }
 
@@ -7251,7 +7251,7 @@ func (f *RepoUpdaterClientEnqueueRepoUpdateFunc) SetDefaultHook(hook func(contex
 // invokes the hook at the front of the queue and discards it. After the
 // queue is empty, the default hook function is invoked for any future
 // action.
-func (f *RepoUpdaterClientEnqueueRepoUpdateFunc) PushHook(hook func(context.Context, api.RepoName) (*protocol.RepoUpdateResponse, error)) {
+func (f *RepoUpdaterClientEnqueueRepoUpdateFunc) PushHook(hook func(context.Context, api.RepoName, protocol.RepoUpdatePriority) (*protocol.RepoUpdateResponse, error)) {
 	f.mutex.Lock()
 	f.hooks = append(f.hooks, hook)
 	f.mutex.Unlock()
@@ -7260,7 +7260,7 @@ func (f *RepoUpdaterClientEnqueueRepoUpdateFunc) PushHook(hook func(context.Cont
 // SetDefaultReturn calls SetDefaultDefaultHook with a function that returns
 // the given values.
 func (f *RepoUpdaterClientEnqueueRepoUpdateFunc) SetDefaultReturn(r0 *protocol.RepoUpdateResponse, r1 error) {
-	f.SetDefaultHook(func(context.Context, api.RepoName) (*protocol.RepoUpdateResponse, error) {
+	f.SetDefaultHook(func(context.Context, api.RepoName, protocol.RepoUpdatePriority) (*protocol.RepoUpdateResponse, error) {
 		return r0, r1
 	})
 }
@@ -7268,12 +7268,12 @@ func (f *RepoUpdaterClientEnqueueRepoUpdateFunc) SetDefaultReturn(r0 *protocol.R
 // PushReturn calls PushDefaultHook with a function that returns the given
 // values.
 func (f *RepoUpdaterClientEnqueueRepoUpdateFunc) PushReturn(r0 *protocol.RepoUpdateResponse, r1 error) {
-	f.PushHook(func(context.Context, api.RepoName) (*protocol.RepoUpdateResponse, error) {
+	f.PushHook(func(context.Context, api.RepoName, protocol.RepoUpdatePriority) (*protocol.RepoUpdateResponse, error) {
 		return r0, r1
 	})
 }
 
-func (f *RepoUpdaterClientEnqueueRepoUpdateFunc) nextHook() func(context.Context, api.RepoName) (*protocol.RepoUpdateResponse, error) {
+func (f *RepoUpdaterClientEnqueueRepoUpdateFunc) nextHook() func(context.Context, api.RepoName, protocol.RepoUpdatePriority) (*protocol.RepoUpdateResponse, error) {
 	f.mutex.Lock()
 	defer f.mutex.Unlock()
 
@@ -7313,6 +7313,9 @@ type RepoUpdaterClientEnqueueRepoUpdateFuncCall struct {
 	// Arg1 is the value of the 2nd argument passed to this method
 	// invocation.
 	Arg1 api.RepoName
+	// Arg2 is the value of the 3rd argument passed to this method
+	// invocation.
+	Arg2 protocol.RepoUpdatePriority
 	// Result0 is the value of the 1st result returned from this method
 	// invocation.
 	Result0 *protocol.RepoUpdateResponse
@@ -7324,7 +7327,7 @@ type RepoUpdaterClientEnqueueRepoUpdateFuncCall struct {
 // Args returns an interface slice containing the arguments of this
 // invocation.
 func (c RepoUpdaterClientEnqueueRepoUpdateFuncCall) Args() []interface{} {
-	return []interface{}{c.Arg0, c.Arg1}
+	return []interface{}{c.Arg0, c.Arg1, c.Arg2}
 }
 
 // Results returns an interface slice containing the results of this
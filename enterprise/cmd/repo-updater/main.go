@@ -37,8 +37,16 @@ func main() {
 		log.Println("enterprise edition")
 	}
 	shared.Main(enterpriseInit)
+
+	// shared.Main returns once repo-updater has been told to shut down. Give the
+	// batch changes workers the chance to finish their in-flight jobs.
+	waitForBatchChanges()
 }
 
+// waitForBatchChanges blocks until the batch changes background jobs have
+// stopped. It is set by enterpriseInit if they were started.
+var waitForBatchChanges = func() {}
+
 func enterpriseInit(
 	db *sql.DB,
 	repoStore *repos.Store,
@@ -55,7 +63,8 @@ func enterpriseInit(
 	// No Batch Changes on dotcom, so we don't need to spawn the
 	// background jobs for this feature.
 	if !envvar.SourcegraphDotComMode() {
-		syncRegistry := batches.InitBackgroundJobs(ctx, db, keyring.BatchChangesCredentialKey, cf)
+		syncRegistry, wait := batches.InitBackgroundJobs(ctx, db, keyring.BatchChangesCredentialKey, cf)
+		waitForBatchChanges = wait
 		if server != nil {
 			server.ChangesetSyncRegistry = syncRegistry
 		}
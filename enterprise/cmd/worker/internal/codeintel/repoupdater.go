@@ -0,0 +1,28 @@
+package codeintel
+
+import (
+	"github.com/inconshreveable/log15"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sourcegraph/sourcegraph/cmd/worker/shared"
+	"github.com/sourcegraph/sourcegraph/enterprise/internal/codeintel/repoupdater"
+	"github.com/sourcegraph/sourcegraph/internal/observation"
+	"github.com/sourcegraph/sourcegraph/internal/trace"
+)
+
+// InitRepoUpdaterClient initializes and returns a repo-updater client.
+func InitRepoUpdaterClient() *repoupdater.Client {
+	client, _ := initRepoUpdaterClient.Init()
+	return client.(*repoupdater.Client)
+}
+
+var initRepoUpdaterClient = shared.NewMemoizedConstructor(func() (interface{}, error) {
+	observationContext := &observation.Context{
+		Logger:     log15.Root(),
+		Tracer:     &trace.Tracer{Tracer: opentracing.GlobalTracer()},
+		Registerer: prometheus.DefaultRegisterer,
+	}
+
+	return repoupdater.New(observationContext), nil
+})
@@ -2,6 +2,9 @@ package batches
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/inconshreveable/log15"
 	"github.com/opentracing/opentracing-go"
@@ -21,15 +24,21 @@ import (
 
 // InitBackgroundJobs starts all jobs required to run batches. Currently, it is called from
 // repo-updater and in the future will be the main entry point for the batch changes worker.
+//
+// The jobs are stopped when the context is canceled or the process receives a shutdown
+// signal, including SIGTERM, which is what Kubernetes and Docker send. The returned wait
+// function blocks until all jobs have stopped, which includes waiting for in-flight worker
+// jobs to drain. Once the jobs drained after a SIGTERM, the signal is raised again with its
+// default action, so that the process exits like it would have without the jobs.
 func InitBackgroundJobs(
 	ctx context.Context,
 	db dbutil.DB,
 	key encryption.Key,
 	cf *httpcli.Factory,
-) interface {
+) (syncRegistry interface {
 	// EnqueueChangesetSyncs will queue the supplied changesets to sync ASAP.
 	EnqueueChangesetSyncs(ctx context.Context, ids []int64) error
-} {
+}, wait func()) {
 	// We use an internal actor so that we can freely load dependencies from
 	// the database without repository permissions being enforced.
 	// We do check for repository permissions consciously in the Rewirer when
@@ -44,13 +53,27 @@ func InitBackgroundJobs(
 	}
 	bstore := store.New(db, observationContext, key)
 
-	syncRegistry := syncer.NewSyncRegistry(ctx, bstore, cf, observationContext)
+	registry := syncer.NewSyncRegistry(ctx, bstore, cf, observationContext)
 
 	routines := background.Routines(ctx, bstore, cf, observationContext)
 
-	routines = append(routines, syncRegistry)
+	routines = append(routines, registry)
 
-	go goroutine.MonitorBackgroundRoutines(ctx, routines...)
+	// Only these jobs drain on SIGTERM. Other services, and the other monitors of
+	// repo-updater, keep exiting on it right away.
+	drainCtx, stopDrainOnSignal := signal.NotifyContext(ctx, syscall.SIGTERM)
 
-	return syncRegistry
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		goroutine.MonitorBackgroundRoutines(drainCtx, routines...)
+
+		terminated := drainCtx.Err() != nil && ctx.Err() == nil
+		stopDrainOnSignal()
+		if terminated {
+			_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		}
+	}()
+
+	return registry, func() { <-stopped }
 }
@@ -23,17 +23,21 @@ func Routines(ctx context.Context, batchesStore *store.Store, cf *httpcli.Factor
 	batchSpecResolutionWorkerStore := newBatchSpecResolutionWorkerStore(batchesStore.Handle(), observationContext)
 
 	routines := []goroutine.BackgroundRoutine{
-		newReconcilerWorker(ctx, batchesStore, reconcilerWorkerStore, gitserver.DefaultClient, sourcer, metrics),
+		newDrainingWorker(newReconcilerWorker(ctx, batchesStore, reconcilerWorkerStore, gitserver.DefaultClient, sourcer, metrics)),
 		newReconcilerWorkerResetter(reconcilerWorkerStore, metrics),
+		newReconcilerJanitor(ctx, batchesStore, metrics),
 
-		newSpecExpireJob(ctx, batchesStore),
+		newSpecExpireJob(ctx, batchesStore, metrics),
+		newCompletionNotifier(ctx, batchesStore, metrics),
+		newOrphanedChangesetsCleaner(ctx, batchesStore, metrics),
+		newHeartbeatWatchdog(ctx, metrics.heartbeats),
 
 		scheduler.NewScheduler(ctx, batchesStore),
 
-		newBulkOperationWorker(ctx, batchesStore, bulkProcessorWorkerStore, sourcer, metrics),
+		newDrainingWorker(newBulkOperationWorker(ctx, batchesStore, bulkProcessorWorkerStore, sourcer, metrics)),
 		newBulkOperationWorkerResetter(bulkProcessorWorkerStore, metrics),
 
-		newBatchSpecResolutionWorker(ctx, batchesStore, batchSpecResolutionWorkerStore, metrics),
+		newDrainingWorker(newBatchSpecResolutionWorker(ctx, batchesStore, batchSpecResolutionWorkerStore, metrics)),
 		newBatchSpecResolutionWorkerResetter(batchSpecResolutionWorkerStore, metrics),
 
 		newBatchSpecWorkspaceExecutionWorkerResetter(batchSpecWorkspaceExecutionWorkerStore, metrics),
@@ -39,7 +39,7 @@ func newBulkOperationWorker(
 
 	options := workerutil.WorkerOptions{
 		Name:              "batches_bulk_processor",
-		NumHandlers:       5,
+		NumHandlers:       bulkProcessorWorkerConcurrency,
 		HeartbeatInterval: 15 * time.Second,
 		Interval:          5 * time.Second,
 		Metrics:           metrics.bulkProcessorWorkerMetrics,
@@ -0,0 +1,162 @@
+package background
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/inconshreveable/log15"
+
+	"github.com/sourcegraph/sourcegraph/enterprise/internal/batches/reconciler"
+	"github.com/sourcegraph/sourcegraph/enterprise/internal/batches/store"
+	btypes "github.com/sourcegraph/sourcegraph/enterprise/internal/batches/types"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/conf"
+	"github.com/sourcegraph/sourcegraph/internal/database"
+	"github.com/sourcegraph/sourcegraph/internal/errcode"
+	"github.com/sourcegraph/sourcegraph/internal/goroutine"
+	"github.com/sourcegraph/sourcegraph/internal/slack"
+	"github.com/sourcegraph/sourcegraph/internal/txemail"
+	"github.com/sourcegraph/sourcegraph/internal/txemail/txtypes"
+)
+
+const (
+	completionNotifierInterval = 5 * time.Minute
+
+	// completionNotifierBatchSize is the maximum number of batch changes
+	// notified about in a single run.
+	completionNotifierBatchSize = 100
+)
+
+var completionEmailTemplates = txemail.MustValidate(txtypes.Templates{
+	Subject: `Batch change {{.Name}} is complete`,
+	Text: `
+All changesets of your batch change {{.Name}} have been merged or closed.
+
+View batch change: {{.URL}}
+`,
+	HTML: `
+<p>All changesets of your batch change <strong>{{.Name}}</strong> have been merged or closed.</p>
+
+<p><a href="{{.URL}}">View batch change</a></p>
+`,
+})
+
+type completionNotifier struct {
+	store   *store.Store
+	metrics completionNotifierMetrics
+}
+
+var _ goroutine.Handler = &completionNotifier{}
+var _ goroutine.ErrorHandler = &completionNotifier{}
+
+// newCompletionNotifier returns a background routine that periodically
+// notifies the authors of batch changes whose changesets have all been merged
+// or closed on the code host, by email and, if configured, on Slack.
+func newCompletionNotifier(ctx context.Context, s *store.Store, metrics batchChangesMetrics) goroutine.BackgroundRoutine {
+	return newPeriodicRoutine(ctx, "completion_notifier", completionNotifierInterval, &completionNotifier{
+		store:   s,
+		metrics: metrics.completionNotifierMetrics,
+	}, s, metrics)
+}
+
+func (n *completionNotifier) Handle(ctx context.Context) error {
+	batchChanges, err := n.store.ListCompletedBatchChangesToNotify(ctx, completionNotifierBatchSize)
+	if err != nil {
+		return errors.Wrap(err, "ListCompletedBatchChangesToNotify")
+	}
+
+	for _, batchChange := range batchChanges {
+		// Delivery failures are logged, but don't prevent the batch change from
+		// being marked as notified: a missing SMTP configuration or a broken
+		// Slack webhook would otherwise cause notifications to be sent on every
+		// run over channels that do work.
+		n.notify(ctx, batchChange)
+
+		if err := n.store.MarkBatchChangeCompletionNotified(ctx, batchChange.ID); err != nil {
+			return errors.Wrap(err, "MarkBatchChangeCompletionNotified")
+		}
+		n.metrics.notified.Inc()
+	}
+
+	return nil
+}
+
+func (n *completionNotifier) HandleError(err error) {
+	n.metrics.errors.Inc()
+	log15.Error("Failed to notify about completed batch changes", "error", err)
+}
+
+func (n *completionNotifier) notify(ctx context.Context, batchChange *btypes.BatchChange) {
+	ns, err := database.NamespacesWith(n.store).GetByID(ctx, batchChange.NamespaceOrgID, batchChange.NamespaceUserID)
+	if err != nil {
+		n.deliveryFailed(batchChange, "namespace", err)
+		return
+	}
+
+	url, err := reconciler.BatchChangeURL(ctx, ns, batchChange)
+	if err != nil {
+		n.deliveryFailed(batchChange, "url", err)
+		return
+	}
+
+	if err := n.sendEmail(ctx, batchChange, url); err != nil {
+		n.deliveryFailed(batchChange, "email", err)
+	}
+
+	if err := postSlackMessage(ctx, batchChange, url); err != nil {
+		n.deliveryFailed(batchChange, "slack", err)
+	}
+}
+
+func (n *completionNotifier) deliveryFailed(batchChange *btypes.BatchChange, channel string, err error) {
+	n.metrics.errors.Inc()
+	log15.Error("Failed to notify about completed batch change", "batchChangeID", batchChange.ID, "channel", channel, "error", err)
+}
+
+// sendEmail notifies the author of the batch change by email. Nothing is sent
+// if email isn't configured, or if the author has no verified email address.
+func (n *completionNotifier) sendEmail(ctx context.Context, batchChange *btypes.BatchChange, url string) error {
+	if batchChange.InitialApplierID == 0 || conf.Get().EmailSmtp == nil {
+		return nil
+	}
+
+	email, verified, err := database.UserEmailsWith(n.store).GetPrimaryEmail(ctx, batchChange.InitialApplierID)
+	if err != nil {
+		if errcode.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "getting primary email of author")
+	}
+	if !verified {
+		return nil
+	}
+
+	return api.InternalClient.SendEmail(ctx, txtypes.Message{
+		To:       []string{email},
+		Template: completionEmailTemplates,
+		Data: struct {
+			Name string
+			URL  string
+		}{
+			Name: batchChange.Name,
+			URL:  url,
+		},
+	})
+}
+
+// postSlackMessage posts a message about the completed batch change to the
+// Slack webhook in the site configuration, if any.
+func postSlackMessage(ctx context.Context, batchChange *btypes.BatchChange, url string) error {
+	webhookURL := conf.Get().BatchChangesCompletionNotificationSlackWebhook
+	if webhookURL == "" {
+		return nil
+	}
+
+	return slack.New(webhookURL).Post(ctx, &slack.Payload{
+		Username:  "Sourcegraph Batch Changes",
+		IconEmoji: ":white_check_mark:",
+		Text:      fmt.Sprintf("All changesets of batch change <%s|%s> have been merged or closed.", url, batchChange.Name),
+	})
+}
@@ -0,0 +1,36 @@
+package background
+
+import (
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/env"
+	"github.com/sourcegraph/sourcegraph/internal/goroutine"
+	"github.com/sourcegraph/sourcegraph/internal/workerutil"
+)
+
+var (
+	reconcilerWorkerConcurrency          = env.MustGetInt("BATCH_CHANGES_RECONCILER_WORKER_CONCURRENCY", 5, "The maximum number of changesets the batch changes reconciler processes concurrently.")
+	bulkProcessorWorkerConcurrency       = env.MustGetInt("BATCH_CHANGES_BULK_PROCESSOR_WORKER_CONCURRENCY", 5, "The maximum number of changeset jobs of bulk operations processed concurrently.")
+	batchSpecResolutionWorkerConcurrency = env.MustGetInt("BATCH_CHANGES_BATCH_SPEC_RESOLUTION_WORKER_CONCURRENCY", 5, "The maximum number of batch specs whose workspaces are resolved concurrently.")
+
+	workerDrainTimeout = env.MustGetDuration("BATCH_CHANGES_WORKER_DRAIN_TIMEOUT", 20*time.Second, "The time batch changes workers wait for in-flight jobs to finish on shutdown before canceling them.")
+)
+
+// drainingWorker is a worker that lets in-flight jobs finish when stopped,
+// instead of canceling them right away, so that a shutdown doesn't leave
+// changesets or bulk operations half-processed.
+type drainingWorker struct {
+	*workerutil.Worker
+}
+
+var _ goroutine.BackgroundRoutine = &drainingWorker{}
+
+func newDrainingWorker(w *workerutil.Worker) *drainingWorker {
+	return &drainingWorker{Worker: w}
+}
+
+// Stop stops dequeueing new jobs and waits up to workerDrainTimeout for the
+// in-flight jobs to finish, before canceling the remaining ones.
+func (w *drainingWorker) Stop() {
+	w.Worker.Drain(workerDrainTimeout)
+}
@@ -0,0 +1,149 @@
+package background
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sourcegraph/sourcegraph/internal/goroutine"
+	"github.com/sourcegraph/sourcegraph/internal/observation"
+)
+
+const heartbeatWatchdogInterval = 1 * time.Minute
+
+const (
+	// heartbeatStallFactor is the number of intervals a periodic routine can
+	// go without a heartbeat before it is considered stalled.
+	heartbeatStallFactor = 2
+
+	// heartbeatMinStallTimeout is the minimum time a periodic routine can go
+	// without a heartbeat before it is considered stalled, so that routines
+	// with short intervals aren't reported for an occasional slow run.
+	heartbeatMinStallTimeout = 5 * time.Minute
+)
+
+// heartbeats records when the periodic batches background routines start and
+// finish their runs, so that the watchdog can detect routines that silently
+// stopped making progress, for example because a run is stuck on a lock.
+type heartbeats struct {
+	clock   func() time.Time
+	metrics heartbeatMetrics
+
+	mu       sync.Mutex
+	routines map[string]*heartbeat
+}
+
+type heartbeat struct {
+	interval time.Duration
+	running  bool
+	// last is the time the current run started, if running, or the time the
+	// last run finished.
+	last    time.Time
+	stalled bool
+}
+
+type heartbeatMetrics struct {
+	stalled *prometheus.GaugeVec
+	stalls  *prometheus.CounterVec
+}
+
+func newHeartbeats(observationContext *observation.Context) *heartbeats {
+	stalled := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "src_batch_changes_background_routine_stalled",
+		Help: "Whether a periodic batch changes background routine hasn't completed a run within its expected cadence.",
+	}, []string{"routine"})
+	observationContext.Registerer.MustRegister(stalled)
+
+	stalls := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "src_batch_changes_background_routine_stalls_total",
+		Help: "The number of times a periodic batch changes background routine was detected as stalled.",
+	}, []string{"routine"})
+	observationContext.Registerer.MustRegister(stalls)
+
+	return &heartbeats{
+		clock:    time.Now,
+		metrics:  heartbeatMetrics{stalled: stalled, stalls: stalls},
+		routines: make(map[string]*heartbeat),
+	}
+}
+
+// register adds a routine with the given name and interval. Registering
+// starts its clock, so a routine that never starts a run is reported as
+// stalled, too.
+func (h *heartbeats) register(name string, interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.routines[name] = &heartbeat{interval: interval, last: h.clock()}
+	h.metrics.stalled.WithLabelValues(name).Set(0)
+}
+
+func (h *heartbeats) beat(name string, running bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r, ok := h.routines[name]; ok {
+		r.running = running
+		r.last = h.clock()
+	}
+}
+
+// check updates the stalled state of all registered routines and returns the
+// names of the routines that are stalled.
+func (h *heartbeats) check() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.clock()
+	var stalled []string
+	for name, r := range h.routines {
+		timeout := heartbeatStallTimeout(r.interval)
+		if !r.running {
+			// An idle routine is only late once its next run is overdue.
+			timeout += r.interval
+		}
+		since := now.Sub(r.last)
+
+		if since <= timeout {
+			if r.stalled {
+				r.stalled = false
+				h.metrics.stalled.WithLabelValues(name).Set(0)
+				log15.Info("Batch changes background routine recovered", "routine", name)
+			}
+			continue
+		}
+
+		stalled = append(stalled, name)
+		if !r.stalled {
+			r.stalled = true
+			h.metrics.stalled.WithLabelValues(name).Set(1)
+			h.metrics.stalls.WithLabelValues(name).Inc()
+			log15.Warn("Batch changes background routine stalled", "routine", name, "running", r.running, "since", since, "interval", r.interval)
+		}
+	}
+
+	sort.Strings(stalled)
+	return stalled
+}
+
+func heartbeatStallTimeout(interval time.Duration) time.Duration {
+	timeout := heartbeatStallFactor * interval
+	if timeout < heartbeatMinStallTimeout {
+		timeout = heartbeatMinStallTimeout
+	}
+	return timeout
+}
+
+// newHeartbeatWatchdog returns a background routine that periodically checks
+// the heartbeats of the periodic routines and reports the ones that haven't
+// completed a run within their expected cadence.
+func newHeartbeatWatchdog(ctx context.Context, h *heartbeats) goroutine.BackgroundRoutine {
+	return goroutine.NewPeriodicGoroutine(ctx, heartbeatWatchdogInterval, goroutine.HandlerFunc(func(ctx context.Context) error {
+		h.check()
+		return nil
+	}))
+}
@@ -0,0 +1,63 @@
+package background
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sourcegraph/sourcegraph/internal/observation"
+)
+
+func TestHeartbeatsCheck(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	h := newHeartbeats(&observation.Context{Registerer: prometheus.NewRegistry()})
+	h.clock = func() time.Time { return now }
+
+	h.register("fast", 1*time.Minute)
+	h.register("slow", 1*time.Hour)
+
+	h.beat("fast", true)
+	h.beat("slow", false)
+
+	// A run of "fast" is stuck, but still within the minimum stall timeout.
+	now = now.Add(4 * time.Minute)
+	if diff := cmp.Diff([]string(nil), h.check()); diff != "" {
+		t.Fatalf("unexpected stalled routines (-want +got):\n%s", diff)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if diff := cmp.Diff([]string{"fast"}, h.check()); diff != "" {
+		t.Fatalf("unexpected stalled routines (-want +got):\n%s", diff)
+	}
+	if have := testutil.ToFloat64(h.metrics.stalled.WithLabelValues("fast")); have != 1 {
+		t.Fatalf("wrong stalled gauge. want=1 have=%f", have)
+	}
+
+	// Stalls are only counted once.
+	h.check()
+	if have := testutil.ToFloat64(h.metrics.stalls.WithLabelValues("fast")); have != 1 {
+		t.Fatalf("wrong stalls count. want=1 have=%f", have)
+	}
+
+	// The stuck run finishes.
+	h.beat("fast", false)
+	if diff := cmp.Diff([]string(nil), h.check()); diff != "" {
+		t.Fatalf("unexpected stalled routines (-want +got):\n%s", diff)
+	}
+	if have := testutil.ToFloat64(h.metrics.stalled.WithLabelValues("fast")); have != 0 {
+		t.Fatalf("wrong stalled gauge. want=0 have=%f", have)
+	}
+
+	// The idle "slow" routine is late once its next run is overdue by the
+	// stall timeout.
+	now = now.Add(2*time.Hour + 54*time.Minute)
+	if diff := cmp.Diff([]string{"fast"}, h.check()); diff != "" {
+		t.Fatalf("unexpected stalled routines (-want +got):\n%s", diff)
+	}
+	now = now.Add(1 * time.Minute)
+	if diff := cmp.Diff([]string{"fast", "slow"}, h.check()); diff != "" {
+		t.Fatalf("unexpected stalled routines (-want +got):\n%s", diff)
+	}
+}
@@ -20,6 +20,43 @@ type batchChangesMetrics struct {
 	batchSpecResolutionWorkerResetterMetrics dbworker.ResetterMetrics
 
 	batchSpecWorkspaceExecutionWorkerResetterMetrics dbworker.ResetterMetrics
+
+	specExpireMetrics specExpireMetrics
+
+	reconcilerJanitorMetrics reconcilerJanitorMetrics
+
+	completionNotifierMetrics completionNotifierMetrics
+
+	orphanedChangesetsMetrics orphanedChangesetsMetrics
+
+	heartbeats             *heartbeats
+	periodicRoutineMetrics periodicRoutineMetrics
+}
+
+type orphanedChangesetsMetrics struct {
+	deleted  prometheus.Counter
+	archived prometheus.Counter
+	errors   prometheus.Counter
+}
+
+type completionNotifierMetrics struct {
+	notified prometheus.Counter
+	errors   prometheus.Counter
+}
+
+type reconcilerJanitorMetrics struct {
+	retries prometheus.Histogram
+	errors  prometheus.Counter
+}
+
+type specExpireMetrics struct {
+	runs                  prometheus.Counter
+	incompleteRuns        prometheus.Counter
+	errors                prometheus.Counter
+	changesetSpecsDeleted prometheus.Counter
+	batchSpecsDeleted     prometheus.Counter
+	dryRunChangesetSpecs  prometheus.Gauge
+	dryRunBatchSpecs      prometheus.Gauge
 }
 
 func newMetrics(observationContext *observation.Context) batchChangesMetrics {
@@ -33,6 +70,136 @@ func newMetrics(observationContext *observation.Context) batchChangesMetrics {
 		batchSpecResolutionWorkerResetterMetrics: makeResetterMetrics(observationContext, "batch_changes_batch_spec_resolution_worker_resetter"),
 
 		batchSpecWorkspaceExecutionWorkerResetterMetrics: makeResetterMetrics(observationContext, "batch_spec_workspace_execution_worker_resetter"),
+
+		specExpireMetrics: makeSpecExpireMetrics(observationContext),
+
+		reconcilerJanitorMetrics: makeReconcilerJanitorMetrics(observationContext),
+
+		completionNotifierMetrics: makeCompletionNotifierMetrics(observationContext),
+
+		orphanedChangesetsMetrics: makeOrphanedChangesetsMetrics(observationContext),
+
+		heartbeats:             newHeartbeats(observationContext),
+		periodicRoutineMetrics: makePeriodicRoutineMetrics(observationContext),
+	}
+}
+
+func makeOrphanedChangesetsMetrics(observationContext *observation.Context) orphanedChangesetsMetrics {
+	deleted := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "src_batch_changes_orphaned_changesets_deleted_total",
+		Help: "The number of changesets deleted because they were no longer attached to any batch change.",
+	})
+	observationContext.Registerer.MustRegister(deleted)
+
+	archived := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "src_batch_changes_orphaned_changesets_archived_total",
+		Help: "The number of changesets archived because their repository or the changeset on the code host was deleted.",
+	})
+	observationContext.Registerer.MustRegister(archived)
+
+	errors := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "src_batch_changes_orphaned_changesets_errors_total",
+		Help: "The number of errors that occur when cleaning up orphaned changesets.",
+	})
+	observationContext.Registerer.MustRegister(errors)
+
+	return orphanedChangesetsMetrics{
+		deleted:  deleted,
+		archived: archived,
+		errors:   errors,
+	}
+}
+
+func makeCompletionNotifierMetrics(observationContext *observation.Context) completionNotifierMetrics {
+	notified := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "src_batch_changes_completion_notifier_notified_total",
+		Help: "The number of completed batch changes whose authors were notified.",
+	})
+	observationContext.Registerer.MustRegister(notified)
+
+	errors := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "src_batch_changes_completion_notifier_errors_total",
+		Help: "The number of errors that occur when notifying about completed batch changes.",
+	})
+	observationContext.Registerer.MustRegister(errors)
+
+	return completionNotifierMetrics{
+		notified: notified,
+		errors:   errors,
+	}
+}
+
+func makeReconcilerJanitorMetrics(observationContext *observation.Context) reconcilerJanitorMetrics {
+	retries := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "src_batch_changes_reconciler_janitor_retries",
+		Help:    "The retry count of changesets requeued after the reconciler gave up on them.",
+		Buckets: prometheus.LinearBuckets(1, 1, reconcilerJanitorMaxRetries),
+	})
+	observationContext.Registerer.MustRegister(retries)
+
+	errors := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "src_batch_changes_reconciler_janitor_errors_total",
+		Help: "The number of errors that occur when requeueing failed changesets.",
+	})
+	observationContext.Registerer.MustRegister(errors)
+
+	return reconcilerJanitorMetrics{
+		retries: retries,
+		errors:  errors,
+	}
+}
+
+func makeSpecExpireMetrics(observationContext *observation.Context) specExpireMetrics {
+	runs := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "src_batch_changes_spec_expire_runs_total",
+		Help: "The number of runs of the expired spec deletion job.",
+	})
+	observationContext.Registerer.MustRegister(runs)
+
+	incompleteRuns := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "src_batch_changes_spec_expire_incomplete_runs_total",
+		Help: "The number of runs of the expired spec deletion job that reached the per-run limit.",
+	})
+	observationContext.Registerer.MustRegister(incompleteRuns)
+
+	errors := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "src_batch_changes_spec_expire_errors_total",
+		Help: "The number of errors that occur when deleting expired specs.",
+	})
+	observationContext.Registerer.MustRegister(errors)
+
+	changesetSpecsDeleted := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "src_batch_changes_spec_expire_changeset_specs_deleted_total",
+		Help: "The number of expired changeset specs deleted.",
+	})
+	observationContext.Registerer.MustRegister(changesetSpecsDeleted)
+
+	batchSpecsDeleted := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "src_batch_changes_spec_expire_batch_specs_deleted_total",
+		Help: "The number of expired batch specs deleted.",
+	})
+	observationContext.Registerer.MustRegister(batchSpecsDeleted)
+
+	dryRunChangesetSpecs := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "src_batch_changes_spec_expire_dry_run_changeset_specs",
+		Help: "The number of expired changeset specs found by the last dry run of the expired spec deletion job.",
+	})
+	observationContext.Registerer.MustRegister(dryRunChangesetSpecs)
+
+	dryRunBatchSpecs := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "src_batch_changes_spec_expire_dry_run_batch_specs",
+		Help: "The number of expired batch specs found by the last dry run of the expired spec deletion job.",
+	})
+	observationContext.Registerer.MustRegister(dryRunBatchSpecs)
+
+	return specExpireMetrics{
+		runs:                  runs,
+		incompleteRuns:        incompleteRuns,
+		errors:                errors,
+		changesetSpecsDeleted: changesetSpecsDeleted,
+		batchSpecsDeleted:     batchSpecsDeleted,
+		dryRunChangesetSpecs:  dryRunChangesetSpecs,
+		dryRunBatchSpecs:      dryRunBatchSpecs,
 	}
 }
 
@@ -0,0 +1,71 @@
+package background
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/inconshreveable/log15"
+
+	"github.com/sourcegraph/sourcegraph/enterprise/internal/batches/store"
+	"github.com/sourcegraph/sourcegraph/internal/goroutine"
+)
+
+const orphanedChangesetsInterval = 1 * time.Hour
+
+// orphanedChangesetsGracePeriod is the time a changeset has to be orphaned
+// before it is cleaned up. It leaves room for repositories that are deleted
+// and restored, and for changesets that are detached and then reattached by
+// applying a batch change again.
+const orphanedChangesetsGracePeriod = 24 * time.Hour
+
+type orphanedChangesetsCleaner struct {
+	store   *store.Store
+	metrics orphanedChangesetsMetrics
+}
+
+var _ goroutine.Handler = &orphanedChangesetsCleaner{}
+var _ goroutine.ErrorHandler = &orphanedChangesetsCleaner{}
+
+// newOrphanedChangesetsCleaner returns a background routine that periodically
+// cleans up changesets that are no longer useful to any batch change.
+// Changesets that aren't attached to any batch change anymore, because the
+// batch changes were deleted or detached them, are deleted. Changesets whose
+// repository was deleted, or that were deleted on the code host, are archived
+// in all batch changes they are attached to.
+//
+// Changesets are never closed on the code host by this routine. Whether to
+// close them is decided by the user when closing the batch change.
+func newOrphanedChangesetsCleaner(ctx context.Context, s *store.Store, metrics batchChangesMetrics) goroutine.BackgroundRoutine {
+	return newPeriodicRoutine(ctx, "orphaned_changesets", orphanedChangesetsInterval, &orphanedChangesetsCleaner{
+		store:   s,
+		metrics: metrics.orphanedChangesetsMetrics,
+	}, s, metrics)
+}
+
+func (c *orphanedChangesetsCleaner) Handle(ctx context.Context) error {
+	olderThan := c.store.Clock()().Add(-orphanedChangesetsGracePeriod)
+
+	deleted, err := c.store.DeleteOrphanedChangesets(ctx, olderThan)
+	if err != nil {
+		return errors.Wrap(err, "DeleteOrphanedChangesets")
+	}
+	c.metrics.deleted.Add(float64(deleted))
+
+	archived, err := c.store.ArchiveOrphanedChangesets(ctx, olderThan)
+	if err != nil {
+		return errors.Wrap(err, "ArchiveOrphanedChangesets")
+	}
+	c.metrics.archived.Add(float64(archived))
+
+	if deleted > 0 || archived > 0 {
+		log15.Info("Cleaned up orphaned changesets", "deleted", deleted, "archived", archived)
+	}
+
+	return nil
+}
+
+func (c *orphanedChangesetsCleaner) HandleError(err error) {
+	c.metrics.errors.Inc()
+	log15.Error("Failed to clean up orphaned changesets", "error", err)
+}
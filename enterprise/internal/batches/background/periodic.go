@@ -0,0 +1,169 @@
+package background
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sourcegraph/sourcegraph/enterprise/internal/batches/store"
+	"github.com/sourcegraph/sourcegraph/internal/database/locker"
+	"github.com/sourcegraph/sourcegraph/internal/goroutine"
+	"github.com/sourcegraph/sourcegraph/internal/observation"
+)
+
+// periodicRoutineLockNamespace is the advisory lock namespace used to elect
+// the replica that runs a periodic routine.
+const periodicRoutineLockNamespace = "batches_periodic_routines"
+
+// periodicRoutineJitterDivisor determines the maximum random delay added to
+// the first run and to every interval of a periodic routine, as a fraction of
+// the interval. Without it, the routines of all replicas wake up at the same
+// time, which causes synchronized load spikes on the database.
+const periodicRoutineJitterDivisor = 5
+
+// routineLocker takes the advisory lock of a periodic routine. It is
+// implemented by *locker.Locker.
+type routineLocker interface {
+	Lock(ctx context.Context, key int32, blocking bool) (bool, locker.UnlockFunc, error)
+}
+
+// periodicRoutineMetrics are recorded for every periodic routine, labeled with
+// the routine name, so that the health of all routines can be shown on a
+// single dashboard.
+type periodicRoutineMetrics struct {
+	runs        *prometheus.CounterVec
+	errors      *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	lastSuccess *prometheus.GaugeVec
+	notLeader   *prometheus.CounterVec
+}
+
+func makePeriodicRoutineMetrics(observationContext *observation.Context) periodicRoutineMetrics {
+	runs := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "src_batch_changes_background_routine_runs_total",
+		Help: "The number of runs of a periodic batch changes background routine.",
+	}, []string{"routine"})
+	observationContext.Registerer.MustRegister(runs)
+
+	errors := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "src_batch_changes_background_routine_errors_total",
+		Help: "The number of runs of a periodic batch changes background routine that failed.",
+	}, []string{"routine"})
+	observationContext.Registerer.MustRegister(errors)
+
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "src_batch_changes_background_routine_duration_seconds",
+		Help:    "The duration of runs of a periodic batch changes background routine.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"routine"})
+	observationContext.Registerer.MustRegister(duration)
+
+	lastSuccess := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "src_batch_changes_background_routine_last_success_timestamp_seconds",
+		Help: "The Unix time at which a periodic batch changes background routine last completed a run without error.",
+	}, []string{"routine"})
+	observationContext.Registerer.MustRegister(lastSuccess)
+
+	notLeader := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "src_batch_changes_background_routine_not_leader_total",
+		Help: "The number of runs of a periodic batch changes background routine skipped because another replica was running it.",
+	}, []string{"routine"})
+	observationContext.Registerer.MustRegister(notLeader)
+
+	return periodicRoutineMetrics{
+		runs:        runs,
+		errors:      errors,
+		duration:    duration,
+		lastSuccess: lastSuccess,
+		notLeader:   notLeader,
+	}
+}
+
+// newPeriodicRoutine returns a periodic goroutine that invokes handler every
+// interval and records a heartbeat and the run metrics under the given name
+// for every run. The runs are jittered by up to a fifth of the interval.
+//
+// All replicas start the periodic routines, so every run first takes an
+// advisory lock keyed on the name. Only the replica that gets the lock runs
+// the handler; the others skip the run, which keeps them from duplicating
+// work and contending on the same rows.
+func newPeriodicRoutine(ctx context.Context, name string, interval time.Duration, handler goroutine.Handler, s *store.Store, metrics batchChangesMetrics) goroutine.BackgroundRoutine {
+	metrics.heartbeats.register(name, interval)
+	options := goroutine.PeriodicOptions{Jitter: interval / periodicRoutineJitterDivisor}
+	return goroutine.NewPeriodicGoroutineWithOptions(ctx, interval, &periodicHandler{
+		name:       name,
+		handler:    handler,
+		locker:     locker.NewWithDB(s.DB(), periodicRoutineLockNamespace),
+		heartbeats: metrics.heartbeats,
+		metrics:    metrics.periodicRoutineMetrics,
+	}, nil, options)
+}
+
+type periodicHandler struct {
+	name       string
+	handler    goroutine.Handler
+	locker     routineLocker
+	heartbeats *heartbeats
+	metrics    periodicRoutineMetrics
+}
+
+var _ goroutine.Handler = &periodicHandler{}
+var _ goroutine.ErrorHandler = &periodicHandler{}
+var _ goroutine.Finalizer = &periodicHandler{}
+
+func (h *periodicHandler) Handle(ctx context.Context) (err error) {
+	h.heartbeats.beat(h.name, true)
+	defer h.heartbeats.beat(h.name, false)
+
+	// The lock is held in a transaction for the duration of the run, and
+	// released when the transaction is done.
+	locked, unlock, err := h.locker.Lock(ctx, locker.StringKey(h.name), false)
+	if err != nil {
+		h.metrics.errors.WithLabelValues(h.name).Inc()
+		return errors.Wrap(err, "taking periodic routine lock")
+	}
+	if !locked {
+		h.metrics.notLeader.WithLabelValues(h.name).Inc()
+		log15.Debug("Skipping batch changes background routine run, another replica is running it", "routine", h.name)
+		return nil
+	}
+	defer func() { err = unlock(err) }()
+
+	return h.run(ctx)
+}
+
+// run invokes the handler and records the metrics of the run.
+func (h *periodicHandler) run(ctx context.Context) (err error) {
+	start := h.heartbeats.clock()
+	defer func() {
+		end := h.heartbeats.clock()
+		h.metrics.runs.WithLabelValues(h.name).Inc()
+		h.metrics.duration.WithLabelValues(h.name).Observe(end.Sub(start).Seconds())
+
+		if err != nil {
+			// Runs interrupted by a shutdown aren't failures.
+			if ctx.Err() == nil {
+				h.metrics.errors.WithLabelValues(h.name).Inc()
+			}
+			return
+		}
+		h.metrics.lastSuccess.WithLabelValues(h.name).Set(float64(end.Unix()))
+	}()
+
+	return h.handler.Handle(ctx)
+}
+
+func (h *periodicHandler) HandleError(err error) {
+	if eh, ok := h.handler.(goroutine.ErrorHandler); ok {
+		eh.HandleError(err)
+	}
+}
+
+func (h *periodicHandler) OnShutdown() {
+	if f, ok := h.handler.(goroutine.Finalizer); ok {
+		f.OnShutdown()
+	}
+}
@@ -0,0 +1,115 @@
+package background
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/sourcegraph/sourcegraph/internal/database/locker"
+	"github.com/sourcegraph/sourcegraph/internal/goroutine"
+	"github.com/sourcegraph/sourcegraph/internal/observation"
+)
+
+type testPeriodicHandler struct {
+	err                        error
+	handled, errored, shutdown bool
+}
+
+func (h *testPeriodicHandler) Handle(ctx context.Context) error { h.handled = true; return h.err }
+func (h *testPeriodicHandler) HandleError(err error)            { h.errored = true }
+func (h *testPeriodicHandler) OnShutdown()                      { h.shutdown = true }
+
+type testRoutineLocker struct {
+	held     map[int32]bool
+	unlocked int
+}
+
+func (l *testRoutineLocker) Lock(ctx context.Context, key int32, blocking bool) (bool, locker.UnlockFunc, error) {
+	if l.held[key] {
+		return false, nil, nil
+	}
+	return true, func(err error) error { l.unlocked++; return err }, nil
+}
+
+func TestPeriodicHandler(t *testing.T) {
+	observationContext := &observation.Context{Registerer: prometheus.NewRegistry()}
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	h := newHeartbeats(observationContext)
+	h.clock = func() time.Time { return now }
+	h.register("test", 1*time.Minute)
+
+	l := &testRoutineLocker{held: map[int32]bool{}}
+	inner := &testPeriodicHandler{}
+	var handler goroutine.Handler = &periodicHandler{
+		name:       "test",
+		handler:    inner,
+		locker:     l,
+		heartbeats: h,
+		metrics:    makePeriodicRoutineMetrics(observationContext),
+	}
+
+	if err := handler.Handle(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	handler.(goroutine.ErrorHandler).HandleError(nil)
+	handler.(goroutine.Finalizer).OnShutdown()
+
+	if !inner.handled || !inner.errored || !inner.shutdown {
+		t.Fatalf("calls not forwarded: %+v", inner)
+	}
+	if l.unlocked != 1 {
+		t.Fatalf("lock not released. unlocked=%d", l.unlocked)
+	}
+	if h.routines["test"].running {
+		t.Fatal("routine still marked as running")
+	}
+
+	metrics := handler.(*periodicHandler).metrics
+	if have := testutil.ToFloat64(metrics.runs.WithLabelValues("test")); have != 1 {
+		t.Fatalf("wrong runs count. want=1 have=%f", have)
+	}
+	if have := testutil.ToFloat64(metrics.lastSuccess.WithLabelValues("test")); have != float64(now.Unix()) {
+		t.Fatalf("wrong last success. want=%d have=%f", now.Unix(), have)
+	}
+
+	t.Run("error", func(t *testing.T) {
+		inner.err = errors.New("oops")
+		defer func() { inner.err = nil }()
+		now = now.Add(time.Minute)
+
+		if err := handler.Handle(context.Background()); err != inner.err {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if have := testutil.ToFloat64(metrics.errors.WithLabelValues("test")); have != 1 {
+			t.Fatalf("wrong errors count. want=1 have=%f", have)
+		}
+		if have := testutil.ToFloat64(metrics.lastSuccess.WithLabelValues("test")); have == float64(now.Unix()) {
+			t.Fatal("last success updated by failed run")
+		}
+	})
+
+	t.Run("not leader", func(t *testing.T) {
+		l.held[locker.StringKey("test")] = true
+		inner.handled = false
+
+		if err := handler.Handle(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if inner.handled {
+			t.Fatal("handler invoked without holding the lock")
+		}
+		if have := testutil.ToFloat64(metrics.notLeader.WithLabelValues("test")); have != 1 {
+			t.Fatalf("wrong not leader count. want=1 have=%f", have)
+		}
+		if have := testutil.ToFloat64(metrics.runs.WithLabelValues("test")); have != 2 {
+			t.Fatalf("skipped run counted. want=2 have=%f", have)
+		}
+		if h.routines["test"].running {
+			t.Fatal("routine still marked as running")
+		}
+	})
+}
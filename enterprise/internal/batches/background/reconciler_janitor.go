@@ -0,0 +1,72 @@
+package background
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/inconshreveable/log15"
+
+	"github.com/sourcegraph/sourcegraph/enterprise/internal/batches/store"
+	"github.com/sourcegraph/sourcegraph/internal/goroutine"
+)
+
+const reconcilerJanitorInterval = 1 * time.Minute
+
+const (
+	// reconcilerJanitorMaxRetries is the maximum number of times a changeset
+	// is requeued after the reconciler gave up on it.
+	reconcilerJanitorMaxRetries = 8
+
+	// reconcilerJanitorBackoff is the time after the reconciler gave up on a
+	// changeset before it is requeued for the first time. The backoff doubles
+	// for every retry, up to reconcilerJanitorMaxBackoff.
+	reconcilerJanitorBackoff    = 5 * time.Minute
+	reconcilerJanitorMaxBackoff = 12 * time.Hour
+)
+
+type reconcilerJanitor struct {
+	store   *store.Store
+	metrics reconcilerJanitorMetrics
+}
+
+var _ goroutine.Handler = &reconcilerJanitor{}
+var _ goroutine.ErrorHandler = &reconcilerJanitor{}
+
+// newReconcilerJanitor returns a background routine that periodically
+// requeues changesets for which the reconciler exhausted its retries or
+// resets, with exponential backoff, so that they don't stay failed after a
+// temporary outage of the code host or gitserver.
+func newReconcilerJanitor(ctx context.Context, s *store.Store, metrics batchChangesMetrics) goroutine.BackgroundRoutine {
+	return newPeriodicRoutine(ctx, "reconciler_janitor", reconcilerJanitorInterval, &reconcilerJanitor{
+		store:   s,
+		metrics: metrics.reconcilerJanitorMetrics,
+	}, s, metrics)
+}
+
+func (j *reconcilerJanitor) Handle(ctx context.Context) error {
+	retries, err := j.store.RequeueFailedChangesets(ctx, store.RequeueFailedChangesetsOpts{
+		MaxNumFailures: reconcilerMaxNumRetries,
+		MaxNumResets:   reconcilerMaxNumResets,
+		MaxRetries:     reconcilerJanitorMaxRetries,
+		Backoff:        reconcilerJanitorBackoff,
+		MaxBackoff:     reconcilerJanitorMaxBackoff,
+	})
+	if err != nil {
+		return errors.Wrap(err, "RequeueFailedChangesets")
+	}
+
+	for _, retry := range retries {
+		j.metrics.retries.Observe(float64(retry))
+	}
+	if len(retries) > 0 {
+		log15.Info("Requeued failed changesets for the reconciler", "count", len(retries))
+	}
+
+	return nil
+}
+
+func (j *reconcilerJanitor) HandleError(err error) {
+	j.metrics.errors.Inc()
+	log15.Error("Failed to requeue failed changesets", "error", err)
+}
@@ -40,7 +40,7 @@ func newReconcilerWorker(
 
 	options := workerutil.WorkerOptions{
 		Name:              "batches_reconciler_worker",
-		NumHandlers:       5,
+		NumHandlers:       reconcilerWorkerConcurrency,
 		Interval:          5 * time.Second,
 		HeartbeatInterval: 15 * time.Second,
 		Metrics:           metrics.reconcilerWorkerMetrics,
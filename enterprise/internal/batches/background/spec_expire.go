@@ -2,31 +2,270 @@ package background
 
 import (
 	"context"
+	"encoding/json"
+	"sort"
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/inconshreveable/log15"
 
 	"github.com/sourcegraph/sourcegraph/enterprise/internal/batches/store"
+	btypes "github.com/sourcegraph/sourcegraph/enterprise/internal/batches/types"
+	"github.com/sourcegraph/sourcegraph/internal/conf"
+	"github.com/sourcegraph/sourcegraph/internal/database"
 	"github.com/sourcegraph/sourcegraph/internal/goroutine"
 )
 
 const specExpireInteral = 2 * time.Minute
 
-func newSpecExpireJob(ctx context.Context, cstore *store.Store) goroutine.BackgroundRoutine {
-	return goroutine.NewPeriodicGoroutine(
-		ctx,
-		specExpireInteral,
-		goroutine.NewHandlerWithErrorMessage("expire batch changes specs", func(ctx context.Context) error {
-			// We first need to delete expired ChangesetSpecs...
-			if err := cstore.DeleteExpiredChangesetSpecs(ctx); err != nil {
-				return errors.Wrap(err, "DeleteExpiredChangesetSpecs")
+const (
+	// specExpireChunkSize is the maximum number of specs deleted in a single
+	// statement, which bounds how long rows in the specs tables stay locked.
+	specExpireChunkSize = 500
+
+	// specExpireChunkDelay is the pause between two consecutive chunks, which
+	// gives other work on the specs tables a chance to make progress.
+	specExpireChunkDelay = 100 * time.Millisecond
+
+	// specExpireMaxPerRun is the maximum number of specs of each kind deleted
+	// in a single run. Any remaining expired specs are deleted in later runs.
+	specExpireMaxPerRun = 20000
+
+	// specExpireAuditTimeout bounds how long recording the audit events of a
+	// run may take once the run itself has been interrupted.
+	specExpireAuditTimeout = 10 * time.Second
+)
+
+type specExpirer struct {
+	store      *store.Store
+	metrics    specExpireMetrics
+	chunkSize  int
+	chunkDelay time.Duration
+	maxPerRun  int
+}
+
+var _ goroutine.Handler = &specExpirer{}
+var _ goroutine.ErrorHandler = &specExpirer{}
+
+func newSpecExpireJob(ctx context.Context, cstore *store.Store, metrics batchChangesMetrics) goroutine.BackgroundRoutine {
+	return newPeriodicRoutine(ctx, "spec_expire", specExpireInteral, &specExpirer{
+		store:      cstore,
+		metrics:    metrics.specExpireMetrics,
+		chunkSize:  specExpireChunkSize,
+		chunkDelay: specExpireChunkDelay,
+		maxPerRun:  specExpireMaxPerRun,
+	}, cstore, metrics)
+}
+
+func (e *specExpirer) Handle(ctx context.Context) error {
+	e.metrics.runs.Inc()
+
+	if conf.Get().BatchChangesSpecExpirationDryRun {
+		return e.reportExpired(ctx)
+	}
+
+	// We first need to delete expired ChangesetSpecs...
+	changesetSpecOwners, changesetSpecsDone, err := e.deleteInChunks(ctx, e.store.DeleteExpiredChangesetSpecs)
+	changesetSpecs := changesetSpecOwners.Count()
+	e.metrics.changesetSpecsDeleted.Add(float64(changesetSpecs))
+	if err != nil {
+		log15.Warn("Deleting expired changeset specs was interrupted", "deleted", changesetSpecs)
+		e.logAuditEvents(ctx, changesetSpecOwners, nil)
+		return errors.Wrap(err, "DeleteExpiredChangesetSpecs")
+	}
+
+	// ... and then the BatchSpecs, due to the batch_spec_id
+	// foreign key on changeset_specs.
+	batchSpecOwners, batchSpecsDone, err := e.deleteInChunks(ctx, e.store.DeleteExpiredBatchSpecs)
+	batchSpecs := batchSpecOwners.Count()
+	e.metrics.batchSpecsDeleted.Add(float64(batchSpecs))
+	e.logAuditEvents(ctx, changesetSpecOwners, batchSpecOwners)
+	if err != nil {
+		log15.Warn("Deleting expired batch specs was interrupted", "deleted", batchSpecs, "changesetSpecs", changesetSpecs)
+		return errors.Wrap(err, "DeleteExpiredBatchSpecs")
+	}
+
+	if !changesetSpecsDone || !batchSpecsDone {
+		e.metrics.incompleteRuns.Inc()
+		log15.Info("Deleted expired batch changes specs, more remain to be deleted in the next run", "changesetSpecs", changesetSpecs, "batchSpecs", batchSpecs)
+	} else if changesetSpecs > 0 || batchSpecs > 0 {
+		log15.Info("Deleted expired batch changes specs", "changesetSpecs", changesetSpecs, "batchSpecs", batchSpecs)
+	} else {
+		log15.Debug("No expired batch changes specs to delete")
+	}
+
+	return nil
+}
+
+// reportExpired logs the owners and ages of the specs that would be deleted
+// if dry-run mode was disabled, without deleting anything.
+func (e *specExpirer) reportExpired(ctx context.Context) error {
+	changesetSpecOwners, err := e.store.ListExpiredChangesetSpecOwners(ctx)
+	if err != nil {
+		return errors.Wrap(err, "ListExpiredChangesetSpecOwners")
+	}
+	batchSpecOwners, err := e.store.ListExpiredBatchSpecOwners(ctx)
+	if err != nil {
+		return errors.Wrap(err, "ListExpiredBatchSpecOwners")
+	}
+
+	now := e.store.Clock()()
+	changesetSpecs := reportExpiredOwners(now, "changeset specs", changesetSpecOwners)
+	batchSpecs := reportExpiredOwners(now, "batch specs", batchSpecOwners)
+	e.metrics.dryRunChangesetSpecs.Set(float64(changesetSpecs))
+	e.metrics.dryRunBatchSpecs.Set(float64(batchSpecs))
+
+	log15.Info("Dry run: would delete expired batch changes specs", "changesetSpecs", changesetSpecs, "batchSpecs", batchSpecs)
+	return nil
+}
+
+// reportExpiredOwners logs the expired specs of each owner and returns the
+// total number of expired specs.
+func reportExpiredOwners(now time.Time, kind string, owners btypes.ExpiredSpecsOwners) (total int) {
+	for _, o := range owners {
+		total += o.Count
+		log15.Info("Dry run: would delete expired "+kind, "userID", o.UserID, "count", o.Count, "oldestAge", now.Sub(o.OldestCreatedAt).Truncate(time.Minute))
+	}
+	return total
+}
+
+// specsExpiredEvent is the argument of the security event recorded for the
+// specs of a single user deleted in a run.
+type specsExpiredEvent struct {
+	ChangesetSpecs int `json:"changesetSpecs"`
+	BatchSpecs     int `json:"batchSpecs"`
+
+	OldestChangesetSpecCreatedAt *time.Time `json:"oldestChangesetSpecCreatedAt,omitempty"`
+	OldestBatchSpecCreatedAt     *time.Time `json:"oldestBatchSpecCreatedAt,omitempty"`
+
+	// The TTLs are recorded so that the time at which the specs expired can
+	// be told from their creation time.
+	ChangesetSpecTTL string `json:"changesetSpecTTL"`
+	BatchSpecTTL     string `json:"batchSpecTTL"`
+}
+
+// specsExpiredEvents groups the deleted specs by the user who created them.
+func specsExpiredEvents(changesetSpecOwners, batchSpecOwners btypes.ExpiredSpecsOwners) (userIDs []int32, events map[int32]*specsExpiredEvent) {
+	events = make(map[int32]*specsExpiredEvent)
+	eventFor := func(userID int32) *specsExpiredEvent {
+		if _, ok := events[userID]; !ok {
+			userIDs = append(userIDs, userID)
+			events[userID] = &specsExpiredEvent{
+				ChangesetSpecTTL: btypes.ChangesetSpecTTL.String(),
+				BatchSpecTTL:     btypes.BatchSpecTTL.String(),
+			}
+		}
+		return events[userID]
+	}
+
+	for _, o := range changesetSpecOwners {
+		ev := eventFor(o.UserID)
+		ev.ChangesetSpecs += o.Count
+		oldest := o.OldestCreatedAt
+		ev.OldestChangesetSpecCreatedAt = &oldest
+	}
+	for _, o := range batchSpecOwners {
+		ev := eventFor(o.UserID)
+		ev.BatchSpecs += o.Count
+		oldest := o.OldestCreatedAt
+		ev.OldestBatchSpecCreatedAt = &oldest
+	}
+
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	return userIDs, events
+}
+
+// logAuditEvents records a security event per user whose specs were deleted,
+// so that deletions can be reviewed later. Failing to record them is logged,
+// but doesn't fail the run, as the specs are already deleted. For the same
+// reason, they are recorded even if ctx is canceled.
+func (e *specExpirer) logAuditEvents(ctx context.Context, changesetSpecOwners, batchSpecOwners btypes.ExpiredSpecsOwners) {
+	userIDs, events := specsExpiredEvents(changesetSpecOwners, batchSpecOwners)
+
+	ctx, cancel := context.WithTimeout(goroutine.Detach(ctx), specExpireAuditTimeout)
+	defer cancel()
+
+	for _, userID := range userIDs {
+		arg, err := json.Marshal(events[userID])
+		if err != nil {
+			log15.Error("Failed to marshal audit event for expired specs", "error", err)
+			continue
+		}
+
+		event := &database.SecurityEvent{
+			Name:      database.SecurityEventNameBatchChangesSpecsExpired,
+			UserID:    uint32(userID),
+			Argument:  arg,
+			Source:    "BACKEND",
+			Timestamp: e.store.Clock()(),
+		}
+		if userID == 0 {
+			// The user who created the specs has been deleted.
+			event.AnonymousUserID = "internal"
+		}
+		if err := database.SecurityEventLogs(e.store.DB()).Insert(ctx, event); err != nil {
+			log15.Error("Failed to record audit event for expired specs", "error", err, "userID", userID, "event", string(arg))
+		}
+	}
+}
+
+// deleteInChunks calls deleteChunk with the configured chunk size until it
+// deletes less than a full chunk or the per-run maximum is reached. It returns
+// the deleted records per owner, and whether all expired records have been
+// deleted. The owners are accurate even if an error is returned.
+func (e *specExpirer) deleteInChunks(ctx context.Context, deleteChunk func(ctx context.Context, limit int) (btypes.ExpiredSpecsOwners, error)) (owners btypes.ExpiredSpecsOwners, done bool, err error) {
+	total := 0
+	for total < e.maxPerRun {
+		limit := e.chunkSize
+		if remaining := e.maxPerRun - total; remaining < limit {
+			limit = remaining
+		}
+
+		deleted, err := deleteChunk(ctx, limit)
+		owners = mergeExpiredSpecsOwners(owners, deleted)
+		count := deleted.Count()
+		total += count
+		if err != nil {
+			return owners, false, err
+		}
+		if count < limit {
+			return owners, true, nil
+		}
+
+		select {
+		case <-time.After(e.chunkDelay):
+		case <-ctx.Done():
+			return owners, false, ctx.Err()
+		}
+	}
+
+	return owners, false, nil
+}
+
+// mergeExpiredSpecsOwners adds the counts of the owners in b to the owners in
+// a, keeping the oldest creation time of each owner.
+func mergeExpiredSpecsOwners(a, b btypes.ExpiredSpecsOwners) btypes.ExpiredSpecsOwners {
+	for _, o := range b {
+		merged := false
+		for _, existing := range a {
+			if existing.UserID != o.UserID {
+				continue
 			}
-			// ... and then the BatchSpecs, due to the batch_spec_id
-			// foreign key on changeset_specs.
-			if err := cstore.DeleteExpiredBatchSpecs(ctx); err != nil {
-				return errors.Wrap(err, "DeleteExpiredBatchSpecs")
+			existing.Count += o.Count
+			if o.OldestCreatedAt.Before(existing.OldestCreatedAt) {
+				existing.OldestCreatedAt = o.OldestCreatedAt
 			}
-			return nil
-		}),
-	)
+			merged = true
+			break
+		}
+		if !merged {
+			a = append(a, o)
+		}
+	}
+	return a
+}
+
+func (e *specExpirer) HandleError(err error) {
+	e.metrics.errors.Inc()
+	log15.Error("Failed to expire batch changes specs", "error", err)
 }
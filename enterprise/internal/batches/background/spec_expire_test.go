@@ -0,0 +1,197 @@
+package background
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/enterprise/internal/batches/store"
+	ct "github.com/sourcegraph/sourcegraph/enterprise/internal/batches/testing"
+	btypes "github.com/sourcegraph/sourcegraph/enterprise/internal/batches/types"
+	"github.com/sourcegraph/sourcegraph/internal/conf"
+	"github.com/sourcegraph/sourcegraph/internal/database"
+	"github.com/sourcegraph/sourcegraph/internal/database/dbtest"
+	"github.com/sourcegraph/sourcegraph/internal/observation"
+	"github.com/sourcegraph/sourcegraph/internal/timeutil"
+)
+
+func TestSpecExpirerDeleteInChunks(t *testing.T) {
+	tests := []struct {
+		name       string
+		backlog    int
+		failAfter  int
+		wantTotal  int
+		wantDone   bool
+		wantErr    bool
+		wantLimits []int
+	}{
+		{name: "empty", backlog: 0, wantTotal: 0, wantDone: true, wantLimits: []int{3}},
+		{name: "partial chunk", backlog: 2, wantTotal: 2, wantDone: true, wantLimits: []int{3}},
+		{name: "full chunks", backlog: 6, wantTotal: 6, wantDone: true, wantLimits: []int{3, 3, 1}},
+		{name: "per run limit", backlog: 20, wantTotal: 7, wantDone: false, wantLimits: []int{3, 3, 1}},
+		{name: "error", backlog: 20, failAfter: 2, wantTotal: 3, wantErr: true, wantLimits: []int{3, 3}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &specExpirer{chunkSize: 3, maxPerRun: 7}
+
+			backlog := tc.backlog
+			var limits []int
+			deleteChunk := func(ctx context.Context, limit int) (btypes.ExpiredSpecsOwners, error) {
+				limits = append(limits, limit)
+				if tc.failAfter > 0 && len(limits) == tc.failAfter {
+					return nil, errors.New("database unavailable")
+				}
+
+				count := limit
+				if backlog < count {
+					count = backlog
+				}
+				backlog -= count
+				if count == 0 {
+					return nil, nil
+				}
+				return btypes.ExpiredSpecsOwners{{UserID: 1, Count: count}}, nil
+			}
+
+			owners, done, err := e.deleteInChunks(context.Background(), deleteChunk)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(owners) > 1 {
+				t.Errorf("owners not merged: %+v", owners)
+			}
+			if total := owners.Count(); total != tc.wantTotal {
+				t.Errorf("wrong total. want=%d have=%d", tc.wantTotal, total)
+			}
+			if done != tc.wantDone {
+				t.Errorf("wrong done. want=%t have=%t", tc.wantDone, done)
+			}
+			if diff := cmp.Diff(tc.wantLimits, limits); diff != "" {
+				t.Errorf("unexpected limits (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSpecsExpiredEvents(t *testing.T) {
+	older := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+
+	changesetSpecOwners := mergeExpiredSpecsOwners(
+		btypes.ExpiredSpecsOwners{{UserID: 2, Count: 3, OldestCreatedAt: newer}},
+		btypes.ExpiredSpecsOwners{{UserID: 2, Count: 1, OldestCreatedAt: older}, {UserID: 0, Count: 1, OldestCreatedAt: older}},
+	)
+	batchSpecOwners := btypes.ExpiredSpecsOwners{{UserID: 1, Count: 2, OldestCreatedAt: newer}, {UserID: 2, Count: 1, OldestCreatedAt: newer}}
+
+	userIDs, events := specsExpiredEvents(changesetSpecOwners, batchSpecOwners)
+	if diff := cmp.Diff([]int32{0, 1, 2}, userIDs); diff != "" {
+		t.Fatalf("unexpected user IDs (-want +got):\n%s", diff)
+	}
+
+	ttls := specsExpiredEvent{ChangesetSpecTTL: btypes.ChangesetSpecTTL.String(), BatchSpecTTL: btypes.BatchSpecTTL.String()}
+	want := map[int32]*specsExpiredEvent{
+		0: {ChangesetSpecs: 1, OldestChangesetSpecCreatedAt: &older},
+		1: {BatchSpecs: 2, OldestBatchSpecCreatedAt: &newer},
+		2: {ChangesetSpecs: 4, OldestChangesetSpecCreatedAt: &older, BatchSpecs: 1, OldestBatchSpecCreatedAt: &newer},
+	}
+	for _, ev := range want {
+		ev.ChangesetSpecTTL, ev.BatchSpecTTL = ttls.ChangesetSpecTTL, ttls.BatchSpecTTL
+	}
+	if diff := cmp.Diff(want, events); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+}
+
+func TestSpecExpirerInterruptedRunRecordsAuditEvents(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	t.Parallel()
+
+	ctx := context.Background()
+	db := dbtest.NewDB(t, "")
+
+	now := timeutil.Now()
+	clock := func() time.Time { return now }
+	cstore := store.NewWithClock(db, &observation.TestContext, nil, clock)
+	ct.MockConfig(t, &conf.Unified{})
+
+	user := ct.CreateTestUser(t, db, false)
+	repos, _ := ct.CreateTestRepos(t, ctx, db, 1)
+	for i := 0; i < 2; i++ {
+		spec := &btypes.ChangesetSpec{
+			RepoID:    repos[0].ID,
+			UserID:    user.ID,
+			CreatedAt: now.Add(-btypes.ChangesetSpecTTL - time.Hour),
+		}
+		if err := cstore.CreateChangesetSpec(ctx, spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The run deletes a single spec, and is then interrupted while waiting
+	// to delete the next one.
+	e := &specExpirer{
+		store:      cstore,
+		metrics:    makeSpecExpireMetrics(&observation.TestContext),
+		chunkSize:  1,
+		chunkDelay: time.Hour,
+		maxPerRun:  10,
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() { errs <- e.Handle(runCtx) }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		count, err := cstore.CountChangesetSpecs(ctx, store.CountChangesetSpecsOpts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count < 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no changeset spec deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT argument FROM security_event_logs WHERE name = $1 AND user_id = $2", database.SecurityEventNameBatchChangesSpecsExpired, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var events []specsExpiredEvent
+	for rows.Next() {
+		var arg []byte
+		if err := rows.Scan(&arg); err != nil {
+			t.Fatal(err)
+		}
+		var ev specsExpiredEvent
+		if err := json.Unmarshal(arg, &ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0].ChangesetSpecs != 1 {
+		t.Fatalf("want one audit event for one deleted changeset spec, have %+v", events)
+	}
+}
@@ -496,7 +496,7 @@ func decorateChangesetBody(ctx context.Context, tx getBatchChanger, nsStore getN
 		return errors.Wrap(err, "retrieving namespace")
 	}
 
-	u, err := batchChangeURL(ctx, ns, batchChange)
+	u, err := BatchChangeURL(ctx, ns, batchChange)
 	if err != nil {
 		return errors.Wrap(err, "building URL")
 	}
@@ -514,7 +514,9 @@ var internalClient interface {
 	ExternalURL(context.Context) (string, error)
 } = api.InternalClient
 
-func batchChangeURL(ctx context.Context, ns *database.Namespace, c *btypes.BatchChange) (string, error) {
+// BatchChangeURL returns the absolute URL of the given batch change on this
+// Sourcegraph instance.
+func BatchChangeURL(ctx context.Context, ns *database.Namespace, c *btypes.BatchChange) (string, error) {
 	// To build the absolute URL, we need to know where Sourcegraph is!
 	extStr, err := internalClient.ExternalURL(ctx)
 	if err != nil {
@@ -1036,7 +1036,7 @@ func TestBatchChangeURL(t *testing.T) {
 				internalClient = tc
 				defer func() { internalClient = api.InternalClient }()
 
-				if _, err := batchChangeURL(ctx, nil, nil); err == nil {
+				if _, err := BatchChangeURL(ctx, nil, nil); err == nil {
 					t.Error("unexpected nil error")
 				}
 			})
@@ -1047,7 +1047,7 @@ func TestBatchChangeURL(t *testing.T) {
 		internalClient = &mockInternalClient{externalURL: "https://sourcegraph.test"}
 		defer func() { internalClient = api.InternalClient }()
 
-		url, err := batchChangeURL(
+		url, err := BatchChangeURL(
 			ctx,
 			&database.Namespace{Name: "foo", Organization: 123},
 			&btypes.BatchChange{Name: "bar"},
@@ -526,6 +526,80 @@ func listBatchChangesQuery(opts *ListBatchChangesOpts, repoAuthzConds *sqlf.Quer
 	)
 }
 
+// ListCompletedBatchChangesToNotify lists open batch changes whose changesets
+// have all reached a final state on the code host, and whose author has not
+// been notified about it since the batch change was last applied.
+func (s *Store) ListCompletedBatchChangesToNotify(ctx context.Context, limit int) (cs []*btypes.BatchChange, err error) {
+	ctx, endObservation := s.operations.listCompletedBatchChangesToNotify.With(ctx, &err, observation.Args{})
+	defer func() {
+		endObservation(1, observation.Args{LogFields: []log.Field{log.Int("count", len(cs))}})
+	}()
+
+	q := sqlf.Sprintf(
+		listCompletedBatchChangesToNotifyQueryFmtstr,
+		sqlf.Join(batchChangeColumns, ", "),
+		btypes.ChangesetExternalStateMerged,
+		btypes.ChangesetExternalStateClosed,
+		btypes.ChangesetExternalStateDeleted,
+		limit,
+	)
+
+	err = s.query(ctx, q, func(sc scanner) error {
+		var c btypes.BatchChange
+		if err := scanBatchChange(&c, sc); err != nil {
+			return err
+		}
+		cs = append(cs, &c)
+		return nil
+	})
+	return cs, err
+}
+
+var listCompletedBatchChangesToNotifyQueryFmtstr = `
+-- source: enterprise/internal/batches/store/batch_changes.go:ListCompletedBatchChangesToNotify
+WITH tracked_changesets AS (
+	SELECT
+		batch_changes.id AS batch_change_id,
+		changesets.external_state
+	FROM batch_changes
+	JOIN changesets ON changesets.batch_change_ids ? batch_changes.id::TEXT
+	JOIN repo ON repo.id = changesets.repo_id
+	WHERE
+		repo.deleted_at IS NULL AND
+		NOT COALESCE((changesets.batch_change_ids->batch_changes.id::TEXT->>'isArchived')::bool, false) AND
+		NOT COALESCE((changesets.batch_change_ids->batch_changes.id::TEXT->>'archive')::bool, false)
+)
+SELECT %s FROM batch_changes
+WHERE
+	batch_changes.closed_at IS NULL AND
+	(batch_changes.completion_notified_at IS NULL OR batch_changes.completion_notified_at < batch_changes.last_applied_at) AND
+	EXISTS (SELECT 1 FROM tracked_changesets WHERE batch_change_id = batch_changes.id) AND
+	NOT EXISTS (
+		SELECT 1 FROM tracked_changesets
+		WHERE
+			batch_change_id = batch_changes.id AND
+			(external_state IS NULL OR external_state NOT IN (%s, %s, %s))
+	)
+ORDER BY batch_changes.id ASC
+LIMIT %s
+`
+
+// MarkBatchChangeCompletionNotified records that the author of the batch
+// change with the given ID has been notified about its completion.
+func (s *Store) MarkBatchChangeCompletionNotified(ctx context.Context, id int64) (err error) {
+	ctx, endObservation := s.operations.markBatchChangeCompletionNotified.With(ctx, &err, observation.Args{LogFields: []log.Field{
+		log.Int("ID", int(id)),
+	}})
+	defer endObservation(1, observation.Args{})
+
+	return s.Store.Exec(ctx, sqlf.Sprintf(markBatchChangeCompletionNotifiedQueryFmtstr, s.now(), id))
+}
+
+var markBatchChangeCompletionNotifiedQueryFmtstr = `
+-- source: enterprise/internal/batches/store/batch_changes.go:MarkBatchChangeCompletionNotified
+UPDATE batch_changes SET completion_notified_at = %s WHERE id = %s
+`
+
 func scanBatchChange(c *btypes.BatchChange, s scanner) error {
 	return s.Scan(
 		&c.ID,
@@ -797,6 +797,101 @@ func testStoreBatchChanges(t *testing.T, ctx context.Context, s *Store, clock ct
 	})
 }
 
+func testStoreCompletedBatchChanges(t *testing.T, ctx context.Context, s *Store, clock ct.Clock) {
+	repo := ct.TestRepo(t, database.ExternalServicesWith(s), extsvc.KindGitHub)
+	if err := database.ReposWith(s).Create(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+
+	createBatchChange := func(name string, closedAt time.Time) *btypes.BatchChange {
+		c := &btypes.BatchChange{
+			Name:             name,
+			InitialApplierID: 1,
+			NamespaceUserID:  1,
+			LastApplierID:    1,
+			LastAppliedAt:    clock.Now(),
+			BatchSpecID:      1,
+			ClosedAt:         closedAt,
+		}
+		if err := s.CreateBatchChange(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	createChangeset := func(c *btypes.BatchChange, state btypes.ChangesetExternalState, archived bool) {
+		cs := &btypes.Changeset{
+			RepoID:              repo.ID,
+			ExternalServiceType: extsvc.TypeGitHub,
+			PublicationState:    btypes.ChangesetPublicationStatePublished,
+			ExternalState:       state,
+			BatchChanges:        []btypes.BatchChangeAssoc{{BatchChangeID: c.ID, IsArchived: archived}},
+		}
+		if state == "" {
+			cs.PublicationState = btypes.ChangesetPublicationStateUnpublished
+		}
+		if err := s.CreateChangeset(ctx, cs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		completed  = createBatchChange("completed", time.Time{})
+		inProgress = createBatchChange("in-progress", time.Time{})
+		unpublish  = createBatchChange("unpublished", time.Time{})
+		closed     = createBatchChange("closed", clock.Now())
+		_          = createBatchChange("empty", time.Time{})
+	)
+
+	createChangeset(completed, btypes.ChangesetExternalStateMerged, false)
+	createChangeset(completed, btypes.ChangesetExternalStateClosed, false)
+	// Archived changesets are no longer tracked by the batch change.
+	createChangeset(completed, btypes.ChangesetExternalStateOpen, true)
+
+	createChangeset(inProgress, btypes.ChangesetExternalStateMerged, false)
+	createChangeset(inProgress, btypes.ChangesetExternalStateOpen, false)
+
+	createChangeset(unpublish, btypes.ChangesetExternalStateMerged, false)
+	createChangeset(unpublish, "", false)
+
+	createChangeset(closed, btypes.ChangesetExternalStateMerged, false)
+
+	assertCompleted := func(t *testing.T, want ...int64) {
+		t.Helper()
+
+		have, err := s.ListCompletedBatchChangesToNotify(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		haveIDs := []int64{}
+		for _, c := range have {
+			haveIDs = append(haveIDs, c.ID)
+		}
+		if want == nil {
+			want = []int64{}
+		}
+		if diff := cmp.Diff(want, haveIDs); diff != "" {
+			t.Fatalf("unexpected batch changes (-want +got):\n%s", diff)
+		}
+	}
+
+	assertCompleted(t, completed.ID)
+
+	if err := s.MarkBatchChangeCompletionNotified(ctx, completed.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t)
+
+	// Applying the batch change again makes it eligible for another
+	// notification once it completes.
+	clock.Add(time.Minute)
+	completed.LastAppliedAt = clock.Now()
+	if err := s.UpdateBatchChange(ctx, completed); err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, completed.ID)
+}
+
 func testUserDeleteCascades(t *testing.T, ctx context.Context, s *Store, clock ct.Clock) {
 	orgID := ct.InsertTestOrg(t, s.DB(), "user-delete-cascades")
 	user := ct.CreateTestUser(t, s.DB(), false)
@@ -405,29 +405,104 @@ ON
 }
 
 // DeleteExpiredBatchSpecs deletes BatchSpecs that have not been attached
-// to a Batch change within BatchSpecTTL.
-func (s *Store) DeleteExpiredBatchSpecs(ctx context.Context) (err error) {
-	ctx, endObservation := s.operations.deleteExpiredBatchSpecs.With(ctx, &err, observation.Args{})
-	defer endObservation(1, observation.Args{})
-
-	expirationTime := s.now().Add(-btypes.BatchSpecTTL)
-	q := sqlf.Sprintf(deleteExpiredBatchSpecsQueryFmtstr, expirationTime)
+// to a Batch change within BatchSpecTTL. At most limit BatchSpecs are
+// deleted. It returns the number of deleted BatchSpecs per user who created
+// them.
+func (s *Store) DeleteExpiredBatchSpecs(ctx context.Context, limit int) (owners btypes.ExpiredSpecsOwners, err error) {
+	ctx, endObservation := s.operations.deleteExpiredBatchSpecs.With(ctx, &err, observation.Args{LogFields: []log.Field{
+		log.Int("limit", limit),
+	}})
+	defer func() {
+		endObservation(1, observation.Args{LogFields: []log.Field{log.Int("count", owners.Count())}})
+	}()
 
-	return s.Store.Exec(ctx, q)
+	q := sqlf.Sprintf(deleteExpiredBatchSpecsQueryFmtstr, s.expiredBatchSpecsCondition(), limit)
+	err = s.query(ctx, q, func(sc scanner) error {
+		var o btypes.ExpiredSpecsOwner
+		if err := scanExpiredSpecsOwner(&o, sc); err != nil {
+			return err
+		}
+		owners = append(owners, &o)
+		return nil
+	})
+	return owners, err
 }
 
 var deleteExpiredBatchSpecsQueryFmtstr = `
 -- source: enterprise/internal/batches/store.go:DeleteExpiredBatchSpecs
-DELETE FROM
-  batch_specs
-WHERE
-  created_at < %s
-AND NOT EXISTS (
-  SELECT 1 FROM batch_changes WHERE batch_spec_id = batch_specs.id
-)
-AND NOT EXISTS (
-  SELECT 1 FROM changeset_specs WHERE batch_spec_id = batch_specs.id
+WITH deleted AS (
+  DELETE FROM
+    batch_specs
+  WHERE id IN (
+    SELECT
+      bspecs.id
+    FROM
+      batch_specs bspecs
+    WHERE
+      %s
+    LIMIT %s
+  )
+  RETURNING user_id, created_at
 )
+SELECT
+  user_id,
+  COUNT(*),
+  MIN(created_at)
+FROM deleted
+GROUP BY user_id
+ORDER BY user_id ASC NULLS FIRST
+`
+
+// ListExpiredBatchSpecOwners returns, for each user, the number of BatchSpecs
+// that DeleteExpiredBatchSpecs would currently delete and the creation time
+// of the oldest of them. It doesn't delete anything.
+//
+// BatchSpecs that still have ChangesetSpecs attached are not included, even
+// if those ChangesetSpecs are expired, too.
+func (s *Store) ListExpiredBatchSpecOwners(ctx context.Context) (owners btypes.ExpiredSpecsOwners, err error) {
+	ctx, endObservation := s.operations.listExpiredBatchSpecOwners.With(ctx, &err, observation.Args{})
+	defer endObservation(1, observation.Args{})
+
+	q := sqlf.Sprintf(listExpiredBatchSpecOwnersQueryFmtstr, s.expiredBatchSpecsCondition())
+	err = s.query(ctx, q, func(sc scanner) error {
+		var o btypes.ExpiredSpecsOwner
+		if err := scanExpiredSpecsOwner(&o, sc); err != nil {
+			return err
+		}
+		owners = append(owners, &o)
+		return nil
+	})
+	return owners, err
+}
+
+var listExpiredBatchSpecOwnersQueryFmtstr = `
+-- source: enterprise/internal/batches/store/batch_specs.go:ListExpiredBatchSpecOwners
+SELECT
+  bspecs.user_id,
+  COUNT(*),
+  MIN(bspecs.created_at)
+FROM
+  batch_specs bspecs
+WHERE
+  %s
+GROUP BY bspecs.user_id
+ORDER BY bspecs.user_id ASC NULLS FIRST
+`
+
+// expiredBatchSpecsCondition returns the condition that the BatchSpecs
+// aliased as bspecs have to satisfy to be expired.
+func (s *Store) expiredBatchSpecsCondition() *sqlf.Query {
+	return sqlf.Sprintf(expiredBatchSpecsConditionFmtstr, s.now().Add(-btypes.BatchSpecTTL))
+}
+
+var expiredBatchSpecsConditionFmtstr = `
+  bspecs.created_at < %s
+  AND NOT EXISTS (
+    SELECT 1 FROM batch_changes WHERE batch_spec_id = bspecs.id
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM changeset_specs WHERE batch_spec_id = bspecs.id
+  )
 `
 
 func scanBatchSpec(c *btypes.BatchSpec, s scanner) error {
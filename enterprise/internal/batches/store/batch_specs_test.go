@@ -343,9 +343,19 @@ func testStoreBatchSpecs(t *testing.T, ctx context.Context, s *Store, clock ct.C
 				}
 			}
 
-			if err := s.DeleteExpiredBatchSpecs(ctx); err != nil {
+			owners, err := s.DeleteExpiredBatchSpecs(ctx, 100)
+			if err != nil {
 				t.Fatal(err)
 			}
+			count := owners.Count()
+
+			wantCount := 0
+			if tc.wantDeleted {
+				wantCount = 1
+			}
+			if count != wantCount {
+				t.Fatalf("tc=%+v\n\t want %d batch specs deleted, got %d", tc, wantCount, count)
+			}
 
 			haveBatchSpecs, err := s.GetBatchSpec(ctx, GetBatchSpecOpts{ID: batchSpec.ID})
 			if err != nil && err != ErrNoResults {
@@ -361,4 +371,64 @@ func testStoreBatchSpecs(t *testing.T, ctx context.Context, s *Store, clock ct.C
 			}
 		}
 	})
+
+	t.Run("DeleteExpiredBatchSpecs with limit", func(t *testing.T) {
+		overTTL := clock.Now().Add(-btypes.BatchSpecTTL - 1*time.Minute)
+
+		for i := 0; i < 3; i++ {
+			batchSpec := &btypes.BatchSpec{
+				UserID:          1,
+				NamespaceUserID: 1,
+				CreatedAt:       overTTL,
+			}
+			if err := s.CreateBatchSpec(ctx, batchSpec); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, want := range []int{2, 1, 0} {
+			owners, err := s.DeleteExpiredBatchSpecs(ctx, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := owners.Count(); have != want {
+				t.Fatalf("wrong number of batch specs deleted. want=%d, have=%d", want, have)
+			}
+		}
+	})
+
+	t.Run("ListExpiredBatchSpecOwners", func(t *testing.T) {
+		underTTL := clock.Now().Add(-btypes.BatchSpecTTL + 1*time.Minute)
+		overTTL := clock.Now().Add(-btypes.BatchSpecTTL - 1*time.Minute)
+		oldest := overTTL.Add(-1 * time.Hour)
+
+		for _, createdAt := range []time.Time{underTTL, overTTL, oldest} {
+			batchSpec := &btypes.BatchSpec{
+				UserID:          1,
+				NamespaceUserID: 1,
+				CreatedAt:       createdAt,
+			}
+			if err := s.CreateBatchSpec(ctx, batchSpec); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		have, err := s.ListExpiredBatchSpecOwners(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := btypes.ExpiredSpecsOwners{{UserID: 1, Count: 2, OldestCreatedAt: oldest}}
+		if diff := cmp.Diff(want, have); diff != "" {
+			t.Fatal(diff)
+		}
+
+		// Listing doesn't delete anything, and deleting reports the same owners.
+		deleted, err := s.DeleteExpiredBatchSpecs(ctx, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, deleted); diff != "" {
+			t.Fatal(diff)
+		}
+	})
 }
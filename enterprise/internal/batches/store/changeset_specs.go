@@ -456,40 +456,123 @@ func (s *Store) ListChangesetSpecsWithConflictingHeadRef(ctx context.Context, ba
 // DeleteExpiredChangesetSpecs deletes each ChangesetSpec that has not been
 // attached to a BatchSpec within ChangesetSpecTTL, OR that is attached
 // to a BatchSpec that is not applied and is not attached to a Changeset
-// within BatchSpecTTL
-func (s *Store) DeleteExpiredChangesetSpecs(ctx context.Context) (err error) {
-	ctx, endObservation := s.operations.deleteExpiredChangesetSpecs.With(ctx, &err, observation.Args{})
-	defer endObservation(1, observation.Args{})
+// within BatchSpecTTL. At most limit ChangesetSpecs are deleted, so that a
+// large backlog can be worked off in multiple short transactions. It returns
+// the number of deleted ChangesetSpecs per user who created them.
+func (s *Store) DeleteExpiredChangesetSpecs(ctx context.Context, limit int) (owners btypes.ExpiredSpecsOwners, err error) {
+	ctx, endObservation := s.operations.deleteExpiredChangesetSpecs.With(ctx, &err, observation.Args{LogFields: []log.Field{
+		log.Int("limit", limit),
+	}})
+	defer func() {
+		endObservation(1, observation.Args{LogFields: []log.Field{log.Int("count", owners.Count())}})
+	}()
 
-	changesetSpecTTLExpiration := s.now().Add(-btypes.ChangesetSpecTTL)
-	batchSpecTTLExpiration := s.now().Add(-btypes.BatchSpecTTL)
-	q := sqlf.Sprintf(deleteExpiredChangesetSpecsQueryFmtstr, changesetSpecTTLExpiration, batchSpecTTLExpiration)
-	return s.Store.Exec(ctx, q)
+	q := sqlf.Sprintf(deleteExpiredChangesetSpecsQueryFmtstr, s.expiredChangesetSpecsCondition(), limit)
+	err = s.query(ctx, q, func(sc scanner) error {
+		var o btypes.ExpiredSpecsOwner
+		if err := scanExpiredSpecsOwner(&o, sc); err != nil {
+			return err
+		}
+		owners = append(owners, &o)
+		return nil
+	})
+	return owners, err
 }
 
 var deleteExpiredChangesetSpecsQueryFmtstr = `
 -- source: enterprise/internal/batches/store/changeset_specs.go:DeleteExpiredChangesetSpecs
-DELETE FROM
+WITH deleted AS (
+  DELETE FROM
+    changeset_specs
+  WHERE id IN (
+    SELECT
+      cspecs.id
+    FROM
+      changeset_specs cspecs
+    WHERE
+      %s
+    LIMIT %s
+  )
+  RETURNING user_id, created_at
+)
+SELECT
+  user_id,
+  COUNT(*),
+  MIN(created_at)
+FROM deleted
+GROUP BY user_id
+ORDER BY user_id ASC NULLS FIRST
+`
+
+// ListExpiredChangesetSpecOwners returns, for each user, the number of
+// ChangesetSpecs that DeleteExpiredChangesetSpecs would currently delete and
+// the creation time of the oldest of them. It doesn't delete anything.
+func (s *Store) ListExpiredChangesetSpecOwners(ctx context.Context) (owners btypes.ExpiredSpecsOwners, err error) {
+	ctx, endObservation := s.operations.listExpiredChangesetSpecOwners.With(ctx, &err, observation.Args{})
+	defer endObservation(1, observation.Args{})
+
+	q := sqlf.Sprintf(listExpiredChangesetSpecOwnersQueryFmtstr, s.expiredChangesetSpecsCondition())
+	err = s.query(ctx, q, func(sc scanner) error {
+		var o btypes.ExpiredSpecsOwner
+		if err := scanExpiredSpecsOwner(&o, sc); err != nil {
+			return err
+		}
+		owners = append(owners, &o)
+		return nil
+	})
+	return owners, err
+}
+
+var listExpiredChangesetSpecOwnersQueryFmtstr = `
+-- source: enterprise/internal/batches/store/changeset_specs.go:ListExpiredChangesetSpecOwners
+SELECT
+  cspecs.user_id,
+  COUNT(*),
+  MIN(cspecs.created_at)
+FROM
   changeset_specs cspecs
 WHERE
-(
-  -- The spec is older than the ChangesetSpecTTL
-  created_at < %s
-  AND
-  -- and it was never attached to a batch_spec
-  batch_spec_id IS NULL
-)
-OR
-(
-  -- The spec is older than the BatchSpecTTL
-  created_at < %s
-  AND
-  -- and the batch_spec it is attached to is not applied to a batch_change
-  NOT EXISTS(SELECT 1 FROM batch_changes WHERE batch_spec_id = cspecs.batch_spec_id)
-  AND
-  -- and it is not attached to a changeset
-  NOT EXISTS(SELECT 1 FROM changesets WHERE current_spec_id = cspecs.id OR previous_spec_id = cspecs.id)
-);`
+  %s
+GROUP BY cspecs.user_id
+ORDER BY cspecs.user_id ASC NULLS FIRST
+`
+
+// expiredChangesetSpecsCondition returns the condition that the
+// ChangesetSpecs aliased as cspecs have to satisfy to be expired.
+func (s *Store) expiredChangesetSpecsCondition() *sqlf.Query {
+	changesetSpecTTLExpiration := s.now().Add(-btypes.ChangesetSpecTTL)
+	batchSpecTTLExpiration := s.now().Add(-btypes.BatchSpecTTL)
+	return sqlf.Sprintf(expiredChangesetSpecsConditionFmtstr, changesetSpecTTLExpiration, batchSpecTTLExpiration)
+}
+
+var expiredChangesetSpecsConditionFmtstr = `
+  (
+    -- The spec is older than the ChangesetSpecTTL
+    cspecs.created_at < %s
+    AND
+    -- and it was never attached to a batch_spec
+    cspecs.batch_spec_id IS NULL
+  )
+  OR
+  (
+    -- The spec is older than the BatchSpecTTL
+    cspecs.created_at < %s
+    AND
+    -- and the batch_spec it is attached to is not applied to a batch_change
+    NOT EXISTS(SELECT 1 FROM batch_changes WHERE batch_spec_id = cspecs.batch_spec_id)
+    AND
+    -- and it is not attached to a changeset
+    NOT EXISTS(SELECT 1 FROM changesets WHERE current_spec_id = cspecs.id OR previous_spec_id = cspecs.id)
+  )
+`
+
+func scanExpiredSpecsOwner(o *btypes.ExpiredSpecsOwner, s scanner) error {
+	return s.Scan(
+		&dbutil.NullInt32{N: &o.UserID},
+		&o.Count,
+		&o.OldestCreatedAt,
+	)
+}
 
 func scanChangesetSpec(c *btypes.ChangesetSpec, s scanner) error {
 	var spec json.RawMessage
@@ -479,11 +479,21 @@ func testStoreChangesetSpecs(t *testing.T, ctx context.Context, s *Store, clock
 				}
 			}
 
-			if err := s.DeleteExpiredChangesetSpecs(ctx); err != nil {
+			owners, err := s.DeleteExpiredChangesetSpecs(ctx, 100)
+			if err != nil {
 				t.Fatal(err)
 			}
+			count := owners.Count()
+
+			wantCount := 0
+			if tc.wantDeleted {
+				wantCount = 1
+			}
+			if count != wantCount {
+				t.Fatalf("tc=%s\n\t want %d changeset specs deleted, got %d", printTestCase(tc), wantCount, count)
+			}
 
-			_, err := s.GetChangesetSpec(ctx, GetChangesetSpecOpts{ID: changesetSpec.ID})
+			_, err = s.GetChangesetSpec(ctx, GetChangesetSpecOpts{ID: changesetSpec.ID})
 			if err != nil && err != ErrNoResults {
 				t.Fatal(err)
 			}
@@ -498,6 +508,40 @@ func testStoreChangesetSpecs(t *testing.T, ctx context.Context, s *Store, clock
 		}
 	})
 
+	t.Run("ListExpiredChangesetSpecOwners", func(t *testing.T) {
+		underTTL := clock.Now().Add(-btypes.ChangesetSpecTTL + 24*time.Hour)
+		overTTL := clock.Now().Add(-btypes.ChangesetSpecTTL - 24*time.Hour)
+		oldest := overTTL.Add(-1 * time.Hour)
+
+		for _, createdAt := range []time.Time{underTTL, overTTL, oldest} {
+			changesetSpec := &btypes.ChangesetSpec{
+				RepoID:    repo.ID,
+				CreatedAt: createdAt,
+			}
+			if err := s.CreateChangesetSpec(ctx, changesetSpec); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		have, err := s.ListExpiredChangesetSpecOwners(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := btypes.ExpiredSpecsOwners{{UserID: 0, Count: 2, OldestCreatedAt: oldest}}
+		if diff := cmp.Diff(want, have); diff != "" {
+			t.Fatal(diff)
+		}
+
+		// Listing doesn't delete anything, and deleting reports the same owners.
+		deleted, err := s.DeleteExpiredChangesetSpecs(ctx, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, deleted); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
 	t.Run("GetRewirerMappings", func(t *testing.T) {
 		// Create some test data
 		user := ct.CreateTestUser(t, s.DB(), true)
@@ -456,13 +456,18 @@ func (s *Store) ListChangesetSyncData(ctx context.Context, opts ListChangesetSyn
 }
 
 func scanChangesetSyncData(h *btypes.ChangesetSyncData, s scanner) error {
-	return s.Scan(
+	var externalState string
+	err := s.Scan(
 		&h.ChangesetID,
 		&h.UpdatedAt,
 		&dbutil.NullTime{Time: &h.LatestEvent},
 		&dbutil.NullTime{Time: &h.ExternalUpdatedAt},
+		&h.BatchChangeUpdatedAt,
+		&dbutil.NullString{S: &externalState},
 		&h.RepoExternalServiceID,
 	)
+	h.ExternalState = btypes.ChangesetExternalState(externalState)
+	return err
 }
 
 const listChangesetSyncDataQueryFmtstr = `
@@ -471,6 +476,8 @@ SELECT changesets.id,
 	changesets.updated_at,
 	max(ce.updated_at) AS latest_event,
 	changesets.external_updated_at,
+	max(batch_changes.updated_at) AS batch_change_updated_at,
+	changesets.external_state,
 	r.external_service_id
 FROM changesets
 LEFT JOIN changeset_events ce ON changesets.id = ce.changeset_id
@@ -667,6 +674,7 @@ SET
 	num_failures = 0,
 	failure_message = NULL,
 	syncer_error = NULL,
+	reconciler_retries = 0,
 	updated_at = %s
 WHERE
 	%s
@@ -691,6 +699,172 @@ func (s *Store) enqueueChangesetQuery(cs *btypes.Changeset, resetState, currentS
 	)
 }
 
+// RequeueFailedChangesetsOpts captures the query options needed for
+// requeueing failed changesets.
+type RequeueFailedChangesetsOpts struct {
+	// MaxNumFailures and MaxNumResets are the limits configured on the
+	// reconciler worker store. Only changesets that reached one of them are
+	// requeued, as other failures are not retryable.
+	MaxNumFailures int
+	MaxNumResets   int
+
+	// MaxRetries is the maximum number of times a changeset is requeued.
+	MaxRetries int
+
+	// Backoff is the time after it failed that a changeset is requeued for
+	// the first time. It doubles with every retry, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// RequeueFailedChangesets requeues changesets for which the reconciler gave up
+// after exhausting its retries, once their backoff has passed. It returns the
+// retry count of each requeued changeset. The retry count of changesets that
+// have since been reconciled successfully is reset.
+func (s *Store) RequeueFailedChangesets(ctx context.Context, opts RequeueFailedChangesetsOpts) (retries []int, err error) {
+	ctx, endObservation := s.operations.requeueFailedChangesets.With(ctx, &err, observation.Args{})
+	defer func() {
+		endObservation(1, observation.Args{LogFields: []log.Field{log.Int("count", len(retries))}})
+	}()
+
+	q := sqlf.Sprintf(
+		resetChangesetReconcilerRetriesQueryFmtstr,
+		btypes.ReconcilerStateCompleted.ToDB(),
+	)
+	if err := s.Store.Exec(ctx, q); err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	q = sqlf.Sprintf(
+		requeueFailedChangesetsQueryFmtstr,
+		btypes.ReconcilerStateQueued.ToDB(),
+		now,
+		btypes.ReconcilerStateFailed.ToDB(),
+		opts.MaxNumFailures,
+		opts.MaxNumResets,
+		opts.MaxRetries,
+		now,
+		int(opts.Backoff/time.Second),
+		int(opts.MaxBackoff/time.Second),
+	)
+	return basestore.ScanInts(s.Store.Query(ctx, q))
+}
+
+var resetChangesetReconcilerRetriesQueryFmtstr = `
+-- source: enterprise/internal/batches/store/changesets.go:RequeueFailedChangesets
+UPDATE changesets
+SET reconciler_retries = 0
+WHERE
+	reconciler_retries > 0 AND
+	reconciler_state = %s
+`
+
+var requeueFailedChangesetsQueryFmtstr = `
+-- source: enterprise/internal/batches/store/changesets.go:RequeueFailedChangesets
+UPDATE changesets
+SET
+	reconciler_state = %s,
+	reconciler_retries = reconciler_retries + 1,
+	num_resets = 0,
+	num_failures = 0,
+	failure_message = NULL,
+	started_at = NULL,
+	finished_at = NULL,
+	process_after = NULL,
+	updated_at = %s
+WHERE id IN (
+	SELECT id FROM changesets
+	WHERE
+		reconciler_state = %s AND
+		(num_failures >= %s OR num_resets >= %s) AND
+		reconciler_retries < %s AND
+		finished_at < %s - LEAST(%s * POWER(2, reconciler_retries), %s) * '1 second'::interval
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING
+	reconciler_retries
+`
+
+// DeleteOrphanedChangesets deletes changesets that are no longer attached to
+// any batch change, because the batch changes were deleted or detached them,
+// and that haven't been updated since olderThan. Only the records are deleted,
+// the changesets on the code host are left untouched.
+func (s *Store) DeleteOrphanedChangesets(ctx context.Context, olderThan time.Time) (count int, err error) {
+	ctx, endObservation := s.operations.deleteOrphanedChangesets.With(ctx, &err, observation.Args{})
+	defer func() {
+		endObservation(1, observation.Args{LogFields: []log.Field{log.Int("count", count)}})
+	}()
+
+	q := sqlf.Sprintf(
+		deleteOrphanedChangesetsQueryFmtstr,
+		olderThan,
+		btypes.ReconcilerStateQueued.ToDB(),
+		btypes.ReconcilerStateProcessing.ToDB(),
+	)
+	res, err := s.Store.ExecResult(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := res.RowsAffected()
+	return int(rows), err
+}
+
+var deleteOrphanedChangesetsQueryFmtstr = `
+-- source: enterprise/internal/batches/store/changesets.go:DeleteOrphanedChangesets
+DELETE FROM changesets
+WHERE
+	batch_change_ids = '{}'::jsonb AND
+	updated_at < %s AND
+	reconciler_state NOT IN (%s, %s)
+`
+
+// ArchiveOrphanedChangesets archives changesets in all batch changes they are
+// attached to, if their repository was deleted or they were deleted on the
+// code host before olderThan. Archiving them removes them from the lists of
+// changesets of the batch changes, while keeping their history.
+func (s *Store) ArchiveOrphanedChangesets(ctx context.Context, olderThan time.Time) (count int, err error) {
+	ctx, endObservation := s.operations.archiveOrphanedChangesets.With(ctx, &err, observation.Args{})
+	defer func() {
+		endObservation(1, observation.Args{LogFields: []log.Field{log.Int("count", count)}})
+	}()
+
+	q := sqlf.Sprintf(
+		archiveOrphanedChangesetsQueryFmtstr,
+		s.now(),
+		olderThan,
+		olderThan,
+		btypes.ReconcilerStateQueued.ToDB(),
+		btypes.ReconcilerStateProcessing.ToDB(),
+	)
+	res, err := s.Store.ExecResult(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := res.RowsAffected()
+	return int(rows), err
+}
+
+var archiveOrphanedChangesetsQueryFmtstr = `
+-- source: enterprise/internal/batches/store/changesets.go:ArchiveOrphanedChangesets
+UPDATE changesets
+SET
+	batch_change_ids = (
+		SELECT jsonb_object_agg(key, (value - 'archive') || '{"isArchived": true}'::jsonb)
+		FROM jsonb_each(changesets.batch_change_ids)
+	),
+	updated_at = %s
+WHERE id IN (
+	SELECT changesets.id FROM changesets
+	JOIN repo ON repo.id = changesets.repo_id
+	WHERE
+		(repo.deleted_at < %s OR changesets.external_deleted_at < %s) AND
+		changesets.reconciler_state NOT IN (%s, %s) AND
+		jsonb_path_exists(changesets.batch_change_ids, '$.* ? (!exists(@.isArchived) || @.isArchived == false)')
+	FOR UPDATE OF changesets SKIP LOCKED
+)
+`
+
 // UpdateChangeset updates the given Changeset.
 func (s *Store) UpdateChangeset(ctx context.Context, cs *btypes.Changeset) (err error) {
 	ctx, endObservation := s.operations.updateChangeset.With(ctx, &err, observation.Args{LogFields: []log.Field{
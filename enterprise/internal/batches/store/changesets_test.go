@@ -1587,6 +1587,8 @@ func testStoreListChangesetSyncData(t *testing.T, ctx context.Context, s *Store,
 				UpdatedAt:             clock.Now(),
 				LatestEvent:           clock.Now(),
 				ExternalUpdatedAt:     clock.Now(),
+				BatchChangeUpdatedAt:  clock.Now(),
+				ExternalState:         btypes.ChangesetExternalStateOpen,
 				RepoExternalServiceID: "https://github.com/",
 			},
 			{
@@ -1594,6 +1596,8 @@ func testStoreListChangesetSyncData(t *testing.T, ctx context.Context, s *Store,
 				UpdatedAt:             clock.Now(),
 				LatestEvent:           clock.Now(),
 				ExternalUpdatedAt:     clock.Now(),
+				BatchChangeUpdatedAt:  clock.Now(),
+				ExternalState:         btypes.ChangesetExternalStateOpen,
 				RepoExternalServiceID: "https://github.com/",
 			},
 			{
@@ -1601,6 +1605,8 @@ func testStoreListChangesetSyncData(t *testing.T, ctx context.Context, s *Store,
 				ChangesetID:           changesets[2].ID,
 				UpdatedAt:             clock.Now(),
 				ExternalUpdatedAt:     clock.Now(),
+				BatchChangeUpdatedAt:  clock.Now(),
+				ExternalState:         btypes.ChangesetExternalStateOpen,
 				RepoExternalServiceID: "https://gitlab.com/",
 			},
 		}
@@ -1619,6 +1625,8 @@ func testStoreListChangesetSyncData(t *testing.T, ctx context.Context, s *Store,
 				ChangesetID:           changesets[2].ID,
 				UpdatedAt:             clock.Now(),
 				ExternalUpdatedAt:     clock.Now(),
+				BatchChangeUpdatedAt:  clock.Now(),
+				ExternalState:         btypes.ChangesetExternalStateOpen,
 				RepoExternalServiceID: "https://gitlab.com/",
 			},
 		}
@@ -1638,6 +1646,8 @@ func testStoreListChangesetSyncData(t *testing.T, ctx context.Context, s *Store,
 				UpdatedAt:             clock.Now(),
 				LatestEvent:           clock.Now(),
 				ExternalUpdatedAt:     clock.Now(),
+				BatchChangeUpdatedAt:  clock.Now(),
+				ExternalState:         btypes.ChangesetExternalStateOpen,
 				RepoExternalServiceID: "https://github.com/",
 			},
 		}
@@ -2418,3 +2428,228 @@ func TestEnqueueChangesetsToClose(t *testing.T) {
 		ct.ReloadAndAssertChangeset(t, ctx, s, changeset, want)
 	}
 }
+
+func testStoreRequeueFailedChangesets(t *testing.T, ctx context.Context, s *Store, clock ct.Clock) {
+	rs := database.ReposWith(s)
+	es := database.ExternalServicesWith(s)
+
+	repo := ct.TestRepo(t, es, extsvc.KindGitHub)
+	if err := rs.Create(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := RequeueFailedChangesetsOpts{
+		MaxNumFailures: 3,
+		MaxNumResets:   3,
+		MaxRetries:     2,
+		Backoff:        10 * time.Minute,
+		MaxBackoff:     time.Hour,
+	}
+
+	createChangeset := func(state btypes.ReconcilerState, numFailures, numResets int64, finishedAt time.Time) *btypes.Changeset {
+		cs := &btypes.Changeset{
+			RepoID:              repo.ID,
+			ExternalServiceType: extsvc.TypeGitHub,
+			PublicationState:    btypes.ChangesetPublicationStateUnpublished,
+			ReconcilerState:     state,
+			NumFailures:         numFailures,
+			NumResets:           numResets,
+			FinishedAt:          finishedAt,
+		}
+		if err := s.CreateChangeset(ctx, cs); err != nil {
+			t.Fatal(err)
+		}
+		return cs
+	}
+
+	var (
+		exhaustedFailures = createChangeset(btypes.ReconcilerStateFailed, 3, 0, clock.Now().Add(-20*time.Minute))
+		exhaustedResets   = createChangeset(btypes.ReconcilerStateFailed, 0, 3, clock.Now().Add(-20*time.Minute))
+		notRetryable      = createChangeset(btypes.ReconcilerStateFailed, 1, 0, clock.Now().Add(-20*time.Minute))
+		inBackoff         = createChangeset(btypes.ReconcilerStateFailed, 3, 0, clock.Now().Add(-5*time.Minute))
+		errored           = createChangeset(btypes.ReconcilerStateErrored, 2, 0, clock.Now().Add(-20*time.Minute))
+	)
+
+	assertState := func(t *testing.T, cs *btypes.Changeset, want btypes.ReconcilerState) {
+		t.Helper()
+
+		have, err := s.GetChangesetByID(ctx, cs.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have.ReconcilerState != want {
+			t.Fatalf("changeset %d has wrong reconciler state. want=%s have=%s", cs.ID, want, have.ReconcilerState)
+		}
+	}
+
+	retries, err := s.RequeueFailedChangesets(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{1, 1}, retries); diff != "" {
+		t.Fatalf("unexpected retries (-want +got):\n%s", diff)
+	}
+
+	assertState(t, exhaustedFailures, btypes.ReconcilerStateQueued)
+	assertState(t, exhaustedResets, btypes.ReconcilerStateQueued)
+	assertState(t, notRetryable, btypes.ReconcilerStateFailed)
+	assertState(t, inBackoff, btypes.ReconcilerStateFailed)
+	assertState(t, errored, btypes.ReconcilerStateErrored)
+
+	// Fail the requeued changeset again. The backoff is doubled for the
+	// second retry.
+	fail := func(cs *btypes.Changeset, finishedAt time.Time) {
+		if err := s.Exec(ctx, sqlf.Sprintf(
+			"UPDATE changesets SET reconciler_state = 'failed', num_failures = 3, finished_at = %s WHERE id = %s",
+			finishedAt,
+			cs.ID,
+		)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fail(exhaustedFailures, clock.Now().Add(-15*time.Minute))
+	if retries, err := s.RequeueFailedChangesets(ctx, opts); err != nil {
+		t.Fatal(err)
+	} else if len(retries) != 0 {
+		t.Fatalf("unexpected requeued changesets: %v", retries)
+	}
+
+	fail(exhaustedFailures, clock.Now().Add(-25*time.Minute))
+	if retries, err := s.RequeueFailedChangesets(ctx, opts); err != nil {
+		t.Fatal(err)
+	} else if diff := cmp.Diff([]int{2}, retries); diff != "" {
+		t.Fatalf("unexpected retries (-want +got):\n%s", diff)
+	}
+
+	// After MaxRetries, the changeset stays failed.
+	fail(exhaustedFailures, clock.Now().Add(-24*time.Hour))
+	if retries, err := s.RequeueFailedChangesets(ctx, opts); err != nil {
+		t.Fatal(err)
+	} else if len(retries) != 0 {
+		t.Fatalf("unexpected requeued changesets: %v", retries)
+	}
+	assertState(t, exhaustedFailures, btypes.ReconcilerStateFailed)
+
+	// Once a changeset is reconciled successfully, its retry count is reset.
+	if err := s.Exec(ctx, sqlf.Sprintf("UPDATE changesets SET reconciler_state = 'completed' WHERE id = %s", exhaustedResets.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RequeueFailedChangesets(ctx, opts); err != nil {
+		t.Fatal(err)
+	}
+	if count, _, err := basestore.ScanFirstInt(s.Query(ctx, sqlf.Sprintf("SELECT reconciler_retries FROM changesets WHERE id = %s", exhaustedResets.ID))); err != nil {
+		t.Fatal(err)
+	} else if count != 0 {
+		t.Fatalf("unexpected retry count: %d", count)
+	}
+}
+
+func testStoreOrphanedChangesets(t *testing.T, ctx context.Context, s *Store, clock ct.Clock) {
+	rs := database.ReposWith(s)
+	es := database.ExternalServicesWith(s)
+
+	repo := ct.TestRepo(t, es, extsvc.KindGitHub)
+	deletedRepo := ct.TestRepo(t, es, extsvc.KindGitHub)
+	if err := rs.Create(ctx, repo, deletedRepo); err != nil {
+		t.Fatal(err)
+	}
+
+	createChangeset := func(repoID api.RepoID, state btypes.ReconcilerState, assocs ...btypes.BatchChangeAssoc) *btypes.Changeset {
+		cs := &btypes.Changeset{
+			RepoID:              repoID,
+			ExternalServiceType: extsvc.TypeGitHub,
+			PublicationState:    btypes.ChangesetPublicationStatePublished,
+			ReconcilerState:     state,
+			BatchChanges:        assocs,
+		}
+		if err := s.CreateChangeset(ctx, cs); err != nil {
+			t.Fatal(err)
+		}
+		return cs
+	}
+
+	t.Run("DeleteOrphanedChangesets", func(t *testing.T) {
+		detached := createChangeset(repo.ID, btypes.ReconcilerStateCompleted)
+		queued := createChangeset(repo.ID, btypes.ReconcilerStateQueued)
+		attached := createChangeset(repo.ID, btypes.ReconcilerStateCompleted, btypes.BatchChangeAssoc{BatchChangeID: 1})
+
+		count, err := s.DeleteOrphanedChangesets(ctx, clock.Now().Add(-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Fatalf("wrong number of changesets deleted. want=%d have=%d", 0, count)
+		}
+
+		count, err = s.DeleteOrphanedChangesets(ctx, clock.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Fatalf("wrong number of changesets deleted. want=%d have=%d", 1, count)
+		}
+
+		if _, err := s.GetChangesetByID(ctx, detached.ID); err != ErrNoResults {
+			t.Fatalf("detached changeset not deleted. err=%v", err)
+		}
+		for _, cs := range []*btypes.Changeset{queued, attached} {
+			if _, err := s.GetChangesetByID(ctx, cs.ID); err != nil {
+				t.Fatalf("changeset %d deleted. err=%v", cs.ID, err)
+			}
+		}
+	})
+
+	t.Run("ArchiveOrphanedChangesets", func(t *testing.T) {
+		createChangeset(deletedRepo.ID, btypes.ReconcilerStateCompleted, btypes.BatchChangeAssoc{BatchChangeID: 1})
+		if err := rs.Delete(ctx, deletedRepo.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		externalDeleted := createChangeset(repo.ID, btypes.ReconcilerStateCompleted,
+			btypes.BatchChangeAssoc{BatchChangeID: 1, Archive: true},
+			btypes.BatchChangeAssoc{BatchChangeID: 2},
+		)
+		externalDeleted.ExternalDeletedAt = clock.Now()
+		if err := s.UpdateChangeset(ctx, externalDeleted); err != nil {
+			t.Fatal(err)
+		}
+
+		alreadyArchived := createChangeset(repo.ID, btypes.ReconcilerStateCompleted, btypes.BatchChangeAssoc{BatchChangeID: 1, IsArchived: true})
+		alreadyArchived.ExternalDeletedAt = clock.Now()
+		if err := s.UpdateChangeset(ctx, alreadyArchived); err != nil {
+			t.Fatal(err)
+		}
+
+		count, err := s.ArchiveOrphanedChangesets(ctx, clock.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Fatalf("wrong number of changesets archived. want=%d have=%d", 0, count)
+		}
+
+		count, err = s.ArchiveOrphanedChangesets(ctx, clock.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 2 {
+			t.Fatalf("wrong number of changesets archived. want=%d have=%d", 2, count)
+		}
+
+		have, err := s.GetChangesetByID(ctx, externalDeleted.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []btypes.BatchChangeAssoc{
+			{BatchChangeID: 1, IsArchived: true},
+			{BatchChangeID: 2, IsArchived: true},
+		}
+		sort.Slice(have.BatchChanges, func(i, j int) bool {
+			return have.BatchChanges[i].BatchChangeID < have.BatchChanges[j].BatchChangeID
+		})
+		if diff := cmp.Diff(want, have.BatchChanges); diff != "" {
+			t.Fatalf("unexpected batch changes (-want +got):\n%s", diff)
+		}
+	})
+}
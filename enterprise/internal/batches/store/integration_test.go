@@ -19,9 +19,12 @@ func TestIntegration(t *testing.T) {
 
 	t.Run("Store", func(t *testing.T) {
 		t.Run("BatchChanges", storeTest(db, nil, testStoreBatchChanges))
+		t.Run("CompletedBatchChanges", storeTest(db, nil, testStoreCompletedBatchChanges))
 		t.Run("Changesets", storeTest(db, nil, testStoreChangesets))
 		t.Run("ChangesetEvents", storeTest(db, nil, testStoreChangesetEvents))
 		t.Run("ChangesetScheduling", storeTest(db, nil, testStoreChangesetScheduling))
+		t.Run("RequeueFailedChangesets", storeTest(db, nil, testStoreRequeueFailedChangesets))
+		t.Run("OrphanedChangesets", storeTest(db, nil, testStoreOrphanedChangesets))
 		t.Run("ListChangesetSyncData", storeTest(db, nil, testStoreListChangesetSyncData))
 		t.Run("ListChangesetsTextSearch", storeTest(db, nil, testStoreListChangesetsTextSearch))
 		t.Run("BatchSpecs", storeTest(db, nil, testStoreBatchSpecs))
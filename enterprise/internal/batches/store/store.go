@@ -165,19 +165,23 @@ type operations struct {
 	getRepoDiffStat        *observation.Operation
 	listBatchChanges       *observation.Operation
 
+	listCompletedBatchChangesToNotify *observation.Operation
+	markBatchChangeCompletionNotified *observation.Operation
+
 	createBatchSpecExecution *observation.Operation
 	getBatchSpecExecution    *observation.Operation
 	cancelBatchSpecExecution *observation.Operation
 	listBatchSpecExecutions  *observation.Operation
 
-	createBatchSpec         *observation.Operation
-	updateBatchSpec         *observation.Operation
-	deleteBatchSpec         *observation.Operation
-	countBatchSpecs         *observation.Operation
-	getBatchSpec            *observation.Operation
-	getNewestBatchSpec      *observation.Operation
-	listBatchSpecs          *observation.Operation
-	deleteExpiredBatchSpecs *observation.Operation
+	createBatchSpec            *observation.Operation
+	updateBatchSpec            *observation.Operation
+	deleteBatchSpec            *observation.Operation
+	countBatchSpecs            *observation.Operation
+	getBatchSpec               *observation.Operation
+	getNewestBatchSpec         *observation.Operation
+	listBatchSpecs             *observation.Operation
+	deleteExpiredBatchSpecs    *observation.Operation
+	listExpiredBatchSpecOwners *observation.Operation
 
 	getBulkOperation        *observation.Operation
 	listBulkOperations      *observation.Operation
@@ -199,6 +203,7 @@ type operations struct {
 	getChangesetSpec                         *observation.Operation
 	listChangesetSpecs                       *observation.Operation
 	deleteExpiredChangesetSpecs              *observation.Operation
+	listExpiredChangesetSpecOwners           *observation.Operation
 	getRewirerMappings                       *observation.Operation
 	listChangesetSpecsWithConflictingHeadRef *observation.Operation
 
@@ -220,6 +225,9 @@ type operations struct {
 	getRepoChangesetsStats            *observation.Operation
 	enqueueNextScheduledChangeset     *observation.Operation
 	getChangesetPlaceInSchedulerQueue *observation.Operation
+	requeueFailedChangesets           *observation.Operation
+	deleteOrphanedChangesets          *observation.Operation
+	archiveOrphanedChangesets         *observation.Operation
 
 	listCodeHosts         *observation.Operation
 	getExternalServiceIDs *observation.Operation
@@ -285,19 +293,23 @@ func newOperations(observationContext *observation.Context) *operations {
 			getBatchChangeDiffStat: op("GetBatchChangeDiffStat"),
 			getRepoDiffStat:        op("GetRepoDiffStat"),
 
+			listCompletedBatchChangesToNotify: op("ListCompletedBatchChangesToNotify"),
+			markBatchChangeCompletionNotified: op("MarkBatchChangeCompletionNotified"),
+
 			createBatchSpecExecution: op("CreateBatchSpecExecution"),
 			getBatchSpecExecution:    op("GetBatchSpecExecution"),
 			cancelBatchSpecExecution: op("CancelBatchSpecExecution"),
 			listBatchSpecExecutions:  op("ListBatchSpecExecutions"),
 
-			createBatchSpec:         op("CreateBatchSpec"),
-			updateBatchSpec:         op("UpdateBatchSpec"),
-			deleteBatchSpec:         op("DeleteBatchSpec"),
-			countBatchSpecs:         op("CountBatchSpecs"),
-			getBatchSpec:            op("GetBatchSpec"),
-			getNewestBatchSpec:      op("GetNewestBatchSpec"),
-			listBatchSpecs:          op("ListBatchSpecs"),
-			deleteExpiredBatchSpecs: op("DeleteExpiredBatchSpecs"),
+			createBatchSpec:            op("CreateBatchSpec"),
+			updateBatchSpec:            op("UpdateBatchSpec"),
+			deleteBatchSpec:            op("DeleteBatchSpec"),
+			countBatchSpecs:            op("CountBatchSpecs"),
+			getBatchSpec:               op("GetBatchSpec"),
+			getNewestBatchSpec:         op("GetNewestBatchSpec"),
+			listBatchSpecs:             op("ListBatchSpecs"),
+			deleteExpiredBatchSpecs:    op("DeleteExpiredBatchSpecs"),
+			listExpiredBatchSpecOwners: op("ListExpiredBatchSpecOwners"),
 
 			getBulkOperation:        op("GetBulkOperation"),
 			listBulkOperations:      op("ListBulkOperations"),
@@ -319,6 +331,7 @@ func newOperations(observationContext *observation.Context) *operations {
 			getChangesetSpec:                         op("GetChangesetSpec"),
 			listChangesetSpecs:                       op("ListChangesetSpecs"),
 			deleteExpiredChangesetSpecs:              op("DeleteExpiredChangesetSpecs"),
+			listExpiredChangesetSpecOwners:           op("ListExpiredChangesetSpecOwners"),
 			getRewirerMappings:                       op("GetRewirerMappings"),
 			listChangesetSpecsWithConflictingHeadRef: op("ListChangesetSpecsWithConflictingHeadRef"),
 
@@ -340,6 +353,9 @@ func newOperations(observationContext *observation.Context) *operations {
 			getRepoChangesetsStats:            op("GetRepoChangesetsStats"),
 			enqueueNextScheduledChangeset:     op("EnqueueNextScheduledChangeset"),
 			getChangesetPlaceInSchedulerQueue: op("GetChangesetPlaceInSchedulerQueue"),
+			requeueFailedChangesets:           op("RequeueFailedChangesets"),
+			deleteOrphanedChangesets:          op("DeleteOrphanedChangesets"),
+			archiveOrphanedChangesets:         op("ArchiveOrphanedChangesets"),
 
 			listCodeHosts:         op("ListCodeHosts"),
 			getExternalServiceIDs: op("GetExternalServiceIDs"),
@@ -0,0 +1,66 @@
+package syncer
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/sourcegraph/sourcegraph/internal/ratelimit"
+)
+
+// syncBudgetShare is the share of a code host's configured rate limit that
+// scheduled changeset syncs may use. The remainder is left for other
+// consumers of the code host API, such as repo and permissions syncing, and
+// for high priority changeset syncs requested by users.
+const syncBudgetShare = 0.5
+
+// syncBudget limits the rate at which scheduled changeset syncs are performed
+// against a single code host, based on the rate limit configured for it.
+type syncBudget struct {
+	registry    *ratelimit.Registry
+	codeHostURL string
+	limiter     *rate.Limiter
+}
+
+func newSyncBudget(registry *ratelimit.Registry, codeHostURL string) *syncBudget {
+	b := &syncBudget{
+		registry:    registry,
+		codeHostURL: codeHostURL,
+		limiter:     rate.NewLimiter(rate.Inf, 1),
+	}
+	b.refresh(time.Now())
+	return b
+}
+
+// refresh updates the budget to reflect the currently configured rate limit of
+// the code host, which can change whenever its external services are edited.
+func (b *syncBudget) refresh(now time.Time) {
+	if b.registry == nil {
+		return
+	}
+
+	limit := b.registry.Get(b.codeHostURL).Limit()
+	if limit != rate.Inf {
+		limit *= syncBudgetShare
+	}
+	if limit != b.limiter.Limit() {
+		b.limiter.SetLimitAt(now, limit)
+	}
+}
+
+// take consumes budget for one scheduled sync. If there is no budget left, no
+// budget is consumed and the time until budget is available again is returned.
+func (b *syncBudget) take(now time.Time) time.Duration {
+	r := b.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// consume consumes budget for one sync that must happen regardless of the
+// remaining budget, so that it is accounted for in subsequent scheduled syncs.
+func (b *syncBudget) consume(now time.Time) {
+	b.limiter.ReserveN(now, 1)
+}
@@ -0,0 +1,68 @@
+package syncer
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/sourcegraph/sourcegraph/internal/ratelimit"
+)
+
+func TestSyncBudget(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("unlimited code host", func(t *testing.T) {
+		b := newSyncBudget(ratelimit.NewRegistry(), "https://github.com/")
+		for i := 0; i < 100; i++ {
+			if delay := b.take(now); delay != 0 {
+				t.Fatalf("unexpected delay: %s", delay)
+			}
+		}
+	})
+
+	t.Run("limited code host", func(t *testing.T) {
+		registry := ratelimit.NewRegistry()
+		registry.GetOrSet("https://github.com/", rate.NewLimiter(rate.Limit(2), 10))
+
+		b := newSyncBudget(registry, "https://github.com/")
+		b.refresh(now)
+
+		if have, want := b.limiter.Limit(), rate.Limit(2*syncBudgetShare); have != want {
+			t.Fatalf("wrong limit. want=%v have=%v", want, have)
+		}
+
+		if delay := b.take(now); delay != 0 {
+			t.Fatalf("unexpected delay for first sync: %s", delay)
+		}
+		if delay := b.take(now); delay != time.Second {
+			t.Fatalf("wrong delay for second sync. want=%s have=%s", time.Second, delay)
+		}
+		// A rejected take doesn't consume budget.
+		if delay := b.take(now.Add(time.Second)); delay != 0 {
+			t.Fatalf("unexpected delay after waiting: %s", delay)
+		}
+
+		// Forced syncs consume budget, delaying scheduled ones.
+		b.consume(now.Add(2 * time.Second))
+		b.consume(now.Add(2 * time.Second))
+		if delay := b.take(now.Add(2 * time.Second)); delay != 2*time.Second {
+			t.Fatalf("wrong delay after forced syncs. want=%s have=%s", 2*time.Second, delay)
+		}
+	})
+
+	t.Run("limit changes", func(t *testing.T) {
+		registry := ratelimit.NewRegistry()
+		limiter := registry.GetOrSet("https://gitlab.com/", rate.NewLimiter(rate.Inf, 1))
+
+		b := newSyncBudget(registry, "https://gitlab.com/")
+		limiter.SetLimit(rate.Limit(10))
+		b.refresh(now)
+
+		if have, want := b.limiter.Limit(), rate.Limit(10*syncBudgetShare); have != want {
+			t.Fatalf("wrong limit. want=%v have=%v", want, have)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package syncer
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/inconshreveable/log15"
+
+	"github.com/sourcegraph/sourcegraph/enterprise/internal/batches/store"
+	btypes "github.com/sourcegraph/sourcegraph/enterprise/internal/batches/types"
+)
+
+var (
+	// openChangesetsCheckInterval is the time in between checks for open
+	// changesets that were merged or closed outside of Sourcegraph.
+	openChangesetsCheckInterval = 15 * time.Minute
+
+	// openChangesetsMaxStaleness is the longest an open changeset can go
+	// without a sync before it is checked against the code host. Without the
+	// check, the backoff in NextSync lets open changesets that were merged
+	// long ago show up as open for up to maxSyncDelay.
+	openChangesetsMaxStaleness = 1 * time.Hour
+
+	// openChangesetsCheckLimit is the maximum number of changesets enqueued
+	// per check, so that a backlog doesn't exhaust the sync budget of a code
+	// host in one go. Remaining changesets are picked up by the next check.
+	openChangesetsCheckLimit = 100
+)
+
+// checkOpenChangesets enqueues a high priority sync for the changesets that
+// are open or draft on the code host, as of their last sync, and that haven't
+// been synced in openChangesetsMaxStaleness. The sync picks up changesets that
+// were merged or closed outside of Sourcegraph in the meantime.
+func (s *SyncRegistry) checkOpenChangesets(ctx context.Context) error {
+	syncData, err := s.syncStore.ListChangesetSyncData(ctx, store.ListChangesetSyncDataOpts{})
+	if err != nil {
+		return errors.Wrap(err, "listing changeset sync data")
+	}
+
+	ids := staleOpenChangesets(s.syncStore.Clock()(), syncData, openChangesetsCheckLimit)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	log15.Debug("Checking open changesets against code host", "count", len(ids))
+	return s.EnqueueChangesetSyncs(ctx, ids)
+}
+
+// staleOpenChangesets returns the IDs of at most limit changesets in syncData
+// that are open or draft and were last synced before now minus
+// openChangesetsMaxStaleness. The changesets that were synced the longest ago
+// are returned first.
+func staleOpenChangesets(now time.Time, syncData []*btypes.ChangesetSyncData, limit int) []int64 {
+	cutoff := now.Add(-openChangesetsMaxStaleness)
+
+	stale := make([]*btypes.ChangesetSyncData, 0)
+	for _, d := range syncData {
+		if d.ExternalState != btypes.ChangesetExternalStateOpen && d.ExternalState != btypes.ChangesetExternalStateDraft {
+			continue
+		}
+		if d.UpdatedAt.After(cutoff) {
+			continue
+		}
+		stale = append(stale, d)
+	}
+
+	sort.SliceStable(stale, func(i, j int) bool {
+		return stale[i].UpdatedAt.Before(stale[j].UpdatedAt)
+	})
+	if len(stale) > limit {
+		stale = stale[:limit]
+	}
+
+	ids := make([]int64, len(stale))
+	for i, d := range stale {
+		ids[i] = d.ChangesetID
+	}
+	return ids
+}
@@ -0,0 +1,46 @@
+package syncer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	btypes "github.com/sourcegraph/sourcegraph/enterprise/internal/batches/types"
+)
+
+func TestStaleOpenChangesets(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 01, 01, 01, 01, 01, 01, time.UTC)
+	stale := now.Add(-2 * openChangesetsMaxStaleness)
+	staler := now.Add(-3 * openChangesetsMaxStaleness)
+	fresh := now.Add(-openChangesetsMaxStaleness / 2)
+
+	syncData := []*btypes.ChangesetSyncData{
+		{ChangesetID: 1, UpdatedAt: stale, ExternalState: btypes.ChangesetExternalStateOpen},
+		{ChangesetID: 2, UpdatedAt: fresh, ExternalState: btypes.ChangesetExternalStateOpen},
+		{ChangesetID: 3, UpdatedAt: staler, ExternalState: btypes.ChangesetExternalStateDraft},
+		{ChangesetID: 4, UpdatedAt: staler, ExternalState: btypes.ChangesetExternalStateMerged},
+		{ChangesetID: 5, UpdatedAt: staler, ExternalState: btypes.ChangesetExternalStateClosed},
+		{ChangesetID: 6, UpdatedAt: stale, ExternalState: btypes.ChangesetExternalStateOpen},
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []int64
+	}{
+		{name: "all stale open changesets, oldest first", limit: 10, want: []int64{3, 1, 6}},
+		{name: "limited", limit: 2, want: []int64{3, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			have := staleOpenChangesets(now, syncData, tt.limit)
+			if diff := cmp.Diff(tt.want, have); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
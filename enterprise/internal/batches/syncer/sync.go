@@ -9,6 +9,12 @@ import (
 var (
 	minSyncDelay = 2 * time.Minute
 	maxSyncDelay = 8 * time.Hour
+
+	// activeSyncWindow is the time after a user last changed a batch change
+	// during which its changesets are considered actively looked at. Their
+	// sync delay is capped at activeMaxSyncDelay instead of maxSyncDelay.
+	activeSyncWindow   = 24 * time.Hour
+	activeMaxSyncDelay = 1 * time.Hour
 )
 
 // NextSync computes the time we want the next sync to happen.
@@ -42,8 +48,13 @@ func NextSync(clock func() time.Time, h *btypes.ChangesetSyncData) time.Time {
 		return lastChange.Add(minSyncDelay)
 	}
 
-	if diff > maxSyncDelay {
-		diff = maxSyncDelay
+	maxDelay := maxSyncDelay
+	if !h.BatchChangeUpdatedAt.IsZero() && clock().Sub(h.BatchChangeUpdatedAt) < activeSyncWindow {
+		maxDelay = activeMaxSyncDelay
+	}
+
+	if diff > maxDelay {
+		diff = maxDelay
 	}
 	if diff < minSyncDelay {
 		diff = minSyncDelay
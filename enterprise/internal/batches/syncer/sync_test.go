@@ -68,6 +68,24 @@ func TestNextSync(t *testing.T) {
 			},
 			want: clock().Add(10 * time.Minute).Add(minSyncDelay),
 		},
+		{
+			name: "Diff max is lower for recently changed batch change",
+			h: &btypes.ChangesetSyncData{
+				UpdatedAt:            clock(),
+				ExternalUpdatedAt:    clock().Add(-2 * maxSyncDelay),
+				BatchChangeUpdatedAt: clock().Add(-1 * time.Hour),
+			},
+			want: clock().Add(activeMaxSyncDelay),
+		},
+		{
+			name: "Diff max is not lowered for batch change changed long ago",
+			h: &btypes.ChangesetSyncData{
+				UpdatedAt:            clock(),
+				ExternalUpdatedAt:    clock().Add(-2 * maxSyncDelay),
+				BatchChangeUpdatedAt: clock().Add(-2 * activeSyncWindow),
+			},
+			want: clock().Add(maxSyncDelay),
+		},
 		{
 			name: "Never synced",
 			h:    &btypes.ChangesetSyncData{},
@@ -4,6 +4,7 @@ import (
 	"context"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/errors"
@@ -18,6 +19,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/goroutine"
 	"github.com/sourcegraph/sourcegraph/internal/httpcli"
 	"github.com/sourcegraph/sourcegraph/internal/observation"
+	"github.com/sourcegraph/sourcegraph/internal/ratelimit"
 	"github.com/sourcegraph/sourcegraph/internal/types"
 )
 
@@ -76,7 +78,18 @@ func (s *SyncRegistry) Start() {
 		}),
 	)
 
-	goroutine.MonitorBackgroundRoutines(s.ctx, externalServiceSyncer)
+	openChangesetsChecker := goroutine.NewPeriodicGoroutine(
+		s.ctx,
+		openChangesetsCheckInterval,
+		goroutine.NewHandlerWithErrorMessage("Batch Changes syncer open changesets check", func(ctx context.Context) error {
+			if conf.Get().DisableAutoCodeHostSyncs {
+				return nil
+			}
+			return s.checkOpenChangesets(ctx)
+		}),
+	)
+
+	goroutine.MonitorBackgroundRoutines(s.ctx, externalServiceSyncer, openChangesetsChecker)
 }
 
 func (s *SyncRegistry) Stop() {
@@ -122,6 +135,7 @@ func (s *SyncRegistry) addCodeHostSyncer(codeHost *btypes.CodeHost) {
 		syncStore:      s.syncStore,
 		httpFactory:    s.httpFactory,
 		codeHostURL:    syncerKey,
+		budget:         newSyncBudget(ratelimit.DefaultRegistry, syncerKey),
 		cancel:         cancel,
 		priorityNotify: make(chan []int64, 500),
 		metrics:        s.metrics,
@@ -134,6 +148,28 @@ func (s *SyncRegistry) addCodeHostSyncer(codeHost *btypes.CodeHost) {
 	})
 }
 
+// updateCodeHostWebhooks determines whether the given code host has webhooks
+// configured and passes that on to its syncer, which only polls the code host
+// infrequently if it does.
+func (s *SyncRegistry) updateCodeHostWebhooks(ctx context.Context, codeHost *btypes.CodeHost) {
+	s.mu.Lock()
+	syncer, ok := s.syncers[codeHost.ExternalServiceID]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	hasWebhooks, err := codeHostHasWebhooks(ctx, s.syncStore, codeHost)
+	if err != nil {
+		log15.Error("Checking code host for webhooks", "url", codeHost.ExternalServiceID, "err", err)
+		return
+	}
+
+	if syncer.setHasWebhooks(hasWebhooks) {
+		log15.Info("Changed changeset polling for code host", "url", codeHost.ExternalServiceID, "webhooks", hasWebhooks)
+	}
+}
+
 // handlePriorityItems fetches changesets in the priority queue from the database and passes them
 // to the appropriate syncer.
 func (s *SyncRegistry) handlePriorityItems() {
@@ -194,6 +230,7 @@ func (s *SyncRegistry) syncCodeHosts(ctx context.Context) error {
 	for _, host := range codeHosts {
 		codeHostsByExternalServiceID[host.ExternalServiceID] = host
 		s.addCodeHostSyncer(host)
+		s.updateCodeHostWebhooks(ctx, host)
 	}
 
 	s.mu.Lock()
@@ -229,6 +266,15 @@ type changesetSyncer struct {
 	queue          *changesetPriorityQueue
 	priorityNotify chan []int64
 
+	// budget limits the rate of scheduled syncs to a share of the code host's
+	// rate limit. High priority syncs are not limited, but consume budget.
+	budget *syncBudget
+
+	// hasWebhooks is non-zero if the code host sends webhook events for
+	// changesets, in which case they are only polled as a fallback. It is
+	// accessed atomically as it is updated by the SyncRegistry.
+	hasWebhooks int32
+
 	// Replaceable for testing
 	syncFunc func(ctx context.Context, id int64) error
 
@@ -243,6 +289,7 @@ type syncerMetrics struct {
 	computeScheduleDuration *prometheus.HistogramVec
 	scheduleSize            *prometheus.GaugeVec
 	behindSchedule          *prometheus.GaugeVec
+	budgetExhausted         *prometheus.CounterVec
 }
 
 func makeMetrics(observationContext *observation.Context) *syncerMetrics {
@@ -273,6 +320,10 @@ func makeMetrics(observationContext *observation.Context) *syncerMetrics {
 			Name: "src_repoupdater_changeset_syncer_behind_schedule",
 			Help: "The number of changesets behind schedule",
 		}, []string{"codehost"}),
+		budgetExhausted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "src_repoupdater_changeset_syncer_budget_exhausted",
+			Help: "Total number of scheduled syncs delayed due to the code host rate limit budget",
+		}, []string{"codehost"}),
 	}
 	observationContext.Registerer.MustRegister(metrics.syncs)
 	observationContext.Registerer.MustRegister(metrics.priorityQueued)
@@ -280,6 +331,7 @@ func makeMetrics(observationContext *observation.Context) *syncerMetrics {
 	observationContext.Registerer.MustRegister(metrics.computeScheduleDuration)
 	observationContext.Registerer.MustRegister(metrics.scheduleSize)
 	observationContext.Registerer.MustRegister(metrics.behindSchedule)
+	observationContext.Registerer.MustRegister(metrics.budgetExhausted)
 
 	return metrics
 }
@@ -295,6 +347,9 @@ func (s *changesetSyncer) Run(ctx context.Context) {
 	if s.syncFunc == nil {
 		s.syncFunc = s.SyncChangeset
 	}
+	if s.budget == nil {
+		s.budget = newSyncBudget(nil, s.codeHostURL)
+	}
 	s.queue = newChangesetPriorityQueue()
 	// How often to refresh the schedule
 	scheduleTicker := time.NewTicker(scheduleInterval)
@@ -312,6 +367,11 @@ func (s *changesetSyncer) Run(ctx context.Context) {
 	var next scheduledSync
 	var ok bool
 
+	// budgetAvailableAt is the earliest time at which the budget allows the
+	// next scheduled sync. Syncs that are due before then are delayed, and as
+	// the queue is ordered by due time, the most stale changesets go first.
+	var budgetAvailableAt time.Time
+
 	// NOTE: All mutations of the queue should be done is this loop as operations on the queue
 	// are not safe for concurrent use
 	for {
@@ -325,8 +385,12 @@ func (s *changesetSyncer) Run(ctx context.Context) {
 				// Fire ASAP
 				timer = time.NewTimer(0)
 			} else {
-				// Use scheduled time
-				timer = time.NewTimer(time.Until(next.nextSync))
+				// Use scheduled time, unless we're out of budget
+				at := next.nextSync
+				if budgetAvailableAt.After(at) {
+					at = budgetAvailableAt
+				}
+				timer = time.NewTimer(time.Until(at))
 			}
 			timerChan = timer.C
 		}
@@ -361,8 +425,17 @@ func (s *changesetSyncer) Run(ctx context.Context) {
 				}
 			}
 			s.metrics.behindSchedule.WithLabelValues(s.codeHostURL).Set(float64(behindSchedule))
+			s.budget.refresh(now)
 		case <-timerChan:
 			start := s.syncStore.Clock()()
+			if next.priority == priorityHigh {
+				s.budget.consume(start)
+			} else if delay := s.budget.take(start); delay > 0 {
+				budgetAvailableAt = start.Add(delay)
+				s.metrics.budgetExhausted.WithLabelValues(s.codeHostURL).Inc()
+				continue
+			}
+
 			err := s.syncFunc(ctx, next.changesetID)
 			labelValues := []string{s.codeHostURL, strconv.FormatBool(err == nil)}
 			s.metrics.syncDuration.WithLabelValues(labelValues...).Observe(s.syncStore.Clock()().Sub(start).Seconds())
@@ -400,15 +473,30 @@ func (s *changesetSyncer) Run(ctx context.Context) {
 	}
 }
 
+// setHasWebhooks sets whether the code host of the syncer sends webhook events
+// for changesets. It returns true if that changed.
+func (s *changesetSyncer) setHasWebhooks(hasWebhooks bool) bool {
+	var v int32
+	if hasWebhooks {
+		v = 1
+	}
+	return atomic.SwapInt32(&s.hasWebhooks, v) != v
+}
+
 func (s *changesetSyncer) computeSchedule(ctx context.Context) ([]scheduledSync, error) {
 	syncData, err := s.syncStore.ListChangesetSyncData(ctx, store.ListChangesetSyncDataOpts{ExternalServiceID: s.codeHostURL})
 	if err != nil {
 		return nil, errors.Wrap(err, "listing changeset sync data")
 	}
 
+	nextSyncFunc := NextSync
+	if atomic.LoadInt32(&s.hasWebhooks) != 0 {
+		nextSyncFunc = nextSyncWithWebhooks
+	}
+
 	ss := make([]scheduledSync, len(syncData))
 	for i := range syncData {
-		nextSync := NextSync(s.syncStore.Clock(), syncData[i])
+		nextSync := nextSyncFunc(s.syncStore.Clock(), syncData[i])
 
 		ss[i] = scheduledSync{
 			changesetID: syncData[i].ChangesetID,
@@ -0,0 +1,76 @@
+package syncer
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/enterprise/internal/batches/store"
+	btypes "github.com/sourcegraph/sourcegraph/enterprise/internal/batches/types"
+	"github.com/sourcegraph/sourcegraph/internal/database"
+	"github.com/sourcegraph/sourcegraph/schema"
+)
+
+// webhookFallbackSyncDelay is the time after which changesets on code hosts
+// that deliver webhooks are synced, in case a webhook event was missed.
+var webhookFallbackSyncDelay = 24 * time.Hour
+
+// nextSyncWithWebhooks computes the time we want the next sync to happen for a
+// changeset on a code host that has webhooks configured. Changes to the
+// changeset are applied when its webhook events arrive, so we only poll to
+// catch up on events that were missed.
+func nextSyncWithWebhooks(clock func() time.Time, h *btypes.ChangesetSyncData) time.Time {
+	if h.UpdatedAt.IsZero() {
+		// Edge case where we've never synced
+		return clock()
+	}
+	return h.UpdatedAt.Add(webhookFallbackSyncDelay)
+}
+
+// codeHostHasWebhooks returns true if any external service of the given code
+// host is configured to send webhook events for changesets.
+func codeHostHasWebhooks(ctx context.Context, syncStore SyncStore, codeHost *btypes.CodeHost) (bool, error) {
+	ids, err := syncStore.GetExternalServiceIDs(ctx, store.GetExternalServiceIDsOpts{
+		ExternalServiceType: codeHost.ExternalServiceType,
+		ExternalServiceID:   codeHost.ExternalServiceID,
+	})
+	if err != nil {
+		if err == store.ErrNoResults {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "getting external service IDs")
+	}
+	if len(ids) == 0 {
+		return false, nil
+	}
+
+	externalServices, err := syncStore.ExternalServices().List(ctx, database.ExternalServicesListOptions{IDs: ids})
+	if err != nil {
+		return false, errors.Wrap(err, "listing external services")
+	}
+
+	for _, es := range externalServices {
+		cfg, err := es.Configuration()
+		if err != nil {
+			return false, errors.Wrap(err, "parsing external service config")
+		}
+
+		switch c := cfg.(type) {
+		case *schema.GitHubConnection:
+			if len(c.Webhooks) > 0 {
+				return true, nil
+			}
+		case *schema.GitLabConnection:
+			if len(c.Webhooks) > 0 {
+				return true, nil
+			}
+		case *schema.BitbucketServerConnection:
+			if c.Webhooks != nil || (c.Plugin != nil && c.Plugin.Webhooks != nil) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
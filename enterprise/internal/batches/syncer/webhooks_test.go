@@ -0,0 +1,125 @@
+package syncer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/enterprise/internal/batches/store"
+	btypes "github.com/sourcegraph/sourcegraph/enterprise/internal/batches/types"
+	"github.com/sourcegraph/sourcegraph/internal/database"
+	"github.com/sourcegraph/sourcegraph/internal/extsvc"
+	"github.com/sourcegraph/sourcegraph/internal/types"
+)
+
+func TestNextSyncWithWebhooks(t *testing.T) {
+	t.Parallel()
+
+	clock := func() time.Time { return time.Date(2020, 01, 01, 01, 01, 01, 01, time.UTC) }
+	tests := []struct {
+		name string
+		h    *btypes.ChangesetSyncData
+		want time.Time
+	}{
+		{
+			name: "Recent external change",
+			h: &btypes.ChangesetSyncData{
+				UpdatedAt:         clock(),
+				ExternalUpdatedAt: clock(),
+			},
+			want: clock().Add(webhookFallbackSyncDelay),
+		},
+		{
+			name: "Never synced",
+			h:    &btypes.ChangesetSyncData{},
+			want: clock(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextSyncWithWebhooks(clock, tt.h)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestCodeHostHasWebhooks(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		codeHost *btypes.CodeHost
+		config   string
+		want     bool
+	}{
+		{
+			name:     "GitHub without webhooks",
+			codeHost: &btypes.CodeHost{ExternalServiceType: extsvc.TypeGitHub, ExternalServiceID: "https://github.com/"},
+			config:   `{"url": "https://github.com", "token": "abc", "repos": ["owner/name"]}`,
+			want:     false,
+		},
+		{
+			name:     "GitHub with webhooks",
+			codeHost: &btypes.CodeHost{ExternalServiceType: extsvc.TypeGitHub, ExternalServiceID: "https://github.com/"},
+			config:   `{"url": "https://github.com", "token": "abc", "repos": ["owner/name"], "webhooks": [{"org": "owner", "secret": "s3cr3t"}]}`,
+			want:     true,
+		},
+		{
+			name:     "GitLab with webhooks",
+			codeHost: &btypes.CodeHost{ExternalServiceType: extsvc.TypeGitLab, ExternalServiceID: "https://gitlab.com/"},
+			config:   `{"url": "https://gitlab.com", "token": "abc", "projectQuery": ["none"], "webhooks": [{"secret": "s3cr3t"}]}`,
+			want:     true,
+		},
+		{
+			name:     "Bitbucket Server with plugin webhooks",
+			codeHost: &btypes.CodeHost{ExternalServiceType: extsvc.TypeBitbucketServer, ExternalServiceID: "https://bbs.example.com/"},
+			config:   `{"url": "https://bbs.example.com", "token": "abc", "username": "admin", "repositoryQuery": ["none"], "plugin": {"webhooks": {"secret": "s3cr3t"}}}`,
+			want:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database.Mocks.ExternalServices.List = func(opt database.ExternalServicesListOptions) ([]*types.ExternalService, error) {
+				if diff := cmp.Diff([]int64{1}, opt.IDs); diff != "" {
+					t.Fatalf("unexpected external service IDs (-want +got):\n%s", diff)
+				}
+				return []*types.ExternalService{{
+					ID:     1,
+					Kind:   extsvc.TypeToKind(tc.codeHost.ExternalServiceType),
+					Config: tc.config,
+				}}, nil
+			}
+			t.Cleanup(func() { database.Mocks.ExternalServices.List = nil })
+
+			syncStore := newTestStore()
+			syncStore.GetExternalServiceIDsFunc.SetDefaultReturn([]int64{1}, nil)
+
+			have, err := codeHostHasWebhooks(ctx, syncStore, tc.codeHost)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != tc.want {
+				t.Fatalf("wrong result. want=%t have=%t", tc.want, have)
+			}
+		})
+	}
+
+	t.Run("no external services", func(t *testing.T) {
+		syncStore := newTestStore()
+		syncStore.GetExternalServiceIDsFunc.SetDefaultReturn(nil, store.ErrNoResults)
+
+		codeHost := &btypes.CodeHost{ExternalServiceType: extsvc.TypeGitHub, ExternalServiceID: "https://github.com/"}
+		have, err := codeHostHasWebhooks(ctx, syncStore, codeHost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have {
+			t.Fatal("unexpected webhooks")
+		}
+	})
+}
@@ -47,6 +47,27 @@ func (cs *BatchSpec) Clone() *BatchSpec {
 // yet. It's set to 1 week.
 const BatchSpecTTL = 7 * 24 * time.Hour
 
+// ExpiredSpecsOwner summarizes the expired specs of a single user.
+type ExpiredSpecsOwner struct {
+	// UserID is the ID of the user who created the specs. It's 0 if the user
+	// has been deleted.
+	UserID int32
+	Count  int
+	// OldestCreatedAt is the creation time of the oldest expired spec.
+	OldestCreatedAt time.Time
+}
+
+// ExpiredSpecsOwners is a list of ExpiredSpecsOwner.
+type ExpiredSpecsOwners []*ExpiredSpecsOwner
+
+// Count returns the total number of expired specs of all owners.
+func (os ExpiredSpecsOwners) Count() (count int) {
+	for _, o := range os {
+		count += o.Count
+	}
+	return count
+}
+
 // ExpiresAt returns the time when the BatchSpec will be deleted if not
 // applied.
 func (cs *BatchSpec) ExpiresAt() time.Time {
@@ -25,6 +25,12 @@ type ChangesetSyncData struct {
 	LatestEvent time.Time
 	// ExternalUpdatedAt is the time the external changeset last changed
 	ExternalUpdatedAt time.Time
+	// BatchChangeUpdatedAt is the time the most recently updated open batch
+	// change the changeset belongs to was last changed by a user
+	BatchChangeUpdatedAt time.Time
+	// ExternalState is the state of the changeset on the code host as of the
+	// last sync
+	ExternalState ChangesetExternalState
 	// RepoExternalServiceID is the external_service_id in the repo table, usually
 	// represented by the code host URL
 	RepoExternalServiceID string
@@ -12,6 +12,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/errcode"
 	"github.com/sourcegraph/sourcegraph/internal/observation"
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater/protocol"
 	"github.com/sourcegraph/sourcegraph/lib/codeintel/autoindex/config"
 	"github.com/sourcegraph/sourcegraph/lib/codeintel/autoindex/inference"
 	"github.com/sourcegraph/sourcegraph/lib/codeintel/precise"
@@ -122,7 +123,8 @@ func (s *IndexEnqueuer) QueueIndexesForPackage(ctx context.Context, pkg precise.
 		return err
 	}
 
-	resp, err := s.repoUpdater.EnqueueRepoUpdate(ctx, api.RepoName(repoName))
+	// The revision is resolved immediately below, so ask for the clone ahead of routine updates
+	resp, err := s.repoUpdater.EnqueueRepoUpdate(ctx, api.RepoName(repoName), protocol.RepoUpdatePriorityUrgent)
 	if err != nil {
 		if errcode.IsNotFound(err) {
 			return nil
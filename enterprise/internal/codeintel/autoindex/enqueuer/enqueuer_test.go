@@ -469,10 +469,13 @@ func TestQueueIndexesForPackage(t *testing.T) {
 	mockGitserverClient.ListFilesFunc.SetDefaultReturn([]string{"go.mod"}, nil)
 
 	mockRepoUpdater := NewMockRepoUpdaterClient()
-	mockRepoUpdater.EnqueueRepoUpdateFunc.SetDefaultHook(func(ctx context.Context, repoName api.RepoName) (*protocol.RepoUpdateResponse, error) {
+	mockRepoUpdater.EnqueueRepoUpdateFunc.SetDefaultHook(func(ctx context.Context, repoName api.RepoName, priority protocol.RepoUpdatePriority) (*protocol.RepoUpdateResponse, error) {
 		if repoName != "github.com/sourcegraph/sourcegraph" {
 			t.Errorf("unexpected repo %v supplied to EnqueueRepoUpdate", repoName)
 		}
+		if priority != protocol.RepoUpdatePriorityUrgent {
+			t.Errorf("unexpected priority %v supplied to EnqueueRepoUpdate", priority)
+		}
 		return &protocol.RepoUpdateResponse{ID: 42}, nil
 	})
 
@@ -40,7 +40,7 @@ func (db *DBStoreShim) Transact(ctx context.Context) (DBStore, error) {
 var _ DBStore = &DBStoreShim{}
 
 type RepoUpdaterClient interface {
-	EnqueueRepoUpdate(ctx context.Context, repo api.RepoName) (*protocol.RepoUpdateResponse, error)
+	EnqueueRepoUpdate(ctx context.Context, repo api.RepoName, priority protocol.RepoUpdatePriority) (*protocol.RepoUpdateResponse, error)
 }
 
 type GitserverClient interface {
@@ -0,0 +1,82 @@
+package repoupdater
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ErrCircuitOpen is returned in place of contacting repo-updater after a number of
+// consecutive requests have failed because it was unavailable.
+var ErrCircuitOpen = errors.New("repo-updater circuit breaker is open")
+
+// circuitBreaker stops requests from being sent to repo-updater for a cooldown period
+// once threshold consecutive requests have failed with a transient error. After the
+// cooldown, a single probe request is let through: its success closes the circuit and
+// its failure re-opens it for another cooldown period.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns true if a request may be sent to repo-updater.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return false
+	}
+
+	b.probing = true
+	return true
+}
+
+// record updates the state of the breaker with the outcome of an allowed request.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		// The request was canceled; this says nothing about repo-updater
+
+	case err == nil || !isRetryable(err):
+		b.failures = 0
+
+	default:
+		if b.failures++; b.failures >= b.threshold {
+			b.openUntil = b.now().Add(b.cooldown)
+		}
+	}
+}
+
+// abandon releases the probe of an allowed request which was abandoned by its caller,
+// without recording an outcome.
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
@@ -0,0 +1,137 @@
+package repoupdater
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/internal/observation"
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater"
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater/protocol"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(1587396557, 0).UTC()
+	breaker := newCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	unavailable := errConnectionRefused
+
+	breaker.record(unavailable)
+	breaker.record(context.Canceled)
+	if !breaker.allow() {
+		t.Fatalf("expected breaker to be closed below threshold")
+	}
+
+	breaker.record(unavailable)
+	if breaker.allow() {
+		t.Fatalf("expected breaker to be open at threshold")
+	}
+
+	now = now.Add(time.Minute)
+	if !breaker.allow() {
+		t.Fatalf("expected a probe to be allowed after cooldown")
+	}
+	if breaker.allow() {
+		t.Fatalf("expected only a single concurrent probe")
+	}
+
+	breaker.record(unavailable)
+	if breaker.allow() {
+		t.Fatalf("expected failed probe to re-open breaker")
+	}
+
+	now = now.Add(time.Minute)
+	if !breaker.allow() {
+		t.Fatalf("expected a probe to be allowed after cooldown")
+	}
+	breaker.record(&repoupdater.ErrNotFound{Repo: "github.com/foo/bar", IsNotFound: true})
+	if !breaker.allow() {
+		t.Fatalf("expected successful probe to close breaker")
+	}
+}
+
+func TestCircuitBreakerUpstreamTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hang like an overloaded repo-updater.
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	t.Run("transport timeouts are failures", func(t *testing.T) {
+		client := NewWithClient(&repoupdater.Client{URL: server.URL, HTTPClient: &http.Client{Timeout: 20 * time.Millisecond}}, &observation.TestContext)
+		client.breaker = newCircuitBreaker(2, time.Minute)
+
+		for i := 0; i < 2; i++ {
+			if _, err := client.UpdateQueueStatus(context.Background(), 42); err == nil || errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("unexpected error. want=timeout have=%v", err)
+			}
+		}
+		if _, err := client.UpdateQueueStatus(context.Background(), 42); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("unexpected error. want=%v have=%v", ErrCircuitOpen, err)
+		}
+	})
+
+	t.Run("abandoned requests are not failures", func(t *testing.T) {
+		client := NewWithClient(&repoupdater.Client{URL: server.URL, HTTPClient: http.DefaultClient}, &observation.TestContext)
+		client.breaker = newCircuitBreaker(1, time.Minute)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if _, err := client.UpdateQueueStatus(ctx, 42); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("unexpected error. want=%v have=%v", context.DeadlineExceeded, err)
+		}
+		if !client.breaker.allow() {
+			t.Fatalf("expected breaker to stay closed")
+		}
+	})
+}
+
+func TestRepoLookupStaleFallback(t *testing.T) {
+	available := true
+	repoupdater.MockRepoLookup = func(args protocol.RepoLookupArgs) (*protocol.RepoLookupResult, error) {
+		if !available {
+			return nil, errConnectionRefused
+		}
+		return &protocol.RepoLookupResult{Repo: &protocol.RepoInfo{Name: args.Repo}}, nil
+	}
+	defer func() { repoupdater.MockRepoLookup = nil }()
+
+	now := time.Unix(1587396557, 0).UTC()
+	client := New(&observation.TestContext)
+	client.lookupCache.now = func() time.Time { return now }
+
+	args := protocol.RepoLookupArgs{Repo: "github.com/foo/bar"}
+	if result, err := client.RepoLookup(context.Background(), args); err != nil || result.Stale {
+		t.Fatalf("unexpected lookup result. have=(%v, %v)", result, err)
+	}
+
+	available = false
+	now = now.Add(lookupCacheTTL)
+
+	for i := 0; i < breakerThreshold+1; i++ {
+		result, err := client.RepoLookup(context.Background(), args)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !result.Stale {
+			t.Fatalf("expected stale result")
+		}
+	}
+
+	if client.breaker.allow() {
+		t.Errorf("expected breaker to be open")
+	}
+	if _, err := client.RepoLookup(context.Background(), protocol.RepoLookupArgs{Repo: "github.com/foo/baz"}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("unexpected error. want=%q have=%v", ErrCircuitOpen, err)
+	}
+}
@@ -0,0 +1,90 @@
+package repoupdater
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater/protocol"
+)
+
+// lookupCache is an in-process cache of repo-updater lookup results keyed by
+// repository name. Entries are fresh for a fixed TTL. Successful results are
+// retained for an additional stale TTL so they can be served when repo-updater
+// is unavailable.
+type lookupCache struct {
+	ttl      time.Duration
+	staleTTL time.Duration
+	now      func() time.Time
+	mu       sync.Mutex
+	entries  map[api.RepoName]lookupCacheEntry
+}
+
+type lookupCacheEntry struct {
+	result  *protocol.RepoLookupResult
+	err     error
+	expires time.Time
+}
+
+func newLookupCache(ttl, staleTTL time.Duration) *lookupCache {
+	return &lookupCache{
+		ttl:      ttl,
+		staleTTL: staleTTL,
+		now:      time.Now,
+		entries:  map[api.RepoName]lookupCacheEntry{},
+	}
+}
+
+// get returns the cached result and error for the given repository. The final
+// return value is false if there is no fresh entry for the repository.
+func (c *lookupCache) get(name api.RepoName) (*protocol.RepoLookupResult, error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[name]
+	if !ok || !c.now().Before(entry.expires) {
+		return nil, nil, false
+	}
+
+	return entry.result, entry.err, true
+}
+
+// getStale returns a copy of the last successful result for the given repository,
+// marked as stale, if it has not yet been evicted. Negative entries are not returned.
+func (c *lookupCache) getStale(name api.RepoName) (*protocol.RepoLookupResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[name]
+	if !ok || entry.err != nil || entry.result == nil || entry.result.Repo == nil {
+		return nil, false
+	}
+	if !c.now().Before(entry.expires.Add(c.staleTTL)) {
+		return nil, false
+	}
+
+	result := *entry.result
+	result.Stale = true
+	return &result, true
+}
+
+// set caches the given result and error for the given repository. Entries past
+// their stale TTL are evicted opportunistically so the cache does not grow without
+// bound for long-running processes.
+func (c *lookupCache) set(name api.RepoName, result *protocol.RepoLookupResult, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires.Add(c.staleTTL)) {
+			delete(c.entries, key)
+		}
+	}
+
+	c.entries[name] = lookupCacheEntry{
+		result:  result,
+		err:     err,
+		expires: now.Add(c.ttl),
+	}
+}
@@ -0,0 +1,60 @@
+package repoupdater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater"
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater/protocol"
+)
+
+func TestLookupCache(t *testing.T) {
+	now := time.Unix(1587396557, 0).UTC()
+	cache := newLookupCache(time.Minute, time.Hour)
+	cache.now = func() time.Time { return now }
+
+	found := &protocol.RepoLookupResult{Repo: &protocol.RepoInfo{Name: "github.com/foo/bar"}}
+	notFound := &repoupdater.ErrNotFound{Repo: "github.com/foo/baz", IsNotFound: true}
+
+	cache.set("github.com/foo/bar", found, nil)
+	cache.set("github.com/foo/baz", nil, notFound)
+
+	if result, err, ok := cache.get("github.com/foo/bar"); !ok || err != nil || result != found {
+		t.Errorf("unexpected cached lookup. want=(%v, nil, true) have=(%v, %v, %v)", found, result, err, ok)
+	}
+	if result, err, ok := cache.get("github.com/foo/baz"); !ok || err != notFound || result != nil {
+		t.Errorf("unexpected cached lookup. want=(nil, %v, true) have=(%v, %v, %v)", notFound, result, err, ok)
+	}
+	if _, _, ok := cache.get("github.com/foo/bonk"); ok {
+		t.Errorf("unexpected cache hit for unknown repository")
+	}
+
+	now = now.Add(time.Minute)
+
+	for _, name := range []api.RepoName{"github.com/foo/bar", "github.com/foo/baz"} {
+		if _, _, ok := cache.get(name); ok {
+			t.Errorf("unexpected cache hit for expired entry %q", name)
+		}
+	}
+
+	if result, ok := cache.getStale("github.com/foo/bar"); !ok || !result.Stale || result.Repo.Name != "github.com/foo/bar" {
+		t.Errorf("expected stale result. have=(%v, %v)", result, ok)
+	}
+	if found.Stale {
+		t.Errorf("expected cached result to be copied before being marked stale")
+	}
+	if _, ok := cache.getStale("github.com/foo/baz"); ok {
+		t.Errorf("unexpected stale result for negative entry")
+	}
+
+	now = now.Add(time.Hour)
+	cache.set("github.com/foo/bonk", found, nil)
+
+	if _, ok := cache.getStale("github.com/foo/bar"); ok {
+		t.Errorf("unexpected stale result past stale TTL")
+	}
+	if len(cache.entries) != 1 {
+		t.Errorf("expected entries past stale TTL to be evicted. have=%d", len(cache.entries))
+	}
+}
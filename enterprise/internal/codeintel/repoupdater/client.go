@@ -0,0 +1,297 @@
+package repoupdater
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/opentracing/opentracing-go/log"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/errcode"
+	"github.com/sourcegraph/sourcegraph/internal/goroutine"
+	"github.com/sourcegraph/sourcegraph/internal/httpcli"
+	"github.com/sourcegraph/sourcegraph/internal/observation"
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater"
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater/protocol"
+)
+
+const (
+	// lookupCacheTTL is the duration for which the result of a repository lookup
+	// (including a negative result for an unknown repository) is reused.
+	lookupCacheTTL = 30 * time.Second
+
+	// lookupCacheStaleTTL is the additional duration for which a successful lookup
+	// result is retained to be served, marked stale, while repo-updater is unavailable.
+	lookupCacheStaleTTL = time.Hour
+
+	// lookupTimeout is the time a repository lookup has to finish. It is shared by
+	// concurrent callers, so it isn't bound to the context of any of them.
+	lookupTimeout = 30 * time.Second
+
+	// breakerThreshold is the number of consecutive transient failures after which
+	// requests to repo-updater are suspended for breakerCooldown.
+	breakerThreshold = 10
+	breakerCooldown  = 30 * time.Second
+)
+
+type Client struct {
+	client      *repoupdater.Client
+	lookupCache *lookupCache
+	lookupGroup singleflight.Group
+	breaker     *circuitBreaker
+	retryPolicy retryPolicy
+	operations  *operations
+}
+
+// New creates a client backed by repoupdater.DefaultClient.
+func New(observationContext *observation.Context) *Client {
+	return NewWithClient(repoupdater.DefaultClient, observationContext)
+}
+
+// NewWithClient creates a client that sends requests through the given repo-updater
+// client, which determines the target URL and HTTP doer.
+func NewWithClient(client *repoupdater.Client, observationContext *observation.Context) *Client {
+	var doer httpcli.Doer = http.DefaultClient
+	if client.HTTPClient != nil {
+		doer = client.HTTPClient
+	}
+
+	return &Client{
+		client:      &repoupdater.Client{URL: client.URL, HTTPClient: statusDoer{doer: doer}},
+		lookupCache: newLookupCache(lookupCacheTTL, lookupCacheStaleTTL),
+		breaker:     newCircuitBreaker(breakerThreshold, breakerCooldown),
+		retryPolicy: defaultRetryPolicy,
+		operations:  newOperations(observationContext),
+	}
+}
+
+// RepoLookup retrieves information about the repository from repo-updater. Successful
+// results as well as not-found errors are cached for a short time so that callers
+// resolving the same set of dependencies repeatedly do not hit repo-updater each time.
+// Concurrent lookups of the same repository share a single request to repo-updater,
+// which keeps going if the caller which started it is canceled.
+//
+// If repo-updater is unavailable, the last successful result for the repository is
+// returned with its Stale field set, if one is still cached.
+func (c *Client) RepoLookup(ctx context.Context, args protocol.RepoLookupArgs) (result *protocol.RepoLookupResult, err error) {
+	var shared bool
+	ctx, endObservation := c.operations.repoLookup.With(ctx, &err, observation.Args{LogFields: []log.Field{
+		log.String("repo", string(args.Repo)),
+	}})
+	defer func() {
+		fields := []log.Field{
+			log.Bool("shared", shared),
+			log.Bool("stale", result != nil && result.Stale),
+		}
+		if result != nil && result.Repo != nil {
+			fields = append(fields, log.String("resolvedRepo", string(result.Repo.Name)))
+		}
+		endObservation(1, finishArgs(ctx, err, fields...))
+	}()
+
+	if result, err, ok := c.lookupCache.get(args.Repo); ok {
+		return result, err
+	}
+
+	ch := c.lookupGroup.DoChan(string(args.Repo), func() (interface{}, error) {
+		// The lookup is shared by concurrent callers, so it must not fail because the
+		// caller which started it gave up on it.
+		ctx, cancel := context.WithTimeout(goroutine.Detach(ctx), lookupTimeout)
+		defer cancel()
+
+		// Nobody abandons the shared lookup, so hitting lookupTimeout is a failure.
+		var result *protocol.RepoLookupResult
+		err := c.guard(context.Background(), func() (err error) {
+			result, err = c.client.RepoLookup(ctx, args)
+			return err
+		})
+		if err == nil || errcode.IsNotFound(err) {
+			c.lookupCache.set(args.Repo, result, err)
+		} else if errors.Is(err, ErrCircuitOpen) || isRetryable(err) {
+			if stale, ok := c.lookupCache.getStale(args.Repo); ok {
+				return stale, nil
+			}
+		}
+
+		return result, err
+	})
+
+	select {
+	case res := <-ch:
+		shared = res.Shared
+		result, _ = res.Val.(*protocol.RepoLookupResult)
+		return result, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// guard invokes f unless the circuit breaker is open, in which case ErrCircuitOpen
+// is returned. The outcome of f is recorded by the circuit breaker, unless ctx, the
+// context of the caller, is done: the request was then abandoned, which says nothing
+// about repo-updater. Timeouts of the request itself are recorded as failures.
+func (c *Client) guard(ctx context.Context, f func() error) error {
+	if !c.breaker.allow() {
+		return ErrCircuitOpen
+	}
+
+	err := f()
+	if ctx.Err() != nil {
+		c.breaker.abandon()
+	} else {
+		c.breaker.record(err)
+	}
+	return err
+}
+
+// EnqueueRepoUpdate requests that the given repository be updated in the near future, ahead of
+// queued updates with a lower priority. Requests that fail due to a transient error are retried
+// with exponential backoff.
+func (c *Client) EnqueueRepoUpdate(ctx context.Context, repo api.RepoName, priority protocol.RepoUpdatePriority) (resp *protocol.RepoUpdateResponse, err error) {
+	var attempts int
+	ctx, endObservation := c.operations.enqueueRepoUpdate.With(ctx, &err, observation.Args{LogFields: []log.Field{
+		log.String("repo", string(repo)),
+		log.Int("priority", int(priority)),
+	}})
+	defer func() {
+		fields := []log.Field{log.Int("attempts", attempts)}
+		if resp != nil {
+			fields = append(fields, log.Int("repoID", int(resp.ID)))
+		}
+		endObservation(1, finishArgs(ctx, err, fields...))
+	}()
+
+	attempts, err = c.retryPolicy.do(ctx, func() error {
+		return c.guard(ctx, func() (err error) {
+			resp, err = c.client.EnqueueRepoUpdateWithPriority(ctx, repo, priority)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// EnqueueRepoUpdates requests that each of the given repositories be updated in the near future
+// with a single request to repo-updater. Repositories unknown to repo-updater are omitted from the
+// response. Requests that fail due to a transient error are retried with exponential backoff.
+func (c *Client) EnqueueRepoUpdates(ctx context.Context, repos []api.RepoName, priority protocol.RepoUpdatePriority) (resp *protocol.RepoUpdatesResponse, err error) {
+	var attempts int
+	ctx, endObservation := c.operations.enqueueRepoUpdates.With(ctx, &err, observation.Args{LogFields: []log.Field{
+		log.Int("numRepos", len(repos)),
+		log.Int("priority", int(priority)),
+	}})
+	defer func() {
+		fields := []log.Field{log.Int("attempts", attempts)}
+		if resp != nil {
+			fields = append(fields, log.Int("numEnqueued", len(resp.Repos)))
+		}
+		endObservation(1, finishArgs(ctx, err, fields...))
+	}()
+
+	attempts, err = c.retryPolicy.do(ctx, func() error {
+		return c.guard(ctx, func() (err error) {
+			resp, err = c.client.EnqueueRepoUpdates(ctx, repos, priority)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// UpdateQueueStatus describes the state of a repository in repo-updater's update queue.
+type UpdateQueueStatus struct {
+	// Queued is true if an update of the repository is waiting to be started.
+	Queued bool
+	// Updating is true if an update of the repository is in progress.
+	Updating bool
+	// Position is the number of queued updates that will be started before this one.
+	Position int
+	// Total is the number of updates in the queue, including those in progress.
+	Total int
+}
+
+// UpdateQueueStatus returns the state of the given repository in repo-updater's update queue. A
+// zero value is returned if no update of the repository is queued or in progress.
+func (c *Client) UpdateQueueStatus(ctx context.Context, repositoryID int) (_ UpdateQueueStatus, err error) {
+	ctx, endObservation := c.operations.updateQueueStatus.With(ctx, &err, observation.Args{LogFields: []log.Field{
+		log.Int("repositoryID", repositoryID),
+	}})
+	defer func() { endObservation(1, finishArgs(ctx, err)) }()
+
+	var result *protocol.RepoUpdateSchedulerInfoResult
+	err = c.guard(ctx, func() (err error) {
+		result, err = c.client.RepoUpdateSchedulerInfo(ctx, protocol.RepoUpdateSchedulerInfoArgs{
+			ID: api.RepoID(repositoryID),
+		})
+		return err
+	})
+	if err != nil || result == nil || result.Queue == nil {
+		return UpdateQueueStatus{}, err
+	}
+
+	return UpdateQueueStatus{
+		Queued:   !result.Queue.Updating,
+		Updating: result.Queue.Updating,
+		Position: result.Queue.Position,
+		Total:    result.Queue.Total,
+	}, nil
+}
+
+// RepoUpdateProgress returns the progress of the current or last update of the given repository,
+// including its initial clone, e.g. to report progress while waiting for a repository to be cloned.
+func (c *Client) RepoUpdateProgress(ctx context.Context, repo api.RepoName) (progress *protocol.RepoUpdateProgress, err error) {
+	ctx, endObservation := c.operations.repoUpdateProgress.With(ctx, &err, observation.Args{LogFields: []log.Field{
+		log.String("repo", string(repo)),
+	}})
+	defer func() {
+		var fields []log.Field
+		if progress != nil {
+			fields = append(fields, log.String("state", string(progress.State)))
+		}
+		endObservation(1, finishArgs(ctx, err, fields...))
+	}()
+
+	err = c.guard(ctx, func() (err error) {
+		progress, err = c.client.RepoUpdateProgress(ctx, repo)
+		return err
+	})
+	return progress, err
+}
+
+// SchedulePermsSync requests that repo-updater schedule a permissions sync for each of the given
+// repositories and users. Requests that fail due to a transient error are retried with exponential
+// backoff.
+func (c *Client) SchedulePermsSync(ctx context.Context, repositoryIDs []int, userIDs []int32) (err error) {
+	var attempts int
+	ctx, endObservation := c.operations.schedulePermsSync.With(ctx, &err, observation.Args{LogFields: []log.Field{
+		log.Int("numRepositoryIDs", len(repositoryIDs)),
+		log.Int("numUserIDs", len(userIDs)),
+	}})
+	defer func() {
+		endObservation(1, finishArgs(ctx, err, log.Int("attempts", attempts)))
+	}()
+
+	repoIDs := make([]api.RepoID, 0, len(repositoryIDs))
+	for _, id := range repositoryIDs {
+		repoIDs = append(repoIDs, api.RepoID(id))
+	}
+
+	attempts, err = c.retryPolicy.do(ctx, func() error {
+		return c.guard(ctx, func() error {
+			return c.client.SchedulePermsSync(ctx, protocol.PermsSyncRequest{
+				RepoIDs: repoIDs,
+				UserIDs: userIDs,
+			})
+		})
+	})
+	return err
+}
@@ -0,0 +1,134 @@
+package repoupdater
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/observation"
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater"
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater/protocol"
+)
+
+func TestRepoLookupConcurrent(t *testing.T) {
+	var started sync.WaitGroup
+	var calls int32
+
+	repoupdater.MockRepoLookup = func(args protocol.RepoLookupArgs) (*protocol.RepoLookupResult, error) {
+		atomic.AddInt32(&calls, 1)
+		started.Wait()
+		return &protocol.RepoLookupResult{Repo: &protocol.RepoInfo{Name: args.Repo}}, nil
+	}
+	defer func() { repoupdater.MockRepoLookup = nil }()
+
+	client := New(&observation.TestContext)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		started.Add(1)
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			started.Done()
+			result, err := client.RepoLookup(context.Background(), protocol.RepoLookupArgs{Repo: "github.com/foo/bar"})
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			} else if result == nil || result.Repo == nil || result.Repo.Name != "github.com/foo/bar" {
+				t.Errorf("unexpected result: %v", result)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("unexpected number of upstream lookups. want=%d have=%d", 1, calls)
+	}
+}
+
+func TestRepoLookupSharedSurvivesCanceledCaller(t *testing.T) {
+	var calls int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		started <- struct{}{}
+		<-release
+
+		_ = json.NewEncoder(w).Encode(protocol.RepoLookupResult{Repo: &protocol.RepoInfo{Name: "github.com/foo/bar"}})
+	}))
+	defer server.Close()
+
+	client := NewWithClient(&repoupdater.Client{URL: server.URL, HTTPClient: http.DefaultClient}, &observation.TestContext)
+	args := protocol.RepoLookupArgs{Repo: "github.com/foo/bar"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := client.RepoLookup(ctx, args)
+		firstErr <- err
+	}()
+	<-started
+
+	type lookup struct {
+		result *protocol.RepoLookupResult
+		err    error
+	}
+	second := make(chan lookup, 1)
+	go func() {
+		result, err := client.RepoLookup(context.Background(), args)
+		second <- lookup{result, err}
+	}()
+
+	// Give the second caller time to join the lookup of the first.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-firstErr; err != context.Canceled {
+		t.Errorf("unexpected error for the canceled caller. want=%v have=%v", context.Canceled, err)
+	}
+
+	close(release)
+	if l := <-second; l.err != nil || l.result == nil || l.result.Repo == nil {
+		t.Errorf("unexpected lookup result. have=(%v, %v)", l.result, l.err)
+	}
+	if calls != 1 {
+		t.Errorf("unexpected number of upstream lookups. want=%d have=%d", 1, calls)
+	}
+}
+
+func TestEnqueueRepoUpdateRetriesTransientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/enqueue-repo-update" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+
+		if atomic.AddInt32(&calls, 1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(protocol.RepoUpdateResponse{ID: 42, Name: "github.com/foo/bar"})
+	}))
+	defer server.Close()
+
+	client := NewWithClient(&repoupdater.Client{URL: server.URL, HTTPClient: http.DefaultClient}, &observation.TestContext)
+	client.retryPolicy = retryPolicy{maxAttempts: 3, baseDelay: time.Millisecond, maxDelay: time.Millisecond}
+
+	resp, err := client.EnqueueRepoUpdate(context.Background(), "github.com/foo/bar", protocol.RepoUpdatePriorityUrgent)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resp.ID != 42 {
+		t.Errorf("unexpected repository id. want=%d have=%d", 42, resp.ID)
+	}
+	if calls != 2 {
+		t.Errorf("unexpected number of requests. want=%d have=%d", 2, calls)
+	}
+}
@@ -0,0 +1,102 @@
+package repoupdater
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/cockroachdb/errors"
+	"github.com/opentracing/opentracing-go/log"
+
+	"github.com/sourcegraph/sourcegraph/internal/errcode"
+	"github.com/sourcegraph/sourcegraph/internal/metrics"
+	"github.com/sourcegraph/sourcegraph/internal/observation"
+)
+
+type operations struct {
+	enqueueRepoUpdate  *observation.Operation
+	enqueueRepoUpdates *observation.Operation
+	repoLookup         *observation.Operation
+	repoUpdateProgress *observation.Operation
+	schedulePermsSync  *observation.Operation
+	updateQueueStatus  *observation.Operation
+}
+
+func newOperations(observationContext *observation.Context) *operations {
+	metrics := metrics.NewOperationMetrics(
+		observationContext.Registerer,
+		"codeintel_repoupdater",
+		metrics.WithLabels("op", "outcome"),
+		metrics.WithCountHelp("Total number of method invocations."),
+	)
+
+	op := func(name string) *observation.Operation {
+		return observationContext.Operation(observation.Op{
+			Name:              fmt.Sprintf("codeintel.repoupdater.%s", name),
+			MetricLabelValues: []string{name},
+			Metrics:           metrics,
+			ErrorFilter: func(err error) observation.ErrorFilterBehaviour {
+				if errcode.IsNotFound(err) {
+					return observation.EmitForNone
+				}
+				return observation.EmitForAll
+			},
+		})
+	}
+
+	return &operations{
+		enqueueRepoUpdate:  op("EnqueueRepoUpdate"),
+		enqueueRepoUpdates: op("EnqueueRepoUpdates"),
+		repoLookup:         op("RepoLookup"),
+		repoUpdateProgress: op("RepoUpdateProgress"),
+		schedulePermsSync:  op("SchedulePermsSync"),
+		updateQueueStatus:  op("UpdateQueueStatus"),
+	}
+}
+
+const (
+	outcomeSuccess   = "success"
+	outcomeNotFound  = "not_found"
+	outcomeCanceled  = "canceled"
+	outcomeTemporary = "temporary"
+	outcomePermanent = "permanent"
+)
+
+// outcome classifies the result of an operation so that dashboards can distinguish
+// repositories that no longer exist and requests abandoned by their caller from
+// repo-updater being unavailable and from errors that will not go away when retried.
+// The context of the caller decides whether the request was abandoned, since timeouts
+// of the request itself are a sign of repo-updater being unavailable.
+func outcome(ctx context.Context, err error) string {
+	var statusErr *statusError
+	var netErr net.Error
+
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case errcode.IsNotFound(err):
+		return outcomeNotFound
+	case ctx.Err() != nil || errors.Is(err, context.Canceled):
+		return outcomeCanceled
+	case errcode.IsTemporary(err) || errors.Is(err, ErrCircuitOpen):
+		return outcomeTemporary
+	case errors.As(err, &statusErr) && statusErr.status >= 500:
+		return outcomeTemporary
+	case errors.As(err, &netErr):
+		return outcomeTemporary
+	default:
+		return outcomePermanent
+	}
+}
+
+// finishArgs returns the arguments to supply when finishing an observation of an
+// operation with the given context that resulted in the given error. Every operation
+// is labeled by outcome.
+func finishArgs(ctx context.Context, err error, fields ...log.Field) observation.Args {
+	class := outcome(ctx, err)
+
+	return observation.Args{
+		MetricLabelValues: []string{class},
+		LogFields:         append(fields, log.String("outcome", class)),
+	}
+}
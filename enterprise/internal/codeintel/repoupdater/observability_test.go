@@ -0,0 +1,49 @@
+package repoupdater
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater"
+)
+
+func TestOutcome(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want string
+	}{
+		{nil, outcomeSuccess},
+		{&repoupdater.ErrNotFound{Repo: "github.com/foo/bar", IsNotFound: true}, outcomeNotFound},
+		{errors.Wrap(&repoupdater.ErrNotFound{Repo: "github.com/foo/bar", IsNotFound: true}, "lookup"), outcomeNotFound},
+		{errConnectionRefused, outcomeTemporary},
+		{ErrCircuitOpen, outcomeTemporary},
+		{&repoupdater.ErrTemporary{Repo: "github.com/foo/bar", IsTemporary: true}, outcomeTemporary},
+		{&statusError{status: http.StatusServiceUnavailable}, outcomeTemporary},
+		{&statusError{status: http.StatusInternalServerError}, outcomeTemporary},
+		{&url.Error{Op: "Post", URL: "http://repo-updater", Err: context.DeadlineExceeded}, outcomeTemporary},
+		{&repoupdater.ErrUnauthorized{Repo: "github.com/foo/bar", NoAuthz: true}, outcomePermanent},
+		{errors.New("invalid repository name"), outcomePermanent},
+		{context.Canceled, outcomeCanceled},
+	}
+
+	for _, testCase := range testCases {
+		if have := outcome(context.Background(), testCase.err); have != testCase.want {
+			t.Errorf("unexpected outcome for %v. want=%q have=%q", testCase.err, testCase.want, have)
+		}
+	}
+}
+
+func TestOutcomeCallerGaveUp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+
+	err := &url.Error{Op: "Post", URL: "http://repo-updater", Err: context.DeadlineExceeded}
+	if have := outcome(ctx, err); have != outcomeCanceled {
+		t.Errorf("unexpected outcome. want=%q have=%q", outcomeCanceled, have)
+	}
+}
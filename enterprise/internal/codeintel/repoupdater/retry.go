@@ -0,0 +1,126 @@
+package repoupdater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/internal/errcode"
+	"github.com/sourcegraph/sourcegraph/internal/httpcli"
+)
+
+// retryPolicy describes how many times and how eagerly a failed request to
+// repo-updater is re-attempted.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// defaultRetryPolicy gives repo-updater roughly four seconds to recover from
+// a transient failure (e.g. a restart) before the error is returned to the caller.
+var defaultRetryPolicy = retryPolicy{
+	maxAttempts: 5,
+	baseDelay:   100 * time.Millisecond,
+	maxDelay:    2 * time.Second,
+}
+
+// do invokes f until it succeeds, returns a non-retryable error, or the maximum
+// number of attempts is reached. Between attempts it sleeps for an exponentially
+// increasing and fully jittered duration. The number of attempts made is returned
+// along with the error of the last attempt.
+func (p retryPolicy) do(ctx context.Context, f func() error) (attempts int, err error) {
+	for {
+		attempts++
+
+		if err = f(); err == nil || attempts >= p.maxAttempts || !isRetryable(err) {
+			return attempts, err
+		}
+
+		timer := time.NewTimer(p.delay(attempts))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempts, err
+		}
+	}
+}
+
+// delay returns the duration to wait after the given (one-indexed) attempt.
+func (p retryPolicy) delay(attempt int) time.Duration {
+	delay := p.maxDelay
+	if shift := attempt - 1; shift < 32 {
+		if d := p.baseDelay << shift; d > 0 && d < delay {
+			delay = d
+		}
+	}
+
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// isRetryable returns true if the given error may succeed if the request is re-attempted:
+// errors marked as temporary, which include responses with one of unavailableStatuses, and
+// errors connecting to repo-updater or waiting for its response. Errors describing the
+// request or the state of the repository are deterministic and not retried, nor are errors
+// resulting from the cancellation of the request's context or an open circuit breaker.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	if errcode.IsTemporary(err) {
+		return true
+	}
+
+	// Errors of the transport, like a refused connection or a timeout.
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// unavailableStatuses are the HTTP statuses with which repo-updater, or a proxy in front
+// of it, responds while it is temporarily unable to serve requests.
+var unavailableStatuses = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// statusError is returned in place of a response with a server error status or one of
+// unavailableStatuses. It is temporary for unavailableStatuses only.
+type statusError struct {
+	url    string
+	status int
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s failed with http status %d: %s", e.url, e.status, e.body)
+}
+
+func (e *statusError) Temporary() bool { return unavailableStatuses[e.status] }
+
+// statusDoer turns the responses with a server error status or one of unavailableStatuses
+// into a statusError, since the repo-updater client only reports the body of a failed
+// response.
+type statusDoer struct {
+	doer httpcli.Doer
+}
+
+func (d statusDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.doer.Do(req)
+	if err != nil || (resp.StatusCode < 500 && !unavailableStatuses[resp.StatusCode]) {
+		return resp, err
+	}
+	defer resp.Body.Close()
+
+	// best-effort inclusion of body in error message
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+	return nil, &statusError{url: req.URL.String(), status: resp.StatusCode, body: string(body)}
+}
@@ -0,0 +1,120 @@
+package repoupdater
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/internal/observation"
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater"
+	"github.com/sourcegraph/sourcegraph/internal/repoupdater/protocol"
+)
+
+// errConnectionRefused is the error of a request to a repo-updater which isn't running.
+var errConnectionRefused error = &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 3, baseDelay: time.Millisecond, maxDelay: time.Millisecond}
+
+	t.Run("eventual success", func(t *testing.T) {
+		calls := 0
+		attempts, err := policy.do(context.Background(), func() error {
+			if calls++; calls < 2 {
+				return errConnectionRefused
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if attempts != 2 {
+			t.Errorf("unexpected number of attempts. want=%d have=%d", 2, attempts)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		attempts, err := policy.do(context.Background(), func() error { return errConnectionRefused })
+		if err == nil {
+			t.Fatalf("expected an error")
+		}
+		if attempts != 3 {
+			t.Errorf("unexpected number of attempts. want=%d have=%d", 3, attempts)
+		}
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		attempts, err := policy.do(context.Background(), func() error {
+			return &repoupdater.ErrNotFound{Repo: "github.com/foo/bar", IsNotFound: true}
+		})
+		if err == nil {
+			t.Fatalf("expected an error")
+		}
+		if attempts != 1 {
+			t.Errorf("unexpected number of attempts. want=%d have=%d", 1, attempts)
+		}
+	})
+}
+
+func TestEnqueueRepoUpdateDoesNotRetryBadRequests(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			http.Error(w, "invalid repository name", http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(protocol.RepoUpdateResponse{ID: 42, Name: "github.com/foo/bar"})
+	}))
+	defer server.Close()
+
+	client := NewWithClient(&repoupdater.Client{URL: server.URL, HTTPClient: http.DefaultClient}, &observation.TestContext)
+	client.retryPolicy = retryPolicy{maxAttempts: 3, baseDelay: time.Millisecond, maxDelay: time.Millisecond}
+
+	if _, err := client.EnqueueRepoUpdate(context.Background(), "github.com/foo/bar", protocol.RepoUpdatePriorityUrgent); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if calls != 1 {
+		t.Errorf("unexpected number of requests. want=%d have=%d", 1, calls)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want bool
+	}{
+		{errConnectionRefused, true},
+		{&statusError{status: http.StatusServiceUnavailable}, true},
+		{&statusError{status: http.StatusInternalServerError}, false},
+		{&repoupdater.ErrTemporary{Repo: "github.com/foo/bar", IsTemporary: true}, true},
+		{errors.New("invalid repository name"), false},
+		{&repoupdater.ErrNotFound{Repo: "github.com/foo/bar", IsNotFound: true}, false},
+		{&repoupdater.ErrUnauthorized{Repo: "github.com/foo/bar", NoAuthz: true}, false},
+		{context.Canceled, false},
+		{ErrCircuitOpen, false},
+	}
+
+	for _, testCase := range testCases {
+		if have := isRetryable(testCase.err); have != testCase.want {
+			t.Errorf("unexpected result for %v. want=%v have=%v", testCase.err, testCase.want, have)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 50, baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+
+	for attempt := 1; attempt <= 50; attempt++ {
+		if delay := policy.delay(attempt); delay < 0 || delay > time.Second {
+			t.Errorf("unexpected delay for attempt %d: %s", attempt, delay)
+		}
+	}
+}
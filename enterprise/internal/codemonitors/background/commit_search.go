@@ -0,0 +1,264 @@
+package background
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	cm "github.com/sourcegraph/sourcegraph/enterprise/internal/codemonitors"
+	"github.com/sourcegraph/sourcegraph/internal/actor"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/database/dbutil"
+	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	gitprotocol "github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
+	searchshared "github.com/sourcegraph/sourcegraph/internal/search"
+	"github.com/sourcegraph/sourcegraph/internal/search/commit"
+	"github.com/sourcegraph/sourcegraph/internal/search/query"
+	searchrepos "github.com/sourcegraph/sourcegraph/internal/search/repos"
+	"github.com/sourcegraph/sourcegraph/internal/vcs"
+	"github.com/sourcegraph/sourcegraph/internal/vcs/git"
+)
+
+// errUnsupportedQuery is returned for queries the commit search engine can't
+// evaluate. They are run through the regular search API instead.
+var errUnsupportedQuery = errors.New("query is not supported by incremental commit search")
+
+// commitQuery is a code monitor query compiled into the predicate tree
+// gitserver evaluates against each commit.
+type commitQuery struct {
+	query     query.Basic
+	predicate gitprotocol.Node
+	diff      bool
+}
+
+// compileCommitQuery compiles a type:commit or type:diff query. Other queries
+// return errUnsupportedQuery.
+func compileCommitQuery(queryString string) (*commitQuery, error) {
+	plan, err := query.Pipeline(query.Init(queryString, searchType(queryString)))
+	if err != nil {
+		return nil, err
+	}
+	if len(plan) != 1 {
+		return nil, errors.Wrap(errUnsupportedQuery, "queries with or-expressions on filters are not supported")
+	}
+	b := plan[0]
+
+	q := b.ToParseTree()
+	types, _ := q.StringValues(query.FieldType)
+	if len(types) != 1 || (types[0] != "commit" && types[0] != "diff") {
+		return nil, errors.Wrap(errUnsupportedQuery, "only type:commit and type:diff queries are supported")
+	}
+	diff := types[0] == "diff"
+
+	return &commitQuery{
+		query:     b,
+		predicate: commit.QueryToGitQuery(q, diff),
+		diff:      diff,
+	}, nil
+}
+
+// searchType returns the search type set with patternType:, defaulting to
+// literal like the search API.
+func searchType(queryString string) query.SearchType {
+	st := query.SearchTypeLiteral
+	q, err := query.Parse(queryString, query.SearchTypeLiteral)
+	if err != nil {
+		return st
+	}
+	query.VisitField(query.LowercaseFieldNames(q), query.FieldPatternType, func(value string, _ bool, _ query.Annotation) {
+		switch value {
+		case "regex", "regexp":
+			st = query.SearchTypeRegex
+		case "literal":
+			st = query.SearchTypeLiteral
+		case "structural":
+			st = query.SearchTypeStructural
+		}
+	})
+	return st
+}
+
+// repoOptions returns the options to resolve the repositories the query
+// searches, with the same defaults for forks and archived repositories as the
+// search API.
+func (c *commitQuery) repoOptions() searchshared.RepoOptions {
+	q := c.query.ToParseTree()
+	repoFilters, minusRepoFilters := q.Repositories()
+	repoGroupFilters, _ := q.StringValues(query.FieldRepoGroup)
+	searchContextSpec, _ := q.StringValue(query.FieldContext)
+	visibility, _ := q.StringValue(query.FieldVisibility)
+
+	fork, archived := query.No, query.No
+	if searchrepos.ExactlyOneRepo(repoFilters) {
+		fork, archived = query.Yes, query.Yes
+	}
+	if v := q.Fork(); v != nil {
+		fork = *v
+	}
+	if v := q.Archived(); v != nil {
+		archived = *v
+	}
+
+	return searchshared.RepoOptions{
+		RepoFilters:       repoFilters,
+		MinusRepoFilters:  minusRepoFilters,
+		RepoGroupFilters:  repoGroupFilters,
+		SearchContextSpec: searchContextSpec,
+		OnlyForks:         fork == query.Only,
+		NoForks:           fork == query.No,
+		OnlyArchived:      archived == query.Only,
+		NoArchived:        archived == query.No,
+		Visibility:        query.ParseVisibility(visibility),
+		Query:             q,
+	}
+}
+
+// commitSearcher evaluates commit and diff monitors incrementally. Instead of
+// searching the history of every repository with an after: filter on each
+// run, it remembers the commits each repository was at when it was last
+// searched and only searches the commits added since.
+type commitSearcher struct {
+	// Mockable for tests.
+	resolveRepos    func(ctx context.Context, op searchshared.RepoOptions) ([]*searchshared.RepositoryRevisions, error)
+	resolveRevision func(ctx context.Context, repo api.RepoName, spec string) (api.CommitID, error)
+	search          func(ctx context.Context, args *gitprotocol.SearchRequest, onMatches func([]gitprotocol.CommitMatch)) error
+}
+
+func newCommitSearcher(db dbutil.DB) *commitSearcher {
+	return &commitSearcher{
+		resolveRepos: func(ctx context.Context, op searchshared.RepoOptions) ([]*searchshared.RepositoryRevisions, error) {
+			resolved, err := (&searchrepos.Resolver{DB: db}).Resolve(ctx, op)
+			return resolved.RepoRevs, err
+		},
+		resolveRevision: func(ctx context.Context, repo api.RepoName, spec string) (api.CommitID, error) {
+			return git.ResolveRevision(ctx, repo, spec, git.ResolveRevisionOptions{NoEnsureRevision: true})
+		},
+		search: func(ctx context.Context, args *gitprotocol.SearchRequest, onMatches func([]gitprotocol.CommitMatch)) error {
+			_, err := gitserver.DefaultClient.Search(ctx, args, onMatches)
+			return err
+		},
+	}
+}
+
+// commitSearchResult summarizes the new matching commits of a run.
+type commitSearchResult struct {
+	numResults int
+	// latest is the author date of the latest matching commit.
+	latest time.Time
+}
+
+// Search runs the monitor query q against the commits added since the last
+// run, and records the searched commits in s. The first run of a monitor on a
+// repository only records its commits. It returns errUnsupportedQuery if q
+// isn't a commit or diff search.
+func (c *commitSearcher) Search(ctx context.Context, s *cm.Store, q *cm.MonitorQuery) (*commitSearchResult, error) {
+	cq, err := compileCommitQuery(q.QueryString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Search with the permissions of the owner of the monitor.
+	ctx = actor.WithActor(ctx, actor.FromUser(q.CreatedBy))
+
+	repoRevs, err := c.resolveRepos(ctx, cq.repoOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rr := range repoRevs {
+		for _, rev := range rr.Revs {
+			if rev.RefGlob != "" || rev.ExcludeRefGlob != "" {
+				return nil, errors.Wrap(errUnsupportedQuery, "ref globs are not supported")
+			}
+		}
+	}
+
+	res := &commitSearchResult{}
+	for _, rr := range repoRevs {
+		if err := c.searchRepo(ctx, s, q, cq, rr, res); err != nil {
+			return nil, errors.Wrapf(err, "searching %s", rr.Repo.Name)
+		}
+	}
+	return res, nil
+}
+
+func (c *commitSearcher) searchRepo(ctx context.Context, s *cm.Store, q *cm.MonitorQuery, cq *commitQuery, rr *searchshared.RepositoryRevisions, res *commitSearchResult) error {
+	revs := rr.Revs
+	if len(revs) == 0 {
+		revs = []searchshared.RevisionSpecifier{{RevSpec: "HEAD"}}
+	}
+
+	current := make([]string, 0, len(revs))
+	for _, rev := range revs {
+		spec := rev.RevSpec
+		if spec == "" {
+			spec = "HEAD"
+		}
+		oid, err := c.resolveRevision(ctx, rr.GitserverRepo(), spec)
+		if err != nil {
+			if vcs.IsRepoNotExist(err) || errors.HasType(err, &gitserver.RevisionNotFoundError{}) {
+				// Not cloned yet, or empty. We search it once it has commits.
+				return nil
+			}
+			return err
+		}
+		current = append(current, string(oid))
+	}
+
+	last, err := s.GetLastSearched(ctx, q.Monitor, rr.Repo.ID)
+	if err != nil {
+		return err
+	}
+
+	// Commits which no longer exist, e.g. after a force push, can't be
+	// excluded. If none of them exist anymore, we start over like on the
+	// first run instead of reporting the whole history.
+	excluded := make([]string, 0, len(last))
+	for _, oid := range last {
+		if _, err := c.resolveRevision(ctx, rr.GitserverRepo(), oid); err == nil {
+			excluded = append(excluded, oid)
+		}
+	}
+
+	if len(excluded) > 0 && !equalStrings(excluded, current) {
+		revisions := make([]gitprotocol.RevisionSpecifier, 0, len(current)+len(excluded))
+		for _, oid := range current {
+			revisions = append(revisions, gitprotocol.RevisionSpecifier{RevSpec: oid})
+		}
+		for _, oid := range excluded {
+			revisions = append(revisions, gitprotocol.RevisionSpecifier{RevSpec: "^" + oid})
+		}
+
+		err := c.search(ctx, &gitprotocol.SearchRequest{
+			Repo:        rr.GitserverRepo(),
+			Revisions:   revisions,
+			Query:       cq.predicate,
+			IncludeDiff: cq.diff,
+		}, func(matches []gitprotocol.CommitMatch) {
+			res.numResults += len(matches)
+			for _, m := range matches {
+				if m.Author.Date.After(res.latest) {
+					res.latest = m.Author.Date
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.UpsertLastSearched(ctx, q.Monitor, rr.Repo.ID, current)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package background
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/google/go-cmp/cmp"
+	"github.com/keegancsmith/sqlf"
+
+	"github.com/sourcegraph/sourcegraph/enterprise/internal/codemonitors"
+	"github.com/sourcegraph/sourcegraph/enterprise/internal/codemonitors/storetest"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/database/dbtesting"
+	gitprotocol "github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
+	searchshared "github.com/sourcegraph/sourcegraph/internal/search"
+	"github.com/sourcegraph/sourcegraph/internal/types"
+)
+
+func TestCompileCommitQuery(t *testing.T) {
+	t.Run("diff", func(t *testing.T) {
+		cq, err := compileCommitQuery(`repo:^github\.com/sourcegraph/sourcegraph$ type:diff author:camden TODO patternType:literal`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cq.diff {
+			t.Fatal("expected a diff search")
+		}
+		want := &gitprotocol.Operator{Kind: gitprotocol.And, Operands: []gitprotocol.Node{
+			&gitprotocol.AuthorMatches{Expr: "camden", IgnoreCase: true},
+			&gitprotocol.DiffMatches{Expr: "TODO", IgnoreCase: true},
+		}}
+		if diff := cmp.Diff(want, cq.predicate); diff != "" {
+			t.Fatalf("predicate mismatch (-want +got):\n%s", diff)
+		}
+
+		op := cq.repoOptions()
+		if diff := cmp.Diff([]string{`^github\.com/sourcegraph/sourcegraph$`}, op.RepoFilters); diff != "" {
+			t.Fatalf("repo filters mismatch (-want +got):\n%s", diff)
+		}
+		if op.NoForks || op.NoArchived {
+			t.Fatal("expected forks and archived repositories to be included for a single repo")
+		}
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		cq, err := compileCommitQuery(`type:commit fix\(.*\) patternType:regexp`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := &gitprotocol.Operator{Kind: gitprotocol.And, Operands: []gitprotocol.Node{
+			&gitprotocol.MessageMatches{Expr: `fix\(.*\)`, IgnoreCase: true},
+		}}
+		if diff := cmp.Diff(want, cq.predicate); diff != "" {
+			t.Fatalf("predicate mismatch (-want +got):\n%s", diff)
+		}
+		if op := cq.repoOptions(); !op.NoForks || !op.NoArchived {
+			t.Fatal("expected forks and archived repositories to be excluded by default")
+		}
+	})
+
+	for _, q := range []string{
+		"foo patternType:literal",
+		"type:file foo",
+		"(type:diff foo) or (type:commit bar)",
+	} {
+		t.Run(q, func(t *testing.T) {
+			if _, err := compileCommitQuery(q); !errors.Is(err, errUnsupportedQuery) {
+				t.Fatalf("expected errUnsupportedQuery, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCommitSearcher(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	db := dbtesting.GetDB(t)
+	s := codemonitors.NewStoreWithClock(db, time.Now)
+	ctx, ts := storetest.NewTestStoreWithStore(t, s)
+	_, _, _, userCtx := storetest.NewTestUser(ctx, t)
+	m, err := ts.InsertTestMonitor(userCtx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := s.TriggerQueryByMonitorIDInt64(ctx, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var repoID api.RepoID
+	err = s.QueryRow(ctx, sqlf.Sprintf("INSERT INTO repo (name) VALUES ('github.com/sourcegraph/sourcegraph') RETURNING id")).Scan(&repoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head := "a"
+	var searched [][]gitprotocol.RevisionSpecifier
+	c := &commitSearcher{
+		resolveRepos: func(ctx context.Context, op searchshared.RepoOptions) ([]*searchshared.RepositoryRevisions, error) {
+			return []*searchshared.RepositoryRevisions{{Repo: types.RepoName{ID: repoID, Name: "github.com/sourcegraph/sourcegraph"}}}, nil
+		},
+		resolveRevision: func(ctx context.Context, repo api.RepoName, spec string) (api.CommitID, error) {
+			if spec == "HEAD" {
+				return api.CommitID(head), nil
+			}
+			return api.CommitID(spec), nil
+		},
+		search: func(ctx context.Context, args *gitprotocol.SearchRequest, onMatches func([]gitprotocol.CommitMatch)) error {
+			searched = append(searched, args.Revisions)
+			onMatches([]gitprotocol.CommitMatch{{Oid: api.CommitID(head)}})
+			return nil
+		},
+	}
+
+	// The first run only records the commits.
+	res, err := c.Search(ctx, s, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.numResults != 0 || len(searched) != 0 {
+		t.Fatalf("expected no search on the first run, got %d results and %d searches", res.numResults, len(searched))
+	}
+
+	// Without new commits nothing is searched.
+	if _, err := c.Search(ctx, s, q); err != nil {
+		t.Fatal(err)
+	}
+	if len(searched) != 0 {
+		t.Fatalf("expected no search without new commits, got %d searches", len(searched))
+	}
+
+	// New commits are searched up to the commits of the last run.
+	head = "b"
+	res, err = c.Search(ctx, s, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.numResults != 1 {
+		t.Fatalf("expected 1 result, got %d", res.numResults)
+	}
+	want := [][]gitprotocol.RevisionSpecifier{{{RevSpec: "b"}, {RevSpec: "^a"}}}
+	if diff := cmp.Diff(want, searched); diff != "" {
+		t.Fatalf("searched revisions mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -30,7 +30,8 @@ func newTriggerQueryRunner(ctx context.Context, s *cm.Store, metrics codeMonitor
 		HeartbeatInterval: 15 * time.Second,
 		Metrics:           metrics.workerMetrics,
 	}
-	worker := dbworker.NewWorker(ctx, createDBWorkerStoreForTriggerJobs(s), &queryRunner{s}, options)
+	runner := &queryRunner{Store: s, commitSearcher: newCommitSearcher(s.Handle().DB())}
+	worker := dbworker.NewWorker(ctx, createDBWorkerStoreForTriggerJobs(s), runner, options)
 	return worker
 }
 
@@ -132,6 +133,7 @@ func createDBWorkerStoreForActionJobs(s *cm.Store) dbworkerstore.Store {
 
 type queryRunner struct {
 	*cm.Store
+	commitSearcher *commitSearcher
 }
 
 func (r *queryRunner) Handle(ctx context.Context, record workerutil.Record) (err error) {
@@ -154,15 +156,28 @@ func (r *queryRunner) Handle(ctx context.Context, record workerutil.Record) (err
 	}
 	newQuery := newQueryWithAfterFilter(q)
 
-	// Search.
-	var results *gqlSearchResponse
-	results, err = search(ctx, newQuery)
-	if err != nil {
-		return err
-	}
+	// Search. Commit and diff searches only search the commits added since
+	// the last run, other queries use the search API with an after: filter.
 	var numResults int
-	if results != nil {
-		numResults = len(results.Data.Search.Results.Results)
+	var newLatestResult time.Time
+	var commitResults *commitSearchResult
+	commitResults, err = r.commitSearcher.Search(ctx, s, q)
+	switch {
+	case err == nil:
+		numResults = commitResults.numResults
+		newLatestResult = commitLatestResultTime(q.LatestResult, commitResults)
+	case errors.Is(err, errUnsupportedQuery):
+		var results *gqlSearchResponse
+		results, err = search(ctx, newQuery)
+		if err != nil {
+			return err
+		}
+		if results != nil {
+			numResults = len(results.Data.Search.Results.Results)
+		}
+		newLatestResult = latestResultTime(q.LatestResult, results, err)
+	default:
+		return err
 	}
 	if numResults > 0 {
 		err := s.EnqueueActionEmailsForQueryIDInt64(ctx, q.Id, record.RecordID())
@@ -171,7 +186,6 @@ func (r *queryRunner) Handle(ctx context.Context, record workerutil.Record) (err
 		}
 	}
 	// Log next_run and latest_result to table cm_queries.
-	newLatestResult := latestResultTime(q.LatestResult, results, err)
 	err = s.SetTriggerQueryNextRun(ctx, q.Id, s.Clock()().Add(5*time.Minute), newLatestResult.UTC())
 	if err != nil {
 		return err
@@ -289,6 +303,18 @@ func latestResultTime(previousLastResult *time.Time, v *gqlSearchResponse, searc
 	return *t
 }
 
+// commitLatestResultTime is latestResultTime for the results of the
+// incremental commit search.
+func commitLatestResultTime(previousLastResult *time.Time, res *commitSearchResult) time.Time {
+	if res.numResults == 0 {
+		if previousLastResult != nil {
+			return *previousLastResult
+		}
+		return time.Now()
+	}
+	return res.latest
+}
+
 func zeroOrVal(i *int) int {
 	if i == nil {
 		return 0
@@ -0,0 +1,44 @@
+package codemonitors
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/cockroachdb/errors"
+	"github.com/keegancsmith/sqlf"
+	"github.com/lib/pq"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+const getLastSearchedFmtStr = `
+SELECT commit_oids
+FROM cm_last_searched
+WHERE monitor_id = %s
+AND repo_id = %s
+`
+
+// GetLastSearched returns the OIDs of the revisions of the repository that
+// were searched by the last run of the monitor. It returns nil if the monitor
+// hasn't searched the repository yet.
+func (s *Store) GetLastSearched(ctx context.Context, monitorID int64, repoID api.RepoID) ([]string, error) {
+	var oids []string
+	err := s.QueryRow(ctx, sqlf.Sprintf(getLastSearchedFmtStr, monitorID, repoID)).Scan(pq.Array(&oids))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return oids, err
+}
+
+const upsertLastSearchedFmtStr = `
+INSERT INTO cm_last_searched (monitor_id, repo_id, commit_oids)
+VALUES (%s, %s, %s)
+ON CONFLICT (monitor_id, repo_id)
+DO UPDATE SET commit_oids = %s
+`
+
+// UpsertLastSearched records the OIDs of the revisions of the repository that
+// were searched by the current run of the monitor.
+func (s *Store) UpsertLastSearched(ctx context.Context, monitorID int64, repoID api.RepoID, oids []string) error {
+	return s.Exec(ctx, sqlf.Sprintf(upsertLastSearchedFmtStr, monitorID, repoID, pq.Array(oids), pq.Array(oids)))
+}
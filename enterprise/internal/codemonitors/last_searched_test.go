@@ -0,0 +1,50 @@
+package codemonitors
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/keegancsmith/sqlf"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestLastSearched(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx, s := newTestStore(t)
+	_, _, _, userCTX := newTestUser(ctx, t)
+	m, err := s.insertTestMonitor(userCTX, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var repoID api.RepoID
+	err = s.QueryRow(ctx, sqlf.Sprintf("INSERT INTO repo (name) VALUES ('github.com/sourcegraph/sourcegraph') RETURNING id")).Scan(&repoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oids, err := s.GetLastSearched(ctx, m.ID, repoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oids != nil {
+		t.Fatalf("expected no OIDs before the first run, got %v", oids)
+	}
+
+	for _, want := range [][]string{{"a", "b"}, {"c"}} {
+		if err := s.UpsertLastSearched(ctx, m.ID, repoID, want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.GetLastSearched(ctx, m.ID, repoID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
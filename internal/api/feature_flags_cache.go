@@ -0,0 +1,75 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// featureFlagsCacheTTL is how long evaluated feature flags are cached by
+	// the internal client.
+	featureFlagsCacheTTL = 30 * time.Second
+
+	// featureFlagsCacheMaxEntries is the number of cached actors above which
+	// expired entries are evicted.
+	featureFlagsCacheMaxEntries = 1000
+)
+
+var featureFlagsCache = newFlagCache(featureFlagsCacheTTL, featureFlagsCacheMaxEntries)
+
+// flagCache caches the evaluated feature flags per actor, so that services
+// checking flags on hot paths don't make a request to the frontend for every
+// check.
+type flagCache struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[FeatureFlagsRequest]flagCacheEntry
+}
+
+type flagCacheEntry struct {
+	flags   map[string]bool
+	expires time.Time
+}
+
+func newFlagCache(ttl time.Duration, maxEntries int) *flagCache {
+	return &flagCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[FeatureFlagsRequest]flagCacheEntry),
+	}
+}
+
+func (c *flagCache) get(req FeatureFlagsRequest) (map[string]bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[req]
+	if !ok || !c.now().Before(e.expires) {
+		return nil, false
+	}
+	return e.flags, true
+}
+
+func (c *flagCache) set(req FeatureFlagsRequest, flags map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= c.maxEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		// If all entries are still valid, start over rather than growing
+		// without bound.
+		if len(c.entries) >= c.maxEntries {
+			c.entries = make(map[FeatureFlagsRequest]flagCacheEntry)
+		}
+	}
+	c.entries[req] = flagCacheEntry{flags: flags, expires: now.Add(c.ttl)}
+}
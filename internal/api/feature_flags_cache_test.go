@@ -0,0 +1,39 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlagCache(t *testing.T) {
+	now := time.Now()
+	c := newFlagCache(time.Minute, 2)
+	c.now = func() time.Time { return now }
+
+	alice := FeatureFlagsRequest{UserID: 1}
+	anon := FeatureFlagsRequest{AnonymousUID: "abc"}
+
+	if _, ok := c.get(alice); ok {
+		t.Fatal("unexpected cache hit")
+	}
+
+	c.set(alice, map[string]bool{"a": true})
+	if flags, ok := c.get(alice); !ok || !flags["a"] {
+		t.Fatalf("unexpected cache miss: %v", flags)
+	}
+	if _, ok := c.get(anon); ok {
+		t.Fatal("unexpected cache hit for different actor")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.get(alice); ok {
+		t.Fatal("unexpected cache hit for expired entry")
+	}
+
+	// Expired entries are evicted once the cache is full.
+	c.set(anon, map[string]bool{})
+	c.set(FeatureFlagsRequest{}, map[string]bool{})
+	if len(c.entries) != 2 {
+		t.Fatalf("unexpected number of entries. want=2 have=%d", len(c.entries))
+	}
+}
@@ -53,3 +53,36 @@ type ExternalServicesListRequest struct {
 	Limit   int      `json:"limit"`
 	AfterID int      `json:"after_id"`
 }
+
+// FeatureFlagsRequest is the request to evaluate the feature flags for an
+// actor. If neither UserID nor AnonymousUID is set, the flags are evaluated
+// globally, in which case rollout flags are omitted.
+type FeatureFlagsRequest struct {
+	UserID       int32  `json:"userID,omitempty"`
+	AnonymousUID string `json:"anonymousUID,omitempty"`
+}
+
+// SearcherPrefetchRequest is the request to fetch the archives of
+// repositories at commits into the caches of searcher ahead of searches, for
+// example to warm the caches after a restart.
+type SearcherPrefetchRequest struct {
+	Archives []SearcherArchive `json:"archives"`
+
+	// Deadline if set is the time by which the response is sent, in
+	// RFC3339Nano format. Archives still being fetched then keep being
+	// fetched in the background.
+	Deadline string `json:"deadline,omitempty"`
+}
+
+// SearcherArchive is a repository at a resolved commit.
+type SearcherArchive struct {
+	Repo   RepoName `json:"repo"`
+	Commit CommitID `json:"commit"`
+}
+
+// SearcherPrefetchResponse is the response to a SearcherPrefetchRequest.
+// Errors[i] is the error fetching Archives[i] of the request, or empty if it
+// is cached.
+type SearcherPrefetchResponse struct {
+	Errors []string `json:"errors"`
+}
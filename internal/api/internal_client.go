@@ -16,6 +16,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/env"
 	"github.com/sourcegraph/sourcegraph/internal/httpcli"
 	"github.com/sourcegraph/sourcegraph/internal/jsonc"
+	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
 	"github.com/sourcegraph/sourcegraph/internal/txemail/txtypes"
 	"github.com/sourcegraph/sourcegraph/schema"
 )
@@ -218,6 +219,39 @@ func (c *internalClient) Configuration(ctx context.Context) (conftypes.RawUnifie
 	return cfg, err
 }
 
+// ConfigurationWatchRequest is the request body of the configuration/watch
+// route.
+type ConfigurationWatchRequest struct {
+	// Version is the version of the configuration the caller has, as returned
+	// by conftypes.RawUnified.Version.
+	Version string
+}
+
+// ErrConfigurationWatchUnsupported is returned by ConfigurationWatch if the
+// frontend doesn't have the configuration/watch route yet, e.g. during an
+// upgrade.
+var ErrConfigurationWatchUnsupported = errors.New("frontend does not support watching the configuration")
+
+// ConfigurationWatch returns the configuration once its version differs from
+// version. If it doesn't change within about a minute, the unchanged
+// configuration is returned. Callers compare the version of the result to
+// tell whether it changed.
+//
+// MockInternalClientConfiguration mocks it too.
+func (c *internalClient) ConfigurationWatch(ctx context.Context, version string) (conftypes.RawUnified, error) {
+	if MockInternalClientConfiguration != nil {
+		return MockInternalClientConfiguration()
+	}
+	var cfg conftypes.RawUnified
+	// Not metered, since the duration is dominated by how long the
+	// configuration doesn't change.
+	statusCode, err := c.post(ctx, "/.internal/configuration/watch", &ConfigurationWatchRequest{Version: version}, &cfg)
+	if statusCode == http.StatusNotFound {
+		return cfg, ErrConfigurationWatchUnsupported
+	}
+	return cfg, err
+}
+
 func (c *internalClient) ReposGetByName(ctx context.Context, repoName RepoName) (*Repo, error) {
 	var repo Repo
 	err := c.postInternal(ctx, "repos/"+string(repoName), nil, &repo)
@@ -257,6 +291,44 @@ func (c *internalClient) ExternalServicesList(
 	return extsvcs, c.postInternal(ctx, "external-services/list", &opts, &extsvcs)
 }
 
+// FeatureFlags returns the feature flags evaluated for the actor of the given
+// request. The flags are cached for featureFlagsCacheTTL, so changes to the
+// flags may take that long to be picked up.
+func (c *internalClient) FeatureFlags(ctx context.Context, req FeatureFlagsRequest) (map[string]bool, error) {
+	if flags, ok := featureFlagsCache.get(req); ok {
+		return flags, nil
+	}
+
+	var flags map[string]bool
+	if err := c.postInternal(ctx, "feature-flags/evaluate", &req, &flags); err != nil {
+		return nil, err
+	}
+	featureFlagsCache.set(req, flags)
+	return flags, nil
+}
+
+// FeatureFlag returns the value of the given feature flag evaluated for the
+// actor of the given request. ok is false if the flag doesn't exist.
+func (c *internalClient) FeatureFlag(ctx context.Context, req FeatureFlagsRequest, flag string) (value, ok bool, err error) {
+	flags, err := c.FeatureFlags(ctx, req)
+	if err != nil {
+		return false, false, err
+	}
+	value, ok = flags[flag]
+	return value, ok, nil
+}
+
+// SearcherPrefetch fetches the archives of the request into the caches of the
+// searcher replicas which their searches are sent to. The i-th error is the
+// error fetching req.Archives[i], or empty if it is cached.
+func (c *internalClient) SearcherPrefetch(ctx context.Context, req SearcherPrefetchRequest) ([]string, error) {
+	var resp SearcherPrefetchResponse
+	if err := c.postInternal(ctx, "searcher/prefetch", &req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Errors, nil
+}
+
 func (c *internalClient) LogTelemetry(ctx context.Context, reqBody interface{}) error {
 	return c.postInternal(ctx, "telemetry", reqBody, nil)
 }
@@ -275,7 +347,7 @@ func (c *internalClient) meteredPost(ctx context.Context, route string, reqBody,
 	if err != nil {
 		code = "error"
 	}
-	requestDuration.WithLabelValues(route, code).Observe(d.Seconds())
+	ot.ObserveWithTraceExemplar(ctx, requestDuration.WithLabelValues(route, code), d.Seconds())
 	return err
 }
 
@@ -20,6 +20,12 @@ type client struct {
 	passthrough ConfigurationSource
 	watchersMu  sync.Mutex
 	watchers    []chan struct{}
+
+	// version is the version of the configuration last fetched from the
+	// frontend, and noWatch is set if the frontend doesn't support watching
+	// the configuration. Both are only used by continuouslyUpdate.
+	version string
+	noWatch bool
 }
 
 var (
@@ -186,7 +192,8 @@ type continuousUpdateOptions struct {
 }
 
 // continuouslyUpdate runs (*client).fetchAndUpdate in an infinite loop, with error logging and
-// random sleep intervals.
+// random sleep intervals. If the frontend supports watching the configuration, it doesn't sleep
+// after a successful update, since fetchAndUpdate already waits for the next change.
 //
 // The optOnlySetByTests parameter is ONLY customized by tests. All callers in main code should pass
 // nil (so that the same defaults are used).
@@ -228,24 +235,40 @@ func (c *client) continuouslyUpdate(optOnlySetByTests *continuousUpdateOptions)
 			start = time.Now()
 		}
 
-		opt.sleep()
+		if err != nil || !c.watching() {
+			opt.sleep()
+		}
 	}
 }
 
+// watching reports whether fetchAndUpdate waits for the configuration to change
+// on the frontend.
+func (c *client) watching() bool {
+	return c.passthrough == nil && !c.noWatch
+}
+
 func (c *client) fetchAndUpdate() error {
 	ctx := context.Background()
 	var (
 		newConfig conftypes.RawUnified
 		err       error
 	)
-	if c.passthrough != nil {
+	switch {
+	case c.passthrough != nil:
 		newConfig, err = c.passthrough.Read(ctx)
-	} else {
+	case c.watching():
+		newConfig, err = api.InternalClient.ConfigurationWatch(ctx, c.version)
+		if errors.Is(err, api.ErrConfigurationWatchUnsupported) {
+			c.noWatch = true
+			newConfig, err = api.InternalClient.Configuration(ctx)
+		}
+	default:
 		newConfig, err = api.InternalClient.Configuration(ctx)
 	}
 	if err != nil {
 		return errors.Wrap(err, "unable to fetch new configuration")
 	}
+	c.version = newConfig.Version()
 
 	configChange, err := c.store.MaybeUpdate(newConfig)
 	if err != nil {
@@ -1,6 +1,11 @@
 package conftypes
 
-import "reflect"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+)
 
 // ServiceConnections represents configuration about how the deployment
 // internally connects to services. These are settings that need to be
@@ -36,3 +41,14 @@ type RawUnified struct {
 func (r RawUnified) Equal(other RawUnified) bool {
 	return r.Site == other.Site && reflect.DeepEqual(r.ServiceConnections, other.ServiceConnections)
 }
+
+// Version returns a hash of the configuration, which changes whenever the
+// configuration changes.
+func (r RawUnified) Version() string {
+	h := sha256.New()
+	h.Write([]byte(r.Site))
+	// ServiceConnections only holds strings, so marshalling can't fail.
+	b, _ := json.Marshal(r.ServiceConnections)
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -35,6 +35,10 @@ type Server struct {
 	// configuration that has been written to disk.
 	fileWrite chan chan struct{}
 
+	// changed is closed and replaced whenever the configuration changes.
+	changedMu sync.Mutex
+	changed   chan struct{}
+
 	once sync.Once
 }
 
@@ -48,6 +52,7 @@ func NewServer(source ConfigurationSource) *Server {
 		Source:    source,
 		store:     newStore(),
 		fileWrite: fileWrite,
+		changed:   make(chan struct{}),
 	}
 }
 
@@ -81,6 +86,29 @@ func (s *Server) Write(ctx context.Context, input conftypes.RawUnified) error {
 	return nil
 }
 
+// WaitForChange blocks until the version of the raw configuration differs
+// from version, or ctx is done. It returns the current raw configuration.
+func (s *Server) WaitForChange(ctx context.Context, version string) conftypes.RawUnified {
+	for {
+		// Get the channel before reading the configuration, so that we don't
+		// miss a change in between.
+		s.changedMu.Lock()
+		changed := s.changed
+		s.changedMu.Unlock()
+
+		raw := s.store.Raw()
+		if raw.Version() != version {
+			return raw
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return raw
+		}
+	}
+}
+
 // Edits describes some JSON edits to apply to site configuration.
 type Edits struct {
 	Site []jsonx.Edit
@@ -173,6 +201,11 @@ func (s *Server) updateFromSource(ctx context.Context) error {
 		return nil
 	}
 
+	s.changedMu.Lock()
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.changedMu.Unlock()
+
 	// Don't restart if the configuration was empty before (this only occurs during initialization).
 	if configChange.Old == nil {
 		return nil
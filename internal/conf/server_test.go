@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/conf/conftypes"
+)
+
+type memorySource struct {
+	mu  sync.Mutex
+	raw conftypes.RawUnified
+}
+
+func (s *memorySource) Read(ctx context.Context) (conftypes.RawUnified, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.raw, nil
+}
+
+func (s *memorySource) Write(ctx context.Context, raw conftypes.RawUnified) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.raw = raw
+	return nil
+}
+
+func TestServer_WaitForChange(t *testing.T) {
+	source := &memorySource{raw: conftypes.RawUnified{Site: `{"externalURL": "https://a.example.com"}`}}
+	s := NewServer(source)
+	s.Start()
+
+	ctx := context.Background()
+	first := s.Raw()
+
+	// A stale version returns immediately.
+	if got := s.WaitForChange(ctx, ""); got.Site != first.Site {
+		t.Fatalf("got %q, want %q", got.Site, first.Site)
+	}
+
+	// An unchanged configuration is returned once ctx is done.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if got := s.WaitForChange(timeoutCtx, first.Version()); got.Site != first.Site {
+		t.Fatalf("got %q, want %q", got.Site, first.Site)
+	}
+
+	// A change is returned as soon as it is written.
+	done := make(chan conftypes.RawUnified)
+	go func() {
+		done <- s.WaitForChange(ctx, first.Version())
+	}()
+	want := `{"externalURL": "https://b.example.com"}`
+	if err := s.Write(ctx, conftypes.RawUnified{Site: want}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-done:
+		if got.Site != want {
+			t.Fatalf("got %q, want %q", got.Site, want)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("WaitForChange did not return after the configuration changed")
+	}
+}
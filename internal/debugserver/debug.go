@@ -11,6 +11,7 @@ import (
 
 	"github.com/felixge/fgprof"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/net/trace"
 
@@ -124,7 +125,7 @@ func NewServerRoutine(ready <-chan struct{}, extra ...Endpoint) goroutine.Backgr
 		router.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
 		router.Handle("/debug/requests", http.HandlerFunc(trace.Traces))
 		router.Handle("/debug/events", http.HandlerFunc(trace.Events))
-		router.Handle("/metrics", promhttp.Handler())
+		router.Handle("/metrics", metricsHandler())
 
 		// This path acts as a wildcard and should appear after more specific entries.
 		router.PathPrefix("/debug/pprof").HandlerFunc(pprof.Index)
@@ -136,3 +137,13 @@ func NewServerRoutine(ready <-chan struct{}, extra ...Endpoint) goroutine.Backgr
 
 	return httpserver.NewFromAddr(addr, &http.Server{Handler: handler})
 }
+
+// metricsHandler serves the default prometheus registry like
+// promhttp.Handler, but also serves the OpenMetrics format to scrapers that
+// negotiate it, since it is the only format that includes exemplars.
+func metricsHandler() http.Handler {
+	return promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+	)
+}
@@ -99,7 +99,7 @@ func (s *Store) OpenWithPath(ctx context.Context, key string, fetcher FetcherWit
 		return nil, errors.New("diskcache.Store.Dir must be set")
 	}
 
-	path := s.path(key)
+	path := s.Path(key)
 	span.LogKV("key", key, "path", path)
 
 	// First do a fast-path, assume already on disk
@@ -139,8 +139,8 @@ func (s *Store) OpenWithPath(ctx context.Context, key string, fetcher FetcherWit
 	}
 }
 
-// path returns the path for key.
-func (s *Store) path(key string) string {
+// Path returns the path on disk of the item for key.
+func (s *Store) Path(key string) string {
 	// path uses a sha256 hash of the key since we want to use it for the
 	// disk name.
 	h := sha256.Sum256([]byte(key))
@@ -221,6 +221,9 @@ type EvictStats struct {
 
 	// Evicted is the number of items evicted.
 	Evicted int
+
+	// EvictedBytes is the total size of the items evicted.
+	EvictedBytes int64
 }
 
 // Evict will remove files from Store.Dir until it is smaller than
@@ -285,6 +288,7 @@ func (s *Store) Evict(maxCacheSizeBytes int64) (stats EvictStats, err error) {
 			continue
 		}
 		stats.Evicted++
+		stats.EvictedBytes += fi.Size()
 		size -= fi.Size()
 	}
 
@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/sourcegraph/go-diff/diff"
+
 	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/search/ignore"
 )
 
 // LazyCommit wraps a RawCommit and a DiffFetcher so that we can have a unified interface
@@ -20,6 +22,9 @@ type LazyCommit struct {
 	diff        []*diff.FileDiff
 	diffFetcher *DiffFetcher
 
+	// ignore excludes the diffs of matching files
+	ignore *ignore.Matcher
+
 	// LowerBuf is a re-usable buffer for doing case-transformations on the fields of LazyCommit
 	LowerBuf []byte
 }
@@ -63,8 +68,27 @@ func (l *LazyCommit) Diff() ([]*diff.FileDiff, error) {
 	if err != nil {
 		return nil, err
 	}
-	l.diff = diff
-	return diff, nil
+	l.diff = l.filterIgnored(diff)
+	return l.diff, nil
+}
+
+// filterIgnored removes the diffs of files matched by the ignore file. A
+// rename is only removed if both of its paths are ignored.
+func (l *LazyCommit) filterIgnored(fileDiffs []*diff.FileDiff) []*diff.FileDiff {
+	if l.ignore == nil {
+		return fileDiffs
+	}
+	ignored := func(name string) bool {
+		return name == "/dev/null" || l.ignore.Match(name)
+	}
+	filtered := fileDiffs[:0]
+	for _, fd := range fileDiffs {
+		if ignored(fd.OrigName) && ignored(fd.NewName) {
+			continue
+		}
+		filtered = append(filtered, fd)
+	}
+	return filtered
 }
 
 func (l *LazyCommit) ParentIDs() []api.CommitID {
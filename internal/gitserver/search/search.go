@@ -14,6 +14,7 @@ import (
 
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/search/ignore"
 	"github.com/sourcegraph/sourcegraph/internal/search/result"
 )
 
@@ -92,6 +93,10 @@ type CommitSearcher struct {
 	Query       MatchTree
 	Revisions   []protocol.RevisionSpecifier
 	IncludeDiff bool
+
+	// Ignore excludes the diffs of matching files from matching and from the
+	// returned diffs. See ReadIgnoreFile.
+	Ignore *ignore.Matcher
 }
 
 // Search runs a search for commits matching the given predicate across the revisions passed in as revisionArgs.
@@ -219,6 +224,7 @@ func (cs *CommitSearcher) runJobs(ctx context.Context, jobs chan job) error {
 			lc := &LazyCommit{
 				RawCommit:   cv,
 				diffFetcher: diffFetcher,
+				ignore:      cs.Ignore,
 				LowerBuf:    startBuf,
 			}
 			commitMatches, highlights, err := cs.Query.Match(lc)
@@ -243,6 +249,23 @@ func (cs *CommitSearcher) runJobs(ctx context.Context, jobs chan job) error {
 	return errors
 }
 
+// ReadIgnoreFile reads the ignore file at HEAD of the repository in repoDir.
+// It returns a nil Matcher if the file doesn't exist.
+func ReadIgnoreFile(ctx context.Context, repoDir string) (*ignore.Matcher, error) {
+	cmd := exec.CommandContext(ctx, "git", "cat-file", "blob", "HEAD:"+ignore.File)
+	cmd.Dir = repoDir
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// The file or HEAD doesn't exist.
+			return nil, nil
+		}
+		return nil, err
+	}
+	return ignore.ParseBytes(out)
+}
+
 func revsToGitArgs(revs []protocol.RevisionSpecifier) []string {
 	revArgs := make([]string, 0, len(revs))
 	for _, rev := range revs {
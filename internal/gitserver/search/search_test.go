@@ -178,6 +178,58 @@ func TestSearch(t *testing.T) {
 	})
 }
 
+func TestSearchIgnore(t *testing.T) {
+	cmds := []string{
+		"mkdir .sourcegraph vendor",
+		"echo vendor > .sourcegraph/ignore",
+		"echo lorem ipsum > file1",
+		"echo lorem dolor > vendor/file2",
+		"git add -A",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z " +
+			"GIT_AUTHOR_NAME=a GIT_AUTHOR_EMAIL=a@a.com GIT_AUTHOR_DATE=2006-01-02T15:04:05Z " +
+			"git commit -m commit1",
+		"echo lorem sit > vendor/file2",
+		"git add -A",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z " +
+			"GIT_AUTHOR_NAME=a GIT_AUTHOR_EMAIL=a@a.com GIT_AUTHOR_DATE=2006-01-02T15:04:05Z " +
+			"git commit -m commit2",
+	}
+	dir := initGitRepository(t, cmds...)
+
+	ig, err := ReadIgnoreFile(context.Background(), dir)
+	require.NoError(t, err)
+	require.True(t, ig.Match("vendor/file2"))
+
+	tree, err := ToMatchTree(&protocol.DiffMatches{Expr: "lorem"})
+	require.NoError(t, err)
+	searcher := &CommitSearcher{
+		RepoDir:     dir,
+		Query:       tree,
+		IncludeDiff: true,
+		Ignore:      ig,
+	}
+	var matches []*protocol.CommitMatch
+	err = searcher.Search(context.Background(), func(match *protocol.CommitMatch) bool {
+		matches = append(matches, match)
+		return true
+	})
+	require.NoError(t, err)
+
+	// commit2 only changed an ignored file, and the diff of commit1 doesn't
+	// include the ignored file.
+	require.Len(t, matches, 1)
+	require.Equal(t, "commit1", matches[0].Message.Content)
+	require.Contains(t, matches[0].Diff.Content, "file1")
+	require.NotContains(t, matches[0].Diff.Content, "vendor/file2")
+}
+
+func TestReadIgnoreFile_missing(t *testing.T) {
+	dir := initGitRepository(t)
+	ig, err := ReadIgnoreFile(context.Background(), dir)
+	require.NoError(t, err)
+	require.Nil(t, ig)
+}
+
 func TestCommitScanner(t *testing.T) {
 	cases := []struct {
 		input    []byte
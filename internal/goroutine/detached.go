@@ -0,0 +1,25 @@
+package goroutine
+
+import (
+	"context"
+	"time"
+)
+
+// Detach returns a context with the values of ctx, which is never canceled
+// and has no deadline.
+//
+// Use it for work shared by several callers, or which must finish after the
+// caller which started it gives up, such as a singleflight call or an audit
+// record. Add a timeout of its own to bound the work.
+func Detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,23 @@
+package goroutine
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDetach(t *testing.T) {
+	type key struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+	cancel()
+
+	ctx = Detach(ctx)
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("detached context has error %v", err)
+	}
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("detached context has a deadline")
+	}
+	if got := ctx.Value(key{}); got != "value" {
+		t.Fatalf("got value %v, want %q", got, "value")
+	}
+}
@@ -2,6 +2,8 @@ package goroutine
 
 import (
 	"context"
+	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/cockroachdb/errors"
@@ -18,7 +20,13 @@ import (
 // for more information and a step-by-step guide on how to implement a
 // PeriodicBackgroundRoutine.
 type PeriodicGoroutine struct {
-	interval  time.Duration
+	mu              sync.Mutex
+	interval        time.Duration
+	intervalChanged chan struct{} // signals that the interval was changed via SetInterval
+	trigger         chan struct{} // signals that TriggerNow was called
+
+	options   PeriodicOptions
+	rand      func(n int64) int64 // returns a random number in [0, n)
 	handler   Handler
 	operation *observation.Operation
 	clock     glock.Clock
@@ -75,6 +83,17 @@ func (h *simpleHandler) HandleError(err error) {
 	log15.Error("An error occurred in a background task", "handler", h.name, "error", err)
 }
 
+// PeriodicOptions configure when the handler of a PeriodicGoroutine is invoked.
+type PeriodicOptions struct {
+	// InitialDelay is the time to wait before the first invocation of the handler.
+	InitialDelay time.Duration
+
+	// Jitter is the maximum random duration added to the initial delay and to
+	// every interval, so that goroutines started at the same time with the same
+	// interval, for example on different replicas, don't all wake up at once.
+	Jitter time.Duration
+}
+
 // NewPeriodicGoroutine creates a new PeriodicGoroutine with the given handler. The context provided will propagate into
 // the executing goroutine and will terminate the goroutine if cancelled.
 func NewPeriodicGoroutine(ctx context.Context, interval time.Duration, handler Handler) *PeriodicGoroutine {
@@ -87,17 +106,29 @@ func NewPeriodicGoroutineWithMetrics(ctx context.Context, interval time.Duration
 	return newPeriodicGoroutine(ctx, interval, handler, operation, glock.NewRealClock())
 }
 
+// NewPeriodicGoroutineWithOptions creates a new PeriodicGoroutine with the given handler, whose
+// invocations are scheduled according to the given options. The context provided will propagate
+// into the executing goroutine and will terminate the goroutine if cancelled.
+func NewPeriodicGoroutineWithOptions(ctx context.Context, interval time.Duration, handler Handler, operation *observation.Operation, options PeriodicOptions) *PeriodicGoroutine {
+	r := newPeriodicGoroutine(ctx, interval, handler, operation, glock.NewRealClock())
+	r.options = options
+	return r
+}
+
 func newPeriodicGoroutine(ctx context.Context, interval time.Duration, handler Handler, operation *observation.Operation, clock glock.Clock) *PeriodicGoroutine {
 	ctx, cancel := context.WithCancel(ctx)
 
 	return &PeriodicGoroutine{
-		handler:   handler,
-		interval:  interval,
-		operation: operation,
-		clock:     clock,
-		ctx:       ctx,
-		cancel:    cancel,
-		finished:  make(chan struct{}),
+		handler:         handler,
+		interval:        interval,
+		intervalChanged: make(chan struct{}, 1),
+		trigger:         make(chan struct{}, 1),
+		rand:            rand.Int63n,
+		operation:       operation,
+		clock:           clock,
+		ctx:             ctx,
+		cancel:          cancel,
+		finished:        make(chan struct{}),
 	}
 }
 
@@ -106,7 +137,16 @@ func newPeriodicGoroutine(ctx context.Context, interval time.Duration, handler H
 func (r *PeriodicGoroutine) Start() {
 	defer close(r.finished)
 
-loop:
+	if delay := r.options.InitialDelay + r.jitter(); delay > 0 {
+		select {
+		case <-r.clock.After(delay):
+		case <-r.trigger:
+		case <-r.ctx.Done():
+			r.shutdown()
+			return
+		}
+	}
+
 	for {
 		if shutdown, err := runPeriodicHandler(r.ctx, r.handler, r.operation); shutdown {
 			break
@@ -114,13 +154,79 @@ loop:
 			h.HandleError(err)
 		}
 
+		if !r.wait() {
+			break
+		}
+	}
+
+	r.shutdown()
+}
+
+// wait blocks until the next invocation of the handler is due and returns
+// false if the goroutine is shutting down instead. The next invocation is due
+// one interval after the previous invocation finished, using the interval at
+// the time of the check, or immediately if TriggerNow was called.
+func (r *PeriodicGoroutine) wait() bool {
+	finished := r.clock.Now()
+	jitter := r.jitter()
+
+	for {
 		select {
-		case <-r.clock.After(r.interval):
+		case <-r.clock.After(r.clock.Until(finished.Add(r.Interval() + jitter))):
+			return true
+		case <-r.trigger:
+			return true
+		case <-r.intervalChanged:
+			// Recompute the time of the next invocation
 		case <-r.ctx.Done():
-			break loop
+			return false
 		}
 	}
+}
+
+// jitter returns a random duration in [0, options.Jitter).
+func (r *PeriodicGoroutine) jitter() time.Duration {
+	if r.options.Jitter > 0 {
+		return time.Duration(r.rand(int64(r.options.Jitter)))
+	}
+	return 0
+}
+
+// Interval returns the current interval between invocations of the handler.
+func (r *PeriodicGoroutine) Interval() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.interval
+}
+
+// SetInterval changes the interval between invocations of the handler, for
+// example after a configuration change. If the goroutine is waiting for its
+// next invocation, it is rescheduled to one new interval after the previous
+// invocation finished, which may be immediately.
+func (r *PeriodicGoroutine) SetInterval(interval time.Duration) {
+	r.mu.Lock()
+	r.interval = interval
+	r.mu.Unlock()
+
+	select {
+	case r.intervalChanged <- struct{}{}:
+	default:
+	}
+}
+
+// TriggerNow requests an invocation of the handler without waiting for the
+// interval (or the initial delay) to elapse. If the handler is currently
+// running, it is invoked again once the current invocation finishes. Multiple
+// requests made before the handler is invoked are coalesced into a single
+// invocation. TriggerNow never blocks.
+func (r *PeriodicGoroutine) TriggerNow() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
 
+func (r *PeriodicGoroutine) shutdown() {
 	if h, ok := r.handler.(Finalizer); ok {
 		h.OnShutdown()
 	}
@@ -87,6 +87,109 @@ func TestPeriodicGoroutineFinalizer(t *testing.T) {
 	}
 }
 
+func TestPeriodicGoroutineOptions(t *testing.T) {
+	clock := glock.NewMockClock()
+	handler := NewMockHandler()
+
+	goroutine := newPeriodicGoroutine(context.Background(), time.Second, handler, nil, clock)
+	goroutine.options = PeriodicOptions{InitialDelay: 2 * time.Second, Jitter: time.Second}
+	goroutine.rand = func(n int64) int64 { return n / 2 }
+
+	go goroutine.Start()
+	clock.BlockingAdvance(2500 * time.Millisecond)
+	// Not enough for the interval plus jitter
+	clock.BlockingAdvance(time.Second)
+	goroutine.Stop()
+
+	if calls := len(handler.HandleFunc.History()); calls != 1 {
+		t.Errorf("unexpected number of handler invocations. want=%d have=%d", 1, calls)
+	}
+}
+
+func TestPeriodicGoroutineInitialDelayShutdown(t *testing.T) {
+	clock := glock.NewMockClock()
+	handler := NewMockHandlerWithFinalizer()
+
+	goroutine := newPeriodicGoroutine(context.Background(), time.Second, handler, nil, clock)
+	goroutine.options = PeriodicOptions{InitialDelay: time.Minute}
+
+	go goroutine.Start()
+	goroutine.Stop()
+
+	if calls := len(handler.HandleFunc.History()); calls != 0 {
+		t.Errorf("unexpected number of handler invocations. want=%d have=%d", 0, calls)
+	}
+
+	if calls := len(handler.OnShutdownFunc.History()); calls != 1 {
+		t.Errorf("unexpected number of finalizer invocations. want=%d have=%d", 1, calls)
+	}
+}
+
+func TestPeriodicGoroutineTriggerNow(t *testing.T) {
+	clock := glock.NewMockClock()
+	handler := NewMockHandler()
+	called := make(chan struct{})
+	handler.HandleFunc.SetDefaultHook(func(ctx context.Context) error {
+		called <- struct{}{}
+		return nil
+	})
+
+	goroutine := newPeriodicGoroutine(context.Background(), time.Hour, handler, nil, clock)
+	goroutine.options = PeriodicOptions{InitialDelay: time.Hour}
+
+	go goroutine.Start()
+	goroutine.TriggerNow()
+	<-called
+	goroutine.TriggerNow()
+	<-called
+	goroutine.Stop()
+
+	if calls := len(handler.HandleFunc.History()); calls != 2 {
+		t.Errorf("unexpected number of handler invocations. want=%d have=%d", 2, calls)
+	}
+}
+
+func TestPeriodicGoroutineSetInterval(t *testing.T) {
+	clock := glock.NewMockClock()
+	handler := NewMockHandler()
+	called := make(chan struct{})
+	handler.HandleFunc.SetDefaultHook(func(ctx context.Context) error {
+		called <- struct{}{}
+		return nil
+	})
+
+	goroutine := newPeriodicGoroutine(context.Background(), time.Hour, handler, nil, clock)
+	go goroutine.Start()
+	<-called
+
+	waitBlockedOnAfter(t, clock, 1)
+	goroutine.SetInterval(time.Second)
+	if have := goroutine.Interval(); have != time.Second {
+		t.Errorf("unexpected interval. want=%s have=%s", time.Second, have)
+	}
+
+	// The goroutine waits again with the new interval.
+	waitBlockedOnAfter(t, clock, 2)
+	clock.Advance(time.Second)
+	<-called
+	goroutine.Stop()
+
+	if calls := len(handler.HandleFunc.History()); calls != 2 {
+		t.Errorf("unexpected number of handler invocations. want=%d have=%d", 2, calls)
+	}
+}
+
+func waitBlockedOnAfter(t *testing.T, clock *glock.MockClock, n int) {
+	t.Helper()
+
+	for i := 0; clock.BlockedOnAfter() < n; i++ {
+		if i > 1000 {
+			t.Fatalf("timed out waiting for %d calls to After", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 type MockHandlerWithErrorHandler struct {
 	*MockHandler
 	*MockErrorHandler
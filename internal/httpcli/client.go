@@ -29,6 +29,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/internal/lazyregexp"
 	"github.com/sourcegraph/sourcegraph/internal/metrics"
 	"github.com/sourcegraph/sourcegraph/internal/rcache"
+	"github.com/sourcegraph/sourcegraph/internal/requestid"
 	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
 )
 
@@ -98,6 +99,7 @@ func NewExternalClientFactory() *Factory {
 	return NewFactory(
 		NewMiddleware(
 			ContextErrorMiddleware,
+			NewLoggingMiddleware("external"),
 		),
 		NewTimeoutOpt(externalTimeout),
 		// ExternalTransportOpt needs to be before TracedTransportOpt and
@@ -130,6 +132,7 @@ var (
 	internalRetryDelayBase, _   = time.ParseDuration(env.Get("SRC_HTTP_CLI_INTERNAL_RETRY_DELAY_BASE", "50ms", "Base retry delay duration for internal HTTP requests"))
 	internalRetryDelayMax, _    = time.ParseDuration(env.Get("SRC_HTTP_CLI_INTERNAL_RETRY_DELAY_MAX", "1s", "Max retry delay duration for internal HTTP requests"))
 	internalRetryMaxAttempts, _ = strconv.Atoi(env.Get("SRC_HTTP_CLI_INTERNAL_RETRY_MAX_ATTEMPTS", "20", "Max retry attempts for internal HTTP requests"))
+	internalRetryAfterMax, _    = time.ParseDuration(env.Get("SRC_HTTP_CLI_INTERNAL_RETRY_AFTER_MAX_DURATION", "5s", "Max duration to wait before retrying internal HTTP requests with a Retry-After header"))
 )
 
 // NewInternalClientFactory returns a httpcli.Factory with common options
@@ -138,15 +141,17 @@ func NewInternalClientFactory(subsystem string) *Factory {
 	return NewFactory(
 		NewMiddleware(
 			ContextErrorMiddleware,
+			NewLoggingMiddleware(subsystem),
 		),
 		NewTimeoutOpt(internalTimeout),
 		NewMaxIdleConnsPerHostOpt(500),
 		NewErrorResilientTransportOpt(
-			NewRetryPolicy(MaxRetries(internalRetryMaxAttempts)),
-			ExpJitterDelay(internalRetryDelayBase, internalRetryDelayMax),
+			IdempotentRetryPolicy(NewRetryPolicy(MaxRetries(internalRetryMaxAttempts))),
+			RetryAfterDelay(internalRetryAfterMax, ExpJitterDelay(internalRetryDelayBase, internalRetryDelayMax)),
 		),
 		MeteredTransportOpt(subsystem),
 		TracedTransportOpt,
+		RequestIDTransportOpt,
 	)
 }
 
@@ -239,6 +244,85 @@ func ContextErrorMiddleware(cli Doer) Doer {
 	})
 }
 
+var logRequests, _ = strconv.ParseBool(env.Get("SRC_HTTP_CLI_LOG_REQUESTS", "false", "Log the method, host, route, duration and status of all outbound HTTP requests"))
+
+// NewLoggingMiddleware returns a middleware that logs every request made by
+// the wrapped Doer if SRC_HTTP_CLI_LOG_REQUESTS is enabled, providing an audit
+// trail of which services talk to which hosts.
+//
+// 🚨 SECURITY: Only the method, host and a redacted template of the path of
+// requests are logged. Credentials, query strings and path segments that may
+// contain tokens are never logged.
+func NewLoggingMiddleware(subsystem string) Middleware {
+	return func(cli Doer) Doer {
+		if !logRequests {
+			return cli
+		}
+		return newLoggingDoer(cli, subsystem, log15.Info)
+	}
+}
+
+func newLoggingDoer(cli Doer, subsystem string, log func(msg string, ctx ...interface{})) Doer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := cli.Do(req)
+
+		fields := []interface{}{
+			"subsystem", subsystem,
+			"method", req.Method,
+			"host", req.URL.Host,
+			"route", redactedRoute(req.URL.Path),
+			"duration", time.Since(start),
+		}
+		if resp != nil {
+			fields = append(fields, "status", resp.StatusCode)
+		}
+		if err != nil {
+			// The error of a failed request includes the full URL.
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			fields = append(fields, "error", err)
+		}
+		log("Outbound HTTP request", fields...)
+
+		return resp, err
+	})
+}
+
+// redactedRoute returns a template of the given URL path, in which segments
+// that look like IDs or secrets are replaced by placeholders, so that it
+// groups requests to the same route and is safe to log.
+func redactedRoute(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "":
+		case isNumeric(segment):
+			segments[i] = ":id"
+		case len(segment) >= 16 && strings.IndexFunc(segment, isDigit) >= 0:
+			// Commit SHAs, UUIDs and the tokens some services expect in
+			// the path, such as in webhook URLs.
+			segments[i] = ":redacted"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if !isDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
 // GitHubProxyRedirectMiddleware rewrites requests to the "github-proxy" host
 // to "https://api.github.com".
 func GitHubProxyRedirectMiddleware(cli Doer) Doer {
@@ -341,6 +425,18 @@ func TracedTransportOpt(cli *http.Client) error {
 	return nil
 }
 
+// RequestIDTransportOpt wraps an existing http.Transport of an http.Client
+// with propagation of the request ID of the request context. It must only be
+// used for clients communicating with internal services.
+func RequestIDTransportOpt(cli *http.Client) error {
+	if cli.Transport == nil {
+		cli.Transport = http.DefaultTransport
+	}
+
+	cli.Transport = &requestid.Transport{RoundTripper: cli.Transport}
+	return nil
+}
+
 // MeteredTransportOpt returns an opt that wraps an existing http.Transport of a http.Client with
 // metrics collection.
 func MeteredTransportOpt(subsystem string) Opt {
@@ -480,6 +576,90 @@ func NewRetryPolicy(max int) rehttp.RetryFn {
 	}
 }
 
+// IdempotentRetryPolicy wraps the given retry policy so that requests which
+// aren't idempotent are only retried if the server can't have processed them:
+// either no connection to the server could be established, or the server
+// rejected the request with 429 Too Many Requests or 503 Service Unavailable.
+//
+// Requests with a method that is idempotent as per RFC 7231 (GET, HEAD,
+// OPTIONS, TRACE, PUT and DELETE) are retried as decided by the wrapped
+// policy. Like in net/http, requests with any other method can be marked as
+// idempotent with an Idempotency-Key or X-Idempotency-Key header.
+func IdempotentRetryPolicy(retry rehttp.RetryFn) rehttp.RetryFn {
+	return func(a rehttp.Attempt) bool {
+		if !isIdempotent(a.Request) && !isUnprocessed(a) {
+			return false
+		}
+		return retry(a)
+	}
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	_, hasKey := req.Header["Idempotency-Key"]
+	_, hasXKey := req.Header["X-Idempotency-Key"]
+	return hasKey || hasXKey
+}
+
+// isUnprocessed returns true if the attempt failed in a way that guarantees
+// that the server didn't process the request.
+func isUnprocessed(a rehttp.Attempt) bool {
+	if a.Error != nil {
+		var opErr *net.OpError
+		return errors.As(a.Error, &opErr) && opErr.Op == "dial"
+	}
+
+	return a.Response != nil && isRetryAfterStatus(a.Response.StatusCode)
+}
+
+func isRetryAfterStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// RetryAfterDelay wraps the given DelayFn so that the delay requested by the
+// server in the Retry-After header of a 429 Too Many Requests or 503 Service
+// Unavailable response is respected, up to max. The wrapped DelayFn is used
+// for all other attempts.
+func RetryAfterDelay(max time.Duration, delay rehttp.DelayFn) rehttp.DelayFn {
+	return func(a rehttp.Attempt) time.Duration {
+		if a.Response != nil && isRetryAfterStatus(a.Response.StatusCode) {
+			if d, ok := parseRetryAfter(a.Response.Header.Get("Retry-After"), time.Now()); ok {
+				if d > max {
+					return max
+				}
+				return d
+			}
+		}
+		return delay(a)
+	}
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date, into the duration to wait after now.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	var d time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = t.Sub(now)
+	} else {
+		return 0, false
+	}
+
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
 // ExpJitterDelay returns a DelayFn that returns a delay between 0 and
 // base * 2^attempt capped at max (an exponential backoff delay with
 // jitter).
@@ -363,12 +363,17 @@ func configuredRepoFromRepo(r *types.Repo) configuredRepo {
 
 // UpdateOnce causes a single update of the given repository.
 // It neither adds nor removes the repo from the schedule.
-func (s *updateScheduler) UpdateOnce(id api.RepoID, name api.RepoName) {
+func (s *updateScheduler) UpdateOnce(id api.RepoID, name api.RepoName, p protocol.RepoUpdatePriority) {
 	repo := configuredRepo{
 		ID:   id,
 		Name: name,
 	}
 	schedManualFetch.Inc()
+
+	if p == protocol.RepoUpdatePriorityUrgent {
+		s.updateQueue.enqueue(repo, priorityUrgent)
+		return
+	}
 	s.updateQueue.enqueue(repo, priorityHigh)
 }
 
@@ -451,6 +456,7 @@ func (s *updateScheduler) ScheduleInfo(id api.RepoID) *protocol.RepoUpdateSchedu
 			Index:    update.Index,
 			Total:    len(s.updateQueue.index),
 			Updating: update.Updating,
+			Position: s.updateQueue.position(update),
 		}
 	}
 	s.updateQueue.mu.Unlock()
@@ -480,6 +486,7 @@ type priority int
 const (
 	priorityLow priority = iota
 	priorityHigh
+	priorityUrgent
 )
 
 // repoUpdate is a repository that has been queued for an update.
@@ -547,6 +554,22 @@ func (q *updateQueue) enqueue(repo configuredRepo, p priority) (updated bool) {
 	return true
 }
 
+// position returns the number of updates that will be acquired before the given
+// update. The caller must hold the lock on q.mu.
+func (q *updateQueue) position(update *repoUpdate) int {
+	if update.Updating {
+		return 0
+	}
+
+	position := 0
+	for _, other := range q.heap {
+		if other != update && !other.Updating && q.Less(other.Index, update.Index) {
+			position++
+		}
+	}
+	return position
+}
+
 // nextSeq increments and returns the next sequence number.
 // The caller must hold the lock on q.mu.
 func (q *updateQueue) nextSeq() uint64 {
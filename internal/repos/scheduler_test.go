@@ -146,6 +146,26 @@ func TestUpdateQueue_enqueue(t *testing.T) {
 			},
 			expectedNotifications: 2,
 		},
+		{
+			name: "enqueue high b then urgent a",
+			calls: []*enqueueCall{
+				{repo: b, priority: priorityHigh},
+				{repo: a, priority: priorityUrgent},
+			},
+			expectedUpdates: []*repoUpdate{
+				{
+					Repo:     a,
+					Priority: priorityUrgent,
+					Seq:      2,
+				},
+				{
+					Repo:     b,
+					Priority: priorityHigh,
+					Seq:      1,
+				},
+			},
+			expectedNotifications: 2,
+		},
 		{
 			name: "enqueue low a then low a",
 			calls: []*enqueueCall{
@@ -538,6 +558,35 @@ func TestUpdateQueue_acquireNext(t *testing.T) {
 	}
 }
 
+func TestUpdateScheduler_ScheduleInfoQueuePosition(t *testing.T) {
+	a := configuredRepo{ID: 1, Name: "a"}
+	b := configuredRepo{ID: 2, Name: "b"}
+	c := configuredRepo{ID: 3, Name: "c"}
+	d := configuredRepo{ID: 4, Name: "d"}
+
+	_, stop := startRecording()
+	defer stop()
+
+	s := NewUpdateScheduler()
+	s.updateQueue.enqueue(a, priorityLow)
+	if _, ok := s.updateQueue.acquireNext(); !ok {
+		t.Fatal("expected to acquire an update")
+	}
+	s.updateQueue.enqueue(b, priorityLow)
+	s.updateQueue.enqueue(c, priorityHigh)
+	s.updateQueue.enqueue(d, priorityLow)
+
+	for repo, want := range map[configuredRepo]int{a: 0, b: 1, c: 0, d: 2} {
+		info := s.ScheduleInfo(repo.ID)
+		if info.Queue == nil {
+			t.Fatalf("expected %q to be queued", repo.Name)
+		}
+		if have := info.Queue.Position; have != want {
+			t.Errorf("unexpected position for %q. want=%d have=%d", repo.Name, want, have)
+		}
+	}
+}
+
 func setupInitialQueue(s *updateScheduler, initialQueue []*repoUpdate) {
 	for _, update := range initialQueue {
 		heap.Push(s.updateQueue, update)
@@ -135,12 +135,20 @@ var MockEnqueueRepoUpdate func(ctx context.Context, repo api.RepoName) (*protoco
 // EnqueueRepoUpdate requests that the named repository be updated in the near
 // future. It does not wait for the update.
 func (c *Client) EnqueueRepoUpdate(ctx context.Context, repo api.RepoName) (*protocol.RepoUpdateResponse, error) {
+	return c.EnqueueRepoUpdateWithPriority(ctx, repo, protocol.RepoUpdatePriorityDefault)
+}
+
+// EnqueueRepoUpdateWithPriority requests that the named repository be updated
+// in the near future, ahead of queued updates with a lower priority. It does
+// not wait for the update.
+func (c *Client) EnqueueRepoUpdateWithPriority(ctx context.Context, repo api.RepoName, priority protocol.RepoUpdatePriority) (*protocol.RepoUpdateResponse, error) {
 	if MockEnqueueRepoUpdate != nil {
 		return MockEnqueueRepoUpdate(ctx, repo)
 	}
 
 	req := &protocol.RepoUpdateRequest{
-		Repo: repo,
+		Repo:     repo,
+		Priority: priority,
 	}
 
 	resp, err := c.httpPost(ctx, "enqueue-repo-update", req)
@@ -166,6 +174,71 @@ func (c *Client) EnqueueRepoUpdate(ctx context.Context, repo api.RepoName) (*pro
 	return &res, nil
 }
 
+// EnqueueRepoUpdates requests that each of the named repositories be updated in
+// the near future, ahead of queued updates with a lower priority. Names that are
+// not known to repo-updater are omitted from the response. It does not wait for
+// the updates.
+func (c *Client) EnqueueRepoUpdates(ctx context.Context, repos []api.RepoName, priority protocol.RepoUpdatePriority) (*protocol.RepoUpdatesResponse, error) {
+	req := &protocol.RepoUpdatesRequest{
+		Repos:    repos,
+		Priority: priority,
+	}
+
+	resp, err := c.httpPost(ctx, "enqueue-repo-updates", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+
+	var res protocol.RepoUpdatesResponse
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return nil, errors.New(string(bs))
+	} else if err = json.Unmarshal(bs, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// MockRepoUpdateProgress mocks (*Client).RepoUpdateProgress for tests.
+var MockRepoUpdateProgress func(ctx context.Context, repo api.RepoName) (*protocol.RepoUpdateProgress, error)
+
+// RepoUpdateProgress returns the progress of the current or last update of the
+// named repository, including its initial clone. Callers that enqueued an
+// update can poll it to report progress while they wait.
+func (c *Client) RepoUpdateProgress(ctx context.Context, repo api.RepoName) (*protocol.RepoUpdateProgress, error) {
+	if MockRepoUpdateProgress != nil {
+		return MockRepoUpdateProgress(ctx, repo)
+	}
+
+	resp, err := c.httpPost(ctx, "repo-update-progress", &protocol.RepoUpdateProgressRequest{Repo: repo})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+
+	var res protocol.RepoUpdateProgress
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &repoNotFoundError{string(repo), string(bs)}
+	} else if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return nil, errors.New(string(bs))
+	} else if err = json.Unmarshal(bs, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
 type repoNotFoundError struct {
 	repo         string
 	responseBody string
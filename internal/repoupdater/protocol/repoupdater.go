@@ -40,6 +40,10 @@ type RepoQueueState struct {
 	Index    int
 	Total    int
 	Updating bool
+
+	// Position is the number of queued updates that will be started before
+	// the update of this repo. It is zero if the repo is already updating.
+	Position int
 }
 
 // RepoExternalServicesRequest is a request for the external services
@@ -75,6 +79,10 @@ type RepoLookupResult struct {
 	ErrorNotFound               bool // the repository host reported that the repository was not found
 	ErrorUnauthorized           bool // the repository host rejected the client's authorization
 	ErrorTemporarilyUnavailable bool // the repository host was temporarily unavailable (e.g., rate limit exceeded)
+
+	// Stale is set by clients that serve a previously cached result because
+	// repo-updater could not be reached. It is never sent over the wire.
+	Stale bool `json:"-"`
 }
 
 func (r *RepoLookupResult) String() string {
@@ -91,6 +99,9 @@ func (r *RepoLookupResult) String() string {
 	if r.ErrorTemporarilyUnavailable {
 		parts = append(parts, "tempunavailable")
 	}
+	if r.Stale {
+		parts = append(parts, "stale")
+	}
 	return fmt.Sprintf("RepoLookupResult{%s}", strings.Join(parts, " "))
 }
 
@@ -221,13 +232,29 @@ type RepoLinks struct {
 	Commit string // the URL to a commit, with {commit} substitution variable
 }
 
+// RepoUpdatePriority is the priority with which a requested repo update is
+// processed relative to other queued updates.
+type RepoUpdatePriority int
+
+const (
+	// RepoUpdatePriorityDefault is the priority of explicitly requested
+	// updates. They are processed ahead of periodic background updates.
+	RepoUpdatePriorityDefault RepoUpdatePriority = iota
+
+	// RepoUpdatePriorityUrgent is the priority of updates that other work is
+	// blocked on (e.g. a code intel upload that can't be processed without a
+	// clone). They are processed ahead of all other updates.
+	RepoUpdatePriorityUrgent
+)
+
 // RepoUpdateRequest is a request to update the contents of a given repo, or clone it if it doesn't exist.
 type RepoUpdateRequest struct {
-	Repo api.RepoName `json:"repo"`
+	Repo     api.RepoName       `json:"repo"`
+	Priority RepoUpdatePriority `json:"priority,omitempty"`
 }
 
 func (a *RepoUpdateRequest) String() string {
-	return fmt.Sprintf("RepoUpdateRequest{%s}", a.Repo)
+	return fmt.Sprintf("RepoUpdateRequest{%s, priority=%d}", a.Repo, a.Priority)
 }
 
 // RepoUpdateResponse is a response type to a RepoUpdateRequest.
@@ -240,6 +267,67 @@ type RepoUpdateResponse struct {
 	URL string `json:"url"`
 }
 
+// RepoUpdatesRequest is a request to update the contents of a set of repos, or
+// clone them if they don't exist.
+type RepoUpdatesRequest struct {
+	Repos    []api.RepoName     `json:"repos"`
+	Priority RepoUpdatePriority `json:"priority,omitempty"`
+}
+
+func (a *RepoUpdatesRequest) String() string {
+	return fmt.Sprintf("RepoUpdatesRequest{%d repos, priority=%d}", len(a.Repos), a.Priority)
+}
+
+// RepoUpdatesResponse is a response type to a RepoUpdatesRequest.
+type RepoUpdatesResponse struct {
+	// Repos contains an entry for each requested repo that got an update
+	// request. Repos that are not known to repo-updater are omitted.
+	Repos []RepoUpdateResponse `json:"repos"`
+}
+
+// RepoUpdateProgressRequest is a request for the progress of the update of a
+// repo, including its initial clone.
+type RepoUpdateProgressRequest struct {
+	Repo api.RepoName `json:"repo"`
+}
+
+// RepoUpdateState is the stage of the update of a repo.
+type RepoUpdateState string
+
+const (
+	// RepoUpdateStateQueued means the repo is waiting in the update queue.
+	RepoUpdateStateQueued RepoUpdateState = "queued"
+	// RepoUpdateStateCloning means the repo is being cloned for the first time.
+	RepoUpdateStateCloning RepoUpdateState = "cloning"
+	// RepoUpdateStateUpdating means an existing clone is being fetched.
+	RepoUpdateStateUpdating RepoUpdateState = "updating"
+	// RepoUpdateStateDone means the repo is cloned and its last update succeeded.
+	RepoUpdateStateDone RepoUpdateState = "done"
+	// RepoUpdateStateFailed means the last clone or update of the repo failed.
+	RepoUpdateStateFailed RepoUpdateState = "failed"
+	// RepoUpdateStateNotCloned means the repo isn't cloned and no update is
+	// queued.
+	RepoUpdateStateNotCloned RepoUpdateState = "not_cloned"
+)
+
+// RepoUpdateProgress is the response to a RepoUpdateProgressRequest.
+type RepoUpdateProgress struct {
+	State RepoUpdateState `json:"state"`
+	// Cloned is whether the repo has been cloned successfully, e.g. before a
+	// failed update.
+	Cloned bool `json:"cloned"`
+	// Position is the number of queued updates that will be started before
+	// the update of this repo, if it is queued.
+	Position int `json:"position,omitempty"`
+	// Percent is the completion percentage of the current phase of a running
+	// clone (e.g. receiving objects or resolving deltas), if git reported it.
+	Percent *int `json:"percent,omitempty"`
+	// Message is the latest progress line of a running clone.
+	Message string `json:"message,omitempty"`
+	// Error is the error of the last failed clone or update.
+	Error string `json:"error,omitempty"`
+}
+
 // ChangesetSyncRequest is a request to sync a number of changesets
 type ChangesetSyncRequest struct {
 	IDs []int64
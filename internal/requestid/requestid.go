@@ -0,0 +1,81 @@
+// Package requestid propagates a request ID across Sourcegraph services, so
+// that a single user request can be followed through the logs of every
+// service it touches.
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Header is the HTTP header used to pass the request ID between services and
+// to return it in responses.
+const Header = "X-Request-Id"
+
+// maxLength is the maximum length of a request ID accepted from a request
+// header. Longer IDs are replaced with a new one.
+const maxLength = 64
+
+type key int
+
+const requestIDKey key = iota
+
+// New returns a new random request ID.
+func New() string {
+	return uuid.New().String()
+}
+
+// FromContext returns the request ID of the given context, or the empty
+// string if it has none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithRequestID returns a copy of the given context with the given request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// FromRequest returns the request ID passed in the header of r, if it is
+// valid, or a new request ID otherwise.
+func FromRequest(r *http.Request) string {
+	if id := r.Header.Get(Header); valid(id) {
+		return id
+	}
+	return New()
+}
+
+// valid returns true if id is a non-empty request ID that is safe to include
+// in logs and response headers.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Transport wraps an underlying HTTP RoundTripper, injecting the request ID of
+// the request context into the request header. It must only be used for
+// requests to internal services.
+type Transport struct {
+	http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := FromContext(req.Context()); id != "" {
+		// RoundTrippers must not modify the request.
+		req = req.Clone(req.Context())
+		req.Header.Set(Header, id)
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
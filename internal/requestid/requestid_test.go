@@ -0,0 +1,62 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFromRequest(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "missing", header: "", keep: false},
+		{name: "valid", header: "3c0d6a3e-8c4e-4a2b-9d6c-2a4f7b1e0c55", keep: true},
+		{name: "too long", header: strings.Repeat("a", maxLength+1), keep: false},
+		{name: "invalid characters", header: "abc\ninjected=1", keep: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set(Header, tc.header)
+
+			id := FromRequest(r)
+			if id == "" {
+				t.Fatal("empty request ID")
+			}
+			if keep := id == tc.header; keep != tc.keep {
+				t.Fatalf("unexpected request ID %q for header %q", id, tc.header)
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var have string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		have = r.Header.Get(Header)
+	}))
+	defer srv.Close()
+
+	cli := &http.Client{Transport: &Transport{RoundTripper: http.DefaultTransport}}
+
+	req, err := http.NewRequestWithContext(WithRequestID(context.Background(), "abc"), "GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if have != "abc" {
+		t.Fatalf("unexpected request ID header. want=%q have=%q", "abc", have)
+	}
+	if req.Header.Get(Header) != "" {
+		t.Fatal("original request was modified")
+	}
+}
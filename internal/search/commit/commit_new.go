@@ -37,7 +37,7 @@ func searchInReposNew(ctx context.Context, db dbutil.DB, textParams *search.Text
 		args := &protocol.SearchRequest{
 			Repo:        rr.Repo.Name,
 			Revisions:   searchRevsToGitserverRevs(rr.Revs),
-			Query:       &gitprotocol.Operator{Kind: protocol.And, Operands: queryNodesToPredicates(query, query.IsCaseSensitive(), diff)},
+			Query:       QueryToGitQuery(query, diff),
 			IncludeDiff: diff,
 			Limit:       limit,
 		}
@@ -78,6 +78,12 @@ func searchRevsToGitserverRevs(in []search.RevisionSpecifier) []gitprotocol.Revi
 	return out
 }
 
+// QueryToGitQuery compiles a commit or diff search query into the predicate
+// tree gitserver evaluates against each commit.
+func QueryToGitQuery(q query.Q, diff bool) gitprotocol.Node {
+	return &gitprotocol.Operator{Kind: protocol.And, Operands: queryNodesToPredicates(q, q.IsCaseSensitive(), diff)}
+}
+
 func queryNodesToPredicates(nodes []query.Node, caseSensitive, diff bool) []gitprotocol.Node {
 	res := make([]gitprotocol.Node, 0, len(nodes))
 	for _, node := range nodes {
@@ -0,0 +1,50 @@
+// Package ignore parses .sourcegraph/ignore files. The paths of a repository
+// matched by its ignore file are excluded from indexed search, searcher and
+// commit search, so one file controls exclusions everywhere.
+//
+// The format is the one implemented by zoekt, which applies it when indexing:
+//
+// - each line represents a glob-pattern relative to the root of the repository
+// - for patterns without any glob-characters, a trailing ** is implicit
+// - lines starting with # are ignored
+// - empty lines are ignored
+package ignore
+
+import (
+	"bytes"
+	"io"
+
+	zoektignore "github.com/google/zoekt/ignore"
+)
+
+// File is the path of the ignore file relative to the root of a repository.
+const File = ".sourcegraph/ignore"
+
+// Matcher matches the paths excluded by an ignore file. The zero value and nil
+// match no path.
+type Matcher struct {
+	m *zoektignore.Matcher
+}
+
+// Parse parses the ignore file read from r.
+func Parse(r io.Reader) (*Matcher, error) {
+	m, err := zoektignore.ParseIgnoreFile(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Matcher{m: m}, nil
+}
+
+// ParseBytes parses the content of an ignore file.
+func ParseBytes(b []byte) (*Matcher, error) {
+	return Parse(bytes.NewReader(b))
+}
+
+// Match returns true if path, relative to the root of the repository, is
+// excluded by the ignore file.
+func (m *Matcher) Match(path string) bool {
+	if m == nil || m.m == nil {
+		return false
+	}
+	return m.m.Match(path)
+}
@@ -0,0 +1,43 @@
+package ignore
+
+import (
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	m, err := ParseBytes([]byte(`# comment
+
+vendor
+/node_modules/
+*.min.js
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"vendor/foo.go":          true,
+		"node_modules/a/b.js":    true,
+		"app.min.js":             true,
+		"src/app.min.js":         false,
+		"src/vendor/foo.go":      false,
+		"main.go":                false,
+		".sourcegraph/ignore":    false,
+		"node_modules_backup.js": false,
+	}
+	for path, want := range tests {
+		if got := m.Match(path); got != want {
+			t.Errorf("Match(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestMatcher_empty(t *testing.T) {
+	var m *Matcher
+	if m.Match("foo") {
+		t.Fatal("nil matcher matched")
+	}
+	if (&Matcher{}).Match("foo") {
+		t.Fatal("zero matcher matched")
+	}
+}
@@ -4,15 +4,20 @@ package searcher
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/inconshreveable/log15"
+	"github.com/klauspost/compress/zstd"
 	"github.com/opentracing-contrib/go-stdlib/nethttp"
+	otlog "github.com/opentracing/opentracing-go/log"
 
 	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
 	"github.com/sourcegraph/sourcegraph/internal/api"
@@ -29,6 +34,49 @@ var (
 	MockSearch    func(ctx context.Context, repo api.RepoName, repoID api.RepoID, commit api.CommitID, p *search.TextPatternInfo, fetchTimeout time.Duration, onMatches func([]*protocol.FileMatch)) (limitHit bool, err error)
 )
 
+type key int
+
+const shouldProfileKey key = iota
+
+// WithShouldProfile returns a context which makes Search ask searcher to
+// capture a CPU profile of each search. The profiles are listed on the
+// "/search-profiles" page of the debug server of searcher, and their IDs are
+// logged.
+//
+// 🚨 SECURITY: Capturing profiles is expensive, so only site admins may
+// request it.
+func WithShouldProfile(ctx context.Context, shouldProfile bool) context.Context {
+	return context.WithValue(ctx, shouldProfileKey, shouldProfile)
+}
+
+// ShouldProfile returns true if searches with the given context should be
+// profiled.
+func ShouldProfile(ctx context.Context) bool {
+	v, _ := ctx.Value(shouldProfileKey).(bool)
+	return v
+}
+
+// includePatterns returns the include patterns of p to send to searcher.
+// Searcher detects the languages of files itself, so for non-structural
+// searches we omit the patterns converted from lang filters. Unlike those
+// patterns, detection also finds files without an extension.
+func includePatterns(p *search.TextPatternInfo) []string {
+	if p.IsStructuralPat || len(p.Languages) == 0 {
+		return p.IncludePatterns
+	}
+	langPatterns := make(map[string]struct{}, len(p.Languages))
+	for _, lang := range p.Languages {
+		langPatterns[search.LangToFileRegexp(lang)] = struct{}{}
+	}
+	var patterns []string
+	for _, pattern := range p.IncludePatterns {
+		if _, ok := langPatterns[pattern]; !ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
 // Search searches repo@commit with p.
 func Search(
 	ctx context.Context,
@@ -61,7 +109,7 @@ func Search(
 		PatternInfo: protocol.PatternInfo{
 			Pattern:                      p.Pattern,
 			ExcludePattern:               p.ExcludePattern,
-			IncludePatterns:              p.IncludePatterns,
+			IncludePatterns:              includePatterns(p),
 			Languages:                    p.Languages,
 			CombyRule:                    p.CombyRule,
 			PathPatternsAreRegExps:       true,
@@ -79,6 +127,7 @@ func Search(
 		Indexed:          indexed,
 		FetchTimeout:     fetchTimeout.String(),
 		IndexerEndpoints: indexerEndpoints,
+		Profile:          ShouldProfile(ctx),
 	}
 
 	if deadline, ok := ctx.Deadline(); ok {
@@ -140,6 +189,9 @@ func textSearchStream(ctx context.Context, url string, body []byte, cb func([]*p
 		return false, err
 	}
 	req = req.WithContext(ctx)
+	// Setting Accept-Encoding disables the transparent gzip decompression of
+	// the transport, so we decompress the body ourselves.
+	req.Header.Set("Accept-Encoding", "zstd, gzip")
 
 	req, ht := nethttp.TraceRequest(ot.GetTracer(ctx), req,
 		nethttp.OperationName("Searcher Client"),
@@ -159,8 +211,13 @@ func textSearchStream(ctx context.Context, url string, body []byte, cb func([]*p
 		return false, errors.Wrap(err, "streaming searcher request failed")
 	}
 	defer resp.Body.Close()
+	respBody, err := decompressBody(resp)
+	if err != nil {
+		return false, errors.Wrap(err, "streaming searcher request failed")
+	}
+	defer respBody.Close()
 	if resp.StatusCode != 200 {
-		body, err := io.ReadAll(resp.Body)
+		body, err := io.ReadAll(respBody)
 		if err != nil {
 			return false, err
 		}
@@ -177,18 +234,75 @@ func textSearchStream(ctx context.Context, url string, body []byte, cb func([]*p
 			err = errors.Errorf("unknown event %q", event)
 		},
 	}
-	if err := dec.ReadAll(resp.Body); err != nil {
+	if err := dec.ReadAll(respBody); err != nil {
 		return false, err
 	}
+	if ed.ProfileID != "" {
+		if span := ht.Span(); span != nil {
+			span.LogFields(otlog.String("profile", ed.ProfileID))
+		}
+		log15.Info("searcher: captured CPU profile of search", "searcher", url, "profile", ed.ProfileID)
+	}
+	if ed.FilesTooLarge > 0 {
+		if span := ht.Span(); span != nil {
+			span.LogFields(otlog.Int("filesTooLarge", ed.FilesTooLarge))
+		}
+	}
+	if len(ed.LimitReasons) > 0 {
+		if span := ht.Span(); span != nil {
+			reasons := make([]string, len(ed.LimitReasons))
+			for i, r := range ed.LimitReasons {
+				reasons[i] = string(r)
+			}
+			span.LogFields(otlog.String("limitReasons", strings.Join(reasons, ",")))
+		}
+	}
+	if ed.Stats != nil {
+		if span := ht.Span(); span != nil {
+			span.LogFields(
+				otlog.Int("stats.filesSearched", ed.Stats.FilesSearched),
+				otlog.Int("stats.filesPrefiltered", ed.Stats.FilesPrefiltered),
+				otlog.Int64("stats.bytesSearched", ed.Stats.BytesSearched),
+				otlog.Int64("stats.fetchTimeMs", ed.Stats.FetchTimeMs),
+				otlog.Int64("stats.wallTimeMs", ed.Stats.WallTimeMs),
+				otlog.Int64("stats.cpuTimeMs", ed.Stats.CPUTimeMs),
+			)
+			for reason, n := range ed.Stats.FilesSkipped {
+				span.LogFields(otlog.Int("stats.filesSkipped."+reason, n))
+			}
+		}
+	}
 	if ed.Error != "" {
 		return false, errors.New(ed.Error)
 	}
 	if ed.DeadlineHit {
+		if span := ht.Span(); span != nil {
+			span.LogFields(otlog.Int("filesScanned", ed.FilesScanned), otlog.Int("filesTotal", ed.FilesTotal))
+		}
 		err = context.DeadlineExceeded
 	}
 	return ed.LimitHit, err
 }
 
+// decompressBody returns a reader of the body of resp decoded according to
+// its Content-Encoding.
+func decompressBody(resp *http.Response) (io.ReadCloser, error) {
+	switch resp.Header.Get("Content-Encoding") {
+	case "":
+		return io.NopCloser(resp.Body), nil
+	case "gzip":
+		return gzip.NewReader(resp.Body)
+	case "zstd":
+		dec, err := zstd.NewReader(resp.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return nil, errors.Errorf("unsupported content encoding %q", resp.Header.Get("Content-Encoding"))
+	}
+}
+
 type searcherError struct {
 	StatusCode int
 	Message    string
@@ -0,0 +1,24 @@
+package searcher
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/internal/search"
+)
+
+func TestIncludePatterns(t *testing.T) {
+	p := &search.TextPatternInfo{
+		IncludePatterns: []string{`^cmd/`, search.LangToFileRegexp("go"), search.LangToFileRegexp("Shell")},
+		Languages:       []string{"go", "Shell"},
+	}
+	if diff := cmp.Diff([]string{`^cmd/`}, includePatterns(p)); diff != "" {
+		t.Fatalf("unexpected include patterns (-want +got):\n%s", diff)
+	}
+
+	p.IsStructuralPat = true
+	if diff := cmp.Diff(p.IncludePatterns, includePatterns(p)); diff != "" {
+		t.Fatalf("unexpected include patterns for structural search (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,116 @@
+package searcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/endpoint"
+)
+
+// Prefetch fetches archives into the caches of searcher ahead of searches,
+// for example to warm the caches after a restart. Each archive is fetched by
+// the replica its searches are sent to first, like Search hashes repo@commit
+// onto searcherURLs. The i-th error is the error fetching archives[i], or
+// empty if it is cached. Archives still being fetched when the deadline of ctx
+// is hit keep being fetched in the background.
+func Prefetch(ctx context.Context, searcherURLs *endpoint.Map, archives []protocol.Archive) ([]string, error) {
+	keys := make([]string, len(archives))
+	for i, a := range archives {
+		keys[i] = string(a.Repo) + "@" + string(a.Commit)
+	}
+	urls, err := searcherURLs.GetMany(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The indexes of archives to send to each replica, in batches of at most
+	// protocol.MaxPrefetchArchives.
+	batches := map[string][][]int{}
+	for i, url := range urls {
+		b := batches[url]
+		if len(b) == 0 || len(b[len(b)-1]) == protocol.MaxPrefetchArchives {
+			b = append(b, nil)
+		}
+		b[len(b)-1] = append(b[len(b)-1], i)
+		batches[url] = b
+	}
+
+	var deadline string
+	if d, ok := ctx.Deadline(); ok {
+		t, err := d.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		deadline = string(t)
+	}
+
+	errs := make([]string, len(archives))
+	var wg sync.WaitGroup
+	for url, b := range batches {
+		for _, indexes := range b {
+			wg.Add(1)
+			go func(url string, indexes []int) {
+				defer wg.Done()
+
+				req := protocol.PrefetchRequest{Archives: make([]protocol.Archive, len(indexes)), Deadline: deadline}
+				for j, i := range indexes {
+					req.Archives[j] = archives[i]
+				}
+				batchErrs, err := prefetch(ctx, url, &req)
+				for j, i := range indexes {
+					if err != nil {
+						errs[i] = err.Error()
+					} else {
+						errs[i] = batchErrs[j]
+					}
+				}
+			}(url, indexes)
+		}
+	}
+	wg.Wait()
+	return errs, nil
+}
+
+// prefetch sends req to the searcher at url and returns the errors of its
+// archives.
+func prefetch(ctx context.Context, url string, req *protocol.PrefetchRequest) ([]string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	hreq, err := http.NewRequest("POST", strings.TrimSuffix(url, "/")+"/prefetch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+
+	resp, err := searchDoer.Do(hreq.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "prefetch searcher request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.WithStack(&searcherError{StatusCode: resp.StatusCode, Message: string(msg)})
+	}
+
+	var pr protocol.PrefetchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+		return nil, errors.Wrap(err, "failed to decode prefetch response")
+	}
+	if len(pr.Errors) != len(req.Archives) {
+		return nil, errors.Errorf("prefetch response has %d errors for %d archives", len(pr.Errors), len(req.Archives))
+	}
+	return pr.Errors, nil
+}
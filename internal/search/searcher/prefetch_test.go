@@ -0,0 +1,85 @@
+package searcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/cmd/searcher/protocol"
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/endpoint"
+)
+
+func TestPrefetch(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string][]protocol.Archive{}
+	newSearcher := func() *httptest.Server {
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/prefetch" {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			var req protocol.PrefetchRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			received[srv.URL] = append(received[srv.URL], req.Archives...)
+			mu.Unlock()
+
+			resp := protocol.PrefetchResponse{Errors: make([]string, len(req.Archives))}
+			for i, a := range req.Archives {
+				if a.Repo == "bad" {
+					resp.Errors[i] = "repo not found"
+				}
+			}
+			_ = json.NewEncoder(w).Encode(resp)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	a, b := newSearcher(), newSearcher()
+	searcherURLs := endpoint.Static(a.URL, b.URL)
+
+	var archives []protocol.Archive
+	for i := 0; i < 20; i++ {
+		archives = append(archives, protocol.Archive{Repo: api.RepoName(fmt.Sprintf("repo%d", i)), Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"})
+	}
+	archives = append(archives, protocol.Archive{Repo: "bad", Commit: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"})
+
+	errs, err := Prefetch(context.Background(), searcherURLs, archives)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]string, len(archives))
+	want[len(want)-1] = "repo not found"
+	if diff := cmp.Diff(want, errs); diff != "" {
+		t.Fatalf("unexpected errors (-want +got):\n%s", diff)
+	}
+
+	// Each archive is fetched by the searcher its searches are sent to.
+	total := 0
+	for url, got := range received {
+		for _, a := range got {
+			owner, err := searcherURLs.Get(string(a.Repo) + "@" + string(a.Commit))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if owner != url {
+				t.Errorf("%s was sent to %s, want %s", a.Repo, url, owner)
+			}
+		}
+		total += len(got)
+	}
+	if total != len(archives) {
+		t.Errorf("searchers received %d archives, want %d", total, len(archives))
+	}
+}
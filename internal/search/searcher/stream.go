@@ -55,4 +55,46 @@ type EventDone struct {
 	LimitHit    bool   `json:"limit_hit"`
 	DeadlineHit bool   `json:"deadline_hit"`
 	Error       string `json:"error"`
+	// LimitReasons are the reasons the results of the search may be
+	// incomplete, including the reasons of its file and line matches.
+	LimitReasons []protocol.LimitReason `json:"limit_reasons,omitempty"`
+	// ProfileID is the ID of the CPU profile captured for the search, if
+	// requested.
+	ProfileID string `json:"profile_id,omitempty"`
+	// FilesTooLarge is the number of files which were skipped because they
+	// are larger than the MaxFileSizeBytes of the request.
+	FilesTooLarge int `json:"files_too_large,omitempty"`
+	// FilesScanned and FilesTotal report how much of the archive was
+	// searched. FilesScanned is less than FilesTotal if the search stopped
+	// early, for example because DeadlineHit is true.
+	FilesScanned int `json:"files_scanned,omitempty"`
+	FilesTotal   int `json:"files_total,omitempty"`
+	// Stats describe the work done by the search.
+	Stats *SearchStats `json:"stats,omitempty"`
+}
+
+// SearchStats describe the work done by a search, to understand slow
+// searches.
+type SearchStats struct {
+	// FilesSearched is the number of files whose content was searched.
+	FilesSearched int `json:"files_searched"`
+	// FilesSkipped is the number of files which weren't searched by reason:
+	// "path" for files not matching the path patterns, "filter" for ignored,
+	// vendored or other language files, "too_large" for files larger than
+	// the maximum file size and "index" for files pruned with the trigram
+	// index of the archive.
+	FilesSkipped map[string]int `json:"files_skipped,omitempty"`
+	// FilesPrefiltered is the number of searched files which were rejected
+	// because they don't contain a literal required by the pattern, without
+	// running the regular expression.
+	FilesPrefiltered int `json:"files_prefiltered"`
+	// BytesSearched is the size of the content of the searched files.
+	BytesSearched int64 `json:"bytes_searched"`
+	// FetchTimeMs is the time spent waiting for the archive to be fetched.
+	FetchTimeMs int64 `json:"fetch_time_ms"`
+	// WallTimeMs is the duration of the search, including FetchTimeMs.
+	WallTimeMs int64 `json:"wall_time_ms"`
+	// CPUTimeMs is the time spent searching files summed over the concurrent
+	// workers of the search, which approximates its CPU time.
+	CPUTimeMs int64 `json:"cpu_time_ms"`
 }
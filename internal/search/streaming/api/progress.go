@@ -42,6 +42,10 @@ type ProgressStats struct {
 
 	LimitHit bool
 
+	// Queued is true if the search had to wait for other searches of the
+	// user to finish.
+	Queued bool
+
 	// SuggestedLimit is what to suggest to the user for count if needed.
 	SuggestedLimit int
 
@@ -185,6 +189,19 @@ func excludedArchiveHandler(resultsResolver ProgressStats) (Skipped, bool) {
 	}, true
 }
 
+func searchQueuedHandler(resultsResolver ProgressStats) (Skipped, bool) {
+	if !resultsResolver.Queued {
+		return Skipped{}, false
+	}
+
+	return Skipped{
+		Reason:   SearchQueued,
+		Title:    "search queued",
+		Message:  "You are running too many searches of unindexed repositories at the same time, so this search waited for one of them to finish.",
+		Severity: SeverityInfo,
+	}, true
+}
+
 // TODO implement all skipped reasons
 var skippedHandlers = []func(stats ProgressStats) (Skipped, bool){
 	repositoryMissingHandler,
@@ -196,6 +213,7 @@ var skippedHandlers = []func(stats ProgressStats) (Skipped, bool){
 	excludedForkHandler,
 	excludedArchiveHandler,
 	displayLimitHandler,
+	searchQueuedHandler,
 }
 
 func number(i int) string {
@@ -80,6 +80,10 @@ const (
 	// ExcludedArchive is when we did not search a repository because it is
 	// archived.
 	ExcludedArchive SkippedReason = "excluded-archive"
+	// SearchQueued is when the search had to wait before searching
+	// unindexed repositories because the user reached their limit of
+	// concurrent searches. Nothing is skipped, but results are delayed.
+	SearchQueued SkippedReason = "search-queued"
 )
 
 // SkippedSeverity is an enum for Skipped.Severity.
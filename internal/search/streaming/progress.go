@@ -33,6 +33,10 @@ type Stats struct {
 
 	// IsIndexUnavailable is true if indexed search was unavailable.
 	IsIndexUnavailable bool
+
+	// IsQueued is true if the search had to wait because the user reached
+	// their limit of concurrent searches.
+	IsQueued bool
 }
 
 // update updates c with the other data, deduping as necessary. It modifies c but
@@ -44,6 +48,7 @@ func (c *Stats) Update(other *Stats) {
 
 	c.IsLimitHit = c.IsLimitHit || other.IsLimitHit
 	c.IsIndexUnavailable = c.IsIndexUnavailable || other.IsIndexUnavailable
+	c.IsQueued = c.IsQueued || other.IsQueued
 
 	if c.Repos == nil && len(other.Repos) > 0 {
 		c.Repos = make(map[api.RepoID]types.RepoName, len(other.Repos))
@@ -70,7 +75,8 @@ func (c *Stats) Zero() bool {
 		c.Status.Len() > 0 ||
 		c.ExcludedForks > 0 ||
 		c.ExcludedArchived > 0 ||
-		c.IsIndexUnavailable)
+		c.IsIndexUnavailable ||
+		c.IsQueued)
 }
 
 func (c *Stats) String() string {
@@ -100,6 +106,9 @@ func (c *Stats) String() string {
 	if c.IsIndexUnavailable {
 		parts = append(parts, "indexUnavailable")
 	}
+	if c.IsQueued {
+		parts = append(parts, "queued")
+	}
 
 	return "Stats{" + strings.Join(parts, " ") + "}"
 }
@@ -80,7 +80,22 @@ func SearchFilesInRepos(ctx context.Context, args *search.TextParameters, stream
 			PatternInfo:     args.PatternInfo,
 			UseFullDeadline: args.UseFullDeadline,
 		}
-		return callSearcherOverRepos(ctx, searcherArgs, stream, request.UnindexedRepos(), false)
+
+		unindexedRepos := request.UnindexedRepos()
+		if len(unindexedRepos) == 0 {
+			return nil
+		}
+
+		release, err := userLimiter.acquire(ctx, maxConcurrentUnindexedSearchesPerUser(), func() {
+			tr.LogFields(otlog.Bool("queued", true))
+			stream.Send(streaming.SearchEvent{Stats: streaming.Stats{IsQueued: true}})
+		})
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		return callSearcherOverRepos(ctx, searcherArgs, stream, unindexedRepos, false)
 	})
 
 	return g.Wait()
@@ -124,8 +139,10 @@ func searchFilesInRepo(ctx context.Context, searcherURLs *endpoint.Map, repo typ
 		return false, err
 	}
 
+	// Searcher uses the indexer endpoints for indexed structural search, and
+	// to get archives of indexed commits from zoekt instead of gitserver.
 	var indexerEndpoints []string
-	if info.IsStructuralPat {
+	if info.IsStructuralPat || search.Indexers().Enabled() {
 		indexerEndpoints, err = search.Indexers().Map.Endpoints()
 		if err != nil {
 			return false, err
@@ -0,0 +1,200 @@
+package unindexed
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/sourcegraph/sourcegraph/internal/actor"
+	"github.com/sourcegraph/sourcegraph/internal/conf"
+	"github.com/sourcegraph/sourcegraph/internal/redispool"
+	"github.com/sourcegraph/sourcegraph/internal/search"
+)
+
+var (
+	userSearchQueued = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "src_search_unindexed_user_queued_total",
+		Help: "The number of unindexed searches queued because the user reached their concurrency limit.",
+	})
+	userSearchQueueDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "src_search_unindexed_user_queue_duration_seconds",
+		Help:    "The time queued unindexed searches waited for a slot of their user.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	})
+)
+
+// userLimiter is the limiter on the number of concurrent unindexed searches of
+// a single user, shared by all frontend replicas.
+var userLimiter = &userSearchLimiter{
+	leases:       &redisLeaseStore{pool: redispool.Cache},
+	leaseTTL:     30 * time.Second,
+	pollInterval: 500 * time.Millisecond,
+}
+
+// leaseStore stores the leases of the searches of each user, which expire
+// unless they are renewed, so that the slots of crashed replicas are freed.
+type leaseStore interface {
+	// acquire adds a lease with the given ID for the user, unless the user
+	// already has limit unexpired leases.
+	acquire(ctx context.Context, userID int32, leaseID string, limit int, ttl time.Duration) (bool, error)
+	// renew extends the expiry of the lease.
+	renew(ctx context.Context, userID int32, leaseID string, ttl time.Duration) error
+	// release removes the lease.
+	release(ctx context.Context, userID int32, leaseID string) error
+}
+
+type userSearchLimiter struct {
+	leases       leaseStore
+	leaseTTL     time.Duration
+	pollInterval time.Duration
+}
+
+// acquire waits until the actor of ctx can run another unindexed search and
+// returns a function that must be called once the search is done. If the
+// search has to wait, onQueued is called once before waiting.
+//
+// Only authenticated users are limited. If the lease store is unavailable,
+// searches are not limited either, so that an outage of the store doesn't
+// take down search.
+func (l *userSearchLimiter) acquire(ctx context.Context, limit int, onQueued func()) (release func(), err error) {
+	noop := func() {}
+
+	a := actor.FromContext(ctx)
+	if limit <= 0 || !a.IsAuthenticated() || a.IsInternal() {
+		return noop, nil
+	}
+
+	leaseID := uuid.New().String()
+	var queuedAt time.Time
+	for {
+		ok, err := l.leases.acquire(ctx, a.UID, leaseID, limit, l.leaseTTL)
+		if err != nil {
+			log15.Warn("Failed to acquire search slot, not limiting search", "user", a.UID, "error", err)
+			return noop, nil
+		}
+		if ok {
+			break
+		}
+
+		if queuedAt.IsZero() {
+			queuedAt = time.Now()
+			userSearchQueued.Inc()
+			onQueued()
+		}
+
+		select {
+		case <-time.After(l.pollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if !queuedAt.IsZero() {
+		userSearchQueueDuration.Observe(time.Since(queuedAt).Seconds())
+	}
+
+	// Renew the lease while the search runs, so that it only expires if this
+	// replica stops renewing it.
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(l.leaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := l.leases.renew(context.Background(), a.UID, leaseID, l.leaseTTL); err != nil {
+					log15.Warn("Failed to renew search slot", "user", a.UID, "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		if err := l.leases.release(context.Background(), a.UID, leaseID); err != nil {
+			log15.Warn("Failed to release search slot", "user", a.UID, "error", err)
+		}
+	}, nil
+}
+
+// maxConcurrentUnindexedSearchesPerUser returns the configured limit, or 0 if
+// unindexed searches are not limited per user.
+func maxConcurrentUnindexedSearchesPerUser() int {
+	return search.SearchLimits(conf.Get()).MaxConcurrentUnindexedSearchesPerUser
+}
+
+// redisLeaseStore stores the leases of a user in a sorted set scored by their
+// expiry time.
+type redisLeaseStore struct {
+	pool *redis.Pool
+}
+
+// acquireLeaseScript atomically removes the expired leases of a user and adds
+// a new lease if the user has fewer than the limit.
+//
+// KEYS[1]: the sorted set of leases of the user
+// ARGV[1]: the current time in milliseconds
+// ARGV[2]: the expiry of the new lease in milliseconds
+// ARGV[3]: the limit
+// ARGV[4]: the ID of the new lease
+// ARGV[5]: the TTL of the key in milliseconds
+var acquireLeaseScript = redis.NewScript(1, `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return 1
+`)
+
+func leaseKey(userID int32) string {
+	return "search:unindexed-leases:" + strconv.Itoa(int(userID))
+}
+
+func (s *redisLeaseStore) acquire(ctx context.Context, userID int32, leaseID string, limit int, ttl time.Duration) (bool, error) {
+	c, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	now := time.Now()
+	return redis.Bool(acquireLeaseScript.Do(c, leaseKey(userID), now.UnixMilli(), now.Add(ttl).UnixMilli(), limit, leaseID, ttl.Milliseconds()))
+}
+
+func (s *redisLeaseStore) renew(ctx context.Context, userID int32, leaseID string, ttl time.Duration) error {
+	c, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	key := leaseKey(userID)
+	if _, err := c.Do("ZADD", key, "XX", time.Now().Add(ttl).UnixMilli(), leaseID); err != nil {
+		return err
+	}
+	_, err = c.Do("PEXPIRE", key, ttl.Milliseconds())
+	return err
+}
+
+func (s *redisLeaseStore) release(ctx context.Context, userID int32, leaseID string) error {
+	c, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	_, err = c.Do("ZREM", leaseKey(userID), leaseID)
+	return err
+}
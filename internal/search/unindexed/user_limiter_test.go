@@ -0,0 +1,148 @@
+package unindexed
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/internal/actor"
+)
+
+type fakeLeaseStore struct {
+	mu     sync.Mutex
+	leases map[int32]map[string]struct{}
+	err    error
+}
+
+func (s *fakeLeaseStore) acquire(_ context.Context, userID int32, leaseID string, limit int, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false, s.err
+	}
+	if s.leases == nil {
+		s.leases = map[int32]map[string]struct{}{}
+	}
+	if s.leases[userID] == nil {
+		s.leases[userID] = map[string]struct{}{}
+	}
+	if len(s.leases[userID]) >= limit {
+		return false, nil
+	}
+	s.leases[userID][leaseID] = struct{}{}
+	return true, nil
+}
+
+func (s *fakeLeaseStore) renew(context.Context, int32, string, time.Duration) error { return nil }
+
+func (s *fakeLeaseStore) release(_ context.Context, userID int32, leaseID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.leases[userID], leaseID)
+	return nil
+}
+
+func (s *fakeLeaseStore) count(userID int32) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.leases[userID])
+}
+
+func TestUserSearchLimiter(t *testing.T) {
+	store := &fakeLeaseStore{}
+	l := &userSearchLimiter{leases: store, leaseTTL: time.Minute, pollInterval: time.Millisecond}
+
+	alice := actor.WithActor(context.Background(), actor.FromUser(1))
+	bob := actor.WithActor(context.Background(), actor.FromUser(2))
+
+	notQueued := func() { t.Fatal("unexpected queueing") }
+
+	releaseAlice, err := l.acquire(alice, 1, notQueued)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Other users are not limited by alice's searches.
+	releaseBob, err := l.acquire(bob, 1, notQueued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseBob()
+
+	// Alice's second search waits for her first search to finish.
+	queued := make(chan struct{})
+	acquired := make(chan func())
+	go func() {
+		release, err := l.acquire(alice, 1, func() { close(queued) })
+		if err != nil {
+			t.Error(err)
+			release = func() {}
+		}
+		acquired <- release
+	}()
+
+	<-queued
+	select {
+	case <-acquired:
+		t.Fatal("search acquired a slot while the limit was reached")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	releaseAlice()
+	release := <-acquired
+	release()
+
+	if have := store.count(1); have != 0 {
+		t.Fatalf("leases weren't released. have=%d", have)
+	}
+}
+
+func TestUserSearchLimiterCanceled(t *testing.T) {
+	l := &userSearchLimiter{leases: &fakeLeaseStore{}, leaseTTL: time.Minute, pollInterval: time.Millisecond}
+
+	ctx := actor.WithActor(context.Background(), actor.FromUser(1))
+	release, err := l.acquire(ctx, 1, func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(ctx)
+	_, err = l.acquire(ctx, 1, cancel)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error. want=%v have=%v", context.Canceled, err)
+	}
+}
+
+func TestUserSearchLimiterNotLimited(t *testing.T) {
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		limit int
+		err   error
+	}{
+		{name: "unlimited", ctx: actor.WithActor(context.Background(), actor.FromUser(1)), limit: 0},
+		{name: "anonymous", ctx: context.Background(), limit: 1},
+		{name: "internal", ctx: actor.WithInternalActor(context.Background()), limit: 1},
+		{name: "store unavailable", ctx: actor.WithActor(context.Background(), actor.FromUser(1)), limit: 1, err: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeLeaseStore{err: tt.err}
+			l := &userSearchLimiter{leases: store, leaseTTL: time.Minute, pollInterval: time.Millisecond}
+
+			// Exceed the limit without ever being queued.
+			for i := 0; i < 3; i++ {
+				release, err := l.acquire(tt.ctx, tt.limit, func() { t.Fatal("unexpected queueing") })
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer release()
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"time"
+)
+
+// archiveMemberSeparator separates the path of an archive in the repository
+// from the path of a member inside it, like in "outer.jar!inner/path".
+const archiveMemberSeparator = "!"
+
+type archiveFormat int
+
+const (
+	archiveNone archiveFormat = iota
+	archiveZip
+	archiveTar
+	archiveTarGz
+)
+
+// archiveFormatOf returns the format of the archive at path, based on its
+// extension.
+func archiveFormatOf(path string) archiveFormat {
+	path = strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(path, ".jar"), strings.HasSuffix(path, ".war"), strings.HasSuffix(path, ".ear"), strings.HasSuffix(path, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return archiveTarGz
+	case strings.HasSuffix(path, ".tar"):
+		return archiveTar
+	default:
+		return archiveNone
+	}
+}
+
+// ArchiveOf returns the path of the archive in the repository which contains
+// the file name, if name is the name of a member of an archive. The store
+// adds members when MaxArchiveDepth is positive.
+func ArchiveOf(name string) (archive string, ok bool) {
+	i := strings.Index(name, archiveMemberSeparator)
+	if i < 0 || archiveFormatOf(name[:i]) == archiveNone {
+		return "", false
+	}
+	return name[:i], true
+}
+
+// archiveLimits bound the expansion of the archives in a repository.
+type archiveLimits struct {
+	// maxDepth is the number of levels of nested archives expanded. Zero
+	// disables expansion.
+	maxDepth int
+	// maxSize is the maximum size of an archive in the repository, and of
+	// all members expanded from it.
+	maxSize int64
+}
+
+type archiveMember struct {
+	name string
+	data []byte
+}
+
+// archiveMembers returns the regular files of the archive data. Once the
+// total size of the files exceeds *budget the remaining files are dropped.
+func archiveMembers(format archiveFormat, data []byte, budget *int64) ([]archiveMember, error) {
+	var members []archiveMember
+	add := func(name string, r io.Reader) (bool, error) {
+		b, err := io.ReadAll(io.LimitReader(r, *budget+1))
+		if err != nil {
+			return false, err
+		}
+		if int64(len(b)) > *budget {
+			return false, nil
+		}
+		*budget -= int64(len(b))
+		members = append(members, archiveMember{name: name, data: b})
+		return true, nil
+	}
+
+	switch format {
+	case archiveZip:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			if f.UncompressedSize64 > uint64(*budget) {
+				break
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			ok, err := add(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+		}
+
+	case archiveTar, archiveTarGz:
+		var r io.Reader = bytes.NewReader(data)
+		if format == archiveTarGz {
+			gr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			defer gr.Close()
+			r = gr
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+				continue
+			}
+			if hdr.Size > *budget {
+				break
+			}
+			ok, err := add(hdr.Name, tr)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+		}
+	}
+	return members, nil
+}
+
+// copyArchiveMembers writes the searchable members of the archive data at
+// path to zw using the compression method, descending into nested archives up
+// to depth levels. Archives which can't be read are skipped, since they are
+// only a best effort addition to the files of the repository.
+func copyArchiveMembers(zw *zip.Writer, method uint16, path string, format archiveFormat, data []byte, modTime time.Time, depth int, budget *int64, largeFilePatterns []string, filter FilterFunc) error {
+	members, err := archiveMembers(format, data, budget)
+	if err != nil {
+		return nil
+	}
+
+	for _, m := range members {
+		name := path + archiveMemberSeparator + strings.TrimPrefix(m.name, "/")
+		format := archiveFormatOf(m.name)
+		expand := format != archiveNone && depth > 1
+		size := int64(len(m.data))
+		if expand {
+			// Like in copySearchable, archives are bounded by the budget
+			// rather than the size limit of the filter.
+			size = 0
+		}
+		if filter(&tar.Header{Name: name, Size: size}) {
+			continue
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   method,
+			Modified: modTime,
+		})
+		if err != nil {
+			return err
+		}
+
+		if expand {
+			if err := copyArchiveMembers(zw, method, name, format, m.data, modTime, depth-1, budget, largeFilePatterns, filter); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Like the files of the repository, only the names of large and
+		// binary members are searched.
+		if len(m.data) > maxFileSize && !ignoreSizeMax(name, largeFilePatterns) {
+			continue
+		}
+		head := m.data
+		if len(head) > 32*1024 {
+			head = head[:32*1024]
+		}
+		if bytes.IndexByte(head, 0x00) >= 0 && !hasUTF16BOM(head) {
+			continue
+		}
+		if _, err := w.Write(m.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
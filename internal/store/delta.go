@@ -0,0 +1,216 @@
+package store
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/inconshreveable/log15"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/search/ignore"
+	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
+)
+
+// baseArchive is a zip on disk which the zips of other commits of the same
+// repo can be built from.
+type baseArchive struct {
+	commit api.CommitID
+	path   string
+}
+
+// setBase records the zip at path of commit as the base of the delta zips
+// with baseKey.
+func (s *Store) setBase(baseKey string, commit api.CommitID, path string) {
+	if s.DiffFiles == nil || s.MaxDeltaFiles <= 0 {
+		return
+	}
+	s.bases.Store(baseKey, baseArchive{commit: commit, path: path})
+}
+
+// forgetBase stops using the zip at path as a base.
+func (s *Store) forgetBase(path string) {
+	s.bases.Range(func(k, v interface{}) bool {
+		if v.(baseArchive).path == path {
+			s.bases.Delete(k)
+		}
+		return true
+	})
+}
+
+// fetchDelta returns a reader of the zip of repo at commit built from the
+// files of the last zip prepared for another commit of repo, and the files
+// which changed between both commits. It returns nil if there is no such zip,
+// or if too many files changed for it to be cheaper than fetching the whole
+// archive.
+//
+// Files kept from the base zip keep the modification time of the base
+// commit.
+func (s *Store) fetchDelta(ctx context.Context, repo api.RepoName, commit api.CommitID, baseKey string, largeFilePatterns []string) (rc io.ReadCloser) {
+	// The diff of a commit only tells which submodules changed, not which
+	// of their files did.
+	if s.DiffFiles == nil || s.FetchTarPaths == nil || s.MaxDeltaFiles <= 0 || includeSubmodules(ctx) {
+		return nil
+	}
+	v, ok := s.bases.Load(baseKey)
+	if !ok {
+		return nil
+	}
+	base := v.(baseArchive)
+	if base.commit == commit {
+		return nil
+	}
+
+	span, ctx := ot.StartSpanFromContext(ctx, "Store.fetchDelta")
+	ext.Component.Set(span, "store")
+	span.SetTag("repo", repo)
+	span.SetTag("commit", commit)
+	span.SetTag("baseCommit", base.commit)
+	defer func() {
+		// Otherwise the span finishes when the zip is built.
+		if rc == nil {
+			span.Finish()
+		}
+	}()
+
+	modified, deleted, err := s.DiffFiles(ctx, repo, base.commit, commit)
+	if err != nil {
+		log15.Warn("failed to diff commits for delta archive", "repo", repo, "base", base.commit, "commit", commit, "error", err)
+		deltaArchives.WithLabelValues("error").Inc()
+		return nil
+	}
+	span.LogFields(otlog.Int("modified", len(modified)), otlog.Int("deleted", len(deleted)))
+	changed := make(map[string]struct{}, len(modified)+len(deleted))
+	for _, paths := range [][]string{modified, deleted} {
+		for _, p := range paths {
+			changed[p] = struct{}{}
+		}
+	}
+	// The base zip was filtered by the ignore file of its commit, so it
+	// lacks the files a changed ignore file no longer excludes.
+	if _, ok := changed[ignore.File]; ok || len(changed) > s.MaxDeltaFiles {
+		deltaArchives.WithLabelValues("skipped").Inc()
+		return nil
+	}
+
+	zf, err := s.ZipCache.Get(ctx, base.path)
+	if err != nil {
+		// The base was evicted or is corrupt.
+		s.bases.Delete(baseKey)
+		return nil
+	}
+
+	fetchQueueSize.Inc()
+	ctx, releaseFetchLimiter, err := s.fetchLimiter.Acquire(ctx)
+	fetchQueueSize.Dec()
+	if err != nil {
+		zf.Close()
+		return nil
+	}
+	ctx, releaseUpstreamLimiter, err := s.acquireUpstream(ctx, s.upstream(repo))
+	if err != nil {
+		zf.Close()
+		releaseFetchLimiter()
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.fetchTimeout())
+	done := func() {
+		zf.Close()
+		releaseUpstreamLimiter()
+		releaseFetchLimiter()
+		cancel()
+	}
+
+	filter := func(hdr *tar.Header) bool { return false }
+	if s.FilterTar != nil {
+		filter, err = s.FilterTar(ctx, repo, commit)
+		if err != nil {
+			done()
+			deltaArchives.WithLabelValues("error").Inc()
+			return nil
+		}
+	}
+
+	// An archive of no paths is an archive of the whole repository.
+	r := io.NopCloser(emptyTarReader())
+	if len(modified) > 0 {
+		r, err = s.FetchTarPaths(ctx, repo, commit, modified)
+		if err != nil {
+			log15.Warn("failed to fetch changed files for delta archive", "repo", repo, "commit", commit, "error", err)
+			done()
+			deltaArchives.WithLabelValues("error").Inc()
+			return nil
+		}
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer done()
+		defer r.Close()
+		zw, method := s.newZipWriter(pw)
+		err := copyBaseFiles(zw, method, zf, changed)
+		if err == nil {
+			err = copySearchable(tar.NewReader(r), "", zw, method, largeFilePatterns, filter, archiveLimits{maxDepth: s.MaxArchiveDepth, maxSize: s.MaxArchiveSize})
+		}
+		if err == nil {
+			err = zw.SetComment(archiveComment(repo, commit))
+		}
+		if err1 := zw.Close(); err == nil {
+			err = err1
+		}
+		if err != nil {
+			// Fetch the whole archive next time.
+			s.bases.Delete(baseKey)
+			deltaArchives.WithLabelValues("error").Inc()
+			ext.Error.Set(span, true)
+			span.SetTag("err", err.Error())
+		} else {
+			deltaArchives.WithLabelValues("built").Inc()
+		}
+		span.Finish()
+		// CloseWithError is guaranteed to return a nil error
+		_ = pw.CloseWithError(errors.Wrapf(err, "failed to build %s@%s from %s", repo, commit, base.commit))
+	}()
+	return pr
+}
+
+// copyBaseFiles copies the files of zf to zw, except the changed files and
+// the members of changed archives.
+func copyBaseFiles(zw *zip.Writer, method uint16, zf *ZipFile, changed map[string]struct{}) error {
+	for i := range zf.Files {
+		f := &zf.Files[i]
+		if _, ok := changed[f.Name]; ok {
+			continue
+		}
+		if archive, ok := ArchiveOf(f.Name); ok {
+			if _, ok := changed[archive]; ok {
+				continue
+			}
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.Name,
+			Method:   method,
+			Modified: time.Unix(f.ModTime, 0),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(zf.DataFor(f)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emptyTarReader returns a reader of a tar archive without files.
+func emptyTarReader() io.Reader {
+	var buf bytes.Buffer
+	_ = tar.NewWriter(&buf).Close()
+	return &buf
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestPrepareZip_delta(t *testing.T) {
+	const (
+		base = api.CommitID("deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+		head = api.CommitID("feedfacefeedfacefeedfacefeedfacefeedface")
+	)
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	s.MaxDeltaFiles = 10
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		if commit != base {
+			t.Errorf("fetched the whole archive of %s", commit)
+		}
+		var buf bytes.Buffer
+		writeTar(t, &buf, map[string]string{
+			"README":  "hi",
+			"main.go": "package main",
+			"old.go":  "package old",
+		})
+		return io.NopCloser(&buf), nil
+	}
+	s.DiffFiles = func(ctx context.Context, repo api.RepoName, b, h api.CommitID) ([]string, []string, error) {
+		if b != base || h != head {
+			t.Errorf("got diff of %s..%s, want %s..%s", b, h, base, head)
+		}
+		return []string{"main.go", "new.go"}, []string{"old.go"}, nil
+	}
+	s.FetchTarPaths = func(ctx context.Context, repo api.RepoName, commit api.CommitID, paths []string) (io.ReadCloser, error) {
+		if want := []string{"main.go", "new.go"}; commit != head || !reflect.DeepEqual(paths, want) {
+			t.Errorf("fetched %v of %s, want %v of %s", paths, commit, want, head)
+		}
+		var buf bytes.Buffer
+		writeTar(t, &buf, map[string]string{
+			"main.go": "package main // changed",
+			"new.go":  "package new",
+		})
+		return io.NopCloser(&buf), nil
+	}
+
+	if _, err := s.PrepareZip(context.Background(), "foo", base); err != nil {
+		t.Fatal(err)
+	}
+	path, err := s.PrepareZip(context.Background(), "foo", head)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zf, err := s.ZipCache.Get(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zf.Close()
+	got := map[string]string{}
+	var names []string
+	for i := range zf.Files {
+		got[zf.Files[i].Name] = string(zf.DataFor(&zf.Files[i]))
+		names = append(names, zf.Files[i].Name)
+	}
+	want := map[string]string{
+		"README":  "hi",
+		"main.go": "package main // changed",
+		"new.go":  "package new",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected files (-want +got):\n%s", diff)
+	}
+	if len(names) != len(want) {
+		t.Errorf("got duplicate files %v", names)
+	}
+}
@@ -0,0 +1,373 @@
+package store
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/internal/diskcache"
+	"github.com/sourcegraph/sourcegraph/internal/encryption"
+)
+
+// Encrypted zips start with encryptedMagic, followed by the version of the key
+// of the store and the data key of the zip encrypted with the key, each
+// preceded by its length as a big endian uint32, and a random nonce prefix. The zip follows
+// in chunks of encryptedChunkSize bytes, each sealed with AES-256-GCM under
+// the data key. The nonce of a chunk is the prefix, the index of the chunk as
+// a big endian uint32 and a byte which is 1 for the last chunk and 0
+// otherwise, so that chunks can't be reordered or dropped.
+const (
+	encryptedMagic     = "SGZIPENC1\n"
+	encryptedChunkSize = 64 * 1024
+	noncePrefixSize    = 7
+
+	// decryptKeyTimeout bounds how long decrypting the data key of a zip,
+	// which may call a KMS, can take. ZipCache holds a lock meanwhile.
+	decryptKeyTimeout = 30 * time.Second
+)
+
+// archiveKey is the key which encrypts the zips of a store, and the version of
+// the key recorded in the zips it encrypts. The zero value disables
+// encryption.
+type archiveKey struct {
+	key     encryption.Key
+	version string
+}
+
+// SetEncryptionKey sets the key which encrypts the zips written to disk, each
+// with a data key of its own encrypted with key. A nil key disables
+// encryption. Like compressed zips, encrypted zips are decrypted into memory
+// when they are opened. Trigram indexes, which reveal the content of the
+// files, aren't built.
+//
+// Zips which aren't encrypted are removed when a key is set. Zips encrypted
+// with another key, or with any key once encryption is disabled, are treated
+// as corrupt and fetched again, so the key can be changed at any time without
+// evicting the cache.
+func (s *Store) SetEncryptionKey(ctx context.Context, key encryption.Key) error {
+	if key == nil {
+		s.ZipCache.setKey(archiveKey{})
+		return nil
+	}
+	v, err := key.Version(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get encryption key version")
+	}
+	s.ZipCache.setKey(archiveKey{key: key, version: v.JSON()})
+	s.removePlaintext()
+	return nil
+}
+
+// isEncrypted returns whether data starts like an encrypted zip.
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedMagic))
+}
+
+// encrypt returns a reader of the zip read from r encrypted with a new data
+// key, itself encrypted with k. Zips which are already encrypted, like the
+// zips downloaded from peers, are returned as they are.
+func encrypt(ctx context.Context, k archiveKey, r io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(encryptedMagic)); isEncrypted(magic) {
+		return readCloser{Reader: br, Closer: r}, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		r.Close()
+		return nil, err
+	}
+	wrappedKey, err := k.key.Encrypt(ctx, dataKey)
+	if err != nil {
+		r.Close()
+		return nil, errors.Wrap(err, "failed to encrypt data key")
+	}
+	ew, err := newEncryptWriter(dataKey)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer r.Close()
+		err := writeEncryptedHeader(pw, k.version, wrappedKey, ew.prefix[:])
+		if err == nil {
+			ew.w = pw
+			_, err = io.Copy(ew, br)
+		}
+		if err == nil {
+			err = ew.Close()
+		}
+		// CloseWithError is guaranteed to return a nil error
+		_ = pw.CloseWithError(errors.Wrap(err, "failed to encrypt archive"))
+	}()
+	return pr, nil
+}
+
+// encrypting returns fetcher, with the zips it returns encrypted if an
+// encryption key is set when they are fetched.
+func (s *Store) encrypting(fetcher diskcache.Fetcher) diskcache.Fetcher {
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		k := s.ZipCache.encryptionKey()
+		rc, err := fetcher(ctx)
+		if err != nil || k.key == nil {
+			return rc, err
+		}
+		return encrypt(ctx, k, rc)
+	}
+}
+
+// removePlaintext removes the zips on disk which aren't encrypted, like the
+// zips written before the encryption key was set.
+func (s *Store) removePlaintext() {
+	paths, err := filepath.Glob(filepath.Join(s.Path, "*.zip"))
+	if err != nil {
+		log.Printf("failed to list zips to encrypt: %s", err)
+		return
+	}
+	removed := 0
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		magic := make([]byte, len(encryptedMagic))
+		_, err = io.ReadFull(f, magic)
+		f.Close()
+		if err == nil && isEncrypted(magic) {
+			continue
+		}
+		if err := s.remove(path); err != nil {
+			log.Printf("failed to remove unencrypted %s: %s", path, err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("removed %d unencrypted zips", removed)
+	}
+}
+
+// ReadableArchives returns whether the zips on disk can be read by other
+// programs, like comby. They can't if they are compressed or encrypted.
+func (s *Store) ReadableArchives() bool {
+	return !s.CompressArchives && s.ZipCache.encryptionKey().key == nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func writeEncryptedHeader(w io.Writer, version string, wrappedKey, noncePrefix []byte) error {
+	var header bytes.Buffer
+	header.WriteString(encryptedMagic)
+	_ = binary.Write(&header, binary.BigEndian, uint32(len(version)))
+	header.WriteString(version)
+	_ = binary.Write(&header, binary.BigEndian, uint32(len(wrappedKey)))
+	header.Write(wrappedKey)
+	header.Write(noncePrefix)
+	_, err := w.Write(header.Bytes())
+	return err
+}
+
+// encryptWriter seals what is written to it in chunks. Close seals the last
+// chunk, which may be empty.
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  [noncePrefixSize]byte
+	counter uint32
+	buf     []byte
+}
+
+func newEncryptWriter(dataKey []byte) (*encryptWriter, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	ew := &encryptWriter{aead: aead, buf: make([]byte, 0, encryptedChunkSize)}
+	if _, err := rand.Read(ew.prefix[:]); err != nil {
+		return nil, err
+	}
+	return ew, nil
+}
+
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, since we
+		// don't know yet whether it is the last one.
+		if len(ew.buf) == encryptedChunkSize {
+			if err := ew.seal(false); err != nil {
+				return 0, err
+			}
+		}
+		m := copy(ew.buf[len(ew.buf):encryptedChunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+m]
+		p = p[m:]
+	}
+	return n, nil
+}
+
+func (ew *encryptWriter) Close() error {
+	return ew.seal(true)
+}
+
+func (ew *encryptWriter) seal(last bool) error {
+	sealed := ew.aead.Seal(nil, chunkNonce(ew.prefix[:], ew.counter, last), ew.buf, nil)
+	ew.counter++
+	ew.buf = ew.buf[:0]
+	_, err := ew.w.Write(sealed)
+	return err
+}
+
+// keyError is returned by decrypt for a data key which couldn't be decrypted
+// with the key which encrypted it. Unlike the other errors of decrypt, it may
+// be transient, like the KMS being unavailable, so it doesn't make the zip
+// corrupt.
+type keyError struct {
+	err error
+}
+
+func (e *keyError) Error() string {
+	return "failed to decrypt data key: " + e.err.Error()
+}
+
+func (e *keyError) Unwrap() error {
+	return e.err
+}
+
+// decrypt returns the zip in data, an encrypted zip whose data key was
+// encrypted with k.
+func decrypt(ctx context.Context, k archiveKey, data []byte) ([]byte, error) {
+	if k.key == nil {
+		return nil, errors.New("archive is encrypted but no encryption key is configured")
+	}
+	data = data[len(encryptedMagic):]
+	version, data, err := readLengthPrefixed(data)
+	if err != nil {
+		return nil, err
+	}
+	if string(version) != k.version {
+		return nil, errors.Errorf("archive was encrypted with key %s, not with key %s", version, k.version)
+	}
+	wrappedKey, data, err := readLengthPrefixed(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < noncePrefixSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	prefix := data[:noncePrefixSize]
+	data = data[noncePrefixSize:]
+
+	ctx, cancel := context.WithTimeout(ctx, decryptKeyTimeout)
+	defer cancel()
+	dataKey, err := k.key.Decrypt(ctx, wrappedKey)
+	if err != nil {
+		return nil, &keyError{err: err}
+	}
+
+	aead, err := newAEAD([]byte(dataKey.Secret()))
+	if err != nil {
+		return nil, err
+	}
+	sealedChunkSize := encryptedChunkSize + aead.Overhead()
+	plain := make([]byte, 0, len(data)/sealedChunkSize*encryptedChunkSize+encryptedChunkSize)
+	for counter := uint32(0); ; counter++ {
+		last := len(data) <= sealedChunkSize
+		chunk := data
+		if !last {
+			chunk = data[:sealedChunkSize]
+		}
+		plain, err = aead.Open(plain, chunkNonce(prefix, counter, last), chunk, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decrypt chunk %d", counter)
+		}
+		if last {
+			return plain, nil
+		}
+		data = data[sealedChunkSize:]
+	}
+}
+
+// readLengthPrefixed returns the bytes at the start of data preceded by their
+// length as a big endian uint32, and the rest of data.
+func readLengthPrefixed(data []byte) (b, rest []byte, err error) {
+	if len(data) < 4 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	n := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint64(len(data)) < uint64(n) {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	return data[:n], data[n:], nil
+}
+
+// readEncryptedZipFile returns a ZipFile holding the files of the encrypted
+// zip f at path of the given size in memory. The chunks of f are
+// authenticated, so the checksums of its files aren't checked. Errors other
+// than failing to decrypt the data key of f mean that it is corrupt.
+func readEncryptedZipFile(ctx context.Context, path string, f *os.File, size int64, k archiveKey) (*ZipFile, error) {
+	data := make([]byte, size)
+	if _, err := f.ReadAt(data, 0); err != nil {
+		return nil, err
+	}
+	plain, err := decrypt(ctx, k, data)
+	if err != nil {
+		var keyErr *keyError
+		if errors.As(err, &keyErr) {
+			return nil, err
+		}
+		return nil, &corruptZipError{path: path, err: err}
+	}
+	r, err := zip.NewReader(bytes.NewReader(plain), int64(len(plain)))
+	if err != nil {
+		return nil, &corruptZipError{path: path, err: err}
+	}
+	if isCompressed(r) {
+		zf, err := decompressZipFile(r)
+		if err != nil {
+			return nil, &corruptZipError{path: path, err: err}
+		}
+		return zf, nil
+	}
+	zf := &ZipFile{Data: plain}
+	if err := zf.PopulateFiles(r); err != nil {
+		return nil, &corruptZipError{path: path, err: err}
+	}
+	return zf, nil
+}
+
+func newAEAD(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
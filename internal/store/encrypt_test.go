@@ -0,0 +1,134 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/encryption"
+	et "github.com/sourcegraph/sourcegraph/internal/encryption/testing"
+)
+
+func TestEncrypt(t *testing.T) {
+	key := archiveKey{key: et.TestKey{}, version: "test"}
+	for _, size := range []int{0, 1, encryptedChunkSize, encryptedChunkSize + 1, 3 * encryptedChunkSize} {
+		plain := bytes.Repeat([]byte("x"), size)
+		r, err := encrypt(context.Background(), key, io.NopCloser(bytes.NewReader(plain)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := decrypt(context.Background(), key, encrypted)
+		if err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: got %d bytes back", size, len(got))
+		}
+
+		// Dropping the last chunk is detected.
+		if size > encryptedChunkSize {
+			last := size % encryptedChunkSize
+			if last == 0 {
+				last = encryptedChunkSize
+			}
+			truncated := encrypted[:len(encrypted)-last-16]
+			if _, err := decrypt(context.Background(), key, truncated); err == nil {
+				t.Errorf("size %d: truncated archive was decrypted", size)
+			}
+		}
+	}
+}
+
+func TestPrepareZip_encrypted(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	// Zips written before the key was set are removed.
+	plaintext := filepath.Join(s.Path, "plaintext.zip")
+	if err := os.WriteFile(plaintext, []byte("PK"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetEncryptionKey(context.Background(), et.TestKey{}); err != nil {
+		t.Fatal(err)
+	}
+	content := strings.Repeat("secret source\n", 10000)
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		var buf bytes.Buffer
+		writeTar(t, &buf, map[string]string{"main.go": content})
+		return io.NopCloser(&buf), nil
+	}
+
+	path, err := s.PrepareZip(context.Background(), "foo", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(data) || bytes.Contains(data, []byte("secret source")) {
+		t.Fatal("zip on disk is not encrypted")
+	}
+	if _, err := os.Stat(plaintext); !os.IsNotExist(err) {
+		t.Error("unencrypted zip was not removed")
+	}
+
+	zf, err := s.ZipCache.Get(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zf.Files) != 1 || string(zf.DataFor(&zf.Files[0])) != content {
+		t.Errorf("unexpected files %v", zf.Files)
+	}
+	zf.Close()
+	s.ZipCache.delete(path)
+
+	// Failing to decrypt the data key may be transient, so the zip is kept.
+	if err := s.SetEncryptionKey(context.Background(), unavailableKey{}); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = GetZipFileWithRetry(func() (string, *ZipFile, error) {
+		zf, err := s.ZipCache.Get(context.Background(), path)
+		return path, zf, err
+	})
+	if err == nil || isCorruptZip(err) {
+		t.Errorf("got error %v, want a key error", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("zip was removed: %s", err)
+	}
+
+	// Zips encrypted with another key are treated as corrupt, so that they
+	// are fetched again.
+	if err := s.SetEncryptionKey(context.Background(), otherKey{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ZipCache.Get(context.Background(), path); !isCorruptZip(err) {
+		t.Errorf("got error %v, want a corrupt zip error", err)
+	}
+}
+
+// unavailableKey is a TestKey whose KMS is unavailable.
+type unavailableKey struct{ et.TestKey }
+
+func (unavailableKey) Decrypt(context.Context, []byte) (*encryption.Secret, error) {
+	return nil, errors.New("kms unavailable")
+}
+
+// otherKey is a TestKey with another version.
+type otherKey struct{ et.TestKey }
+
+func (otherKey) Version(context.Context) (encryption.KeyVersion, error) {
+	return encryption.KeyVersion{Type: "otherkey"}, nil
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// Entry describes a zip in the disk cache.
+type Entry struct {
+	// Path is the path of the zip on disk.
+	Path string
+
+	// Repo and Commit are the repository and commit archived by the zip.
+	// They are empty for zips written before zips recorded them.
+	Repo   api.RepoName
+	Commit api.CommitID
+
+	// Size is the size of the zip on disk in bytes.
+	Size int64
+
+	// LastAccess is the time the zip was last prepared for a search.
+	LastAccess time.Time
+
+	// Open is true if the zip is held open in the ZipCache.
+	Open bool
+
+	// TrigramIndex is true if the zip has a trigram index on disk.
+	TrigramIndex bool
+}
+
+// Entries returns the zips in the disk cache, most recently accessed first.
+func (s *Store) Entries() ([]Entry, error) {
+	entries, err := os.ReadDir(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var list []Entry
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".zip") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			// Evicted since we read the directory.
+			continue
+		}
+		path := filepath.Join(s.Path, e.Name())
+		repo, commit := manifestOrComment(&s.manifest, path)
+		_, err = os.Stat(path + trigramIndexSuffix)
+		list = append(list, Entry{
+			Path:         path,
+			Repo:         repo,
+			Commit:       commit,
+			Size:         fi.Size(),
+			LastAccess:   fi.ModTime(),
+			Open:         s.ZipCache.has(path),
+			TrigramIndex: err == nil,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastAccess.After(list[j].LastAccess) })
+	return list, nil
+}
+
+// manifestOrComment returns the repo and commit of the zip at path from the
+// manifest, or else from the comment of the zip.
+func manifestOrComment(m *manifest, path string) (api.RepoName, api.CommitID) {
+	if e, ok := m.get(filepath.Base(path)); ok {
+		return e.Repo, e.Commit
+	}
+	repo, commit, _ := readArchiveComment(path)
+	return repo, commit
+}
+
+// EntriesHandler returns an HTTP handler which lists the zips in the disk
+// cache, for the debug server.
+func (s *Store) EntriesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list, err := s.Entries()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		var total int64
+		for _, e := range list {
+			total += e.Size
+		}
+		fmt.Fprintf(w, "%d archives, %d bytes on disk, %d bytes open in memory.<br>", len(list), total, s.ZipCache.size())
+		if len(list) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "<table><tr><th>Repo</th><th>Commit</th><th>Size</th><th>Last access</th><th>Open</th><th>Trigram index</th><th>File</th></tr>")
+		for _, e := range list {
+			fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%d</td><td>%s</td><td>%v</td><td>%v</td><td>%s</td></tr>",
+				html.EscapeString(string(e.Repo)), e.Commit, e.Size, e.LastAccess.Format(time.RFC3339), e.Open, e.TrigramIndex, html.EscapeString(filepath.Base(e.Path)))
+		}
+		fmt.Fprintf(w, "</table>")
+	})
+}
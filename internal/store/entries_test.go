@@ -0,0 +1,50 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestEntries(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		var buf bytes.Buffer
+		writeTar(t, &buf, map[string]string{"README": "hi"})
+		return io.NopCloser(&buf), nil
+	}
+	const commit = api.CommitID("deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	path, err := s.PrepareZip(context.Background(), "foo<bar>", commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf, err := s.ZipCache.Get(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf.Close()
+
+	list, err := s.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("got %d entries, want 1", len(list))
+	}
+	e := list[0]
+	if e.Path != path || e.Repo != "foo<bar>" || e.Commit != commit || e.Size == 0 || e.LastAccess.IsZero() || !e.Open || e.TrigramIndex {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	w := httptest.NewRecorder()
+	s.EntriesHandler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := w.Body.String(); !strings.Contains(body, "foo&lt;bar&gt;") || !strings.Contains(body, string(commit)) {
+		t.Errorf("unexpected listing:\n%s", body)
+	}
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// EvictRepo removes the zips of repo at commit from disk and from ZipCache,
+// or of all commits of repo if commit is empty. It waits for the searches
+// using the zips to finish. It returns the number of zips removed.
+//
+// Zips written before zips recorded their repo and commit are not found, and
+// copies in ObjectStore are kept.
+func (s *Store) EvictRepo(repo api.RepoName, commit api.CommitID) (int, error) {
+	entries, err := os.ReadDir(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".zip") {
+			continue
+		}
+		path := filepath.Join(s.Path, e.Name())
+		r, c := manifestOrComment(&s.manifest, path)
+		if r != repo || (commit != "" && c != commit) {
+			continue
+		}
+		if err := s.remove(path); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	evictedByRequest.Add(float64(removed))
+	return removed, nil
+}
+
+// remove removes the zip at path from disk, and everything the store knows
+// about it.
+func (s *Store) remove(path string) error {
+	s.forget(path)
+	s.inObjectStore.Delete(filepath.Base(path))
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
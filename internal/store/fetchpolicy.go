@@ -0,0 +1,181 @@
+package store
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/errcode"
+)
+
+// ErrCircuitOpen is returned in place of calling FetchTar once a number of
+// consecutive fetches from the same upstream have failed. It is temporary, so
+// searches fail fast with a 503 instead of waiting on a dead upstream.
+var ErrCircuitOpen error = temporaryError{error: errors.New("archive fetches are suspended after repeated failures")}
+
+// retryPolicy describes how many times and how eagerly a failed call to
+// FetchTar is re-attempted.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// do invokes f until it succeeds, returns a non-retryable error, or the maximum
+// number of attempts is reached. Between attempts it sleeps for an exponentially
+// increasing and fully jittered duration. The number of attempts made is returned
+// along with the error of the last attempt.
+func (p retryPolicy) do(ctx context.Context, f func() error) (attempts int, err error) {
+	for {
+		attempts++
+
+		if err = f(); err == nil || attempts >= p.maxAttempts || !isRetryableFetch(err) {
+			return attempts, err
+		}
+
+		timer := time.NewTimer(p.delay(attempts))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempts, err
+		}
+	}
+}
+
+// delay returns the duration to wait after the given (one-indexed) attempt.
+func (p retryPolicy) delay(attempt int) time.Duration {
+	delay := p.maxDelay
+	if shift := attempt - 1; shift < 32 {
+		if d := p.baseDelay << shift; d > 0 && d < delay {
+			delay = d
+		}
+	}
+
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// isRetryableFetch returns true if a fetch which failed with err may succeed
+// if it is re-attempted. Errors describing the repository or the request,
+// like a missing repository or commit, are not retried, nor are errors
+// resulting from the cancellation of the fetch or an open circuit breaker.
+func isRetryableFetch(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	return !errcode.IsNotFound(err) && !errcode.IsBadRequest(err) && !errcode.IsUnauthorized(err) && !errcode.IsNonRetryable(err)
+}
+
+// circuitBreaker stops calls to FetchTar for a cooldown period once threshold
+// consecutive calls have failed with a retryable error. After the cooldown, a
+// single probe call is let through: its success closes the circuit and its
+// failure re-opens it for another cooldown period.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns true if FetchTar may be called.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return false
+	}
+
+	b.probing = true
+	return true
+}
+
+// record updates the state of the breaker with the outcome of an allowed call.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// The fetch was abandoned; this says nothing about the upstream.
+
+	case err == nil || !isRetryableFetch(err):
+		b.failures = 0
+
+	default:
+		if b.failures++; b.failures >= b.threshold {
+			b.openUntil = b.now().Add(b.cooldown)
+		}
+	}
+}
+
+// breakerFor returns the circuit breaker of upstream, or nil if circuit
+// breaking is disabled.
+func (s *Store) breakerFor(upstream string) *circuitBreaker {
+	if s.FetchBreakerThreshold <= 0 {
+		return nil
+	}
+	if b, ok := s.breakers.Load(upstream); ok {
+		return b.(*circuitBreaker)
+	}
+	b, _ := s.breakers.LoadOrStore(upstream, newCircuitBreaker(s.FetchBreakerThreshold, s.FetchBreakerCooldown))
+	return b.(*circuitBreaker)
+}
+
+// fetchTar calls FetchTar, re-attempting failures which may be transient,
+// unless the circuit breaker of upstream, the upstream of repo, is open.
+func (s *Store) fetchTar(ctx context.Context, upstream string, repo api.RepoName, commit api.CommitID) (r io.ReadCloser, err error) {
+	b := s.breakerFor(upstream)
+	if b != nil && !b.allow() {
+		fetchCircuitOpen.Inc()
+		return nil, ErrCircuitOpen
+	}
+
+	policy := retryPolicy{
+		maxAttempts: s.FetchMaxAttempts,
+		baseDelay:   100 * time.Millisecond,
+		maxDelay:    5 * time.Second,
+	}
+	attempts, err := policy.do(ctx, func() error {
+		r, err = s.FetchTar(ctx, repo, commit)
+		return err
+	})
+	fetchRetries.Add(float64(attempts - 1))
+	if b != nil {
+		b.record(err)
+	}
+	return r, err
+}
+
+// fetchTimeout returns the time a fetch has to finish.
+func (s *Store) fetchTimeout() time.Duration {
+	if s.FetchTimeout > 0 {
+		return s.FetchTimeout
+	}
+	// We expect git archive, even for large repos, to finish relatively
+	// quickly.
+	return 2 * time.Minute
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(1587396557, 0).UTC()
+	breaker := newCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	unavailable := errors.New("connection refused")
+
+	breaker.record(unavailable)
+	breaker.record(context.Canceled)
+	if !breaker.allow() {
+		t.Fatalf("expected breaker to be closed below threshold")
+	}
+
+	breaker.record(unavailable)
+	if breaker.allow() {
+		t.Fatalf("expected breaker to be open at threshold")
+	}
+
+	now = now.Add(time.Minute)
+	if !breaker.allow() {
+		t.Fatalf("expected a probe to be allowed after cooldown")
+	}
+	if breaker.allow() {
+		t.Fatalf("expected only a single concurrent probe")
+	}
+
+	breaker.record(unavailable)
+	if breaker.allow() {
+		t.Fatalf("expected failed probe to re-open breaker")
+	}
+
+	now = now.Add(time.Minute)
+	if !breaker.allow() {
+		t.Fatalf("expected a probe to be allowed after cooldown")
+	}
+	breaker.record(badRequestError{"invalid commit"})
+	if !breaker.allow() {
+		t.Fatalf("expected successful probe to close breaker")
+	}
+}
+
+func TestPrepareZip_fetchRetry(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	s.FetchMaxAttempts = 3
+	calls := 0
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("connection reset by peer")
+		}
+		var buf bytes.Buffer
+		writeTar(t, &buf, map[string]string{"README": "hi"})
+		return io.NopCloser(&buf), nil
+	}
+	if _, err := s.PrepareZip(context.Background(), "foo", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("got %d calls to FetchTar, want 2", calls)
+	}
+}
+
+func TestPrepareZip_fetchCircuitOpen(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	s.FetchBreakerThreshold = 1
+	s.FetchBreakerCooldown = time.Hour
+	calls := 0
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		calls++
+		return nil, errors.New("connection refused")
+	}
+	if _, err := s.PrepareZip(context.Background(), "foo", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"); err == nil {
+		t.Fatal("expected PrepareZip to fail")
+	}
+	_, err := s.PrepareZip(context.Background(), "foo", "feedfacefeedfacefeedfacefeedfacefeedface")
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got error %v, want ErrCircuitOpen", err)
+	}
+	if calls != 1 {
+		t.Errorf("got %d calls to FetchTar, want 1", calls)
+	}
+}
+
+type badRequestError struct{ msg string }
+
+func (e badRequestError) Error() string    { return e.msg }
+func (e badRequestError) BadRequest() bool { return true }
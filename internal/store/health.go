@@ -0,0 +1,80 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"syscall"
+)
+
+// Health is a snapshot of the health of a store.
+type Health struct {
+	// DiskFreeBytes and DiskSizeBytes are the free space available to the
+	// store and the size of the disk of Path.
+	DiskFreeBytes uint64
+	DiskSizeBytes uint64
+
+	// Writable is whether a file could be written to Path.
+	Writable bool
+
+	// FetchesInFlight is the number of archives being fetched, and
+	// FetchesQueued the number of fetches waiting for their turn.
+	FetchesInFlight int64
+	FetchesQueued   int64
+
+	// Problems describes why the store is unhealthy. It is empty if the
+	// store is healthy.
+	Problems []string `json:",omitempty"`
+}
+
+// Healthy returns whether the store can serve searches.
+func (h *Health) Healthy() bool {
+	return len(h.Problems) == 0
+}
+
+// Health checks the disk of the store. The store is unhealthy if Path can't
+// be written to or its disk has less than MinFreeDiskBytes free.
+func (s *Store) Health() Health {
+	h := Health{
+		FetchesInFlight: atomic.LoadInt64(&s.fetchesInFlight),
+		FetchesQueued:   atomic.LoadInt64(&s.fetchesQueued),
+	}
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(s.Path, &fs); err != nil {
+		h.Problems = append(h.Problems, fmt.Sprintf("failed to stat disk: %s", err))
+	} else {
+		h.DiskFreeBytes = fs.Bavail * uint64(fs.Bsize)
+		h.DiskSizeBytes = fs.Blocks * uint64(fs.Bsize)
+		if s.MinFreeDiskBytes > 0 && h.DiskFreeBytes < uint64(s.MinFreeDiskBytes) {
+			h.Problems = append(h.Problems, fmt.Sprintf("%d bytes free on disk, below the minimum of %d", h.DiskFreeBytes, s.MinFreeDiskBytes))
+		}
+	}
+
+	if err := checkWritable(s.Path); err != nil {
+		h.Problems = append(h.Problems, fmt.Sprintf("disk is not writable: %s", err))
+	} else {
+		h.Writable = true
+	}
+
+	return h
+}
+
+// checkWritable writes and removes a file in dir. The file is synced, so
+// that a disk which fails writes is noticed even if the page cache accepts
+// them.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, "health-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write([]byte("ok"))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	if err := os.MkdirAll(s.Path, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	h := s.Health()
+	if !h.Healthy() || !h.Writable || h.DiskFreeBytes == 0 || h.DiskSizeBytes < h.DiskFreeBytes {
+		t.Fatalf("expected store to be healthy, got %+v", h)
+	}
+	if paths, _ := filepath.Glob(filepath.Join(s.Path, "health-*")); len(paths) > 0 {
+		t.Errorf("expected the health check to clean up, found %v", paths)
+	}
+
+	s.MinFreeDiskBytes = int64(h.DiskSizeBytes) + 1
+	if h := s.Health(); h.Healthy() {
+		t.Errorf("expected store below MinFreeDiskBytes to be unhealthy, got %+v", h)
+	}
+
+	s.MinFreeDiskBytes = 0
+	s.Path = filepath.Join(s.Path, "missing")
+	if h := s.Health(); h.Healthy() || h.Writable {
+		t.Errorf("expected store with a missing directory to be unhealthy, got %+v", h)
+	}
+}
@@ -0,0 +1,262 @@
+package store
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// manifestName is the name of the file in Path which records the zips in
+// the cache across restarts.
+const manifestName = "manifest.json"
+
+// manifestEntry describes a zip in the manifest.
+type manifestEntry struct {
+	Repo   api.RepoName
+	Commit api.CommitID
+
+	// BaseKey is the key of the zips which can be built from the zip, if
+	// it can be a base. See Store.DiffFiles.
+	BaseKey string `json:",omitempty"`
+
+	// Size is the size of the zip in bytes.
+	Size int64
+
+	// CRC32 is the IEEE CRC-32 of the zip, or zero until it is computed.
+	CRC32 uint32 `json:",omitempty"`
+
+	// LastAccess is the time the zip was last prepared.
+	LastAccess time.Time
+}
+
+// manifest is the in-memory state of the manifest file. The zero value is
+// an empty manifest.
+type manifest struct {
+	mu      sync.Mutex
+	entries map[string]*manifestEntry // zip name -> entry
+	dirty   bool
+}
+
+// get returns a copy of the entry of the zip name.
+func (m *manifest) get(name string) (manifestEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[name]
+	if !ok {
+		return manifestEntry{}, false
+	}
+	return *e, true
+}
+
+// remove removes the entry of the zip name.
+func (m *manifest) remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[name]; ok {
+		delete(m.entries, name)
+		m.dirty = true
+	}
+}
+
+// recordAccess records in the manifest that the zip at path of repo at
+// commit was prepared. The checksum of zips new to the manifest, or written
+// again, is computed in the background.
+func (s *Store) recordAccess(path string, repo api.RepoName, commit api.CommitID, baseKey string) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		// Evicted already.
+		return
+	}
+	name := filepath.Base(path)
+	now := time.Now()
+
+	m := &s.manifest
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dirty = true
+	if e, ok := m.entries[name]; ok && e.Size == fi.Size() {
+		e.LastAccess = now
+		return
+	}
+	e := &manifestEntry{Repo: repo, Commit: commit, Size: fi.Size(), LastAccess: now}
+	if s.DiffFiles != nil && s.MaxDeltaFiles > 0 {
+		e.BaseKey = baseKey
+	}
+	if m.entries == nil {
+		m.entries = map[string]*manifestEntry{}
+	}
+	m.entries[name] = e
+	go s.checksum(path)
+}
+
+// checksum computes the CRC-32 of the zip at path into its manifest entry.
+func (s *Store) checksum(path string) {
+	sum, err := fileCRC32(path)
+	if err != nil {
+		return
+	}
+	m := &s.manifest
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[filepath.Base(path)]; ok {
+		e.CRC32 = sum
+		m.dirty = true
+	}
+}
+
+func fileCRC32(path string) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+// loadManifest reads the manifest of the zips in Path written before a
+// restart. Zips whose size changed are removed. Zips written to since they
+// were last accessed are checked against their checksum in the background.
+// The modification times of the zips, which eviction orders zips by, are
+// restored to their last access.
+func (s *Store) loadManifest() {
+	b, err := os.ReadFile(filepath.Join(s.Path, manifestName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("failed to read manifest of %s: %s", s.Path, err)
+		}
+		return
+	}
+	var entries map[string]*manifestEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		log.Printf("failed to parse manifest of %s: %s", s.Path, err)
+		return
+	}
+
+	var verify []string
+	for name, e := range entries {
+		path := filepath.Join(s.Path, name)
+		fi, err := os.Stat(path)
+		if err != nil {
+			delete(entries, name)
+			continue
+		}
+		if fi.Size() != e.Size {
+			log.Printf("removing %s: size %d differs from %d in manifest", path, fi.Size(), e.Size)
+			_ = os.Remove(path)
+			delete(entries, name)
+			continue
+		}
+		if fi.ModTime().After(e.LastAccess) && e.CRC32 != 0 {
+			verify = append(verify, path)
+		} else if e.LastAccess.Sub(fi.ModTime()) > time.Minute {
+			_ = os.Chtimes(path, e.LastAccess, e.LastAccess)
+		}
+	}
+
+	m := &s.manifest
+	m.mu.Lock()
+	m.entries = entries
+	m.mu.Unlock()
+
+	// The most recently accessed zip of each base key is the base.
+	bases := map[string]baseArchive{}
+	lastAccess := map[string]time.Time{}
+	for name, e := range entries {
+		if e.BaseKey == "" || e.LastAccess.Before(lastAccess[e.BaseKey]) {
+			continue
+		}
+		bases[e.BaseKey] = baseArchive{commit: e.Commit, path: filepath.Join(s.Path, name)}
+		lastAccess[e.BaseKey] = e.LastAccess
+	}
+	for baseKey, base := range bases {
+		s.setBase(baseKey, base.commit, base.path)
+	}
+
+	if len(verify) > 0 {
+		go s.verifyManifest(verify)
+	}
+}
+
+// verifyManifest removes the zips at paths whose CRC-32 differs from the one
+// in the manifest.
+func (s *Store) verifyManifest(paths []string) {
+	for _, path := range paths {
+		e, ok := s.manifest.get(filepath.Base(path))
+		if !ok {
+			continue
+		}
+		sum, err := fileCRC32(path)
+		if err != nil || sum == e.CRC32 {
+			continue
+		}
+		log.Printf("removing %s: checksum differs from manifest", path)
+		s.forget(path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to remove %s: %s", path, err)
+		}
+	}
+}
+
+// watchManifest is a loop which periodically saves the manifest.
+func (s *Store) watchManifest() {
+	for {
+		time.Sleep(time.Minute)
+
+		if err := s.SaveManifest(); err != nil {
+			log.Printf("failed to save manifest of %s: %s", s.Path, err)
+		}
+	}
+}
+
+// SaveManifest writes the manifest of the zips in the cache to disk, if it
+// changed since it was last saved. Call it before shutting down so the next
+// process starts with the latest access history.
+func (s *Store) SaveManifest() error {
+	m := &s.manifest
+	m.mu.Lock()
+	if !m.dirty {
+		m.mu.Unlock()
+		return nil
+	}
+	b, err := json.Marshal(m.entries)
+	m.dirty = false
+	m.mu.Unlock()
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(s.Path, manifestName), b)
+	}
+	if err != nil {
+		// Try again next time.
+		m.mu.Lock()
+		m.dirty = true
+		m.mu.Unlock()
+	}
+	return err
+}
+
+// writeFileAtomic writes b to path, replacing it at once.
+func writeFileAtomic(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "manifest-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
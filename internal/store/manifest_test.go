@@ -0,0 +1,65 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestManifest(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		var buf bytes.Buffer
+		writeTar(t, &buf, map[string]string{"README": "hi"})
+		return io.NopCloser(&buf), nil
+	}
+	const commit = api.CommitID("deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	path, err := s.PrepareZip(context.Background(), "foo", commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveManifest(); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := s.manifest.get(filepath.Base(path))
+
+	// Eviction history is lost, for example by restoring a volume.
+	old := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := &Store{Path: s.Path}
+	restarted.loadManifest()
+	got, ok := restarted.manifest.get(filepath.Base(path))
+	if !ok || got.Repo != "foo" || got.Commit != commit || got.Size != want.Size {
+		t.Fatalf("got entry %+v, want %+v", got, want)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(want.LastAccess) {
+		t.Errorf("got modification time %s, want last access %s", fi.ModTime(), want.LastAccess)
+	}
+
+	// Zips whose size doesn't match the manifest are removed.
+	if err := os.Truncate(path, 10); err != nil {
+		t.Fatal(err)
+	}
+	restarted = &Store{Path: s.Path}
+	restarted.loadManifest()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected truncated zip to be removed, got %v", err)
+	}
+	if _, ok := restarted.manifest.get(filepath.Base(path)); ok {
+		t.Error("expected truncated zip to be removed from the manifest")
+	}
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/inconshreveable/log15"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/httpcli"
+)
+
+type withoutPeersKey struct{}
+
+// WithoutPeers returns a context whose PrepareZip calls don't ask peers for
+// zips. Peers serving zips to each other use it, so that a zip missing
+// everywhere is fetched instead of being asked for in a loop.
+func WithoutPeers(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutPeersKey{}, true)
+}
+
+// getFromPeers returns a reader of the zip of repo at commit with the disk
+// name name from the first of s.Peers which serves it, or nil if none does.
+// Peers fetch the zips they are asked for and don't have, so a zip is cached
+// by the peers which own it rather than fetched by every replica.
+func (s *Store) getFromPeers(ctx context.Context, repo api.RepoName, commit api.CommitID, name string) io.ReadCloser {
+	if s.Peers == nil || ctx.Value(withoutPeersKey{}) != nil {
+		return nil
+	}
+	q := url.Values{
+		"repo":   {string(repo)},
+		"commit": {string(commit)},
+		"name":   {name},
+	}
+	if includeSubmodules(ctx) {
+		q.Set("submodules", "true")
+	}
+	for _, peer := range s.Peers(repo, commit) {
+		req, err := http.NewRequestWithContext(ctx, "GET", peer+"/archive?"+q.Encode(), nil)
+		if err != nil {
+			log15.Warn("invalid searcher peer", "peer", peer, "error", err)
+			continue
+		}
+		resp, err := httpcli.InternalDoer.Do(req)
+		if err != nil {
+			log15.Warn("failed to get archive from searcher peer", "peer", peer, "repo", repo, "commit", commit, "error", err)
+			peerFetches.WithLabelValues("error").Inc()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			peerFetches.WithLabelValues("miss").Inc()
+			continue
+		}
+		peerFetches.WithLabelValues("hit").Inc()
+		return resp.Body
+	}
+	return nil
+}
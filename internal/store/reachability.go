@@ -0,0 +1,97 @@
+package store
+
+import (
+	"archive/zip"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// archiveComment is the comment of the zip of repo at commit, which lets
+// the janitor find out which commit a zip belongs to.
+func archiveComment(repo api.RepoName, commit api.CommitID) string {
+	return string(repo) + "\n" + string(commit)
+}
+
+// parseArchiveComment returns the repo and commit of a zip from its comment.
+// ok is false for zips written before comments were added.
+func parseArchiveComment(comment string) (repo api.RepoName, commit api.CommitID, ok bool) {
+	i := strings.LastIndexByte(comment, '\n')
+	if i <= 0 || len(comment)-i-1 != 40 {
+		return "", "", false
+	}
+	return api.RepoName(comment[:i]), api.CommitID(comment[i+1:]), true
+}
+
+// watchReachability is a loop which periodically removes the zips of commits
+// which are no longer reachable.
+func (s *Store) watchReachability() {
+	for {
+		time.Sleep(s.ReachabilityCheckInterval)
+
+		n, err := s.removeUnreachable(context.Background())
+		if err != nil {
+			log.Printf("failed to remove unreachable archives from %s: %s", s.Path, err)
+		}
+		unreachableRemoved.Add(float64(n))
+	}
+}
+
+// removeUnreachable removes the zips in Path whose commit CommitReachable
+// reports as unreachable. Zips whose reachability can't be checked are
+// kept. It returns the number of zips removed.
+func (s *Store) removeUnreachable(ctx context.Context) (int, error) {
+	entries, err := os.ReadDir(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".zip") {
+			continue
+		}
+		path := filepath.Join(s.Path, e.Name())
+		repo, commit, ok := readArchiveComment(path)
+		if !ok {
+			continue
+		}
+
+		reachable, err := s.CommitReachable(ctx, repo, commit)
+		if err != nil {
+			if ctx.Err() != nil {
+				return removed, ctx.Err()
+			}
+			log.Printf("failed to check whether %s@%s is reachable: %s", repo, commit, err)
+			continue
+		}
+		if reachable {
+			continue
+		}
+
+		if err := s.remove(path); err != nil {
+			log.Printf("failed to remove %s: %s", path, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// readArchiveComment returns the repo and commit of the zip at path.
+func readArchiveComment(path string) (repo api.RepoName, commit api.CommitID, ok bool) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return "", "", false
+	}
+	defer r.Close()
+	return parseArchiveComment(r.Comment)
+}
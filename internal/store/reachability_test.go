@@ -0,0 +1,69 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestRemoveUnreachable(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		var buf bytes.Buffer
+		writeTar(t, &buf, map[string]string{"README": string(repo)})
+		return io.NopCloser(&buf), nil
+	}
+	const commit = api.CommitID("deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	paths := map[api.RepoName]string{}
+	for _, repo := range []api.RepoName{"reachable", "unreachable", "unknown"} {
+		path, err := s.PrepareZip(context.Background(), repo, commit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths[repo] = path
+	}
+
+	s.CommitReachable = func(ctx context.Context, repo api.RepoName, c api.CommitID) (bool, error) {
+		if c != commit {
+			t.Errorf("got commit %q, want %q", c, commit)
+		}
+		switch repo {
+		case "reachable":
+			return true, nil
+		case "unreachable":
+			return false, nil
+		default:
+			return false, errors.New("gitserver unavailable")
+		}
+	}
+	n, err := s.removeUnreachable(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d zips removed, want 1", n)
+	}
+	for repo, path := range paths {
+		_, err := os.Stat(path)
+		if kept, want := err == nil, repo != "unreachable"; kept != want {
+			t.Errorf("%s: got kept=%v, want %v", repo, kept, want)
+		}
+	}
+}
+
+func TestParseArchiveComment(t *testing.T) {
+	repo, commit, ok := parseArchiveComment(archiveComment("github.com/foo/bar", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"))
+	if !ok || repo != "github.com/foo/bar" || commit != "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef" {
+		t.Errorf("got %q %q %v", repo, commit, ok)
+	}
+	if _, _, ok := parseArchiveComment(""); ok {
+		t.Error("expected an empty comment not to parse")
+	}
+}
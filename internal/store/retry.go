@@ -6,26 +6,23 @@ import (
 )
 
 // GetZipFileWithRetry retries getting a zip file if the zip is for some reason
-// invalid.
+// invalid. The invalid zip is removed first, so that get fetches it again.
 func GetZipFileWithRetry(get func() (string, *ZipFile, error)) (validPath string, zf *ZipFile, err error) {
-	var path string
-	tries := 0
-	for zf == nil {
-		path, zf, err = get()
-		if err != nil {
-			if tries < 2 && strings.Contains(err.Error(), "not a valid zip file") {
-				err = os.Remove(path)
-				if err != nil {
-					return "", nil, err
-				}
-				tries++
-				if tries == 2 {
-					return "", nil, err
-				}
-				continue
-			}
+	for tries := 0; ; tries++ {
+		path, zf, err := get()
+		if err == nil {
+			return path, zf, nil
+		}
+		if tries > 0 || !(isCorruptZip(err) || strings.Contains(err.Error(), "not a valid zip file")) {
+			return "", nil, err
+		}
+		if err := os.Remove(path); err != nil {
+			return "", nil, err
+		}
+		// The trigram index may not match the zip fetched again.
+		if err := os.Remove(path + trigramIndexSuffix); err != nil && !os.IsNotExist(err) {
 			return "", nil, err
 		}
+		corruptArchives.Inc()
 	}
-	return path, zf, nil
 }
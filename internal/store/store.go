@@ -3,6 +3,7 @@ package store
 import (
 	"archive/tar"
 	"archive/zip"
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/sha256"
@@ -10,23 +11,28 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/inconshreveable/log15"
-	"github.com/opentracing/opentracing-go"
+	"github.com/klauspost/compress/zstd"
 	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/conf"
 	"github.com/sourcegraph/sourcegraph/internal/diskcache"
 	"github.com/sourcegraph/sourcegraph/internal/gitserver"
+	"github.com/sourcegraph/sourcegraph/internal/goroutine"
 	"github.com/sourcegraph/sourcegraph/internal/metrics"
 	"github.com/sourcegraph/sourcegraph/internal/mutablelimiter"
 	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
@@ -48,6 +54,13 @@ const maxFileSize = 1 << 20 // 1MB; match https://sourcegraph.com/search?q=repo:
 // * We touch files when opening them, so can do LRU based on file
 //   modification times.
 //
+// Files eviction doesn't account for, like the temporary files of fetches
+// interrupted by a restart, are periodically removed.
+//
+// The zips in the cache, with their last access, are recorded in a manifest
+// which is loaded on Start, so that a restarted store knows its zips without
+// opening them.
+//
 // Note: The store fetches tarballs but stores zips. We want to be able to
 // filter which files we cache, so we need a format that supports streaming
 // (tar). We want to be able to support random concurrent access for reading,
@@ -67,20 +80,163 @@ type Store struct {
 	// MaxCacheSizeBytes is the maximum size of the cache in bytes. Note:
 	// We can temporarily be larger than MaxCacheSizeBytes. When we go
 	// over MaxCacheSizeBytes we trigger delete files until we get below
-	// MaxCacheSizeBytes.
+	// MaxCacheSizeBytes. Once the store is started, it must only be
+	// changed with SetMaxCacheSizeBytes.
 	MaxCacheSizeBytes int64
 
+	// MinFreeDiskBytes if positive is the free space on the disk of Path
+	// below which Health reports the store as unhealthy.
+	MinFreeDiskBytes int64
+
 	// once protects Start
 	once sync.Once
 
 	// cache is the disk backed cache.
 	cache *diskcache.Store
 
+	// FetchTimeout is the time a fetch, including the retries of FetchTar,
+	// has to finish. Zero means two minutes.
+	FetchTimeout time.Duration
+
+	// FetchMaxAttempts is the maximum number of calls to FetchTar per fetch.
+	// Failures which may be transient are retried with an exponential
+	// backoff. Values below two disable retries.
+	FetchMaxAttempts int
+
+	// FetchBreakerThreshold if positive is the number of consecutive failed
+	// fetches from an upstream after which FetchTar isn't called for the
+	// repos of that upstream for FetchBreakerCooldown. Fetches return
+	// ErrCircuitOpen instead.
+	FetchBreakerThreshold int
+	FetchBreakerCooldown  time.Duration
+
+	// Upstream if set returns the name of the upstream FetchTar fetches repo
+	// from, like the address of its gitserver. Each upstream has its own
+	// circuit breaker.
+	Upstream func(repo api.RepoName) string
+
+	// breakers maps upstreams to their *circuitBreaker.
+	breakers sync.Map
+
+	// MaxFetchesPerUpstream if positive is the maximum number of concurrent
+	// fetches from an upstream. Fetches over it wait for their turn, within
+	// the limit on all fetches.
+	MaxFetchesPerUpstream int
+
+	// upstreamLimiters maps upstreams to their *mutablelimiter.Limiter.
+	upstreamLimiters sync.Map
+
 	// fetchLimiter limits concurrent calls to FetchTar.
 	fetchLimiter *mutablelimiter.Limiter
 
+	// fetchesQueued and fetchesInFlight count the fetches waiting for
+	// fetchLimiter and holding it, for Health. They are accessed atomically.
+	fetchesQueued   int64
+	fetchesInFlight int64
+
 	// ZipCache provides efficient access to repo zip files.
 	ZipCache ZipCache
+
+	// BuildTrigramIndexes if true builds a trigram index next to each zip
+	// once it is prepared. Searches use the index to skip the files which
+	// can't match. The indexes are evicted with their zips, but don't count
+	// towards MaxCacheSizeBytes.
+	BuildTrigramIndexes bool
+
+	// MaxArchiveDepth if positive is the number of levels of nested
+	// archives, like jars and tarballs, whose members are stored next to the
+	// files of the repository. Members are named like "outer.jar!inner/path".
+	// Archives are only expanded when fetched from gitserver, since the
+	// archives built from zoekt have no binary files.
+	MaxArchiveDepth int
+
+	// MaxArchiveSize is the maximum size in bytes of an archive which is
+	// expanded, and of all the members expanded from it.
+	MaxArchiveSize int64
+
+	// CompressArchives if true compresses the files of the zips it writes
+	// with zstd. This uses several times less disk, at the cost of CPU to
+	// compress when fetching and to decompress into memory when a zip is
+	// opened. Zips are read whether or not they are compressed, so it can be
+	// toggled without evicting the cache.
+	CompressArchives bool
+
+	// VerifyArchives if true checks the checksums of the files of a zip when
+	// ZipCache reads it from disk. Zips which are corrupt, whether or not
+	// they are verified, are removed by GetZipFileWithRetry and fetched
+	// again.
+	VerifyArchives bool
+
+	// ObjectStore if set is a second tier of the cache, which can be shared
+	// by replicas. Zips evicted from disk are uploaded to it, and zips
+	// missing from disk are downloaded from it before fetching them.
+	ObjectStore ObjectStore
+
+	// Peers if set returns the base URLs of the other searcher replicas
+	// which cache the zip of repo at commit, in order of preference. Zips
+	// missing from disk are downloaded from them before fetching them. It
+	// must return no peers for the zips this replica caches for others,
+	// which the peers asking it for the zip would otherwise wait on.
+	Peers func(repo api.RepoName, commit api.CommitID) []string
+
+	// Submodules if set returns the submodules of repo at commit. Zips
+	// prepared with a context from WithSubmodules contain their files.
+	Submodules func(ctx context.Context, repo api.RepoName, commit api.CommitID) ([]Submodule, error)
+
+	// inObjectStore is the set of names of the zips on disk which are known
+	// to be in ObjectStore, so that they aren't uploaded when evicted.
+	inObjectStore sync.Map
+
+	// CommitReachable if set reports whether commit is reachable from a ref
+	// of repo. Every ReachabilityCheckInterval the zips of commits which
+	// are no longer reachable, for example because of a force push, are
+	// removed.
+	CommitReachable func(ctx context.Context, repo api.RepoName, commit api.CommitID) (bool, error)
+
+	// ReachabilityCheckInterval is the interval between checks of
+	// CommitReachable. Zero disables them.
+	ReachabilityCheckInterval time.Duration
+
+	// DiffFiles if set returns the paths of the files modified (including
+	// added) and deleted between the commits base and head of repo. With
+	// FetchTarPaths it lets the zip of a commit be built from the zip of
+	// another commit of the same repo, instead of fetching the whole
+	// archive.
+	DiffFiles func(ctx context.Context, repo api.RepoName, base, head api.CommitID) (modified, deleted []string, err error)
+
+	// FetchTarPaths returns an io.ReadCloser to a tar archive of the files
+	// at paths of repo at commit.
+	FetchTarPaths func(ctx context.Context, repo api.RepoName, commit api.CommitID, paths []string) (io.ReadCloser, error)
+
+	// MaxDeltaFiles is the maximum number of files changed between two
+	// commits for the zip of one to be built from the zip of the other.
+	// Zero disables building zips from other zips.
+	MaxDeltaFiles int
+
+	// bases maps repos and the settings which affect their zips to the last
+	// zip prepared for them, which the zips of other commits can be built
+	// from.
+	bases sync.Map
+
+	// manifest records the zips in the cache across restarts.
+	manifest manifest
+
+	// prepareGroup coalesces concurrent PrepareZip calls by key.
+	prepareGroup singleflight.Group
+
+	// indexing is the set of paths of the zips whose trigram index is being
+	// built.
+	indexing sync.Map
+}
+
+// ObjectStore is a blob store, like S3 or GCS.
+type ObjectStore interface {
+	// Get returns a reader of the content of the object at key. Errors,
+	// like the object not existing, may only be returned by the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Upload writes the content of r to the object at key.
+	Upload(ctx context.Context, key string, r io.Reader) (int64, error)
 }
 
 // FilterFunc filters tar files based on their header.
@@ -93,16 +249,23 @@ type FilterFunc func(hdr *tar.Header) bool
 // search request paying the cost of initializing.
 func (s *Store) Start() {
 	s.once.Do(func() {
+		s.ZipCache.verifyChecksums = s.VerifyArchives
 		s.fetchLimiter = mutablelimiter.New(15)
 		s.cache = &diskcache.Store{
 			Dir:               s.Path,
 			Component:         "store",
 			BackgroundTimeout: 10 * time.Minute,
-			BeforeEvict:       s.ZipCache.delete,
+			BeforeEvict:       s.beforeEvict,
 		}
 		_ = os.MkdirAll(s.Path, 0700)
 		metrics.MustRegisterDiskMonitor(s.Path)
+		s.loadManifest()
+		go s.watchManifest()
 		go s.watchAndEvict()
+		go s.watchAndReconcile()
+		if s.CommitReachable != nil && s.ReachabilityCheckInterval > 0 {
+			go s.watchReachability()
+		}
 		go s.watchConfig()
 	})
 }
@@ -112,6 +275,8 @@ func (s *Store) Start() {
 func (s *Store) PrepareZip(ctx context.Context, repo api.RepoName, commit api.CommitID) (path string, err error) {
 	span, ctx := ot.StartSpanFromContext(ctx, "Store.prepareZip")
 	ext.Component.Set(span, "store")
+	span.SetTag("repo", repo)
+	span.SetTag("commit", commit)
 	defer func() {
 		if err != nil {
 			ext.Error.Set(span, true)
@@ -132,25 +297,60 @@ func (s *Store) PrepareZip(ctx context.Context, repo api.RepoName, commit api.Co
 	largeFilePatterns := conf.Get().SearchLargeFiles
 
 	// key is a sha256 hash since we want to use it for the disk name
-	h := sha256.Sum256([]byte(fmt.Sprintf("%q %q %q", repo, commit, largeFilePatterns)))
+	keyInput := fmt.Sprintf("%q %q %q", repo, commit, largeFilePatterns)
+	// Zips can be built from the zips of other commits with the same
+	// baseKey.
+	baseKey := fmt.Sprintf("%q %q", repo, largeFilePatterns)
+	if s.MaxArchiveDepth > 0 {
+		// Archives with and without expanded members must not share a key.
+		archives := fmt.Sprintf(" archives=%d,%d", s.MaxArchiveDepth, s.MaxArchiveSize)
+		keyInput += archives
+		baseKey += archives
+	}
+	if includeSubmodules(ctx) && s.Submodules != nil {
+		keyInput += " submodules"
+		baseKey += " submodules"
+	}
+	h := sha256.Sum256([]byte(keyInput))
 	key := hex.EncodeToString(h[:])
 	span.LogKV("key", key)
 
 	// Our fetch can take a long time, and the frontend aggressively cancels
 	// requests. So we open in the background to give it extra time.
-	type result struct {
-		path string
-		err  error
-	}
-	resC := make(chan result, 1)
-	go func() {
+	// Concurrent calls for the same key share the open, so that they wait
+	// for a single fetch and all see its error if it fails, instead of each
+	// fetching again in turn.
+	resC := s.prepareGroup.DoChan(key, func() (interface{}, error) {
 		start := time.Now()
 		// TODO: consider adding a cache method that doesn't actually bother opening the file,
 		// since we're just going to close it again immediately.
-		bgctx := opentracing.ContextWithSpan(context.Background(), opentracing.SpanFromContext(ctx))
-		f, err := s.cache.Open(bgctx, key, func(ctx context.Context) (io.ReadCloser, error) {
+		// bgctx keeps the values of ctx, such as the span and hints for
+		// FetchTar, but not its cancellation.
+		bgctx := goroutine.Detach(ctx)
+		// source is where the zip came from. It is only written by the
+		// fetcher, which Open waits for since bgctx is never canceled.
+		source := "disk"
+		f, err := s.cache.Open(bgctx, key, s.encrypting(func(ctx context.Context) (io.ReadCloser, error) {
+			// The cache fetches with a context of its own, which has a
+			// timeout but not the values of bgctx.
+			ctx = valuesContext{Context: ctx, values: bgctx}
+			if rc := s.getFromPeers(ctx, repo, commit, filepath.Base(s.cache.Path(key))); rc != nil {
+				source = "peer"
+				return rc, nil
+			}
+			if rc := s.getFromObjectStore(ctx, key); rc != nil {
+				source = "object_store"
+				return rc, nil
+			}
+			if rc := s.fetchDelta(ctx, repo, commit, baseKey, largeFilePatterns); rc != nil {
+				source = "delta"
+				return rc, nil
+			}
+			source = "fetch"
 			return s.fetch(ctx, repo, commit, largeFilePatterns)
-		})
+		}))
+		prepareZipSource.WithLabelValues(source).Inc()
+		prepareZipDuration.WithLabelValues(source).Observe(time.Since(start).Seconds())
 		var path string
 		if f != nil {
 			path = f.Path
@@ -160,38 +360,69 @@ func (s *Store) PrepareZip(ctx context.Context, repo api.RepoName, commit api.Co
 		}
 		if err != nil {
 			log15.Error("failed to fetch archive", "repo", repo, "commit", commit, "duration", time.Since(start), "error", err)
+			return preparedZip{source: source}, err
 		}
-		resC <- result{path, err}
-	}()
+		s.setBase(baseKey, commit, path)
+		s.recordAccess(path, repo, commit, baseKey)
+
+		if s.BuildTrigramIndexes && s.ZipCache.encryptionKey().key == nil {
+			go s.buildTrigramIndex(path)
+		}
+		return preparedZip{path: path, source: source}, nil
+	})
 
 	select {
 	case <-ctx.Done():
 		return "", ctx.Err()
 
 	case res := <-resC:
-		if res.err != nil {
-			return "", res.err
+		if res.Shared {
+			prepareZipShared.Inc()
 		}
-		return res.path, nil
+		// Tells whether a slow search waited for a fetch, and whether it
+		// shared the fetch of another search.
+		prepared, _ := res.Val.(preparedZip)
+		span.SetTag("source", prepared.source)
+		span.SetTag("shared", res.Shared)
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return prepared.path, nil
 	}
 }
 
+// preparedZip is the result of the opens shared by calls to PrepareZip.
+type preparedZip struct {
+	path string
+	// source is where the zip came from, as in the source label of
+	// prepareZipSource.
+	source string
+}
+
 // fetch fetches an archive from the network and stores it on disk. It does
 // not populate the in-memory cache. You should probably be calling
 // prepareZip.
 func (s *Store) fetch(ctx context.Context, repo api.RepoName, commit api.CommitID, largeFilePatterns []string) (rc io.ReadCloser, err error) {
 	fetchQueueSize.Inc()
+	atomic.AddInt64(&s.fetchesQueued, 1)
 	ctx, releaseFetchLimiter, err := s.fetchLimiter.Acquire(ctx) // Acquire concurrent fetches semaphore
+	atomic.AddInt64(&s.fetchesQueued, -1)
 	if err != nil {
 		return nil, err // err will be a context error
 	}
 	fetchQueueSize.Dec()
 
-	// We expect git archive, even for large repos, to finish relatively
-	// quickly.
-	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	upstream := s.upstream(repo)
+	ctx, releaseUpstreamLimiter, err := s.acquireUpstream(ctx, upstream)
+	if err != nil {
+		releaseFetchLimiter()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.fetchTimeout())
 
 	fetching.Inc()
+	atomic.AddInt64(&s.fetchesInFlight, 1)
 	span, ctx := ot.StartSpanFromContext(ctx, "Store.fetch")
 	ext.Component.Set(span, "store")
 	span.SetTag("repo", repo)
@@ -206,6 +437,7 @@ func (s *Store) fetch(ctx context.Context, repo api.RepoName, commit api.CommitI
 		}
 		doneCalled = true
 
+		releaseUpstreamLimiter()
 		releaseFetchLimiter() // Release concurrent fetches semaphore
 		cancel()              // Release context resources
 		if err != nil {
@@ -214,6 +446,7 @@ func (s *Store) fetch(ctx context.Context, repo api.RepoName, commit api.CommitI
 			fetchFailed.Inc()
 		}
 		fetching.Dec()
+		atomic.AddInt64(&s.fetchesInFlight, -1)
 		span.Finish()
 	}
 	defer func() {
@@ -222,10 +455,14 @@ func (s *Store) fetch(ctx context.Context, repo api.RepoName, commit api.CommitI
 		}
 	}()
 
-	r, err := s.FetchTar(ctx, repo, commit)
+	fetchStart := time.Now()
+	r, err := s.fetchTar(ctx, upstream, repo, commit)
 	if err != nil {
 		return nil, err
 	}
+	// The zip is built while the tar is streamed, so the rest of the span
+	// is split between gitserver and copySearchable.
+	span.LogFields(otlog.String("upstream", upstream), otlog.String("timeToFirstByte", time.Since(fetchStart).String()))
 
 	filter := func(hdr *tar.Header) bool { return false } // default: don't filter
 	if s.FilterTar != nil {
@@ -246,8 +483,14 @@ func (s *Store) fetch(ctx context.Context, repo api.RepoName, commit api.CommitI
 	go func() {
 		defer r.Close()
 		tr := tar.NewReader(r)
-		zw := zip.NewWriter(pw)
-		err := copySearchable(tr, zw, largeFilePatterns, filter)
+		zw, method := s.newZipWriter(pw)
+		err := copySearchable(tr, "", zw, method, largeFilePatterns, filter, archiveLimits{maxDepth: s.MaxArchiveDepth, maxSize: s.MaxArchiveSize})
+		if err == nil && includeSubmodules(ctx) {
+			err = s.copySubmodules(ctx, zw, method, repo, commit, largeFilePatterns, filter)
+		}
+		if err == nil {
+			err = zw.SetComment(archiveComment(repo, commit))
+		}
 		if err1 := zw.Close(); err == nil {
 			err = err1
 		}
@@ -259,9 +502,79 @@ func (s *Store) fetch(ctx context.Context, repo api.RepoName, commit api.CommitI
 	return pr, nil
 }
 
-// copySearchable copies searchable files from tr to zw. A searchable file is
-// any file that is under size limit, non-binary, and not matching the filter.
-func copySearchable(tr *tar.Reader, zw *zip.Writer, largeFilePatterns []string, filter FilterFunc) error {
+// newZipWriter returns a zip writer to w, and the compression method of the
+// files to write.
+func (s *Store) newZipWriter(w io.Writer) (*zip.Writer, uint16) {
+	zw := zip.NewWriter(w)
+	if !s.CompressArchives {
+		return zw, zip.Store
+	}
+	zw.RegisterCompressor(zstd.ZipMethodWinZip, zstd.ZipCompressor())
+	return zw, zstd.ZipMethodWinZip
+}
+
+// getFromObjectStore returns a reader of the zip for key in s.ObjectStore, or
+// nil if it isn't there.
+func (s *Store) getFromObjectStore(ctx context.Context, key string) io.ReadCloser {
+	if s.ObjectStore == nil {
+		return nil
+	}
+	name := filepath.Base(s.cache.Path(key))
+	rc, err := s.ObjectStore.Get(ctx, name)
+	if err != nil {
+		objectStoreOps.WithLabelValues("miss").Inc()
+		return nil
+	}
+	// Readers may only report a missing object once read, so we read ahead
+	// to fall back to fetching before anything is written to disk.
+	br := bufio.NewReader(rc)
+	if _, err := br.Peek(1); err != nil {
+		rc.Close()
+		objectStoreOps.WithLabelValues("miss").Inc()
+		return nil
+	}
+	objectStoreOps.WithLabelValues("hit").Inc()
+	s.inObjectStore.Store(name, struct{}{})
+	return struct {
+		io.Reader
+		io.Closer
+	}{br, rc}
+}
+
+// uploadToObjectStore uploads the zip at path to s.ObjectStore, unless it is
+// there already.
+func (s *Store) uploadToObjectStore(path string) {
+	name := filepath.Base(path)
+	if _, ok := s.inObjectStore.LoadAndDelete(name); ok {
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("failed to open %s for upload: %s", path, err)
+		return
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if _, err := s.ObjectStore.Upload(ctx, name, f); err != nil {
+		log.Printf("failed to upload %s: %s", path, err)
+		objectStoreOps.WithLabelValues("upload_error").Inc()
+		return
+	}
+	objectStoreOps.WithLabelValues("upload").Inc()
+}
+
+// hasUTF16BOM returns whether b starts with a UTF-16 byte order mark.
+func hasUTF16BOM(b []byte) bool {
+	return bytes.HasPrefix(b, []byte{0xFF, 0xFE}) || bytes.HasPrefix(b, []byte{0xFE, 0xFF})
+}
+
+// copySearchable copies searchable files from tr to zw, using the compression
+// method. A searchable file is any file that is under size limit, non-binary,
+// and not matching the filter. The searchable members of archives are copied
+// too, within archives. The names of the files are prefixed with prefix.
+func copySearchable(tr *tar.Reader, prefix string, zw *zip.Writer, method uint16, largeFilePatterns []string, filter FilterFunc, archives archiveLimits) error {
 	// 32*1024 is the same size used by io.Copy
 	buf := make([]byte, 32*1024)
 	for {
@@ -284,6 +597,31 @@ func copySearchable(tr *tar.Reader, zw *zip.Writer, largeFilePatterns []string,
 		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
 			continue
 		}
+		hdr.Name = prefix + hdr.Name
+
+		if format := archiveFormatOf(hdr.Name); archives.maxDepth > 0 && format != archiveNone && hdr.Size <= archives.maxSize {
+			// Archives are bounded by archives.maxSize rather than the size
+			// limit of the filter, since only their name is stored.
+			if filter(&tar.Header{Name: hdr.Name}) {
+				continue
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			if _, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     hdr.Name,
+				Method:   method,
+				Modified: hdr.ModTime,
+			}); err != nil {
+				return err
+			}
+			budget := archives.maxSize
+			if err := copyArchiveMembers(zw, method, hdr.Name, format, data, hdr.ModTime, archives.maxDepth, &budget, largeFilePatterns, filter); err != nil {
+				return err
+			}
+			continue
+		}
 
 		// ignore files if they match the filter
 		if filter(hdr) {
@@ -292,8 +630,9 @@ func copySearchable(tr *tar.Reader, zw *zip.Writer, largeFilePatterns []string,
 
 		// We are happy with the file, so we can write it to zw.
 		w, err := zw.CreateHeader(&zip.FileHeader{
-			Name:   hdr.Name,
-			Method: zip.Store,
+			Name:     hdr.Name,
+			Method:   method,
+			Modified: hdr.ModTime,
 		})
 		if err != nil {
 			return err
@@ -318,7 +657,9 @@ func copySearchable(tr *tar.Reader, zw *zip.Writer, largeFilePatterns []string,
 
 		// Heuristic: Assume file is binary if first 256 bytes contain a
 		// 0x00. Best effort, so ignore err. We only search names of binary files.
-		if n > 0 && bytes.IndexByte(buf[:n], 0x00) >= 0 {
+		// UTF-16 text is full of 0x00, so files starting with a UTF-16 byte
+		// order mark are kept for searcher to decode.
+		if n > 0 && bytes.IndexByte(buf[:n], 0x00) >= 0 && !hasUTF16BOM(buf[:n]) {
 			continue
 		}
 
@@ -339,6 +680,59 @@ func copySearchable(tr *tar.Reader, zw *zip.Writer, largeFilePatterns []string,
 	}
 }
 
+// buildTrigramIndex writes the trigram index of the zip at path, unless it
+// already exists or is being built.
+func (s *Store) buildTrigramIndex(path string) {
+	indexPath := path + trigramIndexSuffix
+	if _, err := os.Stat(indexPath); err == nil {
+		return
+	}
+	if _, loaded := s.indexing.LoadOrStore(path, struct{}{}); loaded {
+		return
+	}
+	defer s.indexing.Delete(path)
+
+	start := time.Now()
+	zf, err := s.ZipCache.Get(context.Background(), path)
+	if err != nil {
+		log15.Error("failed to open archive for trigram index", "path", path, "error", err)
+		return
+	}
+	defer zf.Close()
+
+	ix := BuildTrigramIndex(zf)
+	if err := writeTrigramIndex(indexPath, ix); err != nil {
+		log15.Error("failed to write trigram index", "path", path, "error", err)
+		return
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// The zip was evicted while we built its index.
+		_ = os.Remove(indexPath)
+		return
+	}
+	s.ZipCache.setTrigramIndex(path, ix)
+	trigramIndexDuration.Observe(time.Since(start).Seconds())
+}
+
+// beforeEvict is called before the zip at path is evicted from the disk cache.
+func (s *Store) beforeEvict(path string) {
+	if s.ObjectStore != nil {
+		s.uploadToObjectStore(path)
+	}
+	s.forget(path)
+}
+
+// forget removes the zip at path from memory and removes its trigram index,
+// before the zip is removed from disk.
+func (s *Store) forget(path string) {
+	s.forgetBase(path)
+	s.manifest.remove(filepath.Base(path))
+	s.ZipCache.delete(path)
+	if err := os.Remove(path + trigramIndexSuffix); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to remove trigram index of %s: %s", path, err)
+	}
+}
+
 func (s *Store) String() string {
 	return "Store(" + s.Path + ")"
 }
@@ -346,23 +740,90 @@ func (s *Store) String() string {
 // watchAndEvict is a loop which periodically checks the size of the cache and
 // evicts/deletes items if the store gets too large.
 func (s *Store) watchAndEvict() {
-	if s.MaxCacheSizeBytes == 0 {
-		return
-	}
-
 	for {
 		time.Sleep(10 * time.Second)
 
-		stats, err := s.cache.Evict(s.MaxCacheSizeBytes)
+		maxCacheSizeBytes := atomic.LoadInt64(&s.MaxCacheSizeBytes)
+		if maxCacheSizeBytes == 0 {
+			// Still measure the size of the cache.
+			maxCacheSizeBytes = math.MaxInt64
+		}
+
+		stats, err := s.cache.Evict(maxCacheSizeBytes)
 		if err != nil {
 			log.Printf("failed to Evict: %s", err)
 			continue
 		}
 		cacheSizeBytes.Set(float64(stats.CacheSize))
 		evictions.Add(float64(stats.Evicted))
+		evictedBytes.Add(float64(stats.EvictedBytes))
+	}
+}
+
+// staleFileAge is the age after which a partially written zip or trigram
+// index is assumed to be left behind by a process which no longer runs.
+// Fetches time out well before it.
+const staleFileAge = time.Hour
+
+// watchAndReconcile is a loop which periodically removes the files in Path
+// which are not accounted for by the disk cache.
+func (s *Store) watchAndReconcile() {
+	for {
+		n, err := s.reconcile(time.Now())
+		if err != nil {
+			log.Printf("failed to reconcile %s: %s", s.Path, err)
+		}
+		reconciledFiles.Add(float64(n))
+
+		time.Sleep(10 * time.Minute)
 	}
 }
 
+// reconcile removes the files in Path which eviction doesn't see: the
+// trigram indexes of zips which were removed out of band, and the temporary
+// files left behind by fetches and index builds which were interrupted, for
+// example by a restart. It returns the number of files removed.
+func (s *Store) reconcile(now time.Time) (int, error) {
+	entries, err := os.ReadDir(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	for _, e := range entries {
+		name := e.Name()
+		path := filepath.Join(s.Path, name)
+		switch {
+		case strings.HasSuffix(name, trigramIndexSuffix):
+			if _, err := os.Stat(strings.TrimSuffix(path, trigramIndexSuffix)); !os.IsNotExist(err) {
+				continue
+			}
+		case strings.HasSuffix(name, ".part"), (strings.HasPrefix(name, "trigrams-") || strings.HasPrefix(name, "manifest-") || strings.HasPrefix(name, "health-")) && strings.HasSuffix(name, ".tmp"):
+			fi, err := e.Info()
+			if err != nil || now.Sub(fi.ModTime()) < staleFileAge {
+				continue
+			}
+		default:
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to remove %s: %s", path, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// SetMaxCacheSizeBytes changes the maximum size of the cache. It is safe to
+// call while the store is in use. Zero disables eviction.
+func (s *Store) SetMaxCacheSizeBytes(n int64) {
+	atomic.StoreInt64(&s.MaxCacheSizeBytes, n)
+}
+
 // watchConfig updates fetchLimiter as the number of gitservers change.
 func (s *Store) watchConfig() {
 	for {
@@ -398,6 +859,50 @@ var (
 		Name: "searcher_store_evictions",
 		Help: "The total number of items evicted from the cache.",
 	})
+	evictedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "searcher_store_evicted_bytes",
+		Help: "The total size in bytes of the items evicted from the cache.",
+	})
+	reconciledFiles = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "searcher_store_reconciled_files",
+		Help: "The total number of stale temporary files and orphaned trigram indexes removed from the cache directory.",
+	})
+	zipCacheBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "searcher_store_zip_cache_bytes",
+		Help: "The total size of the zip files opened by the in-memory zip cache.",
+	})
+	zipCacheFiles = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "searcher_store_zip_cache_files",
+		Help: "The number of zip files opened by the in-memory zip cache.",
+	})
+	zipCacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "searcher_store_zip_cache_evictions",
+		Help: "The total number of zip files evicted from the in-memory zip cache to stay within its memory budget.",
+	})
+	objectStoreOps = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "searcher_store_object_store_total",
+		Help: "The total number of zips found (hit) or not (miss) in the object store, and uploaded to it (upload, upload_error).",
+	}, []string{"op"})
+	peerFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "searcher_store_peer_fetches_total",
+		Help: "The total number of requests for archives to searcher peers, by whether the peer served it (hit), didn't (miss) or couldn't be reached (error).",
+	}, []string{"result"})
+	submoduleFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "searcher_store_submodule_fetches_total",
+		Help: "The total number of submodule archives fetched to be included in the archive of their repository (fetched), or which failed to be (error).",
+	}, []string{"result"})
+	evictedByRequest = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "searcher_store_evicted_by_request",
+		Help: "The total number of cached archives removed by requests to evict a repository.",
+	})
+	unreachableRemoved = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "searcher_store_unreachable_removed",
+		Help: "The total number of cached archives removed because their commit is no longer reachable.",
+	})
+	deltaArchives = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "searcher_store_delta_archives_total",
+		Help: "The total number of archives built from the archive of another commit (built), not built that way because too many files changed (skipped), or which failed to be (error).",
+	}, []string{"result"})
 	fetching = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "searcher_store_fetching",
 		Help: "The number of fetches currently running.",
@@ -406,10 +911,48 @@ var (
 		Name: "searcher_store_fetch_queue_size",
 		Help: "The number of fetch jobs enqueued.",
 	})
+	upstreamFetching = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "searcher_store_upstream_fetching",
+		Help: "The number of fetches currently running, by upstream. Only fetches limited by MaxFetchesPerUpstream are counted.",
+	}, []string{"upstream"})
+	upstreamFetchQueueSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "searcher_store_upstream_fetch_queue_size",
+		Help: "The number of fetch jobs waiting for the limit of their upstream, by upstream.",
+	}, []string{"upstream"})
+	prepareZipSource = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "searcher_store_prepare_zip_total",
+		Help: "The total number of archives prepared, by where they came from: the disk cache (a hit), or on a miss a peer, the object store, a delta from another commit or a fetch of the whole archive.",
+	}, []string{"source"})
+	prepareZipDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "searcher_store_prepare_zip_duration_seconds",
+		Help:    "Time spent preparing an archive, by where it came from.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"source"})
+	prepareZipShared = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "searcher_store_prepare_zip_shared",
+		Help: "The total number of PrepareZip calls which shared their result with a concurrent call for the same archive.",
+	})
+	corruptArchives = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "searcher_store_corrupt_archives",
+		Help: "The total number of cached archives removed to be fetched again because they were corrupt.",
+	})
+	fetchRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "searcher_store_fetch_retries",
+		Help: "The total number of calls to FetchTar which re-attempted a failed call.",
+	})
+	fetchCircuitOpen = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "searcher_store_fetch_circuit_open",
+		Help: "The total number of fetches which failed without calling FetchTar because the circuit breaker of their upstream was open.",
+	})
 	fetchFailed = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "searcher_store_fetch_failed",
 		Help: "The total number of archive fetches that failed.",
 	})
+	trigramIndexDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "searcher_store_trigram_index_duration_seconds",
+		Help:    "Time spent building the trigram index of an archive.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+	})
 )
 
 // temporaryError wraps an error but adds the Temporary method. It does not
@@ -422,3 +965,12 @@ type temporaryError struct {
 func (temporaryError) Temporary() bool {
 	return true
 }
+
+// valuesContext is a context canceled like the embedded context, with the
+// values of another context.
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesContext) Value(key interface{}) interface{} { return c.values.Value(key) }
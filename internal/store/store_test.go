@@ -2,15 +2,22 @@ package store
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/google/go-cmp/cmp"
 
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/errcode"
@@ -94,6 +101,56 @@ func TestPrepareZip_fetchTarFail(t *testing.T) {
 	}
 }
 
+func TestPrepareZip_fetchTarFailShared(t *testing.T) {
+	fetchErr := errors.New("test")
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+
+	fetchStarted := make(chan struct{}, 1)
+	returnFetch := make(chan struct{})
+	var fetchTarCalled int64
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		atomic.AddInt64(&fetchTarCalled, 1)
+		fetchStarted <- struct{}{}
+		<-returnFetch
+		return nil, fetchErr
+	}
+
+	prepareZipErr := make(chan error, 1)
+	go func() {
+		_, err := s.PrepareZip(context.Background(), "foo", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+		prepareZipErr <- err
+	}()
+	<-fetchStarted
+
+	// Calls while the fetch is running join it, even if they return early
+	// because their context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 10; i++ {
+		if _, err := s.PrepareZip(ctx, "foo", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"); err != context.Canceled {
+			t.Fatalf("expected PrepareZip to fail with %v, failed with %v", context.Canceled, err)
+		}
+	}
+	close(returnFetch)
+
+	if err := <-prepareZipErr; !errors.Is(err, fetchErr) {
+		t.Fatalf("expected PrepareZip to fail with %v, failed with %v", fetchErr, err)
+	}
+	if n := atomic.LoadInt64(&fetchTarCalled); n != 1 {
+		t.Fatalf("expected FetchTar to be called once, called %d times", n)
+	}
+
+	// Failures are not cached, so a later call fetches again.
+	_, err := s.PrepareZip(context.Background(), "foo", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	if !errors.Is(err, fetchErr) {
+		t.Fatalf("expected PrepareZip to fail with %v, failed with %v", fetchErr, err)
+	}
+	if n := atomic.LoadInt64(&fetchTarCalled); n != 2 {
+		t.Fatalf("expected FetchTar to be called twice, called %d times", n)
+	}
+}
+
 func TestPrepareZip_errHeader(t *testing.T) {
 	s, cleanup := tmpStore(t)
 	defer cleanup()
@@ -167,3 +224,265 @@ func emptyTar(t *testing.T) io.ReadCloser {
 	}
 	return io.NopCloser(bytes.NewReader(buf.Bytes()))
 }
+
+func TestPrepareZip_archives(t *testing.T) {
+	// lib.jar contains a text file and a tarball with another text file.
+	var tgz bytes.Buffer
+	gw := gzip.NewWriter(&tgz)
+	writeTar(t, gw, map[string]string{"x.txt": "nested"})
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var jar bytes.Buffer
+	zw := zip.NewWriter(&jar)
+	for name, content := range map[string]string{"a/B.java": "class B {}", "lib.tgz": tgz.String()} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		depth int
+		want  map[string]string
+	}{{
+		depth: 0,
+		want:  map[string]string{"README": "hi", "lib.jar": ""},
+	}, {
+		depth: 1,
+		want:  map[string]string{"README": "hi", "lib.jar": "", "lib.jar!a/B.java": "class B {}", "lib.jar!lib.tgz": ""},
+	}, {
+		depth: 2,
+		want:  map[string]string{"README": "hi", "lib.jar": "", "lib.jar!a/B.java": "class B {}", "lib.jar!lib.tgz": "", "lib.jar!lib.tgz!x.txt": "nested"},
+	}} {
+		s, cleanup := tmpStore(t)
+		s.MaxArchiveDepth = tc.depth
+		s.MaxArchiveSize = 1 << 20
+		s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+			var buf bytes.Buffer
+			writeTar(t, &buf, map[string]string{"README": "hi", "lib.jar": jar.String()})
+			return io.NopCloser(&buf), nil
+		}
+		path, err := s.PrepareZip(context.Background(), "foo", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+		if err != nil {
+			t.Fatal(err)
+		}
+		zf, err := s.ZipCache.Get(context.Background(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]string{}
+		for i := range zf.Files {
+			got[zf.Files[i].Name] = string(zf.DataFor(&zf.Files[i]))
+		}
+		zf.Close()
+		cleanup()
+
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("depth %d: unexpected files (-want +got):\n%s", tc.depth, diff)
+		}
+	}
+
+	if archive, ok := ArchiveOf("lib.jar!lib.tgz!x.txt"); !ok || archive != "lib.jar" {
+		t.Errorf("got archive %q, want lib.jar", archive)
+	}
+	if _, ok := ArchiveOf("README!"); ok {
+		t.Error("README! is not an archive member")
+	}
+}
+
+func TestPrepareZip_compressed(t *testing.T) {
+	files := map[string]string{
+		"README":   "hi",
+		"empty":    "",
+		"main.go":  strings.Repeat("package main\n", 100),
+		"dir/a.go": "package dir",
+	}
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	s.CompressArchives = true
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		var buf bytes.Buffer
+		writeTar(t, &buf, files)
+		return io.NopCloser(&buf), nil
+	}
+	path, err := s.PrepareZip(context.Background(), "foo", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := isCompressed(&r.Reader)
+	r.Close()
+	if !compressed {
+		t.Fatal("expected the zip to be compressed")
+	}
+
+	zf, err := s.ZipCache.Get(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zf.Close()
+	got := map[string]string{}
+	for i := range zf.Files {
+		got[zf.Files[i].Name] = string(zf.DataFor(&zf.Files[i]))
+	}
+	if diff := cmp.Diff(files, got); diff != "" {
+		t.Errorf("unexpected files (-want +got):\n%s", diff)
+	}
+	if want := len(files["main.go"]); zf.MaxLen != want {
+		t.Errorf("got MaxLen %d, want %d", zf.MaxLen, want)
+	}
+}
+
+func writeTar(t *testing.T, w io.Writer, files map[string]string) {
+	tw := tar.NewWriter(w)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+
+	now := time.Now()
+	old := now.Add(-2 * staleFileAge)
+	files := []struct {
+		name    string
+		modTime time.Time
+		keep    bool
+	}{
+		{"a.zip", old, true},
+		{"a.zip" + trigramIndexSuffix, old, true},
+		{"b.zip" + trigramIndexSuffix, now, false},
+		{"c.zip.part", old, false},
+		{"d.zip.part", now, true},
+		{"trigrams-1.tmp", old, false},
+		{"trigrams-2.tmp", now, true},
+		{"other", old, true},
+	}
+	for _, f := range files {
+		path := filepath.Join(s.Path, f.name)
+		if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, f.modTime, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := s.reconcile(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("got %d files removed, want 3", n)
+	}
+	for _, f := range files {
+		_, err := os.Stat(filepath.Join(s.Path, f.name))
+		if kept := err == nil; kept != f.keep {
+			t.Errorf("%s: got kept=%v, want %v", f.name, kept, f.keep)
+		}
+	}
+}
+
+type memObjectStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *memObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		// Like S3, the error is only reported once the object is read.
+		return io.NopCloser(iotest.ErrReader(errors.New("no such key"))), nil
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memObjectStore) Upload(ctx context.Context, key string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+	return int64(len(data)), nil
+}
+
+func TestPrepareZip_objectStore(t *testing.T) {
+	objects := &memObjectStore{objects: map[string][]byte{}}
+	var fetches int64
+	newStore := func() (*Store, func()) {
+		s, cleanup := tmpStore(t)
+		s.ObjectStore = objects
+		s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+			atomic.AddInt64(&fetches, 1)
+			var buf bytes.Buffer
+			writeTar(t, &buf, map[string]string{"README": "hi"})
+			return io.NopCloser(&buf), nil
+		}
+		return s, cleanup
+	}
+	prepare := func(s *Store) {
+		path, err := s.PrepareZip(context.Background(), "foo", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+		if err != nil {
+			t.Fatal(err)
+		}
+		zf, err := s.ZipCache.Get(context.Background(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zf.Close()
+		if len(zf.Files) != 1 || string(zf.DataFor(&zf.Files[0])) != "hi" {
+			t.Fatalf("unexpected files %v", zf.Files)
+		}
+	}
+
+	s, cleanup := newStore()
+	defer cleanup()
+
+	// The first fetch misses the object store.
+	prepare(s)
+	if n := atomic.LoadInt64(&fetches); n != 1 {
+		t.Fatalf("got %d fetches, want 1", n)
+	}
+
+	// The zip is uploaded when evicted.
+	if _, err := s.cache.Evict(0); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects.objects) != 1 {
+		t.Fatalf("got %d objects, want 1", len(objects.objects))
+	}
+
+	// The store and other replicas download it instead of fetching it.
+	prepare(s)
+	other, cleanupOther := newStore()
+	defer cleanupOther()
+	prepare(other)
+	if n := atomic.LoadInt64(&fetches); n != 1 {
+		t.Fatalf("got %d fetches, want 1", n)
+	}
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+
+	"github.com/inconshreveable/log15"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+// Submodule is a submodule of a repository at a commit.
+type Submodule struct {
+	// Path is the path of the submodule in the repository.
+	Path string
+	// Repo is the repository the submodule is cloned from.
+	Repo api.RepoName
+	// Commit is the commit of Repo the submodule is pinned to.
+	Commit api.CommitID
+}
+
+type withSubmodulesKey struct{}
+
+// WithSubmodules returns a context whose PrepareZip calls prepare zips which
+// also contain the files of the submodules of the repository, under the path
+// of each submodule. They are cached separately from the zips without them.
+func WithSubmodules(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withSubmodulesKey{}, true)
+}
+
+// includeSubmodules returns true if the zips prepared with ctx contain the
+// files of submodules.
+func includeSubmodules(ctx context.Context) bool {
+	return ctx.Value(withSubmodulesKey{}) != nil
+}
+
+// copySubmodules writes the files of the submodules of repo at commit to zw,
+// filtered like the files of repo. Submodules of submodules are not
+// included.
+//
+// Submodules which can't be fetched, for example because their repository
+// isn't cloned, are left out rather than failing the fetch of repo.
+func (s *Store) copySubmodules(ctx context.Context, zw *zip.Writer, method uint16, repo api.RepoName, commit api.CommitID, largeFilePatterns []string, filter FilterFunc) error {
+	if s.Submodules == nil {
+		return nil
+	}
+	submodules, err := s.Submodules(ctx, repo, commit)
+	if err != nil {
+		return err
+	}
+	for _, sm := range submodules {
+		r, err := s.fetchTar(ctx, s.upstream(sm.Repo), sm.Repo, sm.Commit)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log15.Warn("failed to fetch submodule archive", "repo", repo, "commit", commit, "submodule", sm.Path, "submoduleRepo", sm.Repo, "submoduleCommit", sm.Commit, "error", err)
+			submoduleFetches.WithLabelValues("error").Inc()
+			continue
+		}
+		err = copySearchable(tar.NewReader(r), sm.Path+"/", zw, method, largeFilePatterns, filter, archiveLimits{maxDepth: s.MaxArchiveDepth, maxSize: s.MaxArchiveSize})
+		r.Close()
+		if err != nil {
+			return err
+		}
+		submoduleFetches.WithLabelValues("fetched").Inc()
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestPrepareZip_submodules(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	const commit = api.CommitID("deadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, c api.CommitID) (io.ReadCloser, error) {
+		var files map[string]string
+		switch repo {
+		case "foo":
+			files = map[string]string{"README": "foo"}
+		case "lib":
+			files = map[string]string{"lib.go": "package lib"}
+		default:
+			return nil, badRequestError{string(repo) + " not found"}
+		}
+		var buf bytes.Buffer
+		writeTar(t, &buf, files)
+		return io.NopCloser(&buf), nil
+	}
+	s.Submodules = func(ctx context.Context, repo api.RepoName, c api.CommitID) ([]Submodule, error) {
+		return []Submodule{
+			{Path: "vendor/lib", Repo: "lib", Commit: "feedfacefeedfacefeedfacefeedfacefeedface"},
+			// Not cloned, so it is left out.
+			{Path: "missing", Repo: "missing", Commit: "feedfacefeedfacefeedfacefeedfacefeedface"},
+		}, nil
+	}
+
+	files := func(ctx context.Context) map[string]string {
+		path, err := s.PrepareZip(ctx, "foo", commit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zf, err := s.ZipCache.Get(context.Background(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zf.Close()
+		got := map[string]string{}
+		for i := range zf.Files {
+			got[zf.Files[i].Name] = string(zf.DataFor(&zf.Files[i]))
+		}
+		return got
+	}
+
+	want := map[string]string{"README": "foo"}
+	if diff := cmp.Diff(want, files(context.Background())); diff != "" {
+		t.Errorf("unexpected files without submodules (-want +got):\n%s", diff)
+	}
+	want = map[string]string{"README": "foo", "vendor/lib/lib.go": "package lib"}
+	if diff := cmp.Diff(want, files(WithSubmodules(context.Background()))); diff != "" {
+		t.Errorf("unexpected files with submodules (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,258 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/errors"
+)
+
+// trigramIndexSuffix is appended to the path of a zip to get the path of its
+// trigram index.
+const trigramIndexSuffix = ".trigrams"
+
+// trigramIndexMagic is the header of trigram index files. Change it when the
+// format changes, so that stale indexes are rebuilt.
+const trigramIndexMagic = "sgtrigrams1\n"
+
+// A TrigramIndex maps each trigram to the files of a ZipFile containing it.
+// Content is ASCII lowercased before it is indexed, so the index can prune
+// case sensitive and case insensitive searches alike.
+type TrigramIndex struct {
+	numFiles int
+
+	// postings maps a trigram to the sorted indexes into ZipFile.Files of
+	// the files containing it.
+	postings map[uint32][]uint32
+
+	// unindexed are the indexes of the files which aren't valid UTF-8. The
+	// searcher transcodes them before matching, so their bytes on disk don't
+	// tell which literals they contain.
+	unindexed []uint32
+}
+
+func trigram(a, b, c byte) uint32 {
+	return uint32(lowerASCII(a))<<16 | uint32(lowerASCII(b))<<8 | uint32(lowerASCII(c))
+}
+
+func lowerASCII(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// BuildTrigramIndex returns the trigram index of the files in zf.
+func BuildTrigramIndex(zf *ZipFile) *TrigramIndex {
+	ix := &TrigramIndex{
+		numFiles: len(zf.Files),
+		postings: make(map[uint32][]uint32),
+	}
+	var trigrams []uint32
+	for i := range zf.Files {
+		data := zf.DataFor(&zf.Files[i])
+		if !utf8.Valid(data) {
+			ix.unindexed = append(ix.unindexed, uint32(i))
+			continue
+		}
+
+		trigrams = trigrams[:0]
+		for j := 0; j+3 <= len(data); j++ {
+			trigrams = append(trigrams, trigram(data[j], data[j+1], data[j+2]))
+		}
+		sort.Slice(trigrams, func(a, b int) bool { return trigrams[a] < trigrams[b] })
+		for j, t := range trigrams {
+			if j > 0 && trigrams[j-1] == t {
+				continue
+			}
+			ix.postings[t] = append(ix.postings[t], uint32(i))
+		}
+	}
+	return ix
+}
+
+// Candidates returns which files of the indexed ZipFile may contain one of
+// literals: a file at index i in ZipFile.Files is a candidate if
+// candidates[i] is true. It returns nil if the index can't prune the files,
+// which is the case if there are no literals or one of them is shorter than
+// a trigram.
+func (ix *TrigramIndex) Candidates(literals [][]byte) []bool {
+	if len(literals) == 0 {
+		return nil
+	}
+	for _, lit := range literals {
+		if len(lit) < 3 {
+			return nil
+		}
+	}
+
+	candidates := make([]bool, ix.numFiles)
+	for _, lit := range literals {
+		for _, i := range ix.lookup(lit) {
+			candidates[i] = true
+		}
+	}
+	for _, i := range ix.unindexed {
+		candidates[i] = true
+	}
+	return candidates
+}
+
+// lookup returns the files containing all the trigrams of lit.
+func (ix *TrigramIndex) lookup(lit []byte) []uint32 {
+	var lists [][]uint32
+	for j := 0; j+3 <= len(lit); j++ {
+		list, ok := ix.postings[trigram(lit[j], lit[j+1], lit[j+2])]
+		if !ok {
+			return nil
+		}
+		lists = append(lists, list)
+	}
+
+	// Intersect the shortest lists first, so that the result shrinks fast.
+	sort.Slice(lists, func(a, b int) bool { return len(lists[a]) < len(lists[b]) })
+	files := lists[0]
+	for _, list := range lists[1:] {
+		files = intersect(files, list)
+		if len(files) == 0 {
+			break
+		}
+	}
+	return files
+}
+
+// intersect returns the elements of the sorted lists a and b which are in
+// both.
+func intersect(a, b []uint32) []uint32 {
+	var out []uint32
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			a = a[1:]
+		case a[0] > b[0]:
+			b = b[1:]
+		default:
+			out = append(out, a[0])
+			a, b = a[1:], b[1:]
+		}
+	}
+	return out
+}
+
+// writeTrigramIndex writes ix to path. It writes to a temporary file first,
+// so that readers never see a partially written index.
+func writeTrigramIndex(path string, ix *TrigramIndex) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "trigrams-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	putUvarint := func(x uint64) {
+		var buf [binary.MaxVarintLen64]byte
+		_, _ = w.Write(buf[:binary.PutUvarint(buf[:], x)])
+	}
+	putList := func(list []uint32) {
+		putUvarint(uint64(len(list)))
+		prev := uint32(0)
+		for _, i := range list {
+			// Lists are sorted, so we store the deltas.
+			putUvarint(uint64(i - prev))
+			prev = i
+		}
+	}
+
+	trigrams := make([]uint32, 0, len(ix.postings))
+	for t := range ix.postings {
+		trigrams = append(trigrams, t)
+	}
+	sort.Slice(trigrams, func(a, b int) bool { return trigrams[a] < trigrams[b] })
+
+	_, _ = w.WriteString(trigramIndexMagic)
+	putUvarint(uint64(ix.numFiles))
+	putList(ix.unindexed)
+	putUvarint(uint64(len(trigrams)))
+	for _, t := range trigrams {
+		putUvarint(uint64(t))
+		putList(ix.postings[t])
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// readTrigramIndex reads the trigram index at path written by
+// writeTrigramIndex.
+func readTrigramIndex(path string) (*TrigramIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	magic := make([]byte, len(trigramIndexMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != trigramIndexMagic {
+		return nil, errors.Errorf("%s is not a trigram index", path)
+	}
+
+	var readErr error
+	getUvarint := func() uint64 {
+		if readErr != nil {
+			return 0
+		}
+		var x uint64
+		x, readErr = binary.ReadUvarint(r)
+		return x
+	}
+	getList := func() []uint32 {
+		n := getUvarint()
+		if readErr != nil || n == 0 {
+			return nil
+		}
+		// n isn't trusted for preallocating, since the file may be corrupt.
+		var list []uint32
+		prev := uint32(0)
+		for j := uint64(0); j < n && readErr == nil; j++ {
+			prev += uint32(getUvarint())
+			list = append(list, prev)
+		}
+		return list
+	}
+
+	ix := &TrigramIndex{numFiles: int(getUvarint())}
+	ix.unindexed = getList()
+	n := getUvarint()
+	ix.postings = make(map[uint32][]uint32)
+	for j := uint64(0); j < n && readErr == nil; j++ {
+		t := uint32(getUvarint())
+		ix.postings[t] = getList()
+	}
+	if readErr != nil {
+		return nil, errors.Wrapf(readErr, "reading trigram index %s", path)
+	}
+	inRange := func(list []uint32) bool {
+		return len(list) == 0 || int(list[len(list)-1]) < ix.numFiles
+	}
+	if !inRange(ix.unindexed) {
+		return nil, errors.Errorf("trigram index %s is corrupt", path)
+	}
+	for _, list := range ix.postings {
+		if !inRange(list) {
+			return nil, errors.Errorf("trigram index %s is corrupt", path)
+		}
+	}
+	return ix, nil
+}
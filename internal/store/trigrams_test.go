@@ -0,0 +1,122 @@
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestTrigramIndex(t *testing.T) {
+	zf := &ZipFile{}
+	for _, content := range []string{
+		"func main() {}",
+		"package Main",
+		"hello world",
+		"\xffmain\xfe", // not UTF-8
+	} {
+		zf.Files = append(zf.Files, SrcFile{Name: content, Off: int64(len(zf.Data)), Len: int32(len(content))})
+		zf.Data = append(zf.Data, content...)
+	}
+	ix := BuildTrigramIndex(zf)
+
+	cases := []struct {
+		literals []string
+		want     []bool
+	}{
+		{literals: []string{"main"}, want: []bool{true, true, false, true}},
+		{literals: []string{"MAIN("}, want: []bool{true, false, false, true}},
+		{literals: []string{"world", "package"}, want: []bool{false, true, true, true}},
+		{literals: []string{"xyz"}, want: []bool{false, false, false, true}},
+		{literals: []string{"hello", "ma"}, want: nil},
+		{literals: nil, want: nil},
+	}
+	for _, tc := range cases {
+		var literals [][]byte
+		for _, lit := range tc.literals {
+			literals = append(literals, []byte(lit))
+		}
+		if diff := cmp.Diff(tc.want, ix.Candidates(literals)); diff != "" {
+			t.Errorf("%q: unexpected candidates (-want +got):\n%s", tc.literals, diff)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "index"+trigramIndexSuffix)
+	if err := writeTrigramIndex(path, ix); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readTrigramIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(ix, got, cmp.AllowUnexported(TrigramIndex{})); diff != "" {
+		t.Errorf("index changed by writing and reading it (-want +got):\n%s", diff)
+	}
+
+	if err := os.WriteFile(path, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readTrigramIndex(path); err == nil {
+		t.Error("expected reading an invalid index to fail")
+	}
+}
+
+func TestPrepareZip_trigramIndex(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	s.BuildTrigramIndexes = true
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		buf := new(bytes.Buffer)
+		w := tar.NewWriter(buf)
+		body := "hello world"
+		if err := w.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0600, Size: int64(len(body))}); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(buf), nil
+	}
+
+	path, err := s.PrepareZip(context.Background(), "somerepo", "0123456789012345678901234567890123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The index is built in the background.
+	var ix *TrigramIndex
+	for i := 0; i < 500 && ix == nil; i++ {
+		zf, err := s.ZipCache.Get(context.Background(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ix = zf.TrigramIndex()
+		zf.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ix == nil {
+		t.Fatal("timed out waiting for the trigram index")
+	}
+	if diff := cmp.Diff([]bool{false}, ix.Candidates([][]byte{[]byte("goodbye")})); diff != "" {
+		t.Errorf("unexpected candidates (-want +got):\n%s", diff)
+	}
+
+	// The index is evicted with its zip.
+	if _, err := s.cache.Evict(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + trigramIndexSuffix); !os.IsNotExist(err) {
+		t.Errorf("expected trigram index to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+	"github.com/sourcegraph/sourcegraph/internal/mutablelimiter"
+)
+
+// upstream returns the name of the upstream repo is fetched from. It is
+// empty if Upstream is not set.
+func (s *Store) upstream(repo api.RepoName) string {
+	if s.Upstream == nil {
+		return ""
+	}
+	return s.Upstream(repo)
+}
+
+// acquireUpstream waits until a fetch from upstream is allowed by
+// MaxFetchesPerUpstream. The returned function must be called once the fetch
+// is done. If ctx is done before, its error is returned.
+func (s *Store) acquireUpstream(ctx context.Context, upstream string) (context.Context, context.CancelFunc, error) {
+	if s.MaxFetchesPerUpstream <= 0 {
+		return ctx, func() {}, nil
+	}
+	l, ok := s.upstreamLimiters.Load(upstream)
+	if !ok {
+		// Upstreams are few, like the gitservers, so the goroutines of the
+		// limiters are bounded.
+		l, _ = s.upstreamLimiters.LoadOrStore(upstream, mutablelimiter.New(s.MaxFetchesPerUpstream))
+	}
+
+	upstreamFetchQueueSize.WithLabelValues(upstream).Inc()
+	ctx, release, err := l.(*mutablelimiter.Limiter).Acquire(ctx)
+	upstreamFetchQueueSize.WithLabelValues(upstream).Dec()
+	if err != nil {
+		return nil, nil, err
+	}
+	upstreamFetching.WithLabelValues(upstream).Inc()
+	return ctx, func() {
+		release()
+		upstreamFetching.WithLabelValues(upstream).Dec()
+	}, nil
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/internal/api"
+)
+
+func TestPrepareZip_maxFetchesPerUpstream(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	s.MaxFetchesPerUpstream = 1
+	s.Upstream = func(repo api.RepoName) string {
+		return "gitserver-0"
+	}
+	var running int32
+	release := make(chan struct{})
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		if n := atomic.AddInt32(&running, 1); n > 1 {
+			t.Errorf("got %d concurrent fetches from the upstream, want 1", n)
+		}
+		<-release
+		var buf bytes.Buffer
+		writeTar(t, &buf, map[string]string{"README": string(repo)})
+		atomic.AddInt32(&running, -1)
+		return io.NopCloser(&buf), nil
+	}
+
+	var wg sync.WaitGroup
+	for _, repo := range []api.RepoName{"foo", "bar"} {
+		wg.Add(1)
+		go func(repo api.RepoName) {
+			defer wg.Done()
+			if _, err := s.PrepareZip(context.Background(), repo, "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"); err != nil {
+				t.Error(err)
+			}
+		}(repo)
+	}
+
+	// Give the second fetch time to start if it isn't queued.
+	time.Sleep(50 * time.Millisecond)
+	release <- struct{}{}
+	release <- struct{}{}
+	wg.Wait()
+}
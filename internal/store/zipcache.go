@@ -2,22 +2,48 @@ package store
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
 	"fmt"
+	"hash/crc32"
 	"hash/fnv"
 	"io"
 	"log"
+	"math"
 	"os"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/klauspost/compress/zstd"
 	"golang.org/x/sys/unix"
 )
 
 // A ZipCache is a shared data structure that provides efficient access to a collection of zip files.
 // The zero value is usable.
 type ZipCache struct {
+	// verifyChecksums if true checks the CRC-32 of every file of a zip when
+	// it is read from disk. It is set by Store.Start.
+	verifyChecksums bool
+
+	// key holds the archiveKey which decrypts the data keys of encrypted
+	// zips. It is set by Store.SetEncryptionKey.
+	key atomic.Value
+
+	// maxBytes is the budget for the total size of the zip files in the
+	// cache. Zero means no budget. It is accessed atomically.
+	maxBytes int64
+
+	// bytes is the total size of the zip files in the cache. It is accessed
+	// atomically.
+	bytes int64
+
+	// evicting is 1 while evict runs, accessed atomically.
+	evicting int32
+
 	// Split the cache into many parts, to minimize lock contention.
 	// This matters because, for simplicity,
 	// we sometimes hold the lock for long-running operations,
@@ -42,7 +68,8 @@ func (c *ZipCache) shardFor(path string) *zipCacheShard {
 
 // Get returns a zipFile for the file on disk at path.
 // The file MUST be Closed when it is no longer needed.
-func (c *ZipCache) Get(path string) (*ZipFile, error) {
+// ctx bounds decrypting the file if it is encrypted.
+func (c *ZipCache) Get(ctx context.Context, path string) (*ZipFile, error) {
 	shard := c.shardFor(path)
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
@@ -51,21 +78,129 @@ func (c *ZipCache) Get(path string) (*ZipFile, error) {
 	}
 	zf, ok := shard.m[path]
 	if ok {
-		zf.wg.Add(1)
+		zf.acquire()
 		return zf, nil
 	}
 	// Cache miss.
 	// Reading zip files is fast enough that we can populate the map in-band,
 	// which also conveniently provides free single-flighting.
-	zf, err := readZipFile(path)
+	zf, err := readZipFile(ctx, path, c.verifyChecksums, c.encryptionKey())
 	if err != nil {
 		return nil, err
 	}
 	shard.m[path] = zf
-	zf.wg.Add(1)
+	zf.acquire()
+	c.add(int64(len(zf.Data)), 1)
+	if maxBytes := atomic.LoadInt64(&c.maxBytes); maxBytes > 0 && atomic.LoadInt64(&c.bytes) > maxBytes {
+		// Evicting locks the shards, so it can't wait on shard.mu.
+		if atomic.CompareAndSwapInt32(&c.evicting, 0, 1) {
+			go func() {
+				defer atomic.StoreInt32(&c.evicting, 0)
+				c.evict(maxBytes)
+			}()
+		}
+	}
 	return zf, nil
 }
 
+// encryptionKey returns the key which encrypts and decrypts zips. Its zero
+// value means that zips aren't encrypted.
+func (c *ZipCache) encryptionKey() archiveKey {
+	k, _ := c.key.Load().(archiveKey)
+	return k
+}
+
+func (c *ZipCache) setKey(k archiveKey) {
+	c.key.Store(k)
+}
+
+// SetMaxBytes sets the budget for the total size of the zip files in the
+// cache. Once it is exceeded the least recently used zip files are unmapped,
+// to be read from disk again when they are next used. Zip files in use are
+// not evicted, so the cache can temporarily exceed the budget. Zero means no
+// budget.
+func (c *ZipCache) SetMaxBytes(n int64) {
+	atomic.StoreInt64(&c.maxBytes, n)
+}
+
+// add records that n zip files of the given size were added to the cache, or
+// removed if they are negative.
+func (c *ZipCache) add(size int64, n int) {
+	atomic.AddInt64(&c.bytes, size)
+	zipCacheBytes.Add(float64(size))
+	zipCacheFiles.Add(float64(n))
+}
+
+// size returns the total size of the zip files in the cache.
+func (c *ZipCache) size() int64 {
+	return atomic.LoadInt64(&c.bytes)
+}
+
+// has returns whether the zip file at path is in the cache.
+func (c *ZipCache) has(path string) bool {
+	shard := c.shardFor(path)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	_, ok := shard.m[path]
+	return ok
+}
+
+// evict removes the least recently used zip files which are not in use until
+// the total size of the cache is at most maxBytes.
+func (c *ZipCache) evict(maxBytes int64) {
+	type candidate struct {
+		shard    *zipCacheShard
+		path     string
+		lastUsed int64
+	}
+	var candidates []candidate
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mu.Lock()
+		for path, zf := range shard.m {
+			if atomic.LoadInt32(&zf.refs) == 0 {
+				candidates = append(candidates, candidate{shard: shard, path: path, lastUsed: zf.lastUsed})
+			}
+		}
+		shard.mu.Unlock()
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].lastUsed < candidates[j].lastUsed })
+
+	for _, cand := range candidates {
+		if atomic.LoadInt64(&c.bytes) <= maxBytes {
+			return
+		}
+		shard := cand.shard
+		shard.mu.Lock()
+		// The zip file may have been used or deleted since we listed it.
+		// Since Get only acquires it with shard.mu held, it can't be
+		// acquired once we checked refs.
+		if zf, ok := shard.m[cand.path]; ok && atomic.LoadInt32(&zf.refs) == 0 {
+			c.remove(shard, cand.path, zf)
+			zipCacheEvictions.Inc()
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// remove releases zf and removes it from shard, whose lock must be held.
+func (c *ZipCache) remove(shard *zipCacheShard, path string, zf *ZipFile) {
+	zf.release()
+	delete(shard.m, path)
+	c.add(-int64(len(zf.Data)), -1)
+}
+
+// setTrigramIndex sets the trigram index of the zip file at path, if it is
+// in the cache. Zip files read later load their index from disk.
+func (c *ZipCache) setTrigramIndex(path string, ix *TrigramIndex) {
+	shard := c.shardFor(path)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if zf, ok := shard.m[path]; ok {
+		zf.trigrams.Store(ix)
+	}
+}
+
 func (c *ZipCache) delete(path string) {
 	shard := c.shardFor(path)
 	shard.mu.Lock()
@@ -77,19 +212,22 @@ func (c *ZipCache) delete(path string) {
 	}
 	// Wait for all clients using this zipFile to complete their work.
 	zf.wg.Wait()
-	// Mock zipFiles have nil f. Only try to munmap and close f if it is non-nil.
-	if zf.f != nil {
-		// For now, only log errors here.
-		// These calls shouldn't ever fail, and if they do,
-		// there's not much to do about it; best to just limp along.
-		if err := unix.Munmap(zf.Data); err != nil {
-			log.Printf("failed to munmap %q: %v", zf.f.Name(), err)
-		}
-		if err := zf.f.Close(); err != nil {
-			log.Printf("failed to close %q: %v", zf.f.Name(), err)
+	c.remove(shard, path, zf)
+}
+
+// Close waits for all clients using the zip files in the cache to complete
+// their work, then unmaps and closes the zip files. The cache is empty
+// afterwards.
+func (c *ZipCache) Close() {
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mu.Lock()
+		for path, zf := range shard.m {
+			zf.wg.Wait()
+			c.remove(shard, path, zf)
 		}
+		shard.mu.Unlock()
 	}
-	delete(shard.m, path)
 }
 
 // ZipFile provides efficient access to a single zip file.
@@ -101,9 +239,53 @@ type ZipFile struct {
 	Data   []byte
 	f      *os.File
 	wg     sync.WaitGroup // ensures underlying file is not munmap'd or closed while in use
+
+	// refs is the number of users of the zip file, accessed atomically. It
+	// is only incremented with the lock of the shard of the zip file held.
+	refs int32
+	// lastUsed is the time in Unix nanoseconds the zip file was last
+	// acquired. It is protected by the lock of the shard of the zip file.
+	lastUsed int64
+
+	trigrams atomic.Value // *TrigramIndex
 }
 
-func readZipFile(path string) (*ZipFile, error) {
+// TrigramIndex returns the trigram index of zf, or nil if it doesn't have
+// one.
+func (zf *ZipFile) TrigramIndex() *TrigramIndex {
+	ix, _ := zf.trigrams.Load().(*TrigramIndex)
+	return ix
+}
+
+// acquire records a new user of zf. The lock of the shard of zf must be held.
+func (zf *ZipFile) acquire() {
+	zf.wg.Add(1)
+	atomic.AddInt32(&zf.refs, 1)
+	zf.lastUsed = time.Now().UnixNano()
+}
+
+// release unmaps and closes the underlying file of zf.
+func (zf *ZipFile) release() {
+	// Mock and decompressed zipFiles have nil f. Only try to munmap and close f if it is non-nil.
+	if zf.f == nil {
+		return
+	}
+	// For now, only log errors here.
+	// These calls shouldn't ever fail, and if they do,
+	// there's not much to do about it; best to just limp along.
+	if err := unix.Munmap(zf.Data); err != nil {
+		log.Printf("failed to munmap %q: %v", zf.f.Name(), err)
+	}
+	if err := zf.f.Close(); err != nil {
+		log.Printf("failed to close %q: %v", zf.f.Name(), err)
+	}
+}
+
+// readZipFile reads the zip file at path. If verify is true the checksums of
+// its files are checked. Encrypted zips are decrypted with the data key
+// encrypted with k. Zips which can't be read because they are corrupt
+// return an error for which isCorruptZip is true.
+func readZipFile(ctx context.Context, path string, verify bool, k archiveKey) (*ZipFile, error) {
 	// Open zip file at path, prepare to read it.
 	f, err := os.Open(path)
 	if err != nil {
@@ -111,29 +293,179 @@ func readZipFile(path string) (*ZipFile, error) {
 	}
 	fi, err := f.Stat()
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
-	r, err := zip.NewReader(f, fi.Size())
-	if err != nil {
-		return nil, err
+
+	var zf *ZipFile
+	if magic := make([]byte, len(encryptedMagic)); fi.Size() >= int64(len(magic)) {
+		if _, err := f.ReadAt(magic, 0); err == nil && isEncrypted(magic) {
+			// Like compressed files, encrypted files are held in memory
+			// rather than mapped, so that no plaintext is written to disk.
+			zf, err = readEncryptedZipFile(ctx, path, f, fi.Size(), k)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if zf == nil {
+		zf, err = readPlainZipFile(path, f, fi.Size(), verify)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Create at populate ZipFile from contents.
-	zf := &ZipFile{f: f}
-	if err := zf.PopulateFiles(r); err != nil {
-		return nil, err
+	// The trigram index is optional, so we search without it if it is
+	// missing or doesn't belong to this zip.
+	if ix, err := readTrigramIndex(path + trigramIndexSuffix); err == nil && ix.numFiles == len(zf.Files) {
+		zf.trigrams.Store(ix)
+	} else if err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to read trigram index for %q: %v", path, err)
 	}
 
-	// mmap file
-	zf.Data, err = unix.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	return zf, nil
+}
+
+// readPlainZipFile reads the zip file f at path, which isn't encrypted. The
+// files of stored zips are mapped from f, which is closed with the ZipFile.
+func readPlainZipFile(path string, f *os.File, size int64, verify bool) (*ZipFile, error) {
+	r, err := zip.NewReader(f, size)
 	if err != nil {
-		return nil, err
+		f.Close()
+		return nil, &corruptZipError{path: path, err: err}
+	}
+
+	var zf *ZipFile
+	if isCompressed(r) {
+		// The files can't be used in place, so we decompress them into
+		// memory and don't need f afterwards. Decompressing always checks
+		// the checksums.
+		zf, err = decompressZipFile(r)
+		f.Close()
+		if err != nil {
+			return nil, &corruptZipError{path: path, err: err}
+		}
+	} else {
+		// Create at populate ZipFile from contents.
+		zf = &ZipFile{f: f}
+		if err := zf.PopulateFiles(r); err != nil {
+			f.Close()
+			return nil, &corruptZipError{path: path, err: err}
+		}
+
+		// mmap file
+		zf.Data, err = unix.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := unix.Madvise(zf.Data, syscall.MADV_SEQUENTIAL); err != nil {
+			// best effort at optimization, so only log failures here
+			log.Printf("failed to madvise for %q: %v", path, err)
+		}
+
+		if verify {
+			if err := verifyChecksums(r, zf.Data); err != nil {
+				zf.release()
+				return nil, &corruptZipError{path: path, err: err}
+			}
+		}
+	}
+	return zf, nil
+}
+
+// verifyChecksums checks the CRC-32 of the stored files of r against their
+// content in data, which holds the whole zip.
+func verifyChecksums(r *zip.Reader, data []byte) error {
+	for _, file := range r.File {
+		off, err := file.DataOffset()
+		if err != nil {
+			return err
+		}
+		end := off + int64(file.UncompressedSize64)
+		if end > int64(len(data)) {
+			return errors.Errorf("file %s extends past the end of the zip", file.Name)
+		}
+		if crc32.ChecksumIEEE(data[off:end]) != file.CRC32 {
+			return errors.Wrapf(zip.ErrChecksum, "file %s", file.Name)
+		}
+	}
+	return nil
+}
+
+// corruptZipError is returned for a zip file which can't be read or whose
+// files don't match their checksums, for example because it was truncated
+// when the disk filled up. It doesn't get better with time, so the zip
+// should be fetched again.
+type corruptZipError struct {
+	path string
+	err  error
+}
+
+func (e *corruptZipError) Error() string {
+	return fmt.Sprintf("corrupt zip file %s: %v", e.path, e.err)
+}
+
+func (e *corruptZipError) Unwrap() error {
+	return e.err
+}
+
+// isCorruptZip returns whether err is caused by a corrupt zip file.
+func isCorruptZip(err error) bool {
+	var e *corruptZipError
+	return errors.As(err, &e)
+}
+
+// isCompressed returns whether any file of r is compressed.
+func isCompressed(r *zip.Reader) bool {
+	for _, file := range r.File {
+		if file.Method != zip.Store {
+			return true
+		}
 	}
-	if err := unix.Madvise(zf.Data, syscall.MADV_SEQUENTIAL); err != nil {
-		// best effort at optimization, so only log failures here
-		log.Printf("failed to madvise for %q: %v", path, err)
+	return false
+}
+
+// decompressZipFile returns a ZipFile holding the files of r in memory. The
+// files must be stored or compressed with zstd, like the zips written by
+// Store when CompressArchives is set.
+func decompressZipFile(r *zip.Reader) (*ZipFile, error) {
+	r.RegisterDecompressor(zstd.ZipMethodWinZip, zstd.ZipDecompressor())
+
+	var total uint64
+	for _, file := range r.File {
+		total += file.UncompressedSize64
 	}
+	buf := bytes.NewBuffer(make([]byte, 0, total))
 
+	zf := &ZipFile{Files: make([]SrcFile, len(r.File))}
+	for i, file := range r.File {
+		if file.Method != zip.Store && file.Method != zstd.ZipMethodWinZip {
+			return nil, errors.Errorf("file %s stored with compression %v, want %v or %v", file.Name, file.Method, zip.Store, zstd.ZipMethodWinZip)
+		}
+		if file.UncompressedSize64 > math.MaxInt32 {
+			return nil, errors.Errorf("file %s has size > 2gb: %v", file.Name, file.UncompressedSize64)
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		off := buf.Len()
+		_, err = io.Copy(buf, rc)
+		if err1 := rc.Close(); err == nil {
+			err = err1
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decompress %s", file.Name)
+		}
+		size := buf.Len() - off
+		zf.Files[i] = SrcFile{Name: file.Name, Off: int64(off), Len: int32(size), ModTime: file.Modified.Unix()}
+		if size > zf.MaxLen {
+			zf.MaxLen = size
+		}
+	}
+	zf.Data = buf.Bytes()
 	return zf, nil
 }
 
@@ -151,7 +483,7 @@ func (f *ZipFile) PopulateFiles(r *zip.Reader) error {
 		if uint64(size) != file.UncompressedSize64 {
 			return errors.Errorf("file %s has size > 2gb: %v", file.Name, size)
 		}
-		f.Files[i] = SrcFile{Name: file.Name, Off: off, Len: int32(size)}
+		f.Files[i] = SrcFile{Name: file.Name, Off: off, Len: int32(size), ModTime: file.Modified.Unix()}
 		if size > f.MaxLen {
 			f.MaxLen = size
 		}
@@ -170,6 +502,7 @@ func (f *ZipFile) PopulateFiles(r *zip.Reader) error {
 // Contents from any SrcFile from within f MUST NOT be used after
 // Close has been called.
 func (f *ZipFile) Close() {
+	atomic.AddInt32(&f.refs, -1)
 	f.wg.Done()
 }
 
@@ -183,6 +516,11 @@ type SrcFile struct {
 	Name string
 	Off  int64
 	Len  int32
+
+	// ModTime is the modification time of the file in Unix seconds, as
+	// recorded in the archive. Archives created by git use the time of the
+	// commit for all files.
+	ModTime int64
 }
 
 // Data returns the contents of s, which is a SrcFile in f.
@@ -1,10 +1,13 @@
 package store
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/sourcegraph/sourcegraph/internal/api"
 )
@@ -32,7 +35,7 @@ func TestZipCacheDelete(t *testing.T) {
 	}
 
 	// Load into zip cache.
-	zf, err := s.ZipCache.Get(path)
+	zf, err := s.ZipCache.Get(context.Background(), path)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -60,3 +63,147 @@ func TestZipCacheDelete(t *testing.T) {
 		t.Errorf("expected non-existence error, got %v", err)
 	}
 }
+
+func TestZipCacheClose(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		return emptyTar(t), nil
+	}
+
+	path, err := s.PrepareZip(context.Background(), "somerepo", "0123456789012345678901234567890123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zf, err := s.ZipCache.Get(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Close waits for the zipFile to be released.
+	closed := make(chan struct{})
+	go func() {
+		s.ZipCache.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while the zipFile was in use")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	zf.Close()
+	<-closed
+
+	if n := s.ZipCache.count(); n != 0 {
+		t.Fatalf("expected 0 items in cache, got %d", n)
+	}
+}
+
+func TestZipCacheCorrupt(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+	s.VerifyArchives = true
+
+	var fetches int
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		fetches++
+		var buf bytes.Buffer
+		writeTar(t, &buf, map[string]string{"README": "hello world"})
+		return io.NopCloser(&buf), nil
+	}
+	get := func() (string, *ZipFile, error) {
+		path, err := s.PrepareZip(context.Background(), "somerepo", "0123456789012345678901234567890123456789")
+		if err != nil {
+			return "", nil, err
+		}
+		zf, err := s.ZipCache.Get(context.Background(), path)
+		return path, zf, err
+	}
+
+	path, err := s.PrepareZip(context.Background(), "somerepo", "0123456789012345678901234567890123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a byte of the content of README.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(data, []byte("hello world"))
+	if i < 0 {
+		t.Fatal("content of README not found in zip")
+	}
+	data[i] = 'j'
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.ZipCache.Get(context.Background(), path); !isCorruptZip(err) {
+		t.Fatalf("expected a corrupt zip error, got %v", err)
+	}
+
+	// The corrupt zip is fetched again.
+	_, zf, err := GetZipFileWithRetry(get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zf.Close()
+	if got := string(zf.DataFor(&zf.Files[0])); got != "hello world" {
+		t.Errorf("got content %q, want %q", got, "hello world")
+	}
+	if fetches != 2 {
+		t.Errorf("got %d fetches, want 2", fetches)
+	}
+}
+
+func TestZipCacheMaxBytes(t *testing.T) {
+	s, cleanup := tmpStore(t)
+	defer cleanup()
+
+	s.FetchTar = func(ctx context.Context, repo api.RepoName, commit api.CommitID) (io.ReadCloser, error) {
+		var buf bytes.Buffer
+		writeTar(t, &buf, map[string]string{"README": string(repo)})
+		return io.NopCloser(&buf), nil
+	}
+	get := func(repo api.RepoName) (string, *ZipFile) {
+		path, err := s.PrepareZip(context.Background(), repo, "0123456789012345678901234567890123456789")
+		if err != nil {
+			t.Fatal(err)
+		}
+		zf, err := s.ZipCache.Get(context.Background(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path, zf
+	}
+
+	// The budget fits a single zip.
+	_, a := get("a")
+	s.ZipCache.SetMaxBytes(int64(len(a.Data)))
+	a.Close()
+
+	pathB, b := get("b")
+	defer b.Close()
+
+	// a is evicted in the background, but b is in use.
+	for i := 0; s.ZipCache.count() != 1; i++ {
+		if i == 500 {
+			t.Fatalf("timed out waiting for eviction, %d zips in cache", s.ZipCache.count())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	shard := s.ZipCache.shardFor(pathB)
+	shard.mu.Lock()
+	_, ok := shard.m[pathB]
+	shard.mu.Unlock()
+	if !ok {
+		t.Fatal("expected the zip in use to stay in the cache")
+	}
+	if got, want := atomic.LoadInt64(&s.ZipCache.bytes), int64(len(b.Data)); got != want {
+		t.Errorf("got %d bytes in cache, want %d", got, want)
+	}
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/sourcegraph/sourcegraph/internal/api"
 	"github.com/sourcegraph/sourcegraph/internal/repotrackutil"
+	"github.com/sourcegraph/sourcegraph/internal/requestid"
 	"github.com/sourcegraph/sourcegraph/internal/sentry"
 	"github.com/sourcegraph/sourcegraph/internal/trace/ot"
 )
@@ -157,6 +158,13 @@ func HTTPTraceMiddleware(next http.Handler) http.Handler {
 		rw.Header().Set("X-Trace", traceURL)
 		ctx = opentracing.ContextWithSpan(ctx, span)
 
+		// Reuse the request ID of the calling service, if any, so that a
+		// request can be followed across services.
+		requestID := requestid.FromRequest(r)
+		rw.Header().Set(requestid.Header, requestID)
+		span.SetTag("requestID", requestID)
+		ctx = requestid.WithRequestID(ctx, requestID)
+
 		routeName := "unknown"
 		ctx = context.WithValue(ctx, routeNameKey, &routeName)
 
@@ -195,7 +203,7 @@ func HTTPTraceMiddleware(next http.Handler) http.Handler {
 			"repo":   repotrackutil.GetTrackedRepo(api.RepoName(r.URL.Path)),
 			"origin": origin,
 		}
-		requestDuration.With(labels).Observe(m.Duration.Seconds())
+		ot.ObserveWithTraceExemplar(ctx, requestDuration.With(labels), m.Duration.Seconds())
 		requestHeartbeat.With(labels).Set(float64(time.Now().Unix()))
 
 		// if it's not a graphql request, then this includes graphql_error=false in the log entry
@@ -227,6 +235,7 @@ func HTTPTraceMiddleware(next http.Handler) http.Handler {
 				"url", r.URL.String(),
 				"code", m.Code,
 				"duration", m.Duration,
+				"requestID", requestID,
 			)
 
 			if traceID != "" {
@@ -272,6 +281,7 @@ func HTTPTraceMiddleware(next http.Handler) http.Handler {
 				"duration":        m.Duration.String(),
 				"graphql_error":   strconv.FormatBool(gqlErr),
 				"trace":           traceURL,
+				"request_id":      requestID,
 			})
 		}
 	}))
@@ -0,0 +1,41 @@
+package ot
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/uber/jaeger-client-go"
+)
+
+// exemplarTraceIDLabel is the exemplar label holding the trace ID. It is the
+// label Grafana looks for to link exemplars to traces.
+const exemplarTraceIDLabel = "traceID"
+
+// ObserveWithTraceExemplar records v on o. If ctx carries a sampled trace and o
+// supports exemplars, the trace ID is attached to the observation as an
+// exemplar, so that a latency spike on a dashboard links to a representative
+// trace.
+func ObserveWithTraceExemplar(ctx context.Context, o prometheus.Observer, v float64) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok {
+		if traceID := sampledTraceID(ctx); traceID != "" {
+			eo.ObserveWithExemplar(v, prometheus.Labels{exemplarTraceIDLabel: traceID})
+			return
+		}
+	}
+	o.Observe(v)
+}
+
+// sampledTraceID returns the ID of the trace of ctx, if it is sampled. Traces
+// that aren't sampled can't be looked up, so they aren't useful as exemplars.
+func sampledTraceID(ctx context.Context) string {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+	spanCtx, ok := span.Context().(jaeger.SpanContext)
+	if !ok || !spanCtx.IsSampled() {
+		return ""
+	}
+	return spanCtx.TraceID().String()
+}
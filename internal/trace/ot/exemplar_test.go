@@ -0,0 +1,45 @@
+package ot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestObserveWithTraceExemplar(t *testing.T) {
+	for _, sampled := range []bool{true, false} {
+		tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(sampled), jaeger.NewNullReporter())
+		defer closer.Close()
+
+		span := tracer.StartSpan("test")
+		ctx := opentracing.ContextWithSpan(context.Background(), span)
+
+		h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test", Buckets: []float64{1}})
+		ObserveWithTraceExemplar(ctx, h, 0.5)
+
+		var m dto.Metric
+		if err := h.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		if have := m.GetHistogram().GetSampleCount(); have != 1 {
+			t.Fatalf("unexpected sample count. want=1 have=%d", have)
+		}
+
+		exemplar := m.GetHistogram().GetBucket()[0].GetExemplar()
+		if !sampled {
+			if exemplar != nil {
+				t.Fatalf("unexpected exemplar for unsampled trace: %v", exemplar)
+			}
+			continue
+		}
+
+		want := span.Context().(jaeger.SpanContext).TraceID().String()
+		if exemplar == nil || len(exemplar.GetLabel()) != 1 || exemplar.GetLabel()[0].GetValue() != want {
+			t.Fatalf("unexpected exemplar. want trace ID %q, have %v", want, exemplar)
+		}
+	}
+}
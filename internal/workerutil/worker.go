@@ -31,6 +31,8 @@ type Worker struct {
 	cancel           func()          // cancels the root context
 	wg               sync.WaitGroup  // tracks active handler routines
 	finished         chan struct{}   // signals that Start has finished
+	draining         chan struct{}   // signals that no new records should be dequeued
+	drainOnce        sync.Once       // guards closing draining
 	runningIDSet     *IDSet          // tracks the running job IDs to heartbeat
 }
 
@@ -106,6 +108,7 @@ func newWorker(ctx context.Context, store Store, handler Handler, options Worker
 		ctx:              ctx,
 		cancel:           cancel,
 		finished:         make(chan struct{}),
+		draining:         make(chan struct{}),
 		runningIDSet:     newIDSet(),
 	}
 }
@@ -188,6 +191,9 @@ loop:
 		case <-w.dequeueClock.After(delay):
 		case <-w.ctx.Done():
 			break loop
+		case <-w.draining:
+			reason = "Draining"
+			break loop
 		case <-shutdownChan:
 			reason = "MaxActiveTime elapsed"
 			break loop
@@ -206,6 +212,22 @@ func (w *Worker) Stop() {
 	w.Wait()
 }
 
+// Drain will cause the worker loop to exit without dequeueing new records, and waits for the
+// handlers of the records that are currently being processed to finish, so that they are not
+// interrupted halfway. Once the timeout has elapsed, the remaining handlers are canceled as in
+// Stop. This method blocks until all handler goroutines have exited.
+func (w *Worker) Drain(timeout time.Duration) {
+	w.drainOnce.Do(func() { close(w.draining) })
+
+	select {
+	case <-w.finished:
+	case <-w.shutdownClock.After(timeout):
+		log15.Warn("Timed out draining worker, canceling remaining handlers", "name", w.options.Name, "ids", w.runningIDSet.Slice())
+	}
+
+	w.Stop()
+}
+
 // Wait blocks until all handler goroutines have exited.
 func (w *Worker) Wait() {
 	<-w.finished
@@ -221,12 +243,21 @@ func (w *Worker) Cancel(id int) {
 // can be dequeued and returns an error only on failure to dequeue a new record - no handler errors
 // will bubble up.
 func (w *Worker) dequeueAndHandle() (dequeued bool, err error) {
+	select {
+	case <-w.draining:
+		// Don't start new work while draining, even if a handler slot is free
+		return false, nil
+	default:
+	}
+
 	select {
 	// If we block here we are waiting for a handler to exit so that we do not
 	// exceed our configured concurrency limit.
 	case <-w.handlerSemaphore:
 	case <-w.ctx.Done():
 		return false, w.ctx.Err()
+	case <-w.draining:
+		return false, nil
 	}
 	defer func() {
 		if !dequeued {
@@ -545,3 +545,111 @@ func TestWorkerCancel(t *testing.T) {
 		t.Fatal("timeout waiting for markFailed call")
 	}
 }
+
+func TestWorkerDrain(t *testing.T) {
+	store := NewMockStore()
+	store.DequeueFunc.PushReturn(TestRecord{ID: 42}, true, nil)
+	store.DequeueFunc.PushReturn(TestRecord{ID: 43}, true, nil)
+	store.DequeueFunc.SetDefaultReturn(nil, false, nil)
+	store.MarkCompleteFunc.SetDefaultReturn(true, nil)
+
+	handler := NewMockHandler()
+	options := WorkerOptions{
+		Name:              "test",
+		WorkerHostname:    "test",
+		NumHandlers:       1,
+		HeartbeatInterval: time.Second,
+		Interval:          time.Second,
+		Metrics:           NewMetrics(&observation.TestContext, "", nil),
+	}
+
+	dequeued := make(chan struct{})
+	doneHandling := make(chan struct{})
+	handler.HandleFunc.SetDefaultHook(func(ctx context.Context, r Record) error {
+		close(dequeued)
+		select {
+		case <-ctx.Done():
+		case <-doneHandling:
+		}
+		return ctx.Err()
+	})
+
+	dequeueClock := glock.NewMockClock()
+	heartbeatClock := glock.NewMockClock()
+	shutdownClock := glock.NewMockClock()
+	worker := newWorker(context.Background(), store, handler, options, dequeueClock, heartbeatClock, shutdownClock)
+	go func() { worker.Start() }()
+
+	// Wait until a job has been dequeued.
+	<-dequeued
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		worker.Drain(time.Minute)
+	}()
+
+	// The running job finishes before the drain timeout. No new job is
+	// dequeued once draining started.
+	<-worker.draining
+	close(doneHandling)
+	<-drained
+
+	if callCount := len(handler.HandleFunc.History()); callCount != 1 {
+		t.Errorf("unexpected handle call count. want=%d have=%d", 1, callCount)
+	}
+	if callCount := len(store.MarkCompleteFunc.History()); callCount != 1 {
+		t.Errorf("unexpected mark complete call count. want=%d have=%d", 1, callCount)
+	}
+	if callCount := len(store.MarkFailedFunc.History()); callCount != 0 {
+		t.Errorf("unexpected mark failed call count. want=%d have=%d", 0, callCount)
+	}
+}
+
+func TestWorkerDrainTimeout(t *testing.T) {
+	store := NewMockStore()
+	store.DequeueFunc.PushReturn(TestRecord{ID: 42}, true, nil)
+	store.DequeueFunc.SetDefaultReturn(nil, false, nil)
+	store.MarkFailedFunc.SetDefaultReturn(true, nil)
+	store.MarkErroredFunc.SetDefaultReturn(true, nil)
+
+	handler := NewMockHandler()
+	options := WorkerOptions{
+		Name:              "test",
+		WorkerHostname:    "test",
+		NumHandlers:       1,
+		HeartbeatInterval: time.Second,
+		Interval:          time.Second,
+		Metrics:           NewMetrics(&observation.TestContext, "", nil),
+	}
+
+	dequeued := make(chan struct{})
+	handler.HandleFunc.SetDefaultHook(func(ctx context.Context, r Record) error {
+		close(dequeued)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	dequeueClock := glock.NewMockClock()
+	heartbeatClock := glock.NewMockClock()
+	shutdownClock := glock.NewMockClock()
+	worker := newWorker(context.Background(), store, handler, options, dequeueClock, heartbeatClock, shutdownClock)
+	go func() { worker.Start() }()
+
+	// Wait until a job has been dequeued.
+	<-dequeued
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		worker.Drain(time.Minute)
+	}()
+
+	// The running job is canceled once the drain timeout has elapsed.
+	shutdownClock.BlockingAdvance(time.Minute)
+	<-drained
+
+	if callCount := len(handler.HandleFunc.History()); callCount != 1 {
+		t.Errorf("unexpected handle call count. want=%d have=%d", 1, callCount)
+	}
+}
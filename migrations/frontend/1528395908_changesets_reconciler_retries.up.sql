@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE changesets ADD COLUMN IF NOT EXISTS reconciler_retries integer NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN changesets.reconciler_retries IS 'The number of times the changeset was requeued by the reconciler janitor after the reconciler exhausted its retries.';
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE batch_changes ADD COLUMN IF NOT EXISTS completion_notified_at timestamp with time zone;
+
+COMMENT ON COLUMN batch_changes.completion_notified_at IS 'The time at which the author was notified that all changesets of the batch change reached a final state on the code host.';
+
+COMMIT;
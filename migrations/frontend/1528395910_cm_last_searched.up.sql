@@ -0,0 +1,14 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS cm_last_searched (
+    monitor_id bigint NOT NULL REFERENCES cm_monitors(id) ON DELETE CASCADE,
+    repo_id integer NOT NULL REFERENCES repo(id) ON DELETE CASCADE,
+    commit_oids text[] NOT NULL,
+    PRIMARY KEY (monitor_id, repo_id)
+);
+
+COMMENT ON TABLE cm_last_searched IS 'The commits of each repository that were searched by the last run of a code monitor. The next run only searches commits added since.';
+
+COMMENT ON COLUMN cm_last_searched.commit_oids IS 'The OIDs of the searched revisions of the repository at the time of the last run.';
+
+COMMIT;
@@ -469,14 +469,16 @@ func (v *EncryptionKey) UnmarshalJSON(data []byte) error {
 	return fmt.Errorf("tagged union type must have a %q property whose value is one of %s", "type", []string{"cloudkms", "awskms", "mounted", "noop"})
 }
 
-// EncryptionKeys description: Configuration for encryption keys used to encrypt data at rest in the database.
+// EncryptionKeys description: Configuration for encryption keys used to encrypt data at rest in the database, and the archives cached by searcher.
 type EncryptionKeys struct {
 	BatchChangesCredentialKey *EncryptionKey `json:"batchChangesCredentialKey,omitempty"`
 	// CacheSize description: number of values to keep in LRU cache
 	CacheSize int `json:"cacheSize,omitempty"`
 	// EnableCache description: enable LRU cache for decryption APIs
-	EnableCache            bool           `json:"enableCache,omitempty"`
-	ExternalServiceKey     *EncryptionKey `json:"externalServiceKey,omitempty"`
+	EnableCache        bool           `json:"enableCache,omitempty"`
+	ExternalServiceKey *EncryptionKey `json:"externalServiceKey,omitempty"`
+	// SearcherArchiveKey description: Key used to encrypt the repository archives searcher caches on disk. Changes are applied without restarting searcher, which fetches the archives cached with a previous key again.
+	SearcherArchiveKey     *EncryptionKey `json:"searcherArchiveKey,omitempty"`
 	UserExternalAccountKey *EncryptionKey `json:"userExternalAccountKey,omitempty"`
 }
 type ExcludedAWSCodeCommitRepo struct {
@@ -1281,11 +1283,43 @@ type SearchLimits struct {
 	CommitDiffMaxRepos int `json:"commitDiffMaxRepos,omitempty"`
 	// CommitDiffWithTimeFilterMaxRepos description: The maximum number of repositories to search across when doing a "type:diff" or "type:commit" with a "after:" or "before:" filter. The user is prompted to narrow their query if the limit is exceeded. There is a separate limit (commitDiffMaxRepos) when "after:" or "before:" is not specified because those queries are slower. Defaults to 10000.
 	CommitDiffWithTimeFilterMaxRepos int `json:"commitDiffWithTimeFilterMaxRepos,omitempty"`
+	// MaxConcurrentUnindexedSearchesPerUser description: The maximum number of searches of unindexed repositories a single user (including their access tokens) can run concurrently across all frontend replicas. Further searches are queued until one finishes or the search times out. Any value less than or equal to zero means unlimited.
+	MaxConcurrentUnindexedSearchesPerUser int `json:"maxConcurrentUnindexedSearchesPerUser,omitempty"`
 	// MaxRepos description: The maximum number of repositories to search across. The user is prompted to narrow their query if exceeded. Any value less than or equal to zero means unlimited.
 	MaxRepos int `json:"maxRepos,omitempty"`
 	// MaxTimeoutSeconds description: The maximum value for "timeout:" that search will respect. "timeout:" values larger than maxTimeoutSeconds are capped at maxTimeoutSeconds. Note: You need to ensure your load balancer / reverse proxy in front of Sourcegraph won't timeout the request for larger values. Note: Too many large rearch requests may harm Soucregraph for other users. Defaults to 1 minute.
 	MaxTimeoutSeconds int `json:"maxTimeoutSeconds,omitempty"`
 }
+
+// SearchSearcher description: Limits and tuning of searcher, the service which searches repositories that are not indexed. Changes are applied without restarting searcher.
+type SearchSearcher struct {
+	// CacheSizeMB description: The maximum size of the on-disk cache of repository archives of each searcher replica in megabytes. Overrides the SEARCHER_CACHE_SIZE_MB environment variable. Any value less than or equal to zero means the environment variable is used.
+	CacheSizeMB int `json:"cacheSizeMB,omitempty"`
+	// FetchTimeoutMilliseconds description: How long a search waits for the archive of a repository to be fetched from gitserver, if the search doesn't specify it. Defaults to 500 milliseconds.
+	FetchTimeoutMilliseconds int `json:"fetchTimeoutMilliseconds,omitempty"`
+	// MaxBatchWorkers description: The maximum number of workers of all concurrent batch priority searches, like code insights backfills, on each searcher replica. Further workers of batch searches wait until one finishes, so that batch searches don't slow down interactive searches. Any value less than or equal to zero means half the CPUs of the replica.
+	MaxBatchWorkers int `json:"maxBatchWorkers,omitempty"`
+	// MaxConcurrentSearchesPerRepo description: The maximum number of concurrent searches of a single repository on each searcher replica. Further searches of the repository wait until one finishes, so that a burst of searches of one large repository doesn't starve the searches of other repositories. Any value less than or equal to zero means unlimited.
+	MaxConcurrentSearchesPerRepo int `json:"maxConcurrentSearchesPerRepo,omitempty"`
+	// MaxContentSize description: The maximum size in bytes of the content of a matched file searcher returns to searches which include the content of matched files. The content of larger files is truncated. Searches can request less. Defaults to 1000000.
+	MaxContentSize int `json:"maxContentSize,omitempty"`
+	// MaxFileMatches description: The maximum number of matching files searcher returns for a single search of a repository. Searches can request fewer. Any value less than or equal to zero means no limit beyond the one requested by the search.
+	MaxFileMatches int `json:"maxFileMatches,omitempty"`
+	// MaxLineMatches description: The maximum number of matching lines searcher returns for a single file. Searches can request fewer. Any value less than or equal to zero means no limit beyond the one requested by the search.
+	MaxLineMatches int `json:"maxLineMatches,omitempty"`
+	// MaxLineSize description: The maximum size in bytes of the preview of a matching line searcher returns. Longer lines are truncated. Searches can request less. Any value less than or equal to zero means no limit beyond the one requested by the search.
+	MaxLineSize int `json:"maxLineSize,omitempty"`
+	// MaxMatches description: The maximum number of matches searcher returns for a single search of a repository. Any value less than or equal to zero means no limit beyond the one requested by the search.
+	MaxMatches int `json:"maxMatches,omitempty"`
+	// MaxResultBytes description: The maximum total size in bytes of the previews of the matching lines searcher returns for a single search of a repository. Once it is reached the search stops, so that searches matching nearly every line of a large repository can't exhaust the memory of searcher. Searches can request less. Defaults to 100000000.
+	MaxResultBytes int `json:"maxResultBytes,omitempty"`
+	// MaxTimeoutSeconds description: The maximum duration of a single search of a repository. Searches still running after it are stopped and return partial results. Any value less than or equal to zero means unlimited.
+	MaxTimeoutSeconds int `json:"maxTimeoutSeconds,omitempty"`
+	// MaxTotalWorkers description: The maximum number of workers of all concurrent searches on each searcher replica. When more searches run than it allows the workers of each, new searches get an equal share of it, and at least one worker, so that a single large search can't starve the others. Any value less than or equal to zero means unlimited.
+	MaxTotalWorkers int `json:"maxTotalWorkers,omitempty"`
+	// Workers description: The number of workers which concurrently search the files of a repository for a single search. Searches can request fewer. Defaults to the SEARCHER_WORKERS environment variable, or 8.
+	Workers int `json:"workers,omitempty"`
+}
 type SearchSavedQueries struct {
 	// Description description: Description of this saved query
 	Description string `json:"description"`
@@ -1468,12 +1502,16 @@ type SiteConfiguration struct {
 	AuthUserOrgMap map[string][]string `json:"auth.userOrgMap,omitempty"`
 	// AuthzEnforceForSiteAdmins description: When true, site admins will only be able to see private code they have access to via our authz system.
 	AuthzEnforceForSiteAdmins bool `json:"authz.enforceForSiteAdmins,omitempty"`
+	// BatchChangesCompletionNotificationSlackWebhook description: The Slack webhook URL to which a message is posted when all changesets of a batch change have been merged or closed. The author of the batch change is also notified by email.
+	BatchChangesCompletionNotificationSlackWebhook string `json:"batchChanges.completionNotificationSlackWebhook,omitempty"`
 	// BatchChangesEnabled description: Enables/disables the Batch Changes feature.
 	BatchChangesEnabled *bool `json:"batchChanges.enabled,omitempty"`
 	// BatchChangesRestrictToAdmins description: When enabled, only site admins can create and apply batch changes.
 	BatchChangesRestrictToAdmins *bool `json:"batchChanges.restrictToAdmins,omitempty"`
 	// BatchChangesRolloutWindows description: Specifies specific windows, which can have associated rate limits, to be used when publishing changesets. All days and times are handled in UTC.
 	BatchChangesRolloutWindows *[]*BatchChangeRolloutWindow `json:"batchChanges.rolloutWindows,omitempty"`
+	// BatchChangesSpecExpirationDryRun description: When enabled, expired batch specs and changeset specs are not deleted. Instead, the number of specs that would be deleted, their owners and their ages are logged.
+	BatchChangesSpecExpirationDryRun bool `json:"batchChanges.specExpirationDryRun,omitempty"`
 	// Branding description: Customize Sourcegraph homepage logo and search icon.
 	//
 	// Only available in Sourcegraph Enterprise.
@@ -1588,6 +1626,8 @@ type SiteConfiguration struct {
 	SearchLargeFiles []string `json:"search.largeFiles,omitempty"`
 	// SearchLimits description: Limits that search applies for number of repositories searched and timeouts.
 	SearchLimits *SearchLimits `json:"search.limits,omitempty"`
+	// SearchSearcher description: Limits and tuning of searcher, the service which searches repositories that are not indexed. Changes are applied without restarting searcher.
+	SearchSearcher *SearchSearcher `json:"search.searcher,omitempty"`
 	// UpdateChannel description: The channel on which to automatically check for Sourcegraph updates.
 	UpdateChannel string `json:"update.channel,omitempty"`
 	// UseJaeger description: DEPRECATED. Use `"observability.tracing": { "sampling": "all" }`, instead. Enables Jaeger tracing.